@@ -230,6 +230,66 @@ func TestFunctionLiteral_String(t *testing.T) {
 	}
 }
 
+func TestFunctionCall_String(t *testing.T) {
+	tests := []struct {
+		desc         string
+		functionCall *FunctionCall
+		expected     string
+	}{
+		{
+			desc:         "f(a, b)",
+			functionCall: &FunctionCall{Function: &Identifier{Name: "f"}, Arguments: []Expression{&Identifier{Name: "a"}, &Identifier{Name: "b"}}},
+			expected:     "f(a, b)",
+		},
+		{
+			desc:         "a -> f(b)",
+			functionCall: &FunctionCall{Function: &Identifier{Name: "f"}, Arguments: []Expression{&Identifier{Name: "a"}, &Identifier{Name: "b"}}, Arrow: true},
+			expected:     "(a -> f(b))",
+		},
+		{
+			desc:         "(a.f)(b)",
+			functionCall: &FunctionCall{Function: &FieldExpression{Object: &Identifier{Name: "a"}, Field: &Identifier{Name: "f"}}, Arguments: []Expression{&Identifier{Name: "b"}}},
+			expected:     "(a.f)(b)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			testString(t, tt.expected, tt.functionCall)
+		})
+	}
+}
+
+func TestStringLiteral_String(t *testing.T) {
+	tests := []struct {
+		desc     string
+		value    string
+		expected string
+	}{
+		{
+			desc:     "plain",
+			value:    "foo bar",
+			expected: `"foo bar"`,
+		},
+		{
+			desc:     "escaped",
+			value:    "\"\\\n\t\r\x00",
+			expected: `"\"\\\n\t\r\0"`,
+		},
+		{
+			desc:     "not escaped",
+			value:    "é\x01",
+			expected: "\"é\x01\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			testString(t, tt.expected, &StringLiteral{Value: tt.value})
+		})
+	}
+}
+
 func testString(t *testing.T, expected string, node Node) {
 	if node.String() != expected {
 		t.Errorf("string expression wrong: \nwant=%q\ngot=%q\n", expected, node.String())
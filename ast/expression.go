@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"bytes"
 	"strconv"
 	"strings"
 )
@@ -10,9 +11,46 @@ type Expression interface {
 	ExpressionNode()
 }
 
+// Scope is where the variable an identifier refers to is declared.
+type Scope int
+
+const (
+	UNRESOLVED Scope = iota
+	LOCAL            // in the function the identifier is in
+	CLOSURE          // in an enclosing function
+	GLOBAL           // at the top level
+	BUILTIN          // not declared, but a builtin function
+)
+
+func (s Scope) String() string {
+	switch s {
+	case LOCAL:
+		return "local"
+	case CLOSURE:
+		return "closure"
+	case GLOBAL:
+		return "global"
+	case BUILTIN:
+		return "builtin"
+	default:
+		return "unresolved"
+	}
+}
+
 type Identifier struct {
 	Name string
-	line int
+	// Scope and Locations are set by the resolver. Locations are the slots of the enclosing frames declaring the name,
+	// from the innermost, or the slot the variable is stored in for a declared identifier.
+	// an identifier with no locations refers to a variable stored by name, or to a builtin function.
+	Scope     Scope
+	Locations []Location
+	line      int
+}
+
+// Location is the slot Index of the frame Depth levels out from the current one.
+type Location struct {
+	Depth int
+	Index int
 }
 
 func NewIdentifier(name string, line int) *Identifier { return &Identifier{Name: name, line: line} }
@@ -44,6 +82,43 @@ func (bl *BooleanLiteral) Line() int       { return bl.line }
 func (bl *BooleanLiteral) String() string  { return strconv.FormatBool(bl.Value) }
 func (bl *BooleanLiteral) ExpressionNode() {}
 
+type StringLiteral struct {
+	Value string
+	line  int
+}
+
+func NewStringLiteral(value string, line int) *StringLiteral {
+	return &StringLiteral{Value: value, line: line}
+}
+func (sl *StringLiteral) Line() int       { return sl.line }
+func (sl *StringLiteral) String() string  { return quote(sl.Value) }
+func (sl *StringLiteral) ExpressionNode() {}
+
+// quote returns s as a double-quoted literal, using only the escapes the lexer reads.
+func quote(s string) string {
+	var out bytes.Buffer
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		case 0:
+			out.WriteString(`\0`)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
 type PrefixExpression struct {
 	Operator string
 	Right    Expression
@@ -76,9 +151,14 @@ func (ie *InfixExpression) String() string {
 func (ie *InfixExpression) ExpressionNode() {}
 
 type FunctionLiteral struct {
-	Parameters []*Identifier
-	Body       *BlockStatement
-	line       int
+	Parameters     []*Identifier
+	ParameterTypes []TypeAnnotation // nil, or one per parameter with nil for the ones not annotated
+	ReturnType     TypeAnnotation   // nil if not annotated
+	Body           *BlockStatement
+	NumSlots       int  // the number of variables in the frame of a call, including the parameters, set by the resolver
+	Captured       int  // the number of the enclosing frames the body refers to, set by the resolver
+	Generator      bool // whether the body yields, set by the resolver
+	line           int
 }
 
 func NewFunctionLiteral(parameters []*Identifier, body *BlockStatement, line int) *FunctionLiteral {
@@ -87,34 +167,115 @@ func NewFunctionLiteral(parameters []*Identifier, body *BlockStatement, line int
 func (fl *FunctionLiteral) Line() int { return fl.line }
 func (fl *FunctionLiteral) String() string {
 	var paramStrs []string
-	for _, param := range fl.Parameters {
-		paramStrs = append(paramStrs, param.String())
+	for i, param := range fl.Parameters {
+		if t := fl.ParameterType(i); t != nil {
+			paramStrs = append(paramStrs, param.String()+": "+t.String())
+		} else {
+			paramStrs = append(paramStrs, param.String())
+		}
 	}
 
+	if fl.ReturnType != nil {
+		return "|" + strings.Join(paramStrs, ", ") + "| -> " + fl.ReturnType.String() + " " + fl.Body.String()
+	}
 	return "|" + strings.Join(paramStrs, ", ") + "| " + fl.Body.String()
 }
 func (fl *FunctionLiteral) ExpressionNode() {}
 
+// ParameterType returns the annotated type of the i-th parameter, or nil if it is not annotated.
+func (fl *FunctionLiteral) ParameterType(i int) TypeAnnotation {
+	if i < len(fl.ParameterTypes) {
+		return fl.ParameterTypes[i]
+	}
+	return nil
+}
+
+type MacroLiteral struct {
+	Parameters []*Identifier
+	Body       *BlockStatement
+	line       int
+}
+
+func NewMacroLiteral(parameters []*Identifier, body *BlockStatement, line int) *MacroLiteral {
+	return &MacroLiteral{Parameters: parameters, Body: body, line: line}
+}
+func (ml *MacroLiteral) Line() int { return ml.line }
+func (ml *MacroLiteral) String() string {
+	var paramStrs []string
+	for _, param := range ml.Parameters {
+		paramStrs = append(paramStrs, param.String())
+	}
+
+	return "macro |" + strings.Join(paramStrs, ", ") + "| " + ml.Body.String()
+}
+func (ml *MacroLiteral) ExpressionNode() {}
+
 type FunctionCall struct {
 	Function  Expression // FunctionLiteral or Identifier
 	Arguments []Expression
+	Arrow     bool     // written as Arguments[0] -> Function(Arguments[1:]...)
+	Sources   []string // nil, or the source text of each argument set by the parser, with "" for the ones not known
 	line      int
 }
 
 func NewFunctionCall(function Expression, arguments []Expression, line int) *FunctionCall {
 	return &FunctionCall{Function: function, Arguments: arguments, line: line}
 }
+
+// Source returns the source text of the i-th argument, or "" if it is not known.
+func (fc *FunctionCall) Source(i int) string {
+	if i < len(fc.Sources) {
+		return fc.Sources[i]
+	}
+	return ""
+}
 func (fc *FunctionCall) Line() int { return fc.line }
 func (fc *FunctionCall) String() string {
+	arguments := fc.Arguments
+	if fc.Arrow && len(arguments) > 0 {
+		arguments = arguments[1:]
+	}
 	var argStrs []string
-	for _, arg := range fc.Arguments {
+	for _, arg := range arguments {
 		argStrs = append(argStrs, arg.String())
 	}
 
-	return fc.Function.String() + "(" + strings.Join(argStrs, ", ") + ")"
+	function := fc.Function.String()
+	if _, ok := fc.Function.(*FieldExpression); ok {
+		// without parentheses, it would be read as a method call.
+		function = "(" + function + ")"
+	}
+	str := function + "(" + strings.Join(argStrs, ", ") + ")"
+	if len(arguments) < len(fc.Arguments) {
+		return "(" + fc.Arguments[0].String() + " -> " + str + ")"
+	}
+	return str
 }
 func (fc *FunctionCall) ExpressionNode() {}
 
+// MethodCall is a call written as receiver.method(args).
+// it is evaluated as method(receiver, args...).
+type MethodCall struct {
+	Receiver  Expression
+	Method    *Identifier
+	Arguments []Expression
+	line      int
+}
+
+func NewMethodCall(receiver Expression, method *Identifier, arguments []Expression, line int) *MethodCall {
+	return &MethodCall{Receiver: receiver, Method: method, Arguments: arguments, line: line}
+}
+func (mc *MethodCall) Line() int { return mc.line }
+func (mc *MethodCall) String() string {
+	var argStrs []string
+	for _, arg := range mc.Arguments {
+		argStrs = append(argStrs, arg.String())
+	}
+
+	return mc.Receiver.String() + "." + mc.Method.String() + "(" + strings.Join(argStrs, ", ") + ")"
+}
+func (mc *MethodCall) ExpressionNode() {}
+
 type ArrayLiteral struct {
 	Elements []Expression
 	line     int
@@ -135,6 +296,55 @@ func (al *ArrayLiteral) String() string {
 }
 func (al *ArrayLiteral) ExpressionNode() {}
 
+// ArrayComprehension is [Element for x in xs if cond ...].
+// the clauses are nested from left to right.
+type ArrayComprehension struct {
+	Element Expression
+	Clauses []*ComprehensionClause
+	line    int
+}
+
+func NewArrayComprehension(element Expression, clauses []*ComprehensionClause, line int) *ArrayComprehension {
+	return &ArrayComprehension{Element: element, Clauses: clauses, line: line}
+}
+
+func (ac *ArrayComprehension) Line() int { return ac.line }
+func (ac *ArrayComprehension) String() string {
+	var out bytes.Buffer
+	out.WriteString("[")
+	out.WriteString(ac.Element.String())
+	for _, clause := range ac.Clauses {
+		out.WriteString(" ")
+		out.WriteString(clause.String())
+	}
+	out.WriteString("]")
+	return out.String()
+}
+func (ac *ArrayComprehension) ExpressionNode() {}
+
+// ComprehensionClause is a `for Variable in Iterable if Condition` part of ArrayComprehension.
+// Condition is nil when the clause has no if.
+type ComprehensionClause struct {
+	Variable  *Identifier
+	Iterable  Expression
+	Condition Expression
+	NumSlots  int // the number of variables in the frame of an iteration, set by the resolver
+	line      int
+}
+
+func NewComprehensionClause(variable *Identifier, iterable Expression, condition Expression, line int) *ComprehensionClause {
+	return &ComprehensionClause{Variable: variable, Iterable: iterable, Condition: condition, line: line}
+}
+
+func (cc *ComprehensionClause) Line() int { return cc.line }
+func (cc *ComprehensionClause) String() string {
+	str := "for " + cc.Variable.String() + " in " + cc.Iterable.String()
+	if cc.Condition == nil {
+		return str
+	}
+	return str + " if " + cc.Condition.String()
+}
+
 type IndexExpression struct {
 	Array Expression
 	Index Expression
@@ -171,3 +381,37 @@ func (ie *IfExpression) String() string {
 	return str + " else " + ie.Alternative.String()
 }
 func (ie *IfExpression) ExpressionNode() {}
+
+type FieldExpression struct {
+	Object Expression
+	Field  *Identifier
+	line   int
+}
+
+func NewFieldExpression(object Expression, field *Identifier, line int) *FieldExpression {
+	return &FieldExpression{Object: object, Field: field, line: line}
+}
+
+func (fe *FieldExpression) Line() int { return fe.line }
+func (fe *FieldExpression) String() string {
+	return fe.Object.String() + "." + fe.Field.String()
+}
+func (fe *FieldExpression) ExpressionNode() {}
+
+type TryExpression struct {
+	Body      *BlockStatement
+	Parameter *Identifier
+	Handler   *BlockStatement
+	NumSlots  int // the number of variables in the frame of the handler, set by the resolver
+	line      int
+}
+
+func NewTryExpression(body *BlockStatement, parameter *Identifier, handler *BlockStatement, line int) *TryExpression {
+	return &TryExpression{Body: body, Parameter: parameter, Handler: handler, line: line}
+}
+
+func (te *TryExpression) Line() int { return te.line }
+func (te *TryExpression) String() string {
+	return "try " + te.Body.String() + " catch (" + te.Parameter.String() + ") " + te.Handler.String()
+}
+func (te *TryExpression) ExpressionNode() {}
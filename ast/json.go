@@ -0,0 +1,457 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSONVersion is the version of the JSON schema written by MarshalJSON.
+// it is incremented whenever the schema changes incompatibly.
+const JSONVersion = 1
+
+// MarshalJSON encodes program as
+//
+//	{"version": 1, "program": {"kind": "Program", "statements": [...]}}
+//
+// every node is an object with "kind" (the Go type name), "line", and one member per field of the node.
+func MarshalJSON(program *Program) ([]byte, error) {
+	encoded, err := encodeNode(program)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(map[string]interface{}{"version": JSONVersion, "program": encoded}, "", "  ")
+}
+
+// UnmarshalJSON decodes a program encoded by MarshalJSON.
+func UnmarshalJSON(data []byte) (*Program, error) {
+	var document struct {
+		Version int             `json:"version"`
+		Program json.RawMessage `json:"program"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if document.Version != JSONVersion {
+		return nil, fmt.Errorf("unsupported ast json version: want=%d got=%d", JSONVersion, document.Version)
+	}
+
+	d := &nodeDecoder{}
+	node := d.node(document.Program)
+	if d.err != nil {
+		return nil, d.err
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("root node must be Program: got=%T", node)
+	}
+	return program, nil
+}
+
+type jsonNode map[string]interface{}
+
+func encodeNode(node Node) (jsonNode, error) {
+	var fields jsonNode
+	var err error
+	encode := func(node Node) interface{} {
+		if err != nil || isNilNode(node) {
+			return nil
+		}
+		var encoded jsonNode
+		encoded, err = encodeNode(node)
+		return encoded
+	}
+	encodeList := func(length int, at func(int) Node) []interface{} {
+		list := make([]interface{}, length)
+		for i := range list {
+			list[i] = encode(at(i))
+		}
+		return list
+	}
+	statements := func(statements []Statement) []interface{} {
+		return encodeList(len(statements), func(i int) Node { return statements[i] })
+	}
+	expressions := func(expressions []Expression) []interface{} {
+		return encodeList(len(expressions), func(i int) Node { return expressions[i] })
+	}
+	identifiers := func(identifiers []*Identifier) []interface{} {
+		return encodeList(len(identifiers), func(i int) Node { return identifiers[i] })
+	}
+	typeAnnotations := func(typeAnnotations []TypeAnnotation) []interface{} {
+		return encodeList(len(typeAnnotations), func(i int) Node { return typeAnnotations[i] })
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		fields = jsonNode{"statements": statements(node.Statements)}
+	case *BlockStatement:
+		fields = jsonNode{"statements": statements(node.Statements), "end": node.End}
+	case *VarStatement:
+		fields = jsonNode{"identifier": encode(node.Identifier), "type": encode(node.Type), "expression": encode(node.Expression)}
+	case *ReturnStatement:
+		fields = jsonNode{"expression": encode(node.Expression)}
+	case *ThrowStatement:
+		fields = jsonNode{"expression": encode(node.Expression)}
+	case *YieldStatement:
+		fields = jsonNode{"expression": encode(node.Expression)}
+	case *ExpressionStatement:
+		fields = jsonNode{"expression": encode(node.Expression)}
+	case *Identifier:
+		fields = jsonNode{"name": node.Name}
+	case *IntegerLiteral:
+		fields = jsonNode{"value": node.Value}
+	case *BooleanLiteral:
+		fields = jsonNode{"value": node.Value}
+	case *StringLiteral:
+		fields = jsonNode{"value": node.Value}
+	case *PrefixExpression:
+		fields = jsonNode{"operator": node.Operator, "right": encode(node.Right)}
+	case *InfixExpression:
+		fields = jsonNode{"operator": node.Operator, "left": encode(node.Left), "right": encode(node.Right)}
+	case *FunctionLiteral:
+		fields = jsonNode{
+			"parameters":     identifiers(node.Parameters),
+			"parameterTypes": typeAnnotations(node.ParameterTypes),
+			"returnType":     encode(node.ReturnType),
+			"body":           encode(node.Body),
+		}
+	case *MacroLiteral:
+		fields = jsonNode{"parameters": identifiers(node.Parameters), "body": encode(node.Body)}
+	case *FunctionCall:
+		fields = jsonNode{"function": encode(node.Function), "arguments": expressions(node.Arguments), "arrow": node.Arrow, "sources": node.Sources}
+	case *MethodCall:
+		fields = jsonNode{"receiver": encode(node.Receiver), "method": encode(node.Method), "arguments": expressions(node.Arguments)}
+	case *ArrayLiteral:
+		fields = jsonNode{"elements": expressions(node.Elements)}
+	case *ArrayComprehension:
+		clauses := encodeList(len(node.Clauses), func(i int) Node { return node.Clauses[i] })
+		fields = jsonNode{"element": encode(node.Element), "clauses": clauses}
+	case *ComprehensionClause:
+		fields = jsonNode{"variable": encode(node.Variable), "iterable": encode(node.Iterable), "condition": encode(node.Condition)}
+	case *IndexExpression:
+		fields = jsonNode{"array": encode(node.Array), "index": encode(node.Index)}
+	case *FieldExpression:
+		fields = jsonNode{"object": encode(node.Object), "field": encode(node.Field)}
+	case *IfExpression:
+		fields = jsonNode{"condition": encode(node.Condition), "consequence": encode(node.Consequence), "alternative": encode(node.Alternative)}
+	case *TryExpression:
+		fields = jsonNode{"body": encode(node.Body), "parameter": encode(node.Parameter), "handler": encode(node.Handler)}
+	case *NamedType:
+		fields = jsonNode{"name": node.Name}
+	case *ArrayType:
+		fields = jsonNode{"element": encode(node.Element)}
+	case *FunctionType:
+		fields = jsonNode{"parameters": typeAnnotations(node.Parameters), "return": encode(node.Return)}
+	default:
+		return nil, fmt.Errorf("unable to encode node: %+v (%T)", node, node)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields["kind"] = kindOf(node)
+	fields["line"] = node.Line()
+	return fields, nil
+}
+
+// kindOf returns the name of the node type without package and pointer, e.g. "InfixExpression".
+func kindOf(node Node) string {
+	name := fmt.Sprintf("%T", node)
+	return name[len("*ast."):]
+}
+
+// isNilNode reports whether node is nil or a typed nil pointer such as an absent else block.
+func isNilNode(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *BlockStatement:
+		return node == nil
+	case *Identifier:
+		return node == nil
+	}
+	return false
+}
+
+// nodeDecoder decodes json nodes, keeping the first error so that decoding code need not check every field.
+type nodeDecoder struct {
+	err error
+}
+
+func (d *nodeDecoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (d *nodeDecoder) node(raw json.RawMessage) Node {
+	if d.err != nil || raw == nil || string(raw) == "null" {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		d.fail("invalid node: %s", err)
+		return nil
+	}
+	var kind string
+	d.field(fields, "kind", &kind)
+	var line int
+	d.field(fields, "line", &line)
+	if d.err != nil {
+		return nil
+	}
+
+	switch kind {
+	case "Program":
+		return &Program{Statements: d.statements(fields, "statements")}
+	case "BlockStatement":
+		block := NewBlockStatement(d.statements(fields, "statements"), line)
+		// "end" was added after version 1 was published, so it may be absent.
+		if _, ok := fields["end"]; ok {
+			d.field(fields, "end", &block.End)
+		}
+		return block
+	case "VarStatement":
+		varStatement := NewVarStatement(d.identifier(fields, "identifier"), d.expression(fields, "expression"), line)
+		varStatement.Type = d.optionalTypeAnnotation(fields, "type")
+		return varStatement
+	case "ReturnStatement":
+		return NewReturnStatement(d.expression(fields, "expression"), line)
+	case "ThrowStatement":
+		return NewThrowStatement(d.expression(fields, "expression"), line)
+	case "YieldStatement":
+		return NewYieldStatement(d.expression(fields, "expression"), line)
+	case "ExpressionStatement":
+		return NewExpressionStatement(d.expression(fields, "expression"), line)
+	case "Identifier":
+		var name string
+		d.field(fields, "name", &name)
+		return NewIdentifier(name, line)
+	case "IntegerLiteral":
+		var value int
+		d.field(fields, "value", &value)
+		return NewIntegerLiteral(value, line)
+	case "BooleanLiteral":
+		var value bool
+		d.field(fields, "value", &value)
+		return NewBooleanLiteral(value, line)
+	case "StringLiteral":
+		var value string
+		d.field(fields, "value", &value)
+		return NewStringLiteral(value, line)
+	case "PrefixExpression":
+		var operator string
+		d.field(fields, "operator", &operator)
+		return NewPrefixExpression(operator, d.expression(fields, "right"), line)
+	case "InfixExpression":
+		var operator string
+		d.field(fields, "operator", &operator)
+		return NewInfixExpression(operator, d.expression(fields, "left"), d.expression(fields, "right"), line)
+	case "FunctionLiteral":
+		// "parameterTypes" and "returnType" were added after version 1 was published, so they may be absent.
+		functionLiteral := NewFunctionLiteral(d.identifiers(fields, "parameters"), d.block(fields, "body", true), line)
+		functionLiteral.ParameterTypes = d.optionalTypeAnnotations(fields, "parameterTypes")
+		functionLiteral.ReturnType = d.optionalTypeAnnotation(fields, "returnType")
+		return functionLiteral
+	case "MacroLiteral":
+		return NewMacroLiteral(d.identifiers(fields, "parameters"), d.block(fields, "body", true), line)
+	case "FunctionCall":
+		call := NewFunctionCall(d.expression(fields, "function"), d.expressions(fields, "arguments"), line)
+		// "arrow" and "sources" were added after version 1 was published, so they may be absent.
+		if _, ok := fields["arrow"]; ok {
+			d.field(fields, "arrow", &call.Arrow)
+		}
+		if _, ok := fields["sources"]; ok {
+			d.field(fields, "sources", &call.Sources)
+		}
+		return call
+	case "MethodCall":
+		return NewMethodCall(d.expression(fields, "receiver"), d.identifier(fields, "method"), d.expressions(fields, "arguments"), line)
+	case "ArrayLiteral":
+		return NewArrayLiteral(d.expressions(fields, "elements"), line)
+	case "ArrayComprehension":
+		var clauses []*ComprehensionClause
+		for _, node := range d.list(fields, "clauses") {
+			clause, ok := node.(*ComprehensionClause)
+			if !ok {
+				d.fail("line %d: clauses of ArrayComprehension must be ComprehensionClause: got=%T", line, node)
+			}
+			clauses = append(clauses, clause)
+		}
+		return NewArrayComprehension(d.expression(fields, "element"), clauses, line)
+	case "ComprehensionClause":
+		return NewComprehensionClause(d.identifier(fields, "variable"), d.expression(fields, "iterable"), d.optionalExpression(fields, "condition"), line)
+	case "IndexExpression":
+		return NewIndexExpression(d.expression(fields, "array"), d.expression(fields, "index"), line)
+	case "FieldExpression":
+		return NewFieldExpression(d.expression(fields, "object"), d.identifier(fields, "field"), line)
+	case "IfExpression":
+		return NewIfExpression(d.expression(fields, "condition"), d.block(fields, "consequence", true), d.block(fields, "alternative", false), line)
+	case "TryExpression":
+		return NewTryExpression(d.block(fields, "body", true), d.identifier(fields, "parameter"), d.block(fields, "handler", true), line)
+	case "NamedType":
+		var name string
+		d.field(fields, "name", &name)
+		return NewNamedType(name, line)
+	case "ArrayType":
+		return NewArrayType(d.typeAnnotation(fields, "element"), line)
+	case "FunctionType":
+		var parameters []TypeAnnotation
+		for _, node := range d.list(fields, "parameters") {
+			parameter, ok := node.(TypeAnnotation)
+			if !ok {
+				d.fail("line %d: parameters of FunctionType must be type annotations: got=%T", line, node)
+			}
+			parameters = append(parameters, parameter)
+		}
+		return NewFunctionType(parameters, d.typeAnnotation(fields, "return"), line)
+	default:
+		d.fail("line %d: unknown node kind: %q", line, kind)
+		return nil
+	}
+}
+
+func (d *nodeDecoder) field(fields map[string]json.RawMessage, key string, v interface{}) {
+	if d.err != nil {
+		return
+	}
+	raw, ok := fields[key]
+	if !ok {
+		d.fail("missing field %q", key)
+		return
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		d.fail("field %q: %s", key, err)
+	}
+}
+
+func (d *nodeDecoder) list(fields map[string]json.RawMessage, key string) []Node {
+	var raws []json.RawMessage
+	d.field(fields, key, &raws)
+	nodes := make([]Node, 0, len(raws))
+	for _, raw := range raws {
+		node := d.node(raw)
+		if node == nil {
+			d.fail("field %q: null element", key)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (d *nodeDecoder) optionalExpression(fields map[string]json.RawMessage, key string) Expression {
+	node := d.node(fields[key])
+	if node == nil {
+		return nil
+	}
+	expression, ok := node.(Expression)
+	if !ok {
+		d.fail("field %q must be expression: got=%T", key, node)
+	}
+	return expression
+}
+
+func (d *nodeDecoder) expression(fields map[string]json.RawMessage, key string) Expression {
+	expression := d.optionalExpression(fields, key)
+	if expression == nil {
+		d.fail("missing field %q", key)
+	}
+	return expression
+}
+
+func (d *nodeDecoder) optionalTypeAnnotation(fields map[string]json.RawMessage, key string) TypeAnnotation {
+	node := d.node(fields[key])
+	if node == nil {
+		return nil
+	}
+	typeAnnotation, ok := node.(TypeAnnotation)
+	if !ok {
+		d.fail("field %q must be type annotation: got=%T", key, node)
+	}
+	return typeAnnotation
+}
+
+func (d *nodeDecoder) typeAnnotation(fields map[string]json.RawMessage, key string) TypeAnnotation {
+	typeAnnotation := d.optionalTypeAnnotation(fields, key)
+	if typeAnnotation == nil {
+		d.fail("missing field %q", key)
+	}
+	return typeAnnotation
+}
+
+// optionalTypeAnnotations decodes a list whose elements may be null, returning nil for an absent or empty list.
+func (d *nodeDecoder) optionalTypeAnnotations(fields map[string]json.RawMessage, key string) []TypeAnnotation {
+	var raws []json.RawMessage
+	if _, ok := fields[key]; ok {
+		d.field(fields, key, &raws)
+	}
+	var typeAnnotations []TypeAnnotation
+	for _, raw := range raws {
+		node := d.node(raw)
+		if node == nil {
+			typeAnnotations = append(typeAnnotations, nil)
+			continue
+		}
+		typeAnnotation, ok := node.(TypeAnnotation)
+		if !ok {
+			d.fail("field %q must be list of type annotations: got=%T", key, node)
+		}
+		typeAnnotations = append(typeAnnotations, typeAnnotation)
+	}
+	return typeAnnotations
+}
+
+func (d *nodeDecoder) identifier(fields map[string]json.RawMessage, key string) *Identifier {
+	identifier, ok := d.node(fields[key]).(*Identifier)
+	if !ok {
+		d.fail("field %q must be Identifier", key)
+	}
+	return identifier
+}
+
+func (d *nodeDecoder) block(fields map[string]json.RawMessage, key string, required bool) *BlockStatement {
+	node := d.node(fields[key])
+	if node == nil && !required {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("field %q must be BlockStatement", key)
+	}
+	return block
+}
+
+func (d *nodeDecoder) statements(fields map[string]json.RawMessage, key string) []Statement {
+	statements := []Statement{}
+	for _, node := range d.list(fields, key) {
+		statement, ok := node.(Statement)
+		if !ok {
+			d.fail("elements of %q must be statements: got=%T", key, node)
+		}
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+func (d *nodeDecoder) expressions(fields map[string]json.RawMessage, key string) []Expression {
+	expressions := []Expression{}
+	for _, node := range d.list(fields, key) {
+		expression, ok := node.(Expression)
+		if !ok {
+			d.fail("elements of %q must be expressions: got=%T", key, node)
+		}
+		expressions = append(expressions, expression)
+	}
+	return expressions
+}
+
+func (d *nodeDecoder) identifiers(fields map[string]json.RawMessage, key string) []*Identifier {
+	identifiers := []*Identifier{}
+	for _, node := range d.list(fields, key) {
+		identifier, ok := node.(*Identifier)
+		if !ok {
+			d.fail("elements of %q must be identifiers: got=%T", key, node)
+		}
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers
+}
@@ -0,0 +1,172 @@
+package ast_test
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSON_RoundTrip(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{
+			desc:  "literals",
+			input: `42; true; false; "foo\n"; [1, [2]]; [];`,
+		},
+		{
+			desc:  "statements",
+			input: "var a = 1; return a; throw a; yield a;",
+		},
+		{
+			desc:  "operators",
+			input: "-1 + 2 * 3 == !true; a[0]; e.message;",
+		},
+		{
+			desc:  "functions",
+			input: "var f = |x, y| { x + y }; f(1, 2); || { 1 }(); 1 -> f(2); x.f(2);",
+		},
+		{
+			desc:  "if",
+			input: "if (a) { 1 }; if (a) { 1 } else { 2 };",
+		},
+		{
+			desc:  "try",
+			input: "try { throw 1 } catch (e) { e.line }",
+		},
+		{
+			desc:  "comprehension",
+			input: "[x * y for x in xs if x > 1 for y in ys];",
+		},
+		{
+			desc:  "type annotations",
+			input: "var f: |int| -> [int] = |x: int, y| -> [a] { [x] }; var g = |x| -> bool { true };",
+		},
+		{
+			desc:  "macro",
+			input: "var m = macro |a| { quote(unquote(a) + 1) }; m(1);",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+			if err != nil {
+				t.Fatalf("parse error: %s", err.Error())
+			}
+
+			encoded, err := ast.MarshalJSON(program)
+			if err != nil {
+				t.Fatalf("marshal error: %s", err.Error())
+			}
+			decoded, err := ast.UnmarshalJSON(encoded)
+			if err != nil {
+				t.Fatalf("unmarshal error: %s", err.Error())
+			}
+
+			if !reflect.DeepEqual(program, decoded) {
+				t.Errorf("decoded program differs.\nwant=%s\ngot=%s\n", program, decoded)
+			}
+			reencoded, err := ast.MarshalJSON(decoded)
+			if err != nil {
+				t.Fatalf("marshal error: %s", err.Error())
+			}
+			if string(encoded) != string(reencoded) {
+				t.Errorf("json is not stable.\nwant=%s\ngot=%s\n", encoded, reencoded)
+			}
+		})
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	program, err := parser.New(lexer.New("1 -> f()")).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s", err.Error())
+	}
+	encoded, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("marshal error: %s", err.Error())
+	}
+
+	expected := `{
+  "program": {
+    "kind": "Program",
+    "line": 1,
+    "statements": [
+      {
+        "expression": {
+          "arguments": [
+            {
+              "kind": "IntegerLiteral",
+              "line": 1,
+              "value": 1
+            }
+          ],
+          "arrow": true,
+          "function": {
+            "kind": "Identifier",
+            "line": 1,
+            "name": "f"
+          },
+          "kind": "FunctionCall",
+          "line": 1,
+          "sources": [
+            ""
+          ]
+        },
+        "kind": "ExpressionStatement",
+        "line": 1
+      }
+    ]
+  },
+  "version": 1
+}`
+	if string(encoded) != expected {
+		t.Errorf("json wrong.\nwant=%s\ngot=%s\n", expected, encoded)
+	}
+}
+
+func TestUnmarshalJSON_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "version",
+			input:    `{"version": 2, "program": {"kind": "Program", "line": 1, "statements": []}}`,
+			expected: "unsupported ast json version",
+		},
+		{
+			desc:     "unknown kind",
+			input:    `{"version": 1, "program": {"kind": "Program", "line": 1, "statements": [{"kind": "Foo", "line": 1}]}}`,
+			expected: `unknown node kind: "Foo"`,
+		},
+		{
+			desc:     "missing field",
+			input:    `{"version": 1, "program": {"kind": "Program", "line": 1, "statements": [{"kind": "ReturnStatement", "line": 1}]}}`,
+			expected: `missing field "expression"`,
+		},
+		{
+			desc:     "expression as statement",
+			input:    `{"version": 1, "program": {"kind": "Program", "line": 1, "statements": [{"kind": "Identifier", "line": 1, "name": "a"}]}}`,
+			expected: "must be statements",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := ast.UnmarshalJSON([]byte(tt.input))
+			if err == nil {
+				t.Fatalf("error expected but got nil")
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("error message wrong.\nwant=%s\ngot=%s\n", tt.expected, err.Error())
+			}
+		})
+	}
+}
@@ -6,11 +6,13 @@ import (
 
 type Node interface {
 	Line() int
+	// String returns the source code of the node. parsing it gives back the same tree, except for the lines.
 	String() string
 }
 
 type Program struct {
 	Statements []Statement
+	Resolved   bool // set by the resolver of package evaluator
 }
 
 func (p *Program) Line() int { return 1 }
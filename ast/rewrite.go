@@ -0,0 +1,181 @@
+package ast
+
+// RewriteFunc returns the node to replace node with, or node itself to keep it.
+type RewriteFunc func(node Node) Node
+
+// Rewrite applies rewrite to every node of the tree in post-order and returns the rewritten tree.
+// The original tree is never mutated: a node is copied only when one of its children was replaced,
+// so unchanged subtrees are shared between the original and the result.
+func Rewrite(node Node, rewrite RewriteFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		if statements, changed := rewriteStatements(node.Statements, rewrite); changed {
+			return rewrite(&Program{Statements: statements})
+		}
+	case *BlockStatement:
+		if statements, changed := rewriteStatements(node.Statements, rewrite); changed {
+			block := NewBlockStatement(statements, node.line)
+			block.End = node.End
+			return rewrite(block)
+		}
+	case *VarStatement:
+		identifier := Rewrite(node.Identifier, rewrite).(*Identifier)
+		expression := Rewrite(node.Expression, rewrite).(Expression)
+		if identifier != node.Identifier || expression != node.Expression {
+			varStatement := NewVarStatement(identifier, expression, node.line)
+			varStatement.Type = node.Type
+			return rewrite(varStatement)
+		}
+	case *ReturnStatement:
+		if expression := Rewrite(node.Expression, rewrite).(Expression); expression != node.Expression {
+			return rewrite(NewReturnStatement(expression, node.line))
+		}
+	case *ThrowStatement:
+		if expression := Rewrite(node.Expression, rewrite).(Expression); expression != node.Expression {
+			return rewrite(NewThrowStatement(expression, node.line))
+		}
+	case *YieldStatement:
+		if expression := Rewrite(node.Expression, rewrite).(Expression); expression != node.Expression {
+			return rewrite(NewYieldStatement(expression, node.line))
+		}
+	case *ExpressionStatement:
+		if expression := Rewrite(node.Expression, rewrite).(Expression); expression != node.Expression {
+			return rewrite(NewExpressionStatement(expression, node.line))
+		}
+	case *PrefixExpression:
+		if right := Rewrite(node.Right, rewrite).(Expression); right != node.Right {
+			return rewrite(NewPrefixExpression(node.Operator, right, node.line))
+		}
+	case *InfixExpression:
+		left := Rewrite(node.Left, rewrite).(Expression)
+		right := Rewrite(node.Right, rewrite).(Expression)
+		if left != node.Left || right != node.Right {
+			return rewrite(NewInfixExpression(node.Operator, left, right, node.line))
+		}
+	case *FunctionLiteral:
+		parameters, parametersChanged := rewriteIdentifiers(node.Parameters, rewrite)
+		body := Rewrite(node.Body, rewrite).(*BlockStatement)
+		if parametersChanged || body != node.Body {
+			functionLiteral := NewFunctionLiteral(parameters, body, node.line)
+			functionLiteral.ParameterTypes = node.ParameterTypes
+			functionLiteral.ReturnType = node.ReturnType
+			return rewrite(functionLiteral)
+		}
+	case *MacroLiteral:
+		parameters, parametersChanged := rewriteIdentifiers(node.Parameters, rewrite)
+		body := Rewrite(node.Body, rewrite).(*BlockStatement)
+		if parametersChanged || body != node.Body {
+			return rewrite(NewMacroLiteral(parameters, body, node.line))
+		}
+	case *FunctionCall:
+		function := Rewrite(node.Function, rewrite).(Expression)
+		arguments, argumentsChanged := rewriteExpressions(node.Arguments, rewrite)
+		if function != node.Function || argumentsChanged {
+			call := NewFunctionCall(function, arguments, node.line)
+			call.Arrow = node.Arrow
+			// the source text is kept only for the arguments left as they were written.
+			if node.Sources != nil {
+				call.Sources = make([]string, len(arguments))
+				for i, argument := range arguments {
+					if argument == node.Arguments[i] {
+						call.Sources[i] = node.Source(i)
+					}
+				}
+			}
+			return rewrite(call)
+		}
+	case *MethodCall:
+		receiver := Rewrite(node.Receiver, rewrite).(Expression)
+		method := Rewrite(node.Method, rewrite).(*Identifier)
+		arguments, argumentsChanged := rewriteExpressions(node.Arguments, rewrite)
+		if receiver != node.Receiver || method != node.Method || argumentsChanged {
+			return rewrite(NewMethodCall(receiver, method, arguments, node.line))
+		}
+	case *ArrayLiteral:
+		if elements, changed := rewriteExpressions(node.Elements, rewrite); changed {
+			return rewrite(NewArrayLiteral(elements, node.line))
+		}
+	case *ArrayComprehension:
+		element := Rewrite(node.Element, rewrite).(Expression)
+		clauses := make([]*ComprehensionClause, len(node.Clauses))
+		clausesChanged := false
+		for i, clause := range node.Clauses {
+			clauses[i] = Rewrite(clause, rewrite).(*ComprehensionClause)
+			clausesChanged = clausesChanged || clauses[i] != clause
+		}
+		if element != node.Element || clausesChanged {
+			return rewrite(NewArrayComprehension(element, clauses, node.line))
+		}
+	case *ComprehensionClause:
+		variable := Rewrite(node.Variable, rewrite).(*Identifier)
+		iterable := Rewrite(node.Iterable, rewrite).(Expression)
+		condition := node.Condition
+		if condition != nil {
+			condition = Rewrite(condition, rewrite).(Expression)
+		}
+		if variable != node.Variable || iterable != node.Iterable || condition != node.Condition {
+			return rewrite(NewComprehensionClause(variable, iterable, condition, node.line))
+		}
+	case *IndexExpression:
+		array := Rewrite(node.Array, rewrite).(Expression)
+		index := Rewrite(node.Index, rewrite).(Expression)
+		if array != node.Array || index != node.Index {
+			return rewrite(NewIndexExpression(array, index, node.line))
+		}
+	case *FieldExpression:
+		object := Rewrite(node.Object, rewrite).(Expression)
+		field := Rewrite(node.Field, rewrite).(*Identifier)
+		if object != node.Object || field != node.Field {
+			return rewrite(NewFieldExpression(object, field, node.line))
+		}
+	case *IfExpression:
+		condition := Rewrite(node.Condition, rewrite).(Expression)
+		consequence := Rewrite(node.Consequence, rewrite).(*BlockStatement)
+		alternative := node.Alternative
+		if alternative != nil {
+			alternative = Rewrite(alternative, rewrite).(*BlockStatement)
+		}
+		if condition != node.Condition || consequence != node.Consequence || alternative != node.Alternative {
+			return rewrite(NewIfExpression(condition, consequence, alternative, node.line))
+		}
+	case *TryExpression:
+		body := Rewrite(node.Body, rewrite).(*BlockStatement)
+		parameter := Rewrite(node.Parameter, rewrite).(*Identifier)
+		handler := Rewrite(node.Handler, rewrite).(*BlockStatement)
+		if body != node.Body || parameter != node.Parameter || handler != node.Handler {
+			return rewrite(NewTryExpression(body, parameter, handler, node.line))
+		}
+	}
+
+	return rewrite(node)
+}
+
+func rewriteStatements(statements []Statement, rewrite RewriteFunc) ([]Statement, bool) {
+	rewritten := make([]Statement, len(statements))
+	changed := false
+	for i, statement := range statements {
+		rewritten[i] = Rewrite(statement, rewrite).(Statement)
+		changed = changed || rewritten[i] != statement
+	}
+	return rewritten, changed
+}
+
+func rewriteExpressions(expressions []Expression, rewrite RewriteFunc) ([]Expression, bool) {
+	rewritten := make([]Expression, len(expressions))
+	changed := false
+	for i, expression := range expressions {
+		rewritten[i] = Rewrite(expression, rewrite).(Expression)
+		changed = changed || rewritten[i] != expression
+	}
+	return rewritten, changed
+}
+
+func rewriteIdentifiers(identifiers []*Identifier, rewrite RewriteFunc) ([]*Identifier, bool) {
+	rewritten := make([]*Identifier, len(identifiers))
+	changed := false
+	for i, identifier := range identifiers {
+		rewritten[i] = Rewrite(identifier, rewrite).(*Identifier)
+		changed = changed || rewritten[i] != identifier
+	}
+	return rewritten, changed
+}
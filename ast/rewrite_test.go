@@ -0,0 +1,126 @@
+package ast
+
+import "testing"
+
+func TestRewrite(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &IntegerLiteral{Value: 2}
+	}
+
+	tests := []struct {
+		desc     string
+		input    Node
+		expected Node
+	}{
+		{
+			desc:     "integer",
+			input:    one(),
+			expected: two(),
+		},
+		{
+			desc:     "program",
+			input:    &Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			expected: &Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			desc:     "infix",
+			input:    &InfixExpression{Operator: "+", Left: one(), Right: two()},
+			expected: &InfixExpression{Operator: "+", Left: two(), Right: two()},
+		},
+		{
+			desc:     "prefix",
+			input:    &PrefixExpression{Operator: "-", Right: one()},
+			expected: &PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			desc:     "index",
+			input:    &IndexExpression{Array: one(), Index: one()},
+			expected: &IndexExpression{Array: two(), Index: two()},
+		},
+		{
+			desc: "if",
+			input: &IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			expected: &IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			desc:     "return",
+			input:    &ReturnStatement{Expression: one()},
+			expected: &ReturnStatement{Expression: two()},
+		},
+		{
+			desc:     "var",
+			input:    &VarStatement{Identifier: &Identifier{Name: "a"}, Expression: one()},
+			expected: &VarStatement{Identifier: &Identifier{Name: "a"}, Expression: two()},
+		},
+		{
+			desc: "function literal",
+			input: &FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			expected: &FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			desc:     "array",
+			input:    &ArrayLiteral{Elements: []Expression{one(), one()}},
+			expected: &ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			desc: "array comprehension",
+			input: &ArrayComprehension{
+				Element: one(),
+				Clauses: []*ComprehensionClause{{Variable: &Identifier{Name: "x"}, Iterable: one(), Condition: one()}},
+			},
+			expected: &ArrayComprehension{
+				Element: two(),
+				Clauses: []*ComprehensionClause{{Variable: &Identifier{Name: "x"}, Iterable: two(), Condition: two()}},
+			},
+		},
+		{
+			desc:     "method call",
+			input:    &MethodCall{Receiver: one(), Method: &Identifier{Name: "f"}, Arguments: []Expression{one()}},
+			expected: &MethodCall{Receiver: two(), Method: &Identifier{Name: "f"}, Arguments: []Expression{two()}},
+		},
+		{
+			desc: "try",
+			input: &TryExpression{
+				Body:      &BlockStatement{Statements: []Statement{&ThrowStatement{Expression: one()}}},
+				Parameter: &Identifier{Name: "e"},
+				Handler:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &FieldExpression{Object: one(), Field: &Identifier{Name: "line"}}}}},
+			},
+			expected: &TryExpression{
+				Body:      &BlockStatement{Statements: []Statement{&ThrowStatement{Expression: two()}}},
+				Parameter: &Identifier{Name: "e"},
+				Handler:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &FieldExpression{Object: two(), Field: &Identifier{Name: "line"}}}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			original := tt.input.String()
+			rewritten := Rewrite(tt.input, turnOneIntoTwo)
+			if rewritten.String() != tt.expected.String() {
+				t.Errorf("rewritten node wrong.\nwant=%q\ngot=%q\n", tt.expected.String(), rewritten.String())
+			}
+			if tt.input.String() != original {
+				t.Errorf("original node was mutated.\nwant=%q\ngot=%q\n", original, tt.input.String())
+			}
+		})
+	}
+}
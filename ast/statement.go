@@ -9,6 +9,7 @@ type Statement interface {
 
 type VarStatement struct {
 	Identifier *Identifier
+	Type       TypeAnnotation // nil if not annotated
 	Expression Expression
 	line       int
 }
@@ -18,6 +19,9 @@ func NewVarStatement(identifier *Identifier, expression Expression, line int) *V
 }
 func (vs *VarStatement) Line() int { return vs.line }
 func (vs *VarStatement) String() string {
+	if vs.Type != nil {
+		return "var " + vs.Identifier.String() + ": " + vs.Type.String() + " = " + vs.Expression.String() + ";"
+	}
 	return "var " + vs.Identifier.String() + " = " + vs.Expression.String() + ";"
 }
 func (vs *VarStatement) StatementNode() {}
@@ -34,6 +38,31 @@ func (rs *ReturnStatement) Line() int      { return rs.line }
 func (rs *ReturnStatement) String() string { return "return " + rs.Expression.String() + ";" }
 func (rs *ReturnStatement) StatementNode() {}
 
+type ThrowStatement struct {
+	Expression Expression
+	line       int
+}
+
+func NewThrowStatement(expression Expression, line int) *ThrowStatement {
+	return &ThrowStatement{Expression: expression, line: line}
+}
+func (ts *ThrowStatement) Line() int      { return ts.line }
+func (ts *ThrowStatement) String() string { return "throw " + ts.Expression.String() + ";" }
+func (ts *ThrowStatement) StatementNode() {}
+
+// YieldStatement produces a value of the generator its function body is evaluated for.
+type YieldStatement struct {
+	Expression Expression
+	line       int
+}
+
+func NewYieldStatement(expression Expression, line int) *YieldStatement {
+	return &YieldStatement{Expression: expression, line: line}
+}
+func (ys *YieldStatement) Line() int      { return ys.line }
+func (ys *YieldStatement) String() string { return "yield " + ys.Expression.String() + ";" }
+func (ys *YieldStatement) StatementNode() {}
+
 type ExpressionStatement struct {
 	Expression Expression
 	line       int
@@ -48,6 +77,7 @@ func (es *ExpressionStatement) StatementNode() {}
 
 type BlockStatement struct {
 	Statements []Statement
+	End        int // the line of the closing brace, set by the parser
 	line       int
 }
 
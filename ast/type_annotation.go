@@ -0,0 +1,56 @@
+package ast
+
+import "strings"
+
+// TypeAnnotation is a type written in the source, such as `int`, `[int]` or `|int| -> bool`.
+type TypeAnnotation interface {
+	Node
+	TypeAnnotationNode()
+}
+
+// NamedType is int, bool, string, null, error or quote. any other name is a type variable, which stands for any type.
+type NamedType struct {
+	Name string
+	line int
+}
+
+func NewNamedType(name string, line int) *NamedType { return &NamedType{Name: name, line: line} }
+func (nt *NamedType) Line() int                     { return nt.line }
+func (nt *NamedType) String() string                { return nt.Name }
+func (nt *NamedType) TypeAnnotationNode()           {}
+
+type ArrayType struct {
+	Element TypeAnnotation
+	line    int
+}
+
+func NewArrayType(element TypeAnnotation, line int) *ArrayType {
+	return &ArrayType{Element: element, line: line}
+}
+func (at *ArrayType) Line() int           { return at.line }
+func (at *ArrayType) String() string      { return "[" + at.Element.String() + "]" }
+func (at *ArrayType) TypeAnnotationNode() {}
+
+type FunctionType struct {
+	Parameters []TypeAnnotation
+	Return     TypeAnnotation
+	line       int
+}
+
+func NewFunctionType(parameters []TypeAnnotation, ret TypeAnnotation, line int) *FunctionType {
+	return &FunctionType{Parameters: parameters, Return: ret, line: line}
+}
+func (ft *FunctionType) Line() int { return ft.line }
+func (ft *FunctionType) String() string {
+	var paramStrs []string
+	for _, param := range ft.Parameters {
+		// a function type is parenthesized as a parameter, since `||` would be read as an empty parameter list.
+		if _, ok := param.(*FunctionType); ok {
+			paramStrs = append(paramStrs, "("+param.String()+")")
+		} else {
+			paramStrs = append(paramStrs, param.String())
+		}
+	}
+	return "|" + strings.Join(paramStrs, ", ") + "| -> " + ft.Return.String()
+}
+func (ft *FunctionType) TypeAnnotationNode() {}
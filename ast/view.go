@@ -0,0 +1,191 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tree returns node as an indented tree, one node per line with its kind, attributes and line, e.g.
+//
+//	Program (line 1)
+//	  statements[0]: ExpressionStatement (line 1)
+//	    expression: FunctionCall arrow=true (line 1)
+//	      function: Identifier name=f (line 1)
+//	      arguments[0]: Identifier name=x (line 1)
+func Tree(node Node) string {
+	var out bytes.Buffer
+	var write func(label string, node Node, depth int)
+	write = func(label string, node Node, depth int) {
+		out.WriteString(strings.Repeat("  ", depth))
+		if label != "" {
+			out.WriteString(label + ": ")
+		}
+		out.WriteString(describe(node) + fmt.Sprintf(" (line %d)\n", node.Line()))
+		for _, child := range children(node) {
+			write(child.label, child.node, depth+1)
+		}
+	}
+	write("", node, 0)
+	return out.String()
+}
+
+// Dot returns node as a graph in the DOT language of Graphviz.
+// every node is a box labeled with its kind, attributes and line, and every edge is labeled with the field of the child.
+func Dot(node Node) string {
+	var out bytes.Buffer
+	out.WriteString("digraph ast {\n")
+	out.WriteString("  node [shape=box];\n")
+	id := 0
+	var write func(node Node) int
+	write = func(node Node) int {
+		nodeID := id
+		id++
+		label := describe(node) + fmt.Sprintf("\nline %d", node.Line())
+		out.WriteString(fmt.Sprintf("  n%d [label=%s];\n", nodeID, dotQuote(label)))
+		for _, child := range children(node) {
+			childID := write(child.node)
+			out.WriteString(fmt.Sprintf("  n%d -> n%d [label=%s];\n", nodeID, childID, dotQuote(child.label)))
+		}
+		return nodeID
+	}
+	write(node)
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// dotQuote quotes s as a DOT string, in which a newline is written as \n.
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// describe returns the kind of node followed by its attributes which are not nodes.
+func describe(node Node) string {
+	kind := kindOf(node)
+	switch node := node.(type) {
+	case *Identifier:
+		return kind + " name=" + node.Name
+	case *IntegerLiteral:
+		return kind + " value=" + strconv.Itoa(node.Value)
+	case *BooleanLiteral:
+		return kind + " value=" + strconv.FormatBool(node.Value)
+	case *StringLiteral:
+		return kind + " value=" + strconv.Quote(node.Value)
+	case *PrefixExpression:
+		return kind + " operator=" + node.Operator
+	case *InfixExpression:
+		return kind + " operator=" + node.Operator
+	case *FunctionCall:
+		if node.Arrow {
+			return kind + " arrow=true"
+		}
+	case *NamedType:
+		return kind + " name=" + node.Name
+	}
+	return kind
+}
+
+// labeledNode is a child of a node with the name of the field it is in.
+type labeledNode struct {
+	label string
+	node  Node
+}
+
+// children returns the child nodes of node in the order of the source, omitting the absent ones.
+func children(node Node) []labeledNode {
+	var nodes []labeledNode
+	add := func(label string, node Node) {
+		if !isNilNode(node) {
+			nodes = append(nodes, labeledNode{label: label, node: node})
+		}
+	}
+	addList := func(label string, length int, at func(int) Node) {
+		for i := 0; i < length; i++ {
+			add(fmt.Sprintf("%s[%d]", label, i), at(i))
+		}
+	}
+	statements := func(label string, statements []Statement) {
+		addList(label, len(statements), func(i int) Node { return statements[i] })
+	}
+	expressions := func(label string, expressions []Expression) {
+		addList(label, len(expressions), func(i int) Node { return expressions[i] })
+	}
+	identifiers := func(label string, identifiers []*Identifier) {
+		addList(label, len(identifiers), func(i int) Node { return identifiers[i] })
+	}
+	typeAnnotations := func(label string, typeAnnotations []TypeAnnotation) {
+		addList(label, len(typeAnnotations), func(i int) Node { return typeAnnotations[i] })
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		statements("statements", node.Statements)
+	case *BlockStatement:
+		statements("statements", node.Statements)
+	case *VarStatement:
+		add("identifier", node.Identifier)
+		add("type", node.Type)
+		add("expression", node.Expression)
+	case *ReturnStatement:
+		add("expression", node.Expression)
+	case *ThrowStatement:
+		add("expression", node.Expression)
+	case *YieldStatement:
+		add("expression", node.Expression)
+	case *ExpressionStatement:
+		add("expression", node.Expression)
+	case *PrefixExpression:
+		add("right", node.Right)
+	case *InfixExpression:
+		add("left", node.Left)
+		add("right", node.Right)
+	case *FunctionLiteral:
+		identifiers("parameters", node.Parameters)
+		typeAnnotations("parameterTypes", node.ParameterTypes)
+		add("returnType", node.ReturnType)
+		add("body", node.Body)
+	case *MacroLiteral:
+		identifiers("parameters", node.Parameters)
+		add("body", node.Body)
+	case *FunctionCall:
+		add("function", node.Function)
+		expressions("arguments", node.Arguments)
+	case *MethodCall:
+		add("receiver", node.Receiver)
+		add("method", node.Method)
+		expressions("arguments", node.Arguments)
+	case *ArrayLiteral:
+		expressions("elements", node.Elements)
+	case *ArrayComprehension:
+		add("element", node.Element)
+		addList("clauses", len(node.Clauses), func(i int) Node { return node.Clauses[i] })
+	case *ComprehensionClause:
+		add("variable", node.Variable)
+		add("iterable", node.Iterable)
+		add("condition", node.Condition)
+	case *IndexExpression:
+		add("array", node.Array)
+		add("index", node.Index)
+	case *FieldExpression:
+		add("object", node.Object)
+		add("field", node.Field)
+	case *IfExpression:
+		add("condition", node.Condition)
+		add("consequence", node.Consequence)
+		add("alternative", node.Alternative)
+	case *TryExpression:
+		add("body", node.Body)
+		add("parameter", node.Parameter)
+		add("handler", node.Handler)
+	case *ArrayType:
+		add("element", node.Element)
+	case *FunctionType:
+		typeAnnotations("parameters", node.Parameters)
+		add("return", node.Return)
+	}
+	return nodes
+}
@@ -0,0 +1,116 @@
+package ast_test
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/parser"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	input := "var f: |int| -> int = |x| { -x };\n[1, 2] -> map(f)"
+	expected := `Program (line 1)
+  statements[0]: VarStatement (line 1)
+    identifier: Identifier name=f (line 1)
+    type: FunctionType (line 1)
+      parameters[0]: NamedType name=int (line 1)
+      return: NamedType name=int (line 1)
+    expression: FunctionLiteral (line 1)
+      parameters[0]: Identifier name=x (line 1)
+      body: BlockStatement (line 1)
+        statements[0]: ExpressionStatement (line 1)
+          expression: PrefixExpression operator=- (line 1)
+            right: Identifier name=x (line 1)
+  statements[1]: ExpressionStatement (line 2)
+    expression: FunctionCall arrow=true (line 2)
+      function: Identifier name=map (line 2)
+      arguments[0]: ArrayLiteral (line 2)
+        elements[0]: IntegerLiteral value=1 (line 2)
+        elements[1]: IntegerLiteral value=2 (line 2)
+      arguments[1]: Identifier name=f (line 2)
+`
+
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if actual := ast.Tree(program); actual != expected {
+		t.Errorf("tree wrong.\nwant=%s\ngot=%s\n", expected, actual)
+	}
+}
+
+func TestDot(t *testing.T) {
+	input := `puts("a\"b")`
+	expected := `digraph ast {
+  node [shape=box];
+  n0 [label="Program\nline 1"];
+  n1 [label="ExpressionStatement\nline 1"];
+  n2 [label="FunctionCall\nline 1"];
+  n3 [label="Identifier name=puts\nline 1"];
+  n2 -> n3 [label="function"];
+  n4 [label="StringLiteral value=\"a\\\"b\"\nline 1"];
+  n2 -> n4 [label="arguments[0]"];
+  n1 -> n2 [label="expression"];
+  n0 -> n1 [label="statements[0]"];
+}
+`
+
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	if actual := ast.Dot(program); actual != expected {
+		t.Errorf("dot wrong.\nwant=%s\ngot=%s\n", expected, actual)
+	}
+}
+
+// TestTree_AllKinds checks that every kind of node is shown, with the same nodes in Tree and Dot.
+func TestTree_AllKinds(t *testing.T) {
+	input := `
+var n: [int] = [x * 2 for x in [1] if !true];
+var f = |g: |int| -> bool, s| -> int { return g(1)[0] };
+throw try { "a".f(1 -> f()) } catch (e) { e.message };
+var m = macro |a| { if (a) { 1 } else { 2 } };
+`
+	expected := []string{
+		"ArrayComprehension", "ArrayLiteral", "ArrayType", "BlockStatement", "BooleanLiteral", "ComprehensionClause",
+		"ExpressionStatement", "FieldExpression", "FunctionCall", "FunctionLiteral", "FunctionType", "Identifier",
+		"IfExpression", "IndexExpression", "InfixExpression", "IntegerLiteral", "MacroLiteral", "MethodCall", "NamedType",
+		"PrefixExpression", "Program", "ReturnStatement", "StringLiteral", "ThrowStatement", "TryExpression", "VarStatement",
+	}
+
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+
+	tree := ast.Tree(program)
+	kinds := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(tree), "\n") {
+		fields := strings.Fields(line)
+		kind := fields[0]
+		if strings.HasSuffix(kind, ":") {
+			kind = fields[1]
+		}
+		kinds[kind] = true
+	}
+	actual := []string{}
+	for kind := range kinds {
+		actual = append(actual, kind)
+	}
+	sort.Strings(actual)
+	if strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("kinds wrong.\nwant=%v\ngot=%v\n", expected, actual)
+	}
+
+	dot := ast.Dot(program)
+	treeNodes := strings.Count(tree, "\n")
+	dotNodes := len(regexp.MustCompile(`(?m)^  n\d+ \[label=`).FindAllString(dot, -1))
+	dotEdges := strings.Count(dot, " -> n")
+	if dotNodes != treeNodes || dotEdges != treeNodes-1 {
+		t.Errorf("number of nodes wrong.\nwant=%d nodes, %d edges\ngot=%d nodes, %d edges\n", treeNodes, treeNodes-1, dotNodes, dotEdges)
+	}
+}
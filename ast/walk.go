@@ -0,0 +1,161 @@
+package ast
+
+// Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children of node with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth-first order, starting with v.Visit(node).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		walkStatements(v, node.Statements)
+	case *BlockStatement:
+		walkStatements(v, node.Statements)
+	case *VarStatement:
+		Walk(v, node.Identifier)
+		Walk(v, node.Expression)
+	case *ReturnStatement:
+		Walk(v, node.Expression)
+	case *ThrowStatement:
+		Walk(v, node.Expression)
+	case *YieldStatement:
+		Walk(v, node.Expression)
+	case *ExpressionStatement:
+		Walk(v, node.Expression)
+	case *PrefixExpression:
+		Walk(v, node.Right)
+	case *InfixExpression:
+		Walk(v, node.Left)
+		Walk(v, node.Right)
+	case *FunctionLiteral:
+		walkIdentifiers(v, node.Parameters)
+		Walk(v, node.Body)
+	case *MacroLiteral:
+		walkIdentifiers(v, node.Parameters)
+		Walk(v, node.Body)
+	case *FunctionCall:
+		Walk(v, node.Function)
+		walkExpressions(v, node.Arguments)
+	case *MethodCall:
+		Walk(v, node.Receiver)
+		Walk(v, node.Method)
+		walkExpressions(v, node.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, node.Elements)
+	case *ArrayComprehension:
+		Walk(v, node.Element)
+		for _, clause := range node.Clauses {
+			Walk(v, clause)
+		}
+	case *ComprehensionClause:
+		Walk(v, node.Variable)
+		Walk(v, node.Iterable)
+		if node.Condition != nil {
+			Walk(v, node.Condition)
+		}
+	case *IndexExpression:
+		Walk(v, node.Array)
+		Walk(v, node.Index)
+	case *FieldExpression:
+		Walk(v, node.Object)
+		Walk(v, node.Field)
+	case *IfExpression:
+		Walk(v, node.Condition)
+		Walk(v, node.Consequence)
+		if node.Alternative != nil {
+			Walk(v, node.Alternative)
+		}
+	case *TryExpression:
+		Walk(v, node.Body)
+		Walk(v, node.Parameter)
+		Walk(v, node.Handler)
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, statement := range statements {
+		Walk(v, statement)
+	}
+}
+
+func walkExpressions(v Visitor, expressions []Expression) {
+	for _, expression := range expressions {
+		Walk(v, expression)
+	}
+}
+
+func walkIdentifiers(v Visitor, identifiers []*Identifier) {
+	for _, identifier := range identifiers {
+		Walk(v, identifier)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order, calling f(node) for each node.
+// If f returns true, Inspect invokes f for each of the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Declarations returns the names declared by the var statements in node which are evaluated in the same environment as node,
+// that is, excluding the ones in functions, catch handlers and array comprehensions.
+func Declarations(node Node) []string {
+	var names []string
+	Inspect(node, func(node Node) bool {
+		switch node := node.(type) {
+		case *VarStatement:
+			names = append(names, node.Identifier.Name)
+		case *FunctionLiteral, *MacroLiteral, *ArrayComprehension:
+			return false
+		case *TryExpression:
+			names = append(names, Declarations(node.Body)...)
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// Hoist adds the names declared in the same environment as node, as returned by Declarations, to names.
+// node may be nil, such as the condition of a comprehension clause without one.
+func Hoist(names map[string]bool, node Node) {
+	if node == nil {
+		return
+	}
+	for _, name := range Declarations(node) {
+		names[name] = true
+	}
+}
+
+// Yields reports whether node contains a yield statement evaluated in the same function as node,
+// that is, excluding the ones in functions and macros. the function whose body yields is a generator.
+func Yields(node Node) bool {
+	yields := false
+	Inspect(node, func(node Node) bool {
+		switch node.(type) {
+		case *YieldStatement:
+			yields = true
+		case *FunctionLiteral, *MacroLiteral:
+			return false
+		}
+		return !yields
+	})
+	return yields
+}
@@ -0,0 +1,208 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+type recordingVisitor struct {
+	visited *[]string
+}
+
+func (rv recordingVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*rv.visited = append(*rv.visited, "end")
+		return nil
+	}
+	*rv.visited = append(*rv.visited, node.String())
+	return rv
+}
+
+func TestWalk(t *testing.T) {
+	// var f = |x| { x + 1 }; f(2)
+	program := &Program{Statements: []Statement{
+		&VarStatement{
+			Identifier: &Identifier{Name: "f"},
+			Expression: &FunctionLiteral{
+				Parameters: []*Identifier{{Name: "x"}},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &InfixExpression{Operator: "+", Left: &Identifier{Name: "x"}, Right: &IntegerLiteral{Value: 1}}},
+				}},
+			},
+		},
+		&ExpressionStatement{Expression: &FunctionCall{Function: &Identifier{Name: "f"}, Arguments: []Expression{&IntegerLiteral{Value: 2}}}},
+	}}
+
+	var visited []string
+	Walk(recordingVisitor{visited: &visited}, program)
+
+	expected := []string{
+		program.String(),
+		"var f = |x| {(x + 1);};",
+		"f", "end",
+		"|x| {(x + 1);}",
+		"x", "end",
+		"{(x + 1);}",
+		"(x + 1);",
+		"(x + 1)",
+		"x", "end",
+		"1", "end",
+		"end",
+		"end",
+		"end",
+		"end",
+		"end",
+		"f(2);",
+		"f(2)",
+		"f", "end",
+		"2", "end",
+		"end",
+		"end",
+		"end",
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("visited nodes wrong.\nwant=%q\ngot=%q\n", expected, visited)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    Node
+		expected []string
+	}{
+		{
+			desc: "identifiers in every kind of node",
+			input: &Program{Statements: []Statement{
+				&ThrowStatement{Expression: &FieldExpression{Object: &Identifier{Name: "a"}, Field: &Identifier{Name: "b"}}},
+				&ReturnStatement{Expression: &MethodCall{Receiver: &Identifier{Name: "c"}, Method: &Identifier{Name: "d"}, Arguments: []Expression{&Identifier{Name: "e"}}}},
+				&ExpressionStatement{Expression: &ArrayComprehension{
+					Element: &Identifier{Name: "f"},
+					Clauses: []*ComprehensionClause{{Variable: &Identifier{Name: "g"}, Iterable: &Identifier{Name: "h"}, Condition: &Identifier{Name: "i"}}},
+				}},
+				&ExpressionStatement{Expression: &TryExpression{
+					Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &IndexExpression{Array: &Identifier{Name: "j"}, Index: &Identifier{Name: "k"}}}}},
+					Parameter: &Identifier{Name: "l"},
+					Handler:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &PrefixExpression{Operator: "-", Right: &Identifier{Name: "m"}}}}},
+				}},
+				&ExpressionStatement{Expression: &IfExpression{
+					Condition:   &Identifier{Name: "n"},
+					Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &ArrayLiteral{Elements: []Expression{&Identifier{Name: "o"}}}}}},
+					Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &MacroLiteral{
+						Parameters: []*Identifier{{Name: "p"}},
+						Body:       &BlockStatement{Statements: []Statement{}},
+					}}}},
+				}},
+			}},
+			expected: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p"},
+		},
+		{
+			desc: "skip function body",
+			input: &ArrayLiteral{Elements: []Expression{
+				&Identifier{Name: "a"},
+				&FunctionLiteral{
+					Parameters: []*Identifier{{Name: "b"}},
+					Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &Identifier{Name: "c"}}}},
+				},
+				&Identifier{Name: "d"},
+			}},
+			expected: []string{"a", "d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var names []string
+			Inspect(tt.input, func(node Node) bool {
+				switch node := node.(type) {
+				case *Identifier:
+					names = append(names, node.Name)
+				case *FunctionLiteral:
+					return false
+				}
+				return true
+			})
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("identifiers wrong.\nwant=%q\ngot=%q\n", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestYields(t *testing.T) {
+	yield := &YieldStatement{Expression: &IntegerLiteral{Value: 1}}
+	tests := []struct {
+		desc     string
+		input    Node
+		expected bool
+	}{
+		{
+			desc:     "no yield",
+			input:    &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &IntegerLiteral{Value: 1}}}},
+			expected: false,
+		},
+		{
+			desc: "yield in if",
+			input: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &IfExpression{
+				Condition:   &BooleanLiteral{Value: true},
+				Consequence: &BlockStatement{Statements: []Statement{yield}},
+			}}}},
+			expected: true,
+		},
+		{
+			desc: "yield in function",
+			input: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &FunctionLiteral{
+				Body: &BlockStatement{Statements: []Statement{yield}},
+			}}}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if actual := Yields(tt.input); actual != tt.expected {
+				t.Errorf("yields wrong.\nwant=%t\ngot=%t\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestHoist(t *testing.T) {
+	declaration := func(name string) Statement {
+		return &VarStatement{Identifier: &Identifier{Name: name}, Expression: &IntegerLiteral{Value: 1}}
+	}
+	tests := []struct {
+		desc     string
+		input    Node
+		expected map[string]bool
+	}{
+		{
+			desc:     "nil",
+			input:    nil,
+			expected: map[string]bool{"x": true},
+		},
+		{
+			desc: "declarations in try and function",
+			input: &BlockStatement{Statements: []Statement{
+				declaration("a"),
+				&ExpressionStatement{Expression: &TryExpression{
+					Body:      &BlockStatement{Statements: []Statement{declaration("b")}},
+					Parameter: &Identifier{Name: "e"},
+					Handler:   &BlockStatement{Statements: []Statement{declaration("c")}},
+				}},
+				&ExpressionStatement{Expression: &FunctionLiteral{Body: &BlockStatement{Statements: []Statement{declaration("d")}}}},
+			}},
+			expected: map[string]bool{"x": true, "a": true, "b": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			names := map[string]bool{"x": true}
+			Hoist(names, tt.input)
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("names wrong.\nwant=%v\ngot=%v\n", tt.expected, names)
+			}
+		})
+	}
+}
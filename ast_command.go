@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/parser"
+	"io/ioutil"
+	"os"
+)
+
+// astCommand prints the parsed AST of a file in the format chosen by the flags.
+func astCommand(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the AST as JSON")
+	asDot := flags.Bool("dot", false, "print the AST as a Graphviz DOT graph")
+	asTree := flags.Bool("tree", false, "print the AST as an indented tree with line numbers")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || countTrue(*asJSON, *asDot, *asTree) != 1 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 1
+	}
+
+	program, status := parseFile(flags.Arg(0))
+	if program == nil {
+		return status
+	}
+
+	switch {
+	case *asDot:
+		fmt.Print(ast.Dot(program))
+	case *asTree:
+		fmt.Print(ast.Tree(program))
+	default:
+		encoded, err := ast.MarshalJSON(program)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(encoded))
+	}
+	return 0
+}
+
+func countTrue(values ...bool) int {
+	count := 0
+	for _, value := range values {
+		if value {
+			count++
+		}
+	}
+	return count
+}
+
+// parseFile parses the file. it returns the exit status to use when the program is nil.
+func parseFile(filename string) (*ast.Program, int) {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, 1
+	}
+
+	program, err := parser.New(lexer.New(string(bytes))).ParseProgram()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, 2
+	}
+	return program, 0
+}
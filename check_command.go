@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/evaluator"
+	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/types"
+	"os"
+)
+
+// checkCommand prints the type errors of files without running them. the exit status is 1 if there is any.
+func checkCommand(args []string) int {
+	status := 0
+	for _, filename := range args {
+		program, parseStatus := parseFile(filename)
+		if program == nil {
+			return parseStatus
+		}
+
+		macroEnv := object.NewEnvironment()
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			return 2
+		}
+
+		_, errors := types.Check(expanded)
+		for _, err := range errors {
+			fmt.Printf("%s: %s\n", filename, err)
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,187 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of instructions, each of which is an opcode followed by its operands.
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant    Opcode = iota // push the constant
+	OpTrue                      // push true
+	OpFalse                     // push false
+	OpNull                      // push null
+	OpNil                       // push nothing, the value of a var statement or an empty block
+	OpPop                       // discard the top of the stack
+	OpGetVariable               // push the variable read by the identifier
+	OpGetLocal                  // push the slot of the scope of the depth, or the variable read by the identifier if it is not set
+	OpSetLocal                  // pop a value into the slot of the innermost scope
+	OpCheckVar                  // check the top of the stack against the type annotation of the var statement
+	OpPrefix                    // apply the prefix expression to the top of the stack
+	OpInfix                     // apply the infix expression to the two values on the top of the stack
+	OpAdd                       // apply the infix expression of + to the two values on the top of the stack, as OpInfix does
+	OpSubtract                  // the same as OpAdd for -
+	OpMultiply                  // the same as OpAdd for *
+	OpDivide                    // the same as OpAdd for /
+	OpModulo                    // the same as OpAdd for %
+	OpGreater                   // the same as OpAdd for >
+	OpLess                      // the same as OpAdd for <
+	OpEqual                     // the same as OpAdd for ==
+	OpNotEqual                  // the same as OpAdd for !=
+	OpJump                      // jump to the address
+	OpJumpIfFalsy               // pop a value and jump to the address if it is false or null
+	OpClosure                   // push a closure of the compiled function in the constants
+	OpCall                      // call the function on the top of the stack with the arguments below it
+	OpTailCall                  // call as OpCall in tail position, replacing the frame of the current function
+	OpReturn                    // return the top of the stack from the current function
+	OpReturnValue               // wrap the top of the stack in a return value, the value of the if or try expression returned from
+	OpArray                     // pop the elements and push an array of them
+	OpIndex                     // pop an index and an array and push the element
+	OpField                     // pop an error and push its field
+	OpThrow                     // pop a value and throw it
+	OpSetupTry                  // install the catch handler at the address
+	OpPopTry                    // uninstall the innermost catch handler
+	OpEnterScope                // create a scope of the number of slots inside the current one
+	OpLeaveScope                // return to the scope enclosing the current one
+	OpIterate                   // replace the array on the top of the stack with an iterator over it
+	OpNext                      // push the next element of the iterator, or pop the iterator and jump to the address if exhausted
+	OpAppend                    // pop a value and append it to the array below the iterators of the number
+	OpQuote                     // pop the values of the unquote calls and push the quoted node
+	OpYield                     // pop a value and yield it from the generator being executed
+)
+
+// Definition describes an opcode. each operand is an unsigned integer of the given width in bytes.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:    {Name: "OpConstant", OperandWidths: []int{2}},
+	OpTrue:        {Name: "OpTrue", OperandWidths: []int{}},
+	OpFalse:       {Name: "OpFalse", OperandWidths: []int{}},
+	OpNull:        {Name: "OpNull", OperandWidths: []int{}},
+	OpNil:         {Name: "OpNil", OperandWidths: []int{}},
+	OpPop:         {Name: "OpPop", OperandWidths: []int{}},
+	OpGetVariable: {Name: "OpGetVariable", OperandWidths: []int{2}},
+	OpGetLocal:    {Name: "OpGetLocal", OperandWidths: []int{1, 2, 2}},
+	OpSetLocal:    {Name: "OpSetLocal", OperandWidths: []int{2}},
+	OpCheckVar:    {Name: "OpCheckVar", OperandWidths: []int{2}},
+	OpPrefix:      {Name: "OpPrefix", OperandWidths: []int{2}},
+	OpInfix:       {Name: "OpInfix", OperandWidths: []int{2}},
+	OpAdd:         {Name: "OpAdd", OperandWidths: []int{2}},
+	OpSubtract:    {Name: "OpSubtract", OperandWidths: []int{2}},
+	OpMultiply:    {Name: "OpMultiply", OperandWidths: []int{2}},
+	OpDivide:      {Name: "OpDivide", OperandWidths: []int{2}},
+	OpModulo:      {Name: "OpModulo", OperandWidths: []int{2}},
+	OpGreater:     {Name: "OpGreater", OperandWidths: []int{2}},
+	OpLess:        {Name: "OpLess", OperandWidths: []int{2}},
+	OpEqual:       {Name: "OpEqual", OperandWidths: []int{2}},
+	OpNotEqual:    {Name: "OpNotEqual", OperandWidths: []int{2}},
+	OpJump:        {Name: "OpJump", OperandWidths: []int{2}},
+	OpJumpIfFalsy: {Name: "OpJumpIfFalsy", OperandWidths: []int{2}},
+	OpClosure:     {Name: "OpClosure", OperandWidths: []int{2}},
+	OpCall:        {Name: "OpCall", OperandWidths: []int{2, 1}},
+	OpTailCall:    {Name: "OpTailCall", OperandWidths: []int{2, 1}},
+	OpReturn:      {Name: "OpReturn", OperandWidths: []int{}},
+	OpReturnValue: {Name: "OpReturnValue", OperandWidths: []int{}},
+	OpArray:       {Name: "OpArray", OperandWidths: []int{2}},
+	OpIndex:       {Name: "OpIndex", OperandWidths: []int{2}},
+	OpField:       {Name: "OpField", OperandWidths: []int{2}},
+	OpThrow:       {Name: "OpThrow", OperandWidths: []int{2}},
+	OpSetupTry:    {Name: "OpSetupTry", OperandWidths: []int{2}},
+	OpPopTry:      {Name: "OpPopTry", OperandWidths: []int{}},
+	OpEnterScope:  {Name: "OpEnterScope", OperandWidths: []int{2}},
+	OpLeaveScope:  {Name: "OpLeaveScope", OperandWidths: []int{}},
+	OpIterate:     {Name: "OpIterate", OperandWidths: []int{2}},
+	OpNext:        {Name: "OpNext", OperandWidths: []int{2}},
+	OpAppend:      {Name: "OpAppend", OperandWidths: []int{2}},
+	OpQuote:       {Name: "OpQuote", OperandWidths: []int{2, 2}},
+	OpYield:       {Name: "OpYield", OperandWidths: []int{2}},
+}
+
+func Lookup(op Opcode) (*Definition, error) {
+	definition, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return definition, nil
+}
+
+// Make returns the instruction of op with operands. an error is returned if op is undefined
+// or an operand does not fit in its width, instead of truncating it.
+func Make(op Opcode, operands ...int) ([]byte, error) {
+	definition, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	length := 1
+	for _, width := range definition.OperandWidths {
+		length += width
+	}
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, operand := range operands {
+		width := definition.OperandWidths[i]
+		if max := 1<<(8*width) - 1; operand < 0 || operand > max {
+			return nil, fmt.Errorf("operand %d of %s out of range: want 0 to %d, got %d", i+1, definition.Name, max, operand)
+		}
+		switch width {
+		case 1:
+			instruction[offset] = byte(operand)
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		}
+		offset += width
+	}
+	return instruction, nil
+}
+
+// ReadOperands decodes the operands of an instruction of definition and returns them with the number of bytes read.
+func ReadOperands(definition *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(definition.OperandWidths))
+	offset := 0
+	for i, width := range definition.OperandWidths {
+		switch width {
+		case 1:
+			operands[i] = int(ins[offset])
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// String disassembles the instructions, one per line prefixed with its address.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+	for i := 0; i < len(ins); {
+		definition, err := Lookup(Opcode(ins[i]))
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(definition, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s", i, definition.Name)
+		for _, operand := range operands {
+			fmt.Fprintf(&out, " %d", operand)
+		}
+		out.WriteString("\n")
+		i += 1 + read
+	}
+	return out.String()
+}
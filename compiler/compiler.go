@@ -0,0 +1,557 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+)
+
+// Bytecode is a program compiled by Compile, which is executed by package vm.
+type Bytecode struct {
+	Instructions Instructions
+	NumSlots     int             // the number of variables in the top-level environment
+	Constants    []object.Object // the integers, strings and compiled functions
+	Nodes        []ast.Node      // the nodes referred to by the instructions, for the errors, type annotations and quotes
+	Variables    []*Variable     // the variables read by OpGetVariable
+}
+
+// Variable is an identifier read by the program. Locations are the slots of the enclosing scopes declaring the name,
+// from the innermost. the first of them which has been set holds the value, as environments are searched by Eval.
+type Variable struct {
+	Identifier *ast.Identifier
+	Locations  []Location
+}
+
+// Location is the slot Index of the scope Depth levels out from the current one.
+type Location struct {
+	Depth int
+	Index int
+}
+
+type CompileError struct {
+	line int
+	msg  string
+}
+
+func (ce *CompileError) Error() string {
+	return fmt.Sprintf("line %d: %s", ce.line, ce.msg)
+}
+
+// scope corresponds to an environment created during the execution: the top level, a function call,
+// a catch handler or an iteration of a comprehension clause.
+type scope struct {
+	outer   *scope
+	slots   map[string]int  // the slots of the names used so far
+	size    int             // the number of the slots
+	hoisted map[string]bool // the names declared anywhere in the scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, slots: make(map[string]int), hoisted: make(map[string]bool)}
+}
+
+func (s *scope) slot(name string) int {
+	if index, ok := s.slots[name]; ok {
+		return index
+	}
+	index := s.size
+	s.slots[name] = index
+	s.size++
+	return index
+}
+
+// parameter declares the parameter at index, which is bound to the slot of the same index.
+// a name repeated in the parameters refers to the last of them, as the arguments are bound in order by Eval.
+func (s *scope) parameter(name string, index int) {
+	s.hoisted[name] = true
+	s.slots[name] = index
+	s.size = index + 1
+}
+
+func (s *scope) declare(name string) int {
+	s.hoisted[name] = true
+	return s.slot(name)
+}
+
+func (s *scope) hoist(node ast.Node) {
+	if node == nil {
+		return
+	}
+	for _, name := range ast.Declarations(node) {
+		s.hoisted[name] = true
+	}
+}
+
+// Compile compiles program to bytecode.
+func Compile(program *ast.Program) (*Bytecode, error) {
+	c := &compiler{bytecode: &Bytecode{}, scope: newScope(nil)}
+	c.scope.hoist(program)
+	c.compileStatements(program.Statements)
+	c.emit(OpReturn)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	c.bytecode.Instructions = c.instructions
+	c.bytecode.NumSlots = c.scope.size
+	return c.bytecode, nil
+}
+
+type compiler struct {
+	bytecode     *Bytecode
+	instructions Instructions // the instructions of the function being compiled
+	scope        *scope
+	line         int // the line of the node being compiled, at which the operands out of range are reported
+	target       *returnTarget
+	unwind       []Opcode // the instructions leaving the try expressions around the statement being compiled, from the outermost
+	err          error
+}
+
+// returnTarget is an if or try expression which is not the expression of a statement, such as an element of an array.
+// a return statement in it does not return from the function, as in evaluator.Eval: it ends the expression,
+// whose value is the value returned wrapped in an object.ReturnValue.
+type returnTarget struct {
+	unwind int   // the number of the instructions of unwind outside of the expression
+	jumps  []int // the positions of the jumps to the end of the expression
+}
+
+// emit appends the instruction of op with operands. if an operand is out of range, the error is recorded
+// and the instruction is appended with zero operands, so that the positions of the following instructions stay the same.
+func (c *compiler) emit(op Opcode, operands ...int) int {
+	position := len(c.instructions)
+	instruction, err := Make(op, operands...)
+	if err != nil {
+		c.fail(err)
+		instruction, _ = Make(op)
+	}
+	c.instructions = append(c.instructions, instruction...)
+	return position
+}
+
+// patch replaces the first operand of the instruction at position.
+func (c *compiler) patch(position int, operand int) {
+	instruction, err := Make(Opcode(c.instructions[position]), operand)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	copy(c.instructions[position:], instruction)
+}
+
+// fail records err raised at the line of the node being compiled, unless an error is recorded already.
+func (c *compiler) fail(err error) {
+	if c.err == nil {
+		c.err = &CompileError{line: c.line, msg: err.Error()}
+	}
+}
+
+func (c *compiler) addConstant(constant object.Object) int {
+	c.bytecode.Constants = append(c.bytecode.Constants, constant)
+	return len(c.bytecode.Constants) - 1
+}
+
+func (c *compiler) addNode(node ast.Node) int {
+	c.bytecode.Nodes = append(c.bytecode.Nodes, node)
+	return len(c.bytecode.Nodes) - 1
+}
+
+func (c *compiler) enter() {
+	c.scope = newScope(c.scope)
+}
+
+func (c *compiler) leave() {
+	c.scope = c.scope.outer
+}
+
+// compileStatements leaves the value of the last statement on the stack.
+func (c *compiler) compileStatements(statements []ast.Statement) {
+	if len(statements) == 0 {
+		c.emit(OpNil)
+		return
+	}
+	for i, statement := range statements {
+		c.compileStatement(statement)
+		if i < len(statements)-1 {
+			c.emit(OpPop)
+		}
+	}
+}
+
+func (c *compiler) compileStatement(statement ast.Statement) {
+	outer := c.line
+	c.line = statement.Line()
+	defer func() { c.line = outer }()
+
+	switch statement := statement.(type) {
+	case *ast.VarStatement:
+		c.compileExpression(statement.Expression)
+		if statement.Type != nil {
+			c.emit(OpCheckVar, c.addNode(statement))
+		}
+		c.emit(OpSetLocal, c.scope.declare(statement.Identifier.Name))
+		c.emit(OpNil)
+	case *ast.ReturnStatement:
+		c.compileStatementExpression(statement.Expression)
+		c.compileReturn()
+	case *ast.ThrowStatement:
+		c.compileExpression(statement.Expression)
+		c.emit(OpThrow, c.addNode(statement))
+	case *ast.YieldStatement:
+		c.compileExpression(statement.Expression)
+		c.emit(OpYield, c.addNode(statement))
+		c.emit(OpNil)
+	case *ast.ExpressionStatement:
+		c.compileStatementExpression(statement.Expression)
+	case *ast.BlockStatement:
+		c.compileStatements(statement.Statements)
+	}
+}
+
+// compileStatementExpression compiles the expression of a statement. an if or try expression is compiled
+// without becoming a return target, so that a return statement in it ends the same expression or function as the statement.
+func (c *compiler) compileStatementExpression(expression ast.Expression) {
+	switch expression := expression.(type) {
+	case *ast.IfExpression:
+		c.compileIfExpression(expression, c.compileStatements)
+	case *ast.TryExpression:
+		c.compileTryExpression(expression)
+	default:
+		c.compileExpression(expression)
+	}
+}
+
+// compileReturn returns the value on the top of the stack from the function, or ends the return target with it,
+// leaving the try expressions entered inside the target.
+func (c *compiler) compileReturn() {
+	if c.target == nil {
+		c.emit(OpReturn)
+		return
+	}
+	c.emit(OpReturnValue)
+	for i := len(c.unwind) - 1; i >= c.target.unwind; i-- {
+		c.emit(c.unwind[i])
+	}
+	c.target.jumps = append(c.target.jumps, c.emit(OpJump, 0))
+}
+
+// compileTarget compiles an if or try expression by compile, as the target of the return statements in it.
+func (c *compiler) compileTarget(compile func()) {
+	outer := c.target
+	c.target = &returnTarget{unwind: len(c.unwind)}
+	compile()
+	for _, jump := range c.target.jumps {
+		c.patch(jump, len(c.instructions))
+	}
+	c.target = outer
+}
+
+func (c *compiler) compileExpression(expression ast.Expression) {
+	outer := c.line
+	c.line = expression.Line()
+	defer func() { c.line = outer }()
+
+	switch expression := expression.(type) {
+	case *ast.IntegerLiteral:
+		c.emit(OpConstant, c.addConstant(&object.Integer{Value: expression.Value}))
+	case *ast.StringLiteral:
+		c.emit(OpConstant, c.addConstant(&object.String{Value: expression.Value}))
+	case *ast.BooleanLiteral:
+		if expression.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case *ast.Identifier:
+		c.compileIdentifier(expression)
+	case *ast.PrefixExpression:
+		c.compileExpression(expression.Right)
+		c.emit(OpPrefix, c.addNode(expression))
+	case *ast.InfixExpression:
+		c.compileExpression(expression.Left)
+		c.compileExpression(expression.Right)
+		op, ok := infixOpcodes[expression.Operator]
+		if !ok {
+			op = OpInfix
+		}
+		c.emit(op, c.addNode(expression))
+	case *ast.IfExpression:
+		c.compileTarget(func() { c.compileIfExpression(expression, c.compileStatements) })
+	case *ast.FunctionLiteral:
+		c.emit(OpClosure, c.addConstant(c.compileFunction(expression)))
+	case *ast.MacroLiteral:
+		if c.err == nil {
+			c.err = &CompileError{line: expression.Line(), msg: fmt.Sprintf("macro can only be defined by top-level var statement: %s", expression)}
+		}
+	case *ast.FunctionCall:
+		if isCallOf(expression, "quote") {
+			c.compileQuote(expression.Arguments[0])
+			return
+		}
+		for _, argument := range expression.Arguments {
+			c.compileExpression(argument)
+		}
+		c.compileExpression(expression.Function)
+		c.emit(OpCall, c.addNode(expression), len(expression.Arguments))
+	case *ast.MethodCall:
+		c.compileExpression(expression.Receiver)
+		for _, argument := range expression.Arguments {
+			c.compileExpression(argument)
+		}
+		c.compileExpression(expression.Method)
+		c.emit(OpCall, c.addNode(expression), len(expression.Arguments)+1)
+	case *ast.ArrayLiteral:
+		for _, element := range expression.Elements {
+			c.compileExpression(element)
+		}
+		c.emit(OpArray, len(expression.Elements))
+	case *ast.ArrayComprehension:
+		c.emit(OpArray, 0)
+		c.compileComprehensionClauses(expression, 0)
+	case *ast.IndexExpression:
+		c.compileExpression(expression.Array)
+		c.compileExpression(expression.Index)
+		c.emit(OpIndex, c.addNode(expression))
+	case *ast.FieldExpression:
+		c.compileExpression(expression.Object)
+		c.emit(OpField, c.addNode(expression))
+	case *ast.TryExpression:
+		c.compileTarget(func() { c.compileTryExpression(expression) })
+	default:
+		if c.err == nil {
+			c.err = &CompileError{line: expression.Line(), msg: fmt.Sprintf("unable to compile expression: %+v (%T)", expression, expression)}
+		}
+	}
+}
+
+// infixOpcodes are the opcodes of the operators applied by an instruction of their own, which the others are by OpInfix.
+var infixOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSubtract,
+	"*":  OpMultiply,
+	"/":  OpDivide,
+	"%":  OpModulo,
+	">":  OpGreater,
+	"<":  OpLess,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+}
+
+// compileIdentifier reads the variable from the innermost of the scopes declaring the name which has been set.
+// a name declared by none of them is looked up among the builtin functions when executed.
+// a name declared by a single scope is read from its slot by OpGetLocal, without searching the locations.
+func (c *compiler) compileIdentifier(identifier *ast.Identifier) {
+	variable := &Variable{Identifier: identifier}
+	depth := 0
+	for s := c.scope; s != nil; s = s.outer {
+		if s.hoisted[identifier.Name] {
+			variable.Locations = append(variable.Locations, Location{Depth: depth, Index: s.slot(identifier.Name)})
+		}
+		depth++
+	}
+	c.bytecode.Variables = append(c.bytecode.Variables, variable)
+	if len(variable.Locations) == 1 && variable.Locations[0].Depth <= maxLocalDepth {
+		location := variable.Locations[0]
+		c.emit(OpGetLocal, location.Depth, location.Index, len(c.bytecode.Variables)-1)
+		return
+	}
+	c.emit(OpGetVariable, len(c.bytecode.Variables)-1)
+}
+
+// maxLocalDepth is the largest depth of the operand of OpGetLocal, which is 1 byte wide.
+const maxLocalDepth = 1<<8 - 1
+
+// compileIfExpression compiles the branches by compileBranch.
+func (c *compiler) compileIfExpression(ifExpression *ast.IfExpression, compileBranch func([]ast.Statement)) {
+	c.compileExpression(ifExpression.Condition)
+	jumpToAlternative := c.emit(OpJumpIfFalsy, 0)
+	compileBranch(ifExpression.Consequence.Statements)
+	jumpToEnd := c.emit(OpJump, 0)
+
+	c.patch(jumpToAlternative, len(c.instructions))
+	if ifExpression.Alternative == nil {
+		c.emit(OpNull)
+	} else {
+		compileBranch(ifExpression.Alternative.Statements)
+	}
+	c.patch(jumpToEnd, len(c.instructions))
+}
+
+// compileTailStatements compiles the statements of a function body, or of a branch of if in it,
+// with the calls in tail position compiled to OpTailCall: the returned values and, if tail, the value of the statements.
+// they are the same as the ones applied by the loop of evaluator.Eval rather than by recursion.
+func (c *compiler) compileTailStatements(statements []ast.Statement, tail bool) {
+	if len(statements) == 0 {
+		c.emit(OpNil)
+		return
+	}
+	for i, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.ReturnStatement:
+			c.compileTailExpression(statement.Expression, true)
+			c.emit(OpReturn)
+		case *ast.ExpressionStatement:
+			c.compileTailExpression(statement.Expression, tail && i == len(statements)-1)
+		default:
+			c.compileStatement(statement)
+		}
+		if i < len(statements)-1 {
+			c.emit(OpPop)
+		}
+	}
+}
+
+func (c *compiler) compileTailExpression(expression ast.Expression, tail bool) {
+	switch expression := expression.(type) {
+	case *ast.FunctionCall:
+		if tail && !isCallOf(expression, "quote") {
+			for _, argument := range expression.Arguments {
+				c.compileExpression(argument)
+			}
+			c.compileExpression(expression.Function)
+			c.emit(OpTailCall, c.addNode(expression), len(expression.Arguments))
+			return
+		}
+	case *ast.MethodCall:
+		if tail {
+			c.compileExpression(expression.Receiver)
+			for _, argument := range expression.Arguments {
+				c.compileExpression(argument)
+			}
+			c.compileExpression(expression.Method)
+			c.emit(OpTailCall, c.addNode(expression), len(expression.Arguments)+1)
+			return
+		}
+	case *ast.IfExpression:
+		c.compileIfExpression(expression, func(statements []ast.Statement) {
+			c.compileTailStatements(statements, tail)
+		})
+		return
+	}
+	c.compileStatementExpression(expression)
+}
+
+func (c *compiler) compileFunction(functionLiteral *ast.FunctionLiteral) *object.CompiledFunction {
+	outerInstructions, outerTarget, outerUnwind := c.instructions, c.target, c.unwind
+	c.instructions, c.target, c.unwind = nil, nil, nil
+	c.enter()
+	for i, parameter := range functionLiteral.Parameters {
+		c.scope.parameter(parameter.Name, i)
+	}
+	c.scope.hoist(functionLiteral.Body)
+
+	// the value of the body of a generator is discarded, so the calls in it are not in tail position, as in evaluator.Eval.
+	generator := ast.Yields(functionLiteral.Body)
+	if generator {
+		c.compileStatements(functionLiteral.Body.Statements)
+	} else {
+		c.compileTailStatements(functionLiteral.Body.Statements, true)
+	}
+	c.emit(OpReturn)
+	function := &object.CompiledFunction{Instructions: c.instructions, NumSlots: c.scope.size, Generator: generator, Closures: definesFunctions(functionLiteral.Body), Literal: functionLiteral}
+
+	c.leave()
+	c.instructions, c.target, c.unwind = outerInstructions, outerTarget, outerUnwind
+	return function
+}
+
+// definesFunctions reports whether body defines functions, which can keep the scope of a call after it returns.
+func definesFunctions(body *ast.BlockStatement) bool {
+	defines := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); ok {
+			defines = true
+		}
+		return !defines
+	})
+	return defines
+}
+
+// compileComprehensionClauses compiles a loop over the clause at index which appends the elements
+// to the array below the iterators of the enclosing clauses, entering a scope per iteration.
+func (c *compiler) compileComprehensionClauses(arrayComprehension *ast.ArrayComprehension, index int) {
+	clauses := arrayComprehension.Clauses
+	if index == len(clauses) {
+		c.compileExpression(arrayComprehension.Element)
+		c.emit(OpAppend, len(clauses))
+		return
+	}
+
+	clause := clauses[index]
+	c.compileExpression(clause.Iterable)
+	c.emit(OpIterate, c.addNode(clause))
+	loop := c.emit(OpNext, 0)
+	enterScope := c.emit(OpEnterScope, 0)
+
+	c.enter()
+	variable := c.scope.declare(clause.Variable.Name)
+	c.scope.hoist(clause.Condition)
+	if index+1 < len(clauses) {
+		c.scope.hoist(clauses[index+1].Iterable)
+	} else {
+		c.scope.hoist(arrayComprehension.Element)
+	}
+	c.emit(OpSetLocal, variable)
+	jumpToNext := -1
+	if clause.Condition != nil {
+		c.compileExpression(clause.Condition)
+		jumpToNext = c.emit(OpJumpIfFalsy, 0)
+	}
+	c.compileComprehensionClauses(arrayComprehension, index+1)
+	c.patch(enterScope, c.scope.size)
+	c.leave()
+
+	if jumpToNext >= 0 {
+		c.patch(jumpToNext, len(c.instructions))
+	}
+	c.emit(OpLeaveScope)
+	c.emit(OpJump, loop)
+	c.patch(loop, len(c.instructions))
+}
+
+// compileTryExpression installs a handler around the body. when an error is raised,
+// the stack is restored to the one at OpSetupTry and the error is pushed for the parameter.
+func (c *compiler) compileTryExpression(tryExpression *ast.TryExpression) {
+	setupTry := c.emit(OpSetupTry, 0)
+	c.unwind = append(c.unwind, OpPopTry)
+	c.compileStatements(tryExpression.Body.Statements)
+	c.unwind = c.unwind[:len(c.unwind)-1]
+	c.emit(OpPopTry)
+	jumpToEnd := c.emit(OpJump, 0)
+
+	c.patch(setupTry, len(c.instructions))
+	enterScope := c.emit(OpEnterScope, 0)
+	c.enter()
+	c.emit(OpSetLocal, c.scope.declare(tryExpression.Parameter.Name))
+	c.scope.hoist(tryExpression.Handler)
+	c.unwind = append(c.unwind, OpLeaveScope)
+	c.compileStatements(tryExpression.Handler.Statements)
+	c.unwind = c.unwind[:len(c.unwind)-1]
+	c.patch(enterScope, c.scope.size)
+	c.leave()
+	c.emit(OpLeaveScope)
+
+	c.patch(jumpToEnd, len(c.instructions))
+}
+
+// compileQuote compiles the arguments of the unquote calls in quoted, in the order they are spliced.
+func (c *compiler) compileQuote(quoted ast.Node) {
+	count := 0
+	ast.Inspect(quoted, func(node ast.Node) bool {
+		if isCallOf(node, "unquote") {
+			c.compileExpression(node.(*ast.FunctionCall).Arguments[0])
+			count++
+			return false
+		}
+		return true
+	})
+	c.emit(OpQuote, c.addNode(quoted), count)
+}
+
+func isCallOf(node ast.Node, name string) bool {
+	functionCall, ok := node.(*ast.FunctionCall)
+	if !ok || len(functionCall.Arguments) != 1 {
+		return false
+	}
+	identifier, ok := functionCall.Function.(*ast.Identifier)
+	return ok && identifier.Name == name
+}
@@ -0,0 +1,253 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		desc     string
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{desc: "no operand", op: OpPop, operands: []int{}, expected: []byte{byte(OpPop)}},
+		{desc: "2 bytes", op: OpConstant, operands: []int{65534}, expected: []byte{byte(OpConstant), 255, 254}},
+		{desc: "2 and 1 bytes", op: OpCall, operands: []int{258, 3}, expected: []byte{byte(OpCall), 1, 2, 3}},
+		{desc: "1 and 2 bytes", op: OpGetLocal, operands: []int{3, 258, 1}, expected: []byte{byte(OpGetLocal), 3, 1, 2, 0, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			instruction, err := Make(tt.op, tt.operands...)
+			if err != nil {
+				t.Fatalf("make error: %s\n", err)
+			}
+			if !reflect.DeepEqual(instruction, tt.expected) {
+				t.Fatalf("instruction wrong.\nwant=%v\ngot=%v\n", tt.expected, instruction)
+			}
+
+			definition, err := Lookup(tt.op)
+			if err != nil {
+				t.Fatalf("definition not found: %s\n", err)
+			}
+			operands, read := ReadOperands(definition, instruction[1:])
+			if read != len(instruction)-1 || !reflect.DeepEqual(operands, tt.operands) {
+				t.Errorf("operands wrong.\nwant=%v\ngot=%v (%d bytes)\n", tt.operands, operands, read)
+			}
+		})
+	}
+}
+
+func TestMake_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		op       Opcode
+		operands []int
+		expected string
+	}{
+		{desc: "2 bytes", op: OpConstant, operands: []int{65536}, expected: "operand 1 of OpConstant out of range: want 0 to 65535, got 65536"},
+		{desc: "1 byte", op: OpCall, operands: []int{0, 256}, expected: "operand 2 of OpCall out of range: want 0 to 255, got 256"},
+		{desc: "negative", op: OpJump, operands: []int{-1}, expected: "operand 1 of OpJump out of range: want 0 to 65535, got -1"},
+		{desc: "undefined", op: Opcode(255), operands: []int{}, expected: "opcode 255 undefined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := Make(tt.op, tt.operands...)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("error wrong.\nwant=%s\ngot=%v\n", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:  "var statement",
+			input: "var x = 1; -x",
+			expected: "0000 OpConstant 0\n" +
+				"0003 OpSetLocal 0\n" +
+				"0006 OpNil\n" +
+				"0007 OpPop\n" +
+				"0008 OpGetLocal 0 0 0\n" +
+				"0014 OpPrefix 0\n" +
+				"0017 OpReturn\n",
+		},
+		{
+			desc:  "if expression",
+			input: "if (true) { 1 }",
+			expected: "0000 OpTrue\n" +
+				"0001 OpJumpIfFalsy 10\n" +
+				"0004 OpConstant 0\n" +
+				"0007 OpJump 11\n" +
+				"0010 OpNull\n" +
+				"0011 OpReturn\n",
+		},
+		{
+			desc:  "function call",
+			input: "f(1, 2)",
+			expected: "0000 OpConstant 0\n" +
+				"0003 OpConstant 1\n" +
+				"0006 OpGetVariable 0\n" +
+				"0009 OpCall 0 2\n" +
+				"0013 OpReturn\n",
+		},
+		{
+			desc:  "try expression",
+			input: "try { 1 } catch (e) { e }",
+			expected: "0000 OpSetupTry 10\n" +
+				"0003 OpConstant 0\n" +
+				"0006 OpPopTry\n" +
+				"0007 OpJump 23\n" +
+				"0010 OpEnterScope 1\n" +
+				"0013 OpSetLocal 0\n" +
+				"0016 OpGetLocal 0 0 0\n" +
+				"0022 OpLeaveScope\n" +
+				"0023 OpReturn\n",
+		},
+		{
+			desc:  "return in array element",
+			input: "[try { return 1 } catch (e) { e }]",
+			expected: "0000 OpSetupTry 15\n" +
+				"0003 OpConstant 0\n" +
+				"0006 OpReturnValue\n" +
+				"0007 OpPopTry\n" +
+				"0008 OpJump 28\n" +
+				"0011 OpPopTry\n" +
+				"0012 OpJump 28\n" +
+				"0015 OpEnterScope 1\n" +
+				"0018 OpSetLocal 0\n" +
+				"0021 OpGetLocal 0 0 0\n" +
+				"0027 OpLeaveScope\n" +
+				"0028 OpArray 1\n" +
+				"0031 OpReturn\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+			if err != nil {
+				t.Fatalf("parse error: %s\n", err)
+			}
+			bytecode, err := Compile(program)
+			if err != nil {
+				t.Fatalf("compile error: %s\n", err)
+			}
+			if bytecode.Instructions.String() != tt.expected {
+				t.Errorf("instructions wrong.\nwant=\n%s\ngot=\n%s\n", tt.expected, bytecode.Instructions)
+			}
+		})
+	}
+}
+
+func TestCompile_TailCall(t *testing.T) {
+	program, err := parser.New(lexer.New("|n| { if (n) { f(n) } else { g(n) + 1 } }")).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err)
+	}
+	bytecode, err := Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %s\n", err)
+	}
+
+	function, ok := bytecode.Constants[1].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("not a compiled function: %+v\n", bytecode.Constants[1])
+	}
+	expected := "0000 OpGetLocal 0 0 0\n" +
+		"0006 OpJumpIfFalsy 25\n" +
+		"0009 OpGetLocal 0 0 1\n" +
+		"0015 OpGetVariable 2\n" +
+		"0018 OpTailCall 0 1\n" +
+		"0022 OpJump 44\n" +
+		"0025 OpGetLocal 0 0 3\n" +
+		"0031 OpGetVariable 4\n" +
+		"0034 OpCall 1 1\n" +
+		"0038 OpConstant 0\n" +
+		"0041 OpAdd 2\n" +
+		"0044 OpReturn\n"
+	if Instructions(function.Instructions).String() != expected {
+		t.Errorf("instructions wrong.\nwant=\n%s\ngot=\n%s\n", expected, Instructions(function.Instructions))
+	}
+}
+
+func TestCompile_Variables(t *testing.T) {
+	program, err := parser.New(lexer.New("var x = 1; var f = |y| { [x, y, len] }")).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err)
+	}
+	bytecode, err := Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %s\n", err)
+	}
+
+	expected := map[string][]Location{
+		"x":   {{Depth: 1, Index: 0}},
+		"y":   {{Depth: 0, Index: 0}},
+		"len": nil,
+	}
+	for _, variable := range bytecode.Variables {
+		if !reflect.DeepEqual(variable.Locations, expected[variable.Identifier.Name]) {
+			t.Errorf("locations of %s wrong.\nwant=%v\ngot=%v\n", variable.Identifier.Name, expected[variable.Identifier.Name], variable.Locations)
+		}
+	}
+}
+
+// the operands of the instructions compiled at their limits, and beyond them, which are reported instead of wrapped around.
+func TestCompile_OperandRange(t *testing.T) {
+	arguments := func(n int) string { return "|| { 0 }(" + strings.Repeat("1, ", n-1) + "1)" }
+	constants := func(n int) string { return strings.Repeat("1;\n", n-1) + "1" }
+	variables := func(n int) string {
+		var out strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&out, "var v%d = true;\n", i)
+		}
+		return out.String()
+	}
+	jump := func(n int) string { return "if (true) {\n" + strings.Repeat("true;\n", n) + "}" }
+	tests := []struct {
+		desc     string
+		input    string
+		expected string // the error, or empty if the program is compiled
+	}{
+		{desc: "arguments", input: arguments(255)},
+		{desc: "too many arguments", input: arguments(256), expected: "line 1: operand 2 of OpCall out of range: want 0 to 255, got 256"},
+		{desc: "constants", input: constants(1 << 16)},
+		{desc: "too many constants", input: constants(1<<16 + 1), expected: "line 65537: operand 1 of OpConstant out of range: want 0 to 65535, got 65536"},
+		{desc: "variables", input: variables(1 << 16)},
+		{desc: "too many variables", input: variables(1<<16 + 1), expected: "line 65537: operand 1 of OpSetLocal out of range: want 0 to 65535, got 65536"},
+		{desc: "jump too far", input: jump(1 << 15), expected: "line 1: operand 1 of OpJumpIfFalsy out of range: want 0 to 65535, got 65542"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+			if err != nil {
+				t.Fatalf("parse error: %s\n", err)
+			}
+			_, err = Compile(program)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("compile error: %s\n", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("error wrong.\nwant=%s\ngot=%v\n", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DIFF_CONTEXT = 3
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns the differences between before and after in the unified format.
+func unifiedDiff(filename, before, after string) string {
+	lines := diffLines(splitLines(before), splitLines(after))
+
+	// oldLines[i] and newLines[i] are the numbers of the old and new lines preceding lines[i].
+	oldLines := make([]int, len(lines)+1)
+	newLines := make([]int, len(lines)+1)
+	for i, line := range lines {
+		oldLines[i+1], newLines[i+1] = oldLines[i], newLines[i]
+		if line.op != '+' {
+			oldLines[i+1]++
+		}
+		if line.op != '-' {
+			newLines[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("--- %s.orig\n+++ %s\n", filename, filename))
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk while the next change is close enough to share the context.
+		last := i
+		for j := i; j < len(lines) && j-last <= 2*DIFF_CONTEXT; j++ {
+			if lines[j].op != ' ' {
+				last = j
+			}
+		}
+		start := i - DIFF_CONTEXT
+		if start < 0 {
+			start = 0
+		}
+		end := last + DIFF_CONTEXT + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		out.WriteString(fmt.Sprintf("@@ -%s +%s @@\n",
+			hunkRange(oldLines[start], oldLines[end]-oldLines[start]),
+			hunkRange(newLines[start], newLines[end]-newLines[start])))
+		for _, line := range lines[start:end] {
+			out.WriteString(string(line.op) + line.text + "\n")
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(preceding, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", preceding)
+	}
+	return fmt.Sprintf("%d,%d", preceding+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the shortest edit from before to after using their longest common subsequence.
+func diffLines(before, after []string) []diffLine {
+	// common[i][j] is the length of the longest common subsequence of before[i:] and after[j:].
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			lines = append(lines, diffLine{op: ' ', text: before[i]})
+			i++
+			j++
+		case j == len(after) || i < len(before) && common[i+1][j] >= common[i][j+1]:
+			lines = append(lines, diffLine{op: '-', text: before[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{op: '+', text: after[j]})
+			j++
+		}
+	}
+	return lines
+}
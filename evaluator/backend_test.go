@@ -0,0 +1,28 @@
+package evaluator_test
+
+import (
+	"context"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/compiler"
+	"github.com/muiscript/ether/evaluator"
+	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/vm"
+)
+
+// the tests of Eval run the programs with package vm as well.
+func init() {
+	evaluator.RunCompiled = func(program *ast.Program) (object.Object, error) {
+		bytecode, err := compiler.Compile(program)
+		if err != nil {
+			return nil, err
+		}
+		return vm.New(bytecode).Run()
+	}
+	evaluator.RunScheduled = func(program *ast.Program, scheduler evaluator.Scheduler) (object.Object, error) {
+		bytecode, err := compiler.Compile(program)
+		if err != nil {
+			return nil, err
+		}
+		return vm.New(bytecode).RunWithScheduler(context.Background(), scheduler)
+	}
+}
@@ -1,13 +1,126 @@
 package evaluator
 
-import "fmt"
+import (
+	"fmt"
+	"github.com/muiscript/ether/object"
+	"runtime/debug"
+	"strings"
+)
+
+// kinds of EvalError. they are exposed to scripts as the kind field of a caught error.
+const (
+	RUNTIME_ERROR    = "RuntimeError"
+	TYPE_ERROR       = "TypeError"
+	NAME_ERROR       = "NameError"
+	INDEX_ERROR      = "IndexError"
+	ARGUMENT_ERROR   = "ArgumentError"
+	THROWN_ERROR     = "Error"
+	LIMIT_ERROR      = "LimitError"
+	ARITHMETIC_ERROR = "ArithmeticError"
+	INTERNAL_ERROR   = "InternalError"
+)
 
 type EvalError struct {
 	error
-	line int
-	msg  string
+	line   int
+	msg    string
+	kind   string
+	thrown *object.Error
+	limit  string // the name of the limit exceeded by a LIMIT_ERROR
+	stack  *CallStack
+	traced bool // whether stack is attached, which is nil for the errors raised outside of functions
+	panic  []byte
+}
+
+// NewEvalError returns an error of kind raised at line, for the backends other than Eval such as package vm.
+func NewEvalError(line int, msg string, kind string) *EvalError {
+	return &EvalError{line: line, msg: msg, kind: kind}
+}
+
+// NotFunctionError returns the error of the builtin function named builtin whose argument, such as "second argument",
+// is got instead of a function. the message names the type of got as scripts see it, which is the same for every backend.
+func NotFunctionError(builtin string, argument string, got object.Object) *EvalError {
+	return &EvalError{line: 1, msg: fmt.Sprintf("%s: %s must be a function, got %s", builtin, argument, got.Type()), kind: TYPE_ERROR}
 }
 
 func (ee *EvalError) Error() string {
 	return fmt.Sprintf("line %d: %s", ee.line, ee.msg)
 }
+
+func (ee *EvalError) Kind() string {
+	if ee.kind == "" {
+		return RUNTIME_ERROR
+	}
+	return ee.kind
+}
+
+// Limit returns the name of the limit exceeded, such as STEPS_LIMIT, or "" if the error is not a LIMIT_ERROR.
+func (ee *EvalError) Limit() string {
+	return ee.limit
+}
+
+// Trace returns the function calls being evaluated when the error is raised, from the outermost one.
+func (ee *EvalError) Trace() []Frame {
+	return ee.stack.Frames()
+}
+
+// Catchable reports whether the error is caught by try. an INTERNAL_ERROR is not, since the state of the evaluation is broken,
+// even if it is returned by a generator or a task which recovered the panic on a goroutine of its own.
+// nor is a LIMIT_ERROR, so that a script cannot go on running once it exceeds a limit, as it cannot once it is canceled.
+func (ee *EvalError) Catchable() bool {
+	return ee.kind != INTERNAL_ERROR && ee.kind != LIMIT_ERROR
+}
+
+// PanicStack returns the stack of the goroutine which panicked for an INTERNAL_ERROR, or nil for the other errors.
+func (ee *EvalError) PanicStack() []byte {
+	return ee.panic
+}
+
+// Recovered returns an error of kind INTERNAL_ERROR for recovered, the value of a panic in the innermost call of stack.
+// it must be called by the deferred function recovering the panic, so that the stack of the panic is recorded.
+func Recovered(recovered interface{}, stack *CallStack) *EvalError {
+	line := 1
+	if frames := stack.Frames(); len(frames) > 0 {
+		line = frames[len(frames)-1].Line
+	}
+	evalError := &EvalError{line: line, msg: fmt.Sprintf("internal error: %v", recovered), kind: INTERNAL_ERROR, panic: debug.Stack()}
+	Traced(evalError, stack)
+	return evalError
+}
+
+// Object converts the error into a value which can be bound by catch.
+func (ee *EvalError) Object() *object.Error {
+	if ee.thrown != nil {
+		return ee.thrown
+	}
+	return &object.Error{Message: scriptMessage(ee.msg), Kind: ee.Kind(), Line: ee.line}
+}
+
+// scriptMessage formats msg, which may span several lines such as "...wrong:\nwant=1\ngot=2\n",
+// as the message of a caught error on one line: "...wrong: want=1, got=2".
+func scriptMessage(msg string) string {
+	msg = strings.TrimRight(msg, "\n")
+	msg = strings.ReplaceAll(msg, ":\n", ": ")
+	return strings.ReplaceAll(msg, "\n", ", ")
+}
+
+// CancelError is returned when the context of an evaluation is done.
+// unlike EvalError, it cannot be caught by try, so a script cannot keep running after it is canceled.
+type CancelError struct {
+	line int
+	err  error
+}
+
+// NewCancelError returns an error of the done context whose error is err, noticed at line.
+func NewCancelError(line int, err error) *CancelError {
+	return &CancelError{line: line, err: err}
+}
+
+func (ce *CancelError) Error() string {
+	return fmt.Sprintf("line %d: evaluation canceled: %s", ce.line, ce.err)
+}
+
+// Unwrap returns the error of the context, context.Canceled or context.DeadlineExceeded.
+func (ce *CancelError) Unwrap() error {
+	return ce.err
+}
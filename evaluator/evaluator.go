@@ -1,9 +1,12 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/format"
 	"github.com/muiscript/ether/object"
+	"strings"
 )
 
 var (
@@ -27,144 +30,217 @@ func init() {
 		"len": {
 			Fn: func(args ...object.Object) (object.Object, error) {
 				if len(args) != 1 {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for len wrong: want=%d got=%d\n", 1, len(args))}
+					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for len wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
 				}
 				array, ok := args[0].(*object.Array)
 				if !ok {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for len wrong: want=%T\ngot=%T\n", &object.Array{}, array)}
+					return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for len wrong: want=%T\ngot=%T\n", &object.Array{}, args[0]), kind: TYPE_ERROR}
 				}
 
 				return &object.Integer{Value: len(array.Elements)}, nil
 			},
 		},
-		"map": {
+		"error": {
 			Fn: func(args ...object.Object) (object.Object, error) {
-				if len(args) != 2 {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for map wrong: want=%d got=%d\n", 2, len(args))}
-				}
-				array, ok := args[0].(*object.Array)
-				if !ok {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for map wrong: want=%T\ngot=%T\n", &object.Array{}, array)}
+				if len(args) != 1 && len(args) != 2 {
+					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for error wrong: want=%d or %d got=%d\n", 1, 2, len(args)), kind: ARGUMENT_ERROR}
 				}
-				function, ok := args[1].(*object.Function)
+				message, ok := args[0].(*object.String)
 				if !ok {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("second argument type for map wrong: want=%T\ngot=%T\n", &object.Function{}, function)}
+					return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for error wrong: want=%T\ngot=%T\n", &object.String{}, args[0]), kind: TYPE_ERROR}
 				}
-				if len(function.Parameters) != 1 {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of parameters of map function wrong: want=%T\ngot=%T\n", 1, len(function.Parameters))}
+				if len(args) == 1 {
+					return &object.Error{Message: message.Value, Kind: THROWN_ERROR}, nil
 				}
-
-				var convertedElems []object.Object
-				for _, elem := range array.Elements {
-					enclosedEnv := object.NewEnclosedEnvironment(function.Env)
-					enclosedEnv.Set(function.Parameters[0].Name, elem)
-
-					evaluated, err := Eval(function.Body, enclosedEnv)
-					if err != nil {
-						return nil, err
-					}
-					convertedElems = append(convertedElems, evaluated)
+				kind, ok := args[1].(*object.String)
+				if !ok {
+					return nil, &EvalError{line: 1, msg: fmt.Sprintf("second argument type for error wrong: want=%T\ngot=%T\n", &object.String{}, args[1]), kind: TYPE_ERROR}
 				}
-
-				return &object.Array{Elements: convertedElems}, nil
+				return &object.Error{Message: message.Value, Kind: kind.Value}, nil
 			},
 		},
-		"filter": {
+		"source": {
 			Fn: func(args ...object.Object) (object.Object, error) {
-				if len(args) != 2 {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for filter wrong: want=%d got=%d\n", 2, len(args))}
-				}
-				array, ok := args[0].(*object.Array)
-				if !ok {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for filter wrong: want=%T\ngot=%T\n", &object.Array{}, array)}
+				if len(args) != 1 {
+					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for source wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
 				}
-				function, ok := args[1].(*object.Function)
+				quoted, ok := args[0].(*object.Quote)
 				if !ok {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("second argument type for filter wrong: want=%T\ngot=%T\n", &object.Function{}, function)}
-				}
-				if len(function.Parameters) != 1 {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of parameters of filter function wrong: want=%T\ngot=%T\n", 1, len(function.Parameters))}
+					return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for source wrong: want=%T\ngot=%T\n", &object.Quote{}, args[0]), kind: TYPE_ERROR}
 				}
 
-				var filteredElems []object.Object
-				for _, elem := range array.Elements {
-					enclosedEnv := object.NewEnclosedEnvironment(function.Env)
-					enclosedEnv.Set(function.Parameters[0].Name, elem)
-
-					evaluated, err := Eval(function.Body, enclosedEnv)
-					if err != nil {
-						return nil, err
-					}
-					if evaluated != NULL_OBJ && evaluated != FALSE_OBJ {
-						filteredElems = append(filteredElems, elem)
-					}
+				if quoted.Source != "" {
+					return &object.String{Value: quoted.Source}, nil
 				}
-
-				return &object.Array{Elements: filteredElems}, nil
+				formatted, err := format.Node(quoted.Node)
+				if err != nil {
+					return &object.String{Value: quoted.Node.String()}, nil
+				}
+				return &object.String{Value: strings.TrimSuffix(string(formatted), "\n")}, nil
+			},
+		},
+		"map": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return newEvaluator(context.Background()).builtinMap(args...)
+			},
+		},
+		"filter": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return newEvaluator(context.Background()).builtinFilter(args...)
 			},
 		},
 		"reduce": {
 			Fn: func(args ...object.Object) (object.Object, error) {
-				if len(args) != 3 {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for reduce wrong: want=%d got=%d\n", 3, len(args))}
-				}
+				return newEvaluator(context.Background()).builtinReduce(args...)
+			},
+		},
+		"take": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return newEvaluator(context.Background()).builtinTake(args...)
+			},
+		},
+		"to_array": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return newEvaluator(context.Background()).builtinToArray(args...)
+			},
+		},
+		"iterate":    {Fn: builtinIterate},
+		"range_from": {Fn: builtinRangeFrom},
+		"spawn": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return newEvaluator(context.Background()).builtinSpawn(args...)
+			},
+		},
+		"wait": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return Wait(NewParallelScheduler(), args...)
+			},
+		},
+		"channel": {Fn: builtinChannel},
+		"send": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return Send(NewParallelScheduler(), args...)
+			},
+		},
+		"recv": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return Recv(NewParallelScheduler(), args...)
+			},
+		},
+		"close": {
+			Fn: func(args ...object.Object) (object.Object, error) {
+				return Close(NewParallelScheduler(), args...)
+			},
+		},
+	}
+}
 
-				array, ok := args[0].(*object.Array)
-				if !ok {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for reduce wrong: want=%T\ngot=%T\n", &object.Array{}, array)}
-				}
+// IsBuiltin reports whether name is the name of a builtin function.
+func IsBuiltin(name string) bool {
+	_, ok := builtinFunctions[name]
+	return ok
+}
 
-				initValue := args[1]
+// LookupBuiltin returns the builtin function named name.
+func LookupBuiltin(name string) (*object.BuiltinFunction, bool) {
+	builtin, ok := builtinFunctions[name]
+	return builtin, ok
+}
 
-				function, ok := args[2].(*object.Function)
-				if !ok {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("second argument type for reduce wrong: want=%T\ngot=%T\n", &object.Function{}, function)}
-				}
-				if len(function.Parameters) != 2 {
-					return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of parameters of reduce function wrong: want=%T\ngot=%T\n", 2, len(function.Parameters))}
-				}
+// MaxCallDepth is the maximum number of nested function calls in an evaluation.
+// the calls in tail position do not nest, so a tail-recursive function can recur any number of times.
+const MaxCallDepth = 10000
 
-				var accumulated = initValue
-				for _, elem := range array.Elements {
-					enclosedEnv := object.NewEnclosedEnvironment(function.Env)
-					enclosedEnv.Set(function.Parameters[0].Name, accumulated)
-					enclosedEnv.Set(function.Parameters[1].Name, elem)
-
-					evaluated, err := Eval(function.Body, enclosedEnv)
-					if err != nil {
-						return nil, err
-					}
-					accumulated = evaluated
-				}
+// Eval evaluates node in env and returns its value. node is resolved by a Resolver, which assigns the slots
+// the variables are stored in. a program which is not resolved yet is resolved first, the undefined identifiers
+// being reported when they are evaluated. a resolved node is only read, so that the same program can be evaluated
+// by several evaluations at once, but it must be resolved before, since the resolution modifies it.
+func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
+	return EvalContext(context.Background(), node, env)
+}
 
-				return accumulated, nil
-			},
-		},
+// EvalContext evaluates node in env as Eval does, but returns a CancelError once ctx is done.
+// ctx is checked at every function call and at every iteration of map, filter, reduce, streams and array comprehensions.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) (object.Object, error) {
+	return newEvaluator(ctx).evalRecovering(node, env)
+}
+
+// evaluator holds the state of an evaluation, or of the body of a generator or a task spawned by it.
+type evaluator struct {
+	ctx       context.Context
+	limits    Limits
+	usage     *usage // shared with the evaluators of the generators and the tasks
+	depth     int    // the number of the function calls being evaluated
+	stack     *CallStack
+	yield     Yield // passes the values yielded by the body of a generator, nil for the other evaluations
+	scheduler Scheduler
+}
+
+// usage is the resources used by an evaluation, counted only if limited. the tasks count them at the same time.
+type usage struct {
+	steps    int64 // the number of the expressions evaluated
+	elements int64 // the number of the array elements created
+}
+
+func newEvaluator(ctx context.Context) *evaluator {
+	return &evaluator{ctx: ctx, usage: &usage{}, scheduler: NewParallelScheduler()}
+}
+
+// evalRecovering evaluates node in env,
+// converting a panic into an EvalError of kind INTERNAL_ERROR, so that a bug of the evaluator does not crash the program running it.
+// the error cannot be caught by try, since the state of the evaluation is broken.
+// the tasks still running once node is evaluated are canceled.
+func (e *evaluator) evalRecovering(node ast.Node, env *object.Environment) (evaluated object.Object, err error) {
+	e.ctx = e.scheduler.Begin(e.ctx)
+	defer e.scheduler.End()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			evaluated, err = nil, Recovered(recovered, e.stack)
+		}
+	}()
+	if program, ok := node.(*ast.Program); ok && !program.Resolved {
+		// the names declared by the programs evaluated in env before are not known, and are looked up by name.
+		NewResolver().Resolve(program)
 	}
+	return e.eval(node, env)
 }
 
-func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
+// checkContext returns a CancelError noticed at line if the context of the evaluation is done.
+func (e *evaluator) checkContext(line int) error {
+	select {
+	case <-e.ctx.Done():
+		return NewCancelError(line, e.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+func (e *evaluator) eval(node ast.Node, env *object.Environment) (object.Object, error) {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	case *ast.VarStatement:
-		return evalVarStatement(node, env)
+		return e.evalVarStatement(node, env)
 	case *ast.ReturnStatement:
-		return evalReturnStatement(node, env)
+		return e.evalReturnStatement(node, env)
+	case *ast.ThrowStatement:
+		return e.evalThrowStatement(node, env)
+	case *ast.YieldStatement:
+		return e.evalYieldStatement(node, env)
 	case *ast.ExpressionStatement:
-		return evalExpressionStatement(node, env)
+		return e.evalExpressionStatement(node, env)
 	default:
 		return nil, &EvalError{line: node.Line(), msg: fmt.Sprintf("unable to eval node: %+v (%T)", node, node)}
 	}
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) (object.Object, error) {
+func (e *evaluator) evalProgram(program *ast.Program, env *object.Environment) (object.Object, error) {
 	var evaluated object.Object
 	for _, statement := range program.Statements {
 		var err error
-		evaluated, err = Eval(statement, env)
+		evaluated, err = e.eval(statement, env)
 		if err != nil {
 			return nil, err
 		}
@@ -175,11 +251,11 @@ func evalProgram(program *ast.Program, env *object.Environment) (object.Object,
 	return evaluated, nil
 }
 
-func evalBlockStatement(blockStatement *ast.BlockStatement, env *object.Environment) (object.Object, error) {
+func (e *evaluator) evalBlockStatement(blockStatement *ast.BlockStatement, env *object.Environment) (object.Object, error) {
 	var evaluated object.Object
 	for _, statement := range blockStatement.Statements {
 		var err error
-		evaluated, err = Eval(statement, env)
+		evaluated, err = e.eval(statement, env)
 		if err != nil {
 			return nil, err
 		}
@@ -190,31 +266,79 @@ func evalBlockStatement(blockStatement *ast.BlockStatement, env *object.Environm
 	return evaluated, nil
 }
 
-func evalVarStatement(varStatement *ast.VarStatement, env *object.Environment) (object.Object, error) {
-	value, err := evalExpression(varStatement.Expression, env)
+func (e *evaluator) evalVarStatement(varStatement *ast.VarStatement, env *object.Environment) (object.Object, error) {
+	value, err := e.evalExpression(varStatement.Expression, env)
 	if err != nil {
 		return nil, err
 	}
-	env.Set(varStatement.Identifier.Name, value)
+	if !Conforms(value, varStatement.Type) {
+		return nil, &EvalError{line: varStatement.Line(), msg: fmt.Sprintf("type of %q wrong: want %s, got %s", varStatement.Identifier.Name, varStatement.Type, Describe(value)), kind: TYPE_ERROR}
+	}
+	declare(env, varStatement.Identifier, value)
 	return nil, nil
 }
 
-func evalReturnStatement(returnStatement *ast.ReturnStatement, env *object.Environment) (object.Object, error) {
-	value, err := evalExpression(returnStatement.Expression, env)
+// declare stores value in the slot of identifier, or by name if it has no location.
+func declare(env *object.Environment, identifier *ast.Identifier, value object.Object) {
+	if len(identifier.Locations) == 0 {
+		env.Set(identifier.Name, value)
+		return
+	}
+	env.SetSlot(identifier.Locations[0].Index, value)
+}
+
+func (e *evaluator) evalReturnStatement(returnStatement *ast.ReturnStatement, env *object.Environment) (object.Object, error) {
+	value, err := e.evalExpression(returnStatement.Expression, env)
 	if err != nil {
 		return nil, err
 	}
-	return &object.ReturnValue{Value: value}, nil
+	return wrapReturnValue(value), nil
+}
+
+// wrapReturnValue returns the value of a return statement returning value. the value of an if or try expression
+// returned from by a return statement in it is returned as it is, so that the inner return statement is the one returning.
+func wrapReturnValue(value object.Object) object.Object {
+	if returnValue, ok := value.(*object.ReturnValue); ok {
+		return returnValue
+	}
+	return &object.ReturnValue{Value: value}
+}
+
+func (e *evaluator) evalThrowStatement(throwStatement *ast.ThrowStatement, env *object.Environment) (object.Object, error) {
+	value, err := e.evalExpression(throwStatement.Expression, env)
+	if err != nil {
+		return nil, err
+	}
+	return nil, Throw(throwStatement, value)
+}
+
+// Throw returns the error raised by throwStatement throwing value.
+func Throw(throwStatement *ast.ThrowStatement, value object.Object) error {
+	thrown, ok := value.(*object.Error)
+	if !ok {
+		thrown = &object.Error{Message: value.String(), Kind: THROWN_ERROR, Value: value}
+	}
+	if thrown.Line == 0 {
+		located := *thrown
+		located.Line = throwStatement.Line()
+		thrown = &located
+	}
+	return &EvalError{line: throwStatement.Line(), msg: fmt.Sprintf("uncaught %s", thrown), kind: thrown.Kind, thrown: thrown}
 }
 
-func evalExpressionStatement(expressionStatement *ast.ExpressionStatement, env *object.Environment) (object.Object, error) {
-	return evalExpression(expressionStatement.Expression, env)
+func (e *evaluator) evalExpressionStatement(expressionStatement *ast.ExpressionStatement, env *object.Environment) (object.Object, error) {
+	return e.evalExpression(expressionStatement.Expression, env)
 }
 
-func evalExpression(expression ast.Expression, env *object.Environment) (object.Object, error) {
+func (e *evaluator) evalExpression(expression ast.Expression, env *object.Environment) (object.Object, error) {
+	if err := e.step(expression); err != nil {
+		return nil, err
+	}
 	switch expression := expression.(type) {
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: expression.Value}, nil
+	case *ast.StringLiteral:
+		return &object.String{Value: expression.Value}, nil
 	case *ast.BooleanLiteral:
 		if expression.Value {
 			return TRUE_OBJ, nil
@@ -222,49 +346,77 @@ func evalExpression(expression ast.Expression, env *object.Environment) (object.
 			return FALSE_OBJ, nil
 		}
 	case *ast.Identifier:
+		if expression.Scope == ast.BUILTIN {
+			if builtin, ok := builtinFunctions[expression.Name]; ok {
+				return builtin, nil
+			}
+		}
+		for _, location := range expression.Locations {
+			if value := env.Slot(location.Depth, location.Index); value != nil {
+				return value, nil
+			}
+		}
 		value := env.Get(expression.Name)
 		if value == nil {
 			if builtin, ok := builtinFunctions[expression.Name]; ok {
 				return builtin, nil
 			} else {
-				return nil, &EvalError{line: expression.Line(), msg: fmt.Sprintf("undefined identifier: %q", expression.Name)}
+				return nil, &EvalError{line: expression.Line(), msg: fmt.Sprintf("undefined identifier: %q", expression.Name), kind: NAME_ERROR}
 			}
 		}
 		return value, nil
 	case *ast.PrefixExpression:
-		return evalPrefixExpression(expression, env)
+		return e.evalPrefixExpression(expression, env)
 	case *ast.InfixExpression:
-		return evalInfixExpression(expression, env)
+		return e.evalInfixExpression(expression, env)
 	case *ast.IfExpression:
-		return evalIfExpression(expression, env)
+		return e.evalIfExpression(expression, env)
 	case *ast.FunctionLiteral:
-		return evalFunctionLiteral(expression, env)
+		return e.evalFunctionLiteral(expression, env)
+	case *ast.MacroLiteral:
+		return nil, &EvalError{line: expression.Line(), msg: fmt.Sprintf("macro can only be defined by top-level var statement: %s", expression)}
 	case *ast.FunctionCall:
-		return evalFunctionCall(expression, env)
+		return e.evalFunctionCall(expression, env)
+	case *ast.MethodCall:
+		return e.evalMethodCall(expression, env)
 	case *ast.ArrayLiteral:
-		return evalArrayLiteral(expression, env)
+		return e.evalArrayLiteral(expression, env)
+	case *ast.ArrayComprehension:
+		return e.evalArrayComprehension(expression, env)
 	case *ast.IndexExpression:
-		return evalIndexExpression(expression, env)
+		return e.evalIndexExpression(expression, env)
+	case *ast.FieldExpression:
+		return e.evalFieldExpression(expression, env)
+	case *ast.TryExpression:
+		return e.evalTryExpression(expression, env)
 	default:
 		return nil, &EvalError{line: expression.Line(), msg: fmt.Sprintf("unable to eval expression: %+v (%T)", expression, expression)}
 	}
 }
 
-func evalPrefixExpression(prefixExpression *ast.PrefixExpression, env *object.Environment) (object.Object, error) {
-	right, err := evalExpression(prefixExpression.Right, env)
+func (e *evaluator) evalPrefixExpression(prefixExpression *ast.PrefixExpression, env *object.Environment) (object.Object, error) {
+	right, err := e.evalExpression(prefixExpression.Right, env)
 	if err != nil {
 		return nil, err
 	}
+	return Prefix(prefixExpression, right)
+}
 
+// Prefix applies the operator of prefixExpression to right, the value of its operand.
+func Prefix(prefixExpression *ast.PrefixExpression, right object.Object) (object.Object, error) {
 	switch right := right.(type) {
 	case *object.Integer:
 		switch prefixExpression.Operator {
 		case "-":
-			return &object.Integer{Value: -right.Value}, nil
+			value, ok := object.Negate(right.Value)
+			if !ok {
+				return nil, &EvalError{line: prefixExpression.Line(), msg: fmt.Sprintf("integer overflow: -%d", right.Value), kind: ARITHMETIC_ERROR}
+			}
+			return &object.Integer{Value: value}, nil
 		case "!":
 			return FALSE_OBJ, nil
 		default:
-			return nil, &EvalError{line: prefixExpression.Line(), msg: fmt.Sprintf("unknown prefix operator for integer: %q", prefixExpression.Operator)}
+			return nil, &EvalError{line: prefixExpression.Line(), msg: fmt.Sprintf("unknown prefix operator for integer: %q", prefixExpression.Operator), kind: TYPE_ERROR}
 		}
 	case *object.Boolean:
 		switch prefixExpression.Operator {
@@ -275,39 +427,66 @@ func evalPrefixExpression(prefixExpression *ast.PrefixExpression, env *object.En
 				return TRUE_OBJ, nil
 			}
 		default:
-			return nil, &EvalError{line: prefixExpression.Line(), msg: fmt.Sprintf("unknown prefix operator for boolean: %q", prefixExpression.Operator)}
+			return nil, &EvalError{line: prefixExpression.Line(), msg: fmt.Sprintf("unknown prefix operator for boolean: %q", prefixExpression.Operator), kind: TYPE_ERROR}
 		}
 	default:
-		return nil, &EvalError{line: prefixExpression.Right.Line(), msg: fmt.Sprintf("invalid type for prefix expression: %+v (%T)", right, right)}
+		return nil, &EvalError{line: prefixExpression.Right.Line(), msg: fmt.Sprintf("invalid type for prefix expression: %+v (%T)", right, right), kind: TYPE_ERROR}
 	}
 }
 
-func evalInfixExpression(infixExpression *ast.InfixExpression, env *object.Environment) (object.Object, error) {
-	left, err := evalExpression(infixExpression.Left, env)
+func (e *evaluator) evalInfixExpression(infixExpression *ast.InfixExpression, env *object.Environment) (object.Object, error) {
+	left, err := e.evalExpression(infixExpression.Left, env)
 	if err != nil {
 		return nil, err
 	}
-	right, err := evalExpression(infixExpression.Right, env)
+	right, err := e.evalExpression(infixExpression.Right, env)
 	if err != nil {
 		return nil, err
 	}
+	return Infix(infixExpression, left, right)
+}
+
+// checkedInteger returns the integer of value, the result of infixExpression applied to left and right,
+// or an error if the result overflows.
+func checkedInteger(infixExpression *ast.InfixExpression, left, right *object.Integer, value int, ok bool) (object.Object, error) {
+	if !ok {
+		return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("integer overflow: %d %s %d", left.Value, infixExpression.Operator, right.Value), kind: ARITHMETIC_ERROR}
+	}
+	return &object.Integer{Value: value}, nil
+}
 
+func divisionByZero(infixExpression *ast.InfixExpression, left, right *object.Integer) *EvalError {
+	return &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("division by zero: %d %s %d", left.Value, infixExpression.Operator, right.Value), kind: ARITHMETIC_ERROR}
+}
+
+// Infix applies the operator of infixExpression to left and right, the values of its operands.
+func Infix(infixExpression *ast.InfixExpression, left, right object.Object) (object.Object, error) {
 	if left.Type() != right.Type() {
-		return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("type mismatch in infix expression: %+v %s %+v", left, infixExpression.Operator, right)}
+		return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("type mismatch in infix expression: %+v %s %+v", left, infixExpression.Operator, right), kind: TYPE_ERROR}
 	}
 	switch left := left.(type) {
 	case *object.Integer:
 		right := right.(*object.Integer)
 		switch infixExpression.Operator {
 		case "+":
-			return &object.Integer{Value: left.Value + right.Value}, nil
+			value, ok := object.Add(left.Value, right.Value)
+			return checkedInteger(infixExpression, left, right, value, ok)
 		case "-":
-			return &object.Integer{Value: left.Value - right.Value}, nil
+			value, ok := object.Subtract(left.Value, right.Value)
+			return checkedInteger(infixExpression, left, right, value, ok)
 		case "*":
-			return &object.Integer{Value: left.Value * right.Value}, nil
+			value, ok := object.Multiply(left.Value, right.Value)
+			return checkedInteger(infixExpression, left, right, value, ok)
 		case "/":
-			return &object.Integer{Value: left.Value / right.Value}, nil
+			if right.Value == 0 {
+				return nil, divisionByZero(infixExpression, left, right)
+			}
+			value, ok := object.Divide(left.Value, right.Value)
+			return checkedInteger(infixExpression, left, right, value, ok)
 		case "%":
+			if right.Value == 0 {
+				return nil, divisionByZero(infixExpression, left, right)
+			}
 			return &object.Integer{Value: left.Value % right.Value}, nil
 		case ">":
 			if left.Value > right.Value {
@@ -334,7 +513,7 @@ func evalInfixExpression(infixExpression *ast.InfixExpression, env *object.Envir
 				return FALSE_OBJ, nil
 			}
 		default:
-			return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("unknown infix operator for integer: %q", infixExpression.Operator)}
+			return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("unknown infix operator for integer: %q", infixExpression.Operator), kind: TYPE_ERROR}
 		}
 	case *object.Boolean:
 		right := right.(*object.Boolean)
@@ -352,15 +531,35 @@ func evalInfixExpression(infixExpression *ast.InfixExpression, env *object.Envir
 				return FALSE_OBJ, nil
 			}
 		default:
-			return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("unknown infix operator for boolean: %q", infixExpression.Operator)}
+			return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("unknown infix operator for boolean: %q", infixExpression.Operator), kind: TYPE_ERROR}
+		}
+	case *object.String:
+		right := right.(*object.String)
+		switch infixExpression.Operator {
+		case "+":
+			return &object.String{Value: left.Value + right.Value}, nil
+		case "==":
+			if left.Value == right.Value {
+				return TRUE_OBJ, nil
+			} else {
+				return FALSE_OBJ, nil
+			}
+		case "!=":
+			if left.Value != right.Value {
+				return TRUE_OBJ, nil
+			} else {
+				return FALSE_OBJ, nil
+			}
+		default:
+			return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("unknown infix operator for string: %q", infixExpression.Operator), kind: TYPE_ERROR}
 		}
 	default:
-		return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("invalid type for infix expression: %+v (%T)", left, left)}
+		return nil, &EvalError{line: infixExpression.Line(), msg: fmt.Sprintf("invalid type for infix expression: %+v (%T)", left, left), kind: TYPE_ERROR}
 	}
 }
 
-func evalIfExpression(ifExpression *ast.IfExpression, env *object.Environment) (object.Object, error) {
-	condition, err := evalExpression(ifExpression.Condition, env)
+func (e *evaluator) evalIfExpression(ifExpression *ast.IfExpression, env *object.Environment) (object.Object, error) {
+	condition, err := e.evalExpression(ifExpression.Condition, env)
 	if err != nil {
 		return nil, err
 	}
@@ -368,13 +567,13 @@ func evalIfExpression(ifExpression *ast.IfExpression, env *object.Environment) (
 		if ifExpression.Alternative == nil {
 			return NULL_OBJ, nil
 		}
-		alternative, err := Eval(ifExpression.Alternative, env)
+		alternative, err := e.eval(ifExpression.Alternative, env)
 		if err != nil {
 			return nil, err
 		}
 		return alternative, nil
 	} else {
-		consequence, err := Eval(ifExpression.Consequence, env)
+		consequence, err := e.eval(ifExpression.Consequence, env)
 		if err != nil {
 			return nil, err
 		}
@@ -382,88 +581,351 @@ func evalIfExpression(ifExpression *ast.IfExpression, env *object.Environment) (
 	}
 }
 
-func evalFunctionLiteral(functionLiteral *ast.FunctionLiteral, env *object.Environment) (object.Object, error) {
-	return &object.Function{Parameters: functionLiteral.Parameters, Body: functionLiteral.Body, Env: env}, nil
+func (e *evaluator) evalFunctionLiteral(functionLiteral *ast.FunctionLiteral, env *object.Environment) (object.Object, error) {
+	return &object.Function{
+		Parameters:     functionLiteral.Parameters,
+		ParameterTypes: functionLiteral.ParameterTypes,
+		ReturnType:     functionLiteral.ReturnType,
+		Body:           functionLiteral.Body,
+		NumSlots:       functionLiteral.NumSlots,
+		Generator:      functionLiteral.Generator,
+		Env:            env.Capture(functionLiteral.Captured),
+	}, nil
 }
 
-func evalFunctionCall(functionCall *ast.FunctionCall, env *object.Environment) (object.Object, error) {
-	var evaluatedArgs []object.Object
-	for _, arg := range functionCall.Arguments {
-		evaluatedArg, err := evalExpression(arg, env)
-		if err != nil {
-			return nil, err
-		}
+func (e *evaluator) evalFunctionCall(functionCall *ast.FunctionCall, env *object.Environment) (object.Object, error) {
+	if isQuoteCall(functionCall) {
+		return Quote(functionCall.Arguments[0], func(expression ast.Expression) (object.Object, error) {
+			return e.evalExpression(expression, env)
+		})
+	}
 
-		evaluatedArgs = append(evaluatedArgs, evaluatedArg)
+	function, evaluatedArgs, err := e.evalCall(functionCall, env)
+	if err != nil {
+		return nil, err
 	}
+	return e.applyFunction(functionCall, function, evaluatedArgs)
+}
 
-	function, err := evalExpression(functionCall.Function, env)
+func (e *evaluator) evalMethodCall(methodCall *ast.MethodCall, env *object.Environment) (object.Object, error) {
+	function, evaluatedArgs, err := e.evalCall(methodCall, env)
 	if err != nil {
 		return nil, err
 	}
+	return e.applyFunction(methodCall, function, evaluatedArgs)
+}
 
-	switch function := function.(type) {
-	case *object.Function:
-		if len(functionCall.Arguments) != len(function.Parameters) {
-			return nil, &EvalError{line: functionCall.Arguments[0].Line(), msg: fmt.Sprintf("number of arguments for %+v wrong:\nwant=%d\ngot=%d\n", function, len(function.Parameters), len(functionCall.Arguments))}
+// evalCall evaluates the function and the arguments of call, which is a function call or a method call.
+// the receiver of a method call is the first argument.
+func (e *evaluator) evalCall(call ast.Expression, env *object.Environment) (object.Object, []object.Object, error) {
+	switch call := call.(type) {
+	case *ast.FunctionCall:
+		evaluatedArgs, err := e.evalExpressions(call.Arguments, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		function, err := e.evalExpression(call.Function, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		return function, evaluatedArgs, nil
+	case *ast.MethodCall:
+		receiver, err := e.evalExpression(call.Receiver, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		evaluatedArgs, err := e.evalExpressions(call.Arguments, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		function, err := e.evalExpression(call.Method, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		return function, append([]object.Object{receiver}, evaluatedArgs...), nil
+	default:
+		return nil, nil, &EvalError{line: call.Line(), msg: fmt.Sprintf("unable to eval call: %+v (%T)", call, call)}
+	}
+}
+
+// applyFunction calls function with args at call, traces the error if any with the calls being evaluated when it is raised.
+// call is the call site, which is used for error messages, or nil for the functions called by builtin functions,
+// whose arguments and return values are not checked.
+func (e *evaluator) applyFunction(call ast.Expression, function object.Object, args []object.Object) (object.Object, error) {
+	// the stack is not restored by a deferred function, so that it is kept for a panic.
+	stack := e.stack
+	returned, err := e.callFunction(call, function, args)
+	if err != nil {
+		err = Traced(err, e.stack)
+	}
+	e.stack = stack
+	return returned, err
+}
+
+// callFunction calls function as applyFunction does, pushing the frame of the call onto the stack of e.
+// a function called in tail position replaces the frame of the function which called it.
+func (e *evaluator) callFunction(call ast.Expression, function object.Object, args []object.Object) (object.Object, error) {
+	stack := e.stack
+	if e.limits.MaxCallDepth > 0 && e.depth >= e.limits.MaxCallDepth {
+		return nil, limitExceeded(callLine(call, function), CALL_DEPTH_LIMIT, e.limits.MaxCallDepth)
+	}
+	if e.depth >= MaxCallDepth {
+		return nil, &EvalError{line: callLine(call, function), msg: fmt.Sprintf("stack depth exceeded: more than %d nested calls", MaxCallDepth)}
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+
+	var returnChecks []returnCheck
+	for {
+		if err := e.checkContext(callLine(call, function)); err != nil {
+			return nil, err
+		}
+		var returned object.Object
+		switch f := function.(type) {
+		case *object.Function:
+			if call != nil && len(args) != len(f.Parameters) {
+				return nil, &EvalError{line: call.Line(), msg: fmt.Sprintf("number of arguments for %s wrong:\nwant=%d\ngot=%d\n", call, len(f.Parameters), len(args)), kind: ARGUMENT_ERROR}
+			}
+
+			frame := object.NewFrame(f.NumSlots, f.Env)
+			for i, arg := range args {
+				ident := f.Parameters[i]
+				if call != nil && i < len(f.ParameterTypes) && !Conforms(arg, f.ParameterTypes[i]) {
+					return nil, &EvalError{line: call.Line(), msg: fmt.Sprintf("type of parameter %q wrong in %s: want %s, got %s", ident.Name, call, f.ParameterTypes[i], Describe(arg)), kind: TYPE_ERROR}
+				}
+				frame.SetSlot(i, arg)
+			}
+			if f.Generator {
+				// the call is made right away as the one of a builtin function, as it is by package vm.
+				e.stack = e.stack.Push(call, function)
+				returned = e.generate(f, args)
+				if call != nil && f.ReturnType != nil {
+					returnChecks = append(returnChecks, returnCheck{call: call, returnType: f.ReturnType})
+				}
+				break
+			}
+
+			e.stack = stack.Push(call, function)
+			evaluated, err := e.evalTailStatements(f.Body.Statements, frame, true)
+			if err != nil {
+				return nil, err
+			}
+			if call != nil && f.ReturnType != nil {
+				returnChecks = append(returnChecks, returnCheck{call: call, returnType: f.ReturnType})
+			}
+			returned = unwrapReturnValue(evaluated)
+			if tail, ok := returned.(*tailCall); ok {
+				call, function, args = tail.call, tail.function, tail.args
+				continue
+			}
+		case *object.BuiltinFunction:
+			var err error
+			e.stack = e.stack.Push(call, function)
+			returned, err = e.applyBuiltin(f, args)
+			if err != nil {
+				return nil, TracedBuiltin(err, call, e.stack)
+			}
+		default:
+			return nil, &EvalError{line: call.Line(), msg: fmt.Sprintf("unable to convert to function in %s: %+v (%T)", call, function, function), kind: TYPE_ERROR}
 		}
 
-		enclosedEnv := object.NewEnclosedEnvironment(function.Env)
-		for i, evaluatedArg := range evaluatedArgs {
-			ident := function.Parameters[i]
-			enclosedEnv.Set(ident.Name, evaluatedArg)
+		// the return values are checked in the function which called, as they are in package vm.
+		e.stack = stack
+		for i := len(returnChecks) - 1; i >= 0; i-- {
+			check := returnChecks[i]
+			if !Conforms(returned, check.returnType) {
+				return nil, &EvalError{line: check.call.Line(), msg: fmt.Sprintf("type of return value wrong in %s: want %s, got %s", check.call, check.returnType, Describe(returned)), kind: TYPE_ERROR}
+			}
 		}
+		return returned, nil
+	}
+}
+
+// returnCheck is the annotated type of the return value of a function called at call.
+type returnCheck struct {
+	call       ast.Expression
+	returnType ast.TypeAnnotation
+}
 
-		evaluated, err := Eval(function.Body, enclosedEnv)
+// callLine returns the line of call, or the line of the body of function if it is called by a builtin function.
+func callLine(call ast.Expression, function object.Object) int {
+	if call != nil {
+		return call.Line()
+	}
+	switch function := function.(type) {
+	case *object.Function:
+		return function.Body.Line()
+	case *object.Closure:
+		return function.Function.Literal.Body.Line()
+	}
+	return 1
+}
+
+func (e *evaluator) evalExpressions(expressions []ast.Expression, env *object.Environment) ([]object.Object, error) {
+	var evaluated []object.Object
+	for _, expression := range expressions {
+		evaluatedExpression, err := e.evalExpression(expression, env)
 		if err != nil {
 			return nil, err
 		}
-		return unwrapReturnValue(evaluated), nil
-	case *object.BuiltinFunction:
-		return function.Fn(evaluatedArgs...)
-	default:
-		return nil, &EvalError{line: functionCall.Line(), msg: fmt.Sprintf("unable to convert to function: %+v (%T)", function, function)}
+		evaluated = append(evaluated, evaluatedExpression)
 	}
+	return evaluated, nil
 }
 
-func evalArrayLiteral(arrayLiteral *ast.ArrayLiteral, env *object.Environment) (object.Object, error) {
+func (e *evaluator) evalArrayLiteral(arrayLiteral *ast.ArrayLiteral, env *object.Environment) (object.Object, error) {
 	var evaluatedElements []object.Object
 	for _, elem := range arrayLiteral.Elements {
-		evaluatedElem, err := evalExpression(elem, env)
+		evaluatedElem, err := e.evalExpression(elem, env)
 		if err != nil {
 			return nil, err
 		}
 		evaluatedElements = append(evaluatedElements, evaluatedElem)
 	}
+	if err := e.allocate(arrayLiteral.Line(), len(evaluatedElements)); err != nil {
+		return nil, err
+	}
 	return &object.Array{Elements: evaluatedElements}, nil
 }
 
-func evalIndexExpression(indexExpression *ast.IndexExpression, env *object.Environment) (object.Object, error) {
-	evaluatedArray, err := evalExpression(indexExpression.Array, env)
+func (e *evaluator) evalArrayComprehension(arrayComprehension *ast.ArrayComprehension, env *object.Environment) (object.Object, error) {
+	var evaluatedElements []object.Object
+	err := e.evalComprehensionClauses(arrayComprehension, arrayComprehension.Clauses, env, &evaluatedElements)
+	if err != nil {
+		return nil, err
+	}
+	return &object.Array{Elements: evaluatedElements}, nil
+}
+
+// evalComprehensionClauses evaluates the first clause and recurses into the rest
+// with a fresh frame per iteration, appending the elements to out. a clause iterates an array or a stream.
+func (e *evaluator) evalComprehensionClauses(arrayComprehension *ast.ArrayComprehension, clauses []*ast.ComprehensionClause, env *object.Environment, out *[]object.Object) error {
+	if len(clauses) == 0 {
+		evaluated, err := e.evalExpression(arrayComprehension.Element, env)
+		if err != nil {
+			return err
+		}
+		if err := e.allocate(arrayComprehension.Line(), 1); err != nil {
+			return err
+		}
+		*out = append(*out, evaluated)
+		return nil
+	}
+
+	clause := clauses[0]
+	evaluatedIterable, err := e.evalExpression(clause.Iterable, env)
+	if err != nil {
+		return err
+	}
+	next, stop, ok := Iterate(evaluatedIterable, e.apply)
+	if !ok {
+		return &EvalError{line: clause.Line(), msg: fmt.Sprintf("unable to convert to array: %+v (%T)", evaluatedIterable, evaluatedIterable), kind: TYPE_ERROR}
+	}
+	defer stop()
+
+	for {
+		elem, ok, err := next()
+		if err != nil {
+			// the errors raised by the stream itself are reported at the iterable, as the ones of a builtin function at its call.
+			return TracedBuiltin(err, clause.Iterable, e.stack)
+		}
+		if !ok {
+			return nil
+		}
+		if err := e.checkContext(clause.Line()); err != nil {
+			return err
+		}
+		frame := object.NewFrame(clause.NumSlots, env)
+		declare(frame, clause.Variable, elem)
+
+		if clause.Condition != nil {
+			condition, err := e.evalExpression(clause.Condition, frame)
+			if err != nil {
+				return err
+			}
+			if condition == NULL_OBJ || condition == FALSE_OBJ {
+				continue
+			}
+		}
+		if err := e.evalComprehensionClauses(arrayComprehension, clauses[1:], frame, out); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *evaluator) evalIndexExpression(indexExpression *ast.IndexExpression, env *object.Environment) (object.Object, error) {
+	evaluatedArray, err := e.evalExpression(indexExpression.Array, env)
 	if err != nil {
 		return nil, err
 	}
 	array, ok := evaluatedArray.(*object.Array)
 	if !ok {
-		return nil, &EvalError{line: indexExpression.Line(), msg: fmt.Sprintf("unable to convert to array: %+v (%T)", evaluatedArray, evaluatedArray)}
+		return nil, &EvalError{line: indexExpression.Line(), msg: fmt.Sprintf("unable to convert to array: %+v (%T)", evaluatedArray, evaluatedArray), kind: TYPE_ERROR}
 	}
 
-	evaluatedIndex, err := evalExpression(indexExpression.Index, env)
+	evaluatedIndex, err := e.evalExpression(indexExpression.Index, env)
 	if err != nil {
 		return nil, err
 	}
+	return Index(indexExpression, array, evaluatedIndex)
+}
+
+// Index returns the element of array at evaluatedIndex, the value of the index of indexExpression.
+func Index(indexExpression *ast.IndexExpression, array *object.Array, evaluatedIndex object.Object) (object.Object, error) {
 	index, ok := evaluatedIndex.(*object.Integer)
 	if !ok {
-		return nil, &EvalError{line: indexExpression.Line(), msg: fmt.Sprintf("unable to convert to integer: %+v (%T)", evaluatedIndex, evaluatedIndex)}
+		return nil, &EvalError{line: indexExpression.Line(), msg: fmt.Sprintf("unable to convert to integer: %+v (%T)", evaluatedIndex, evaluatedIndex), kind: TYPE_ERROR}
 	}
 
 	if index.Value < 0 || len(array.Elements) <= index.Value {
-		return nil, &EvalError{line: indexExpression.Line(), msg: fmt.Sprintf("index out of range: %v[%d]\n", array, index.Value)}
+		return nil, &EvalError{line: indexExpression.Line(), msg: fmt.Sprintf("index out of range: %v[%d]\n", array, index.Value), kind: INDEX_ERROR}
 	}
 
 	return array.Elements[index.Value], nil
 }
 
+func (e *evaluator) evalFieldExpression(fieldExpression *ast.FieldExpression, env *object.Environment) (object.Object, error) {
+	evaluated, err := e.evalExpression(fieldExpression.Object, env)
+	if err != nil {
+		return nil, err
+	}
+	return Field(fieldExpression, evaluated)
+}
+
+// Field returns the field of evaluated, the value of the object of fieldExpression.
+func Field(fieldExpression *ast.FieldExpression, evaluated object.Object) (object.Object, error) {
+	errorObject, ok := evaluated.(*object.Error)
+	if !ok {
+		return nil, &EvalError{line: fieldExpression.Line(), msg: fmt.Sprintf("unable to access field %q of %+v (%T)", fieldExpression.Field.Name, evaluated, evaluated), kind: TYPE_ERROR}
+	}
+
+	switch fieldExpression.Field.Name {
+	case "message":
+		return &object.String{Value: errorObject.Message}, nil
+	case "kind":
+		return &object.String{Value: errorObject.Kind}, nil
+	case "line":
+		return &object.Integer{Value: errorObject.Line}, nil
+	default:
+		return nil, &EvalError{line: fieldExpression.Line(), msg: fmt.Sprintf("unknown field for error: %q", fieldExpression.Field.Name), kind: NAME_ERROR}
+	}
+}
+
+func (e *evaluator) evalTryExpression(tryExpression *ast.TryExpression, env *object.Environment) (object.Object, error) {
+	evaluated, err := e.eval(tryExpression.Body, env)
+	if err == nil {
+		return evaluated, nil
+	}
+	evalError, ok := err.(*EvalError)
+	if !ok || !evalError.Catchable() {
+		return nil, err
+	}
+
+	frame := object.NewFrame(tryExpression.NumSlots, env)
+	declare(frame, tryExpression.Parameter, evalError.Object())
+	return e.eval(tryExpression.Handler, frame)
+}
+
 func unwrapReturnValue(obj object.Object) object.Object {
 	switch obj := obj.(type) {
 	case *object.ReturnValue:
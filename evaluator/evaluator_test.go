@@ -1,11 +1,18 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/muiscript/ether/ast"
 	"github.com/muiscript/ether/lexer"
 	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/optimizer"
 	"github.com/muiscript/ether/parser"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEval_Integer(t *testing.T) {
@@ -378,6 +385,47 @@ func TestEval_ArrowExpression(t *testing.T) {
 	}
 }
 
+func TestEval_MethodCall(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected interface{}
+	}{
+		{
+			desc:     "var identity=|x|{x;};42.identity();",
+			input:    "var identity = |x| { x; }; 42.identity();",
+			expected: 42,
+		},
+		{
+			desc:     "var add=|x,y|{x+y;};7.add(8);",
+			input:    "var add = |x, y| { x + y; }; 7.add(8);",
+			expected: 15,
+		},
+		{
+			desc:     "builtin",
+			input:    "[1, 2, 3].len()",
+			expected: 3,
+		},
+		{
+			desc:     "chain of builtins",
+			input:    "[1, 2, 3, 4].map(|x| { x * 2 }).filter(|x| { x > 4 }).reduce(0, |acc, x| { acc + x })",
+			expected: 14,
+		},
+		{
+			desc:     "same as arrow",
+			input:    "var double = |x| { 2 * x }; var add = |x, y| { x + y }; 7.double().add(1) == 7 -> double() -> add(1)",
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated := eval(t, tt.input)
+			testObject(t, tt.expected, evaluated)
+		})
+	}
+}
+
 func TestEval_ArrayLiteral(t *testing.T) {
 	tests := []struct {
 		desc     string
@@ -423,6 +471,100 @@ func TestEval_ArrayLiteral(t *testing.T) {
 	}
 }
 
+func TestEval_ArrayComprehension(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected []interface{}
+	}{
+		{
+			desc:     "[x for x in []]",
+			input:    "[x for x in []]",
+			expected: []interface{}{},
+		},
+		{
+			desc:     "[x*x for x in xs]",
+			input:    "var xs = [1, 2, 3]; [x * x for x in xs]",
+			expected: []interface{}{1, 4, 9},
+		},
+		{
+			desc:     "[x*x for x in xs if x%2==1]",
+			input:    "var xs = [1, 2, 3, 4, 5]; [x * x for x in xs if x % 2 == 1]",
+			expected: []interface{}{1, 9, 25},
+		},
+		{
+			desc:     "nested",
+			input:    "[x * 10 + y for x in [1, 2, 3] if x != 2 for y in [x, 5] if y > 1]",
+			expected: []interface{}{15, 33, 35},
+		},
+		{
+			desc:     "closure captures each iteration",
+			input:    "var fs = [|| { x } for x in [1, 2, 3]]; [f() for f in fs]",
+			expected: []interface{}{1, 2, 3},
+		},
+		{
+			desc:     "variable does not leak",
+			input:    "var x = 42; [x for x in [1, 2]]; [x]",
+			expected: []interface{}{42},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated := eval(t, tt.input)
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Fatalf("not an array: %+v (%T)\n", evaluated, evaluated)
+			}
+			if len(array.Elements) != len(tt.expected) {
+				t.Fatalf("array length wrong.\nwant=%d\ngot=%d\n", len(tt.expected), len(array.Elements))
+			}
+			for i, expected := range tt.expected {
+				testObject(t, expected, array.Elements[i])
+			}
+		})
+	}
+}
+
+func TestEval_ArrayComprehension_SameAsFilterMap(t *testing.T) {
+	tests := []struct {
+		desc          string
+		comprehension string
+		pipeline      string
+	}{
+		{
+			desc:          "map",
+			comprehension: "[x * 2 for x in [1, 2, 3]]",
+			pipeline:      "[1, 2, 3] -> map(|x| { x * 2 })",
+		},
+		{
+			desc:          "filter",
+			comprehension: "[x for x in [1, 2, 3, 4] if x > 2]",
+			pipeline:      "[1, 2, 3, 4] -> filter(|x| { x > 2 })",
+		},
+		{
+			desc:          "filter and map",
+			comprehension: "[x * x for x in [1, 2, 3, 4, 5] if x % 2 == 1]",
+			pipeline:      "[1, 2, 3, 4, 5] -> filter(|x| { x % 2 == 1 }) -> map(|x| { x * x })",
+		},
+		{
+			desc:          "nothing matches",
+			comprehension: "[x for x in [1, 2, 3] if false]",
+			pipeline:      "[1, 2, 3] -> filter(|x| { false })",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			expected := eval(t, tt.pipeline)
+			actual := eval(t, tt.comprehension)
+			if actual.String() != expected.String() {
+				t.Errorf("evaluated value wrong.\nwant=%s\ngot=%s\n", expected, actual)
+			}
+		})
+	}
+}
+
 func TestEval_IndexExpression(t *testing.T) {
 	tests := []struct {
 		desc     string
@@ -511,6 +653,36 @@ func TestEval_ReturnStatement(t *testing.T) {
 			input:    "42;",
 			expected: 42,
 		},
+		{
+			desc:     "return in if statement in if statement",
+			input:    "var f = || { if (true) { if (true) { return 5 } }; 0 }; f()",
+			expected: 5,
+		},
+		{
+			desc:     "return in if returned",
+			input:    "var f = || { return if (true) { return 1 } else { 2 } }; f() + 1",
+			expected: 2,
+		},
+		{
+			desc:     "return in array element",
+			input:    "var f = || { [if (true) { return 5 }, 6]; 0 }; f()",
+			expected: 0,
+		},
+		{
+			desc:     "return in comprehension element",
+			input:    "var f = |xs| { [if (true) { return x } for x in xs]; 0 }; f([1, 2])",
+			expected: 0,
+		},
+		{
+			desc:     "return in try statement in array element",
+			input:    "var f = || { [try { try { return 1 } catch (e) { 0 }; 2 } catch (e) { 3 }, 4][1] }; f()",
+			expected: 4,
+		},
+		{
+			desc:     "return in catch in array element",
+			input:    "var f = || { [try { try { throw 0 } catch (e) { if (true) { return 1 } }; 2 } catch (e) { 3 }, 1 / 0] }; try { f() } catch (e) { 7 }",
+			expected: 7,
+		},
 	}
 
 	for _, tt := range tests {
@@ -687,6 +859,488 @@ func TestEval_BuiltinFunction_Filter(t *testing.T) {
 	}
 }
 
+func TestEval_Stream(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected []interface{}
+	}{
+		{
+			desc:     "range_from",
+			input:    "range_from(3) -> take(3)",
+			expected: []interface{}{3, 4, 5},
+		},
+		{
+			desc:     "iterate",
+			input:    "iterate(1, |x| { x * 2 }) -> take(4)",
+			expected: []interface{}{1, 2, 4, 8},
+		},
+		{
+			desc:     "map and filter",
+			input:    "range_from(1) -> filter(|x| { x % 3 == 0 }) -> map(|x| { x * x }) -> take(3)",
+			expected: []interface{}{9, 36, 81},
+		},
+		{
+			desc:     "take none",
+			input:    "range_from(1) -> map(|x| { 1 / 0 }) -> take(0)",
+			expected: []interface{}{},
+		},
+		{
+			desc:     "take array",
+			input:    "[1, 2, 3] -> take(2)",
+			expected: []interface{}{1, 2},
+		},
+		{
+			desc:     "take more than finite",
+			input:    "[1, 2] -> take(5)",
+			expected: []interface{}{1, 2},
+		},
+		{
+			desc:     "iterated again",
+			input:    "var s = iterate(1, |x| { x + 1 }) -> map(|x| { x * 10 }); var a = s -> take(2); s -> take(3)",
+			expected: []interface{}{10, 20, 30},
+		},
+		{
+			desc:     "to_array",
+			input:    "[1, 2, 3] -> filter(|x| { x > 1 }) -> to_array()",
+			expected: []interface{}{2, 3},
+		},
+		{
+			desc:     "to_array of finite stream",
+			input:    "var s = range_from(1); to_array(s -> take(3) -> map(|x| { -x }))",
+			expected: []interface{}{-1, -2, -3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated := eval(t, tt.input)
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Fatalf("not an array: %+v (%T)\n", evaluated, evaluated)
+			}
+			if len(array.Elements) != len(tt.expected) {
+				t.Fatalf("number of elements wrong.\nwant=%d\ngot=%d\n", len(tt.expected), len(array.Elements))
+			}
+			for i, expected := range tt.expected {
+				testObject(t, expected, array.Elements[i])
+			}
+		})
+	}
+}
+
+func TestEval_Stream_Reduce(t *testing.T) {
+	testObject(t, 5050, eval(t, "range_from(1) -> take(100) -> reduce(0, |acc, x| { acc + x })"))
+	testObject(t, 55, eval(t, "range_from(1) -> map(|x| { x * x }) -> take(5) -> reduce(0, |acc, x| { acc + x })"))
+}
+
+func TestEval_Stream_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		kind     string
+		expected string
+	}{
+		{
+			desc:     "error in function",
+			input:    "var s = range_from(1) -> map(|x| { 10 / (3 - x) });\ns -> take(5)",
+			kind:     ARITHMETIC_ERROR,
+			expected: "line 1: division by zero: 10 / 0",
+		},
+		{
+			desc:     "negative count",
+			input:    "var s = range_from(1);\ns -> take(-1)",
+			kind:     ARGUMENT_ERROR,
+			expected: "line 2: number of elements for take wrong: -1 is negative",
+		},
+		{
+			desc:     "overflow",
+			input:    "var max = 9223372036854775807;\nrange_from(max) -> take(2)",
+			kind:     ARITHMETIC_ERROR,
+			expected: "line 2: integer overflow: 9223372036854775807 + 1",
+		},
+		{
+			desc:     "not iterable",
+			input:    "1 -> map(|x| { x })",
+			kind:     TYPE_ERROR,
+			expected: "line 1: first argument type for map wrong: want=*object.Array or *object.Stream\ngot=*object.Integer\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.Kind() != tt.kind {
+				t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", tt.kind, evalError.Kind())
+			}
+			if evalError.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, evalError.Error())
+			}
+		})
+	}
+}
+
+func TestEval_TryExpression(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected interface{}
+	}{
+		{
+			desc:     "no error",
+			input:    "try { 42 } catch (e) { 0 }",
+			expected: 42,
+		},
+		{
+			desc:     "throw integer",
+			input:    "try { throw 42; 0 } catch (e) { e.message }",
+			expected: "42",
+		},
+		{
+			desc:     "throw string",
+			input:    `try { throw "bad record" } catch (e) { e.kind + ": " + e.message }`,
+			expected: "Error: bad record",
+		},
+		{
+			desc:     "throw error",
+			input:    `try { throw error("negative", "ValueError") } catch (e) { e.kind }`,
+			expected: "ValueError",
+		},
+		{
+			desc:     "line of thrown error",
+			input:    "try {\n  throw 1\n} catch (e) { e.line }",
+			expected: 2,
+		},
+		{
+			desc:     "index out of range",
+			input:    "try { [1, 2][5] } catch (e) { e.kind }",
+			expected: "IndexError",
+		},
+		{
+			desc:     "message of index out of range",
+			input:    "try { [][0] } catch (e) { e.message }",
+			expected: "index out of range: [][0]",
+		},
+		{
+			desc:     "message of wrong number of arguments",
+			input:    "var f = |x| { x }; try { f(1, 2) } catch (e) { e.message }",
+			expected: "number of arguments for f(1, 2) wrong: want=1, got=2",
+		},
+		{
+			desc:     "message of wrong argument type",
+			input:    "try { len(1) } catch (e) { e.message }",
+			expected: "argument type for len wrong: want=*object.Array, got=*object.Integer",
+		},
+		{
+			desc:     "message of non-function argument",
+			input:    "try { reduce([1], 0, 2) } catch (e) { e.message }",
+			expected: "reduce: third argument must be a function, got INTEGER",
+		},
+		{
+			desc:     "undefined identifier",
+			input:    "try { foo } catch (e) { e.kind }",
+			expected: "NameError",
+		},
+		{
+			desc:     "error from builtin",
+			input:    "try { len(1) } catch (e) { e.kind }",
+			expected: "TypeError",
+		},
+		{
+			desc:     "error from nested function",
+			input:    "var f = |x| { throw x }; var g = |x| { f(x + 1) }; try { g(1) } catch (e) { e.message }",
+			expected: "2",
+		},
+		{
+			desc:     "rethrow",
+			input:    "try { try { throw 1 } catch (e) { throw e } } catch (e) { e.message }",
+			expected: "1",
+		},
+		{
+			desc:     "return inside try",
+			input:    "var f = || { try { return 1 } catch (e) { 2 }; 3 }; f()",
+			expected: 1,
+		},
+		{
+			desc:     "skip bad records",
+			input:    "[2, 0, 4] -> map(|x| { try { if (x == 0) { throw x } else { x } } catch (e) { -1 } })",
+			expected: []interface{}{2, -1, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated := eval(t, tt.input)
+			if expected, ok := tt.expected.([]interface{}); ok {
+				array, ok := evaluated.(*object.Array)
+				if !ok {
+					t.Fatalf("not an array: %+v (%T)\n", evaluated, evaluated)
+				}
+				for i, expectedElem := range expected {
+					testObject(t, expectedElem, array.Elements[i])
+				}
+				return
+			}
+			testObject(t, tt.expected, evaluated)
+		})
+	}
+}
+
+func TestEval_UncaughtError(t *testing.T) {
+	tests := []struct {
+		desc         string
+		input        string
+		expectedKind string
+	}{
+		{
+			desc:         "throw outside try",
+			input:        "throw 1",
+			expectedKind: "Error",
+		},
+		{
+			desc:         "throw inside catch",
+			input:        "try { throw 1 } catch (e) { [][0] }",
+			expectedKind: "IndexError",
+		},
+		{
+			desc:         "return in operand",
+			input:        "var f = || { 1 + if (true) { return 5 } else { 0 }; 99 }; f()",
+			expectedKind: "TypeError",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.Kind() != tt.expectedKind {
+				t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", tt.expectedKind, evalError.Kind())
+			}
+		})
+	}
+}
+
+func TestEval_ArithmeticError(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{desc: "division by zero", input: "var x = 0; 1 / x", expected: "line 1: division by zero: 1 / 0"},
+		{desc: "modulo by zero", input: "var x = 0; 1 % x", expected: "line 1: division by zero: 1 % 0"},
+		{desc: "addition overflow", input: "var x = 9223372036854775807; x + 1", expected: "line 1: integer overflow: 9223372036854775807 + 1"},
+		{desc: "subtraction overflow", input: "var x = -9223372036854775807; x - 2", expected: "line 1: integer overflow: -9223372036854775807 - 2"},
+		{desc: "multiplication overflow", input: "var x = 4611686018427387904; x * 2", expected: "line 1: integer overflow: 4611686018427387904 * 2"},
+		{desc: "division overflow", input: "var x = -9223372036854775807 - 1; x / -1", expected: "line 1: integer overflow: -9223372036854775808 / -1"},
+		{desc: "negation overflow", input: "var x = -9223372036854775807 - 1; -x", expected: "line 1: integer overflow: --9223372036854775808"},
+		{desc: "literals", input: "9223372036854775807 + 1", expected: "line 1: integer overflow: 9223372036854775807 + 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, evalError.Error())
+			}
+			if evalError.Kind() != ARITHMETIC_ERROR {
+				t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", ARITHMETIC_ERROR, evalError.Kind())
+			}
+		})
+	}
+}
+
+func TestEval_ArithmeticError_Caught(t *testing.T) {
+	evaluated := eval(t, "var x = 0; try { 1 / x } catch (e) { e.kind }")
+	testObject(t, ARITHMETIC_ERROR, evaluated)
+}
+
+func TestEval_InternalError(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+		trace    []Frame
+	}{
+		{
+			desc:     "top level",
+			input:    "puts(1) + 1",
+			expected: "line 1: internal error: runtime error: invalid memory address or nil pointer dereference",
+		},
+		{
+			desc:     "not caught",
+			input:    "var f = |x| { puts(x) + 1 }\ntry {\n  f(1)\n} catch (e) { 0 }",
+			expected: "line 3: internal error: runtime error: invalid memory address or nil pointer dereference",
+			trace:    []Frame{{Function: "f", Line: 3}},
+		},
+		{
+			desc:     "not caught from generator",
+			input:    "var g = || {\n  yield puts(1) + 1\n}\ntry {\n  to_array(g())\n} catch (e) { e.kind }",
+			expected: "line 5: internal error: runtime error: invalid memory address or nil pointer dereference",
+			trace:    []Frame{{Function: "g", Line: 5}},
+		},
+		{
+			desc:     "not caught from task",
+			input:    "var t = spawn(|| {\n  puts(1) + 1\n})\ntry {\n  wait(t)\n} catch (e) { e.kind }",
+			expected: "line 1: internal error: runtime error: invalid memory address or nil pointer dereference",
+			trace:    []Frame{{Function: "spawn", Line: 1}, {Function: "", Line: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, evalError.Error())
+			}
+			if evalError.Kind() != INTERNAL_ERROR {
+				t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", INTERNAL_ERROR, evalError.Kind())
+			}
+			if !reflect.DeepEqual(evalError.Trace(), tt.trace) {
+				t.Errorf("trace wrong.\nwant=%v\ngot=%v\n", tt.trace, evalError.Trace())
+			}
+			if !strings.Contains(string(evalError.PanicStack()), "evaluator.Infix") {
+				t.Errorf("panic stack wrong: %s\n", evalError.PanicStack())
+			}
+		})
+	}
+}
+
+func TestEval_TailCall(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected interface{}
+	}{
+		{
+			desc:     "if branch",
+			input:    "var count = |n, acc| { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0)",
+			expected: 100000,
+		},
+		{
+			desc:     "return",
+			input:    "var count = |n, acc| { if (n == 0) { return acc }; return count(n - 1, acc + 1) }; count(100000, 0)",
+			expected: 100000,
+		},
+		{
+			desc:     "mutual recursion",
+			input:    "var even = |n| { if (n == 0) { true } else { odd(n - 1) } }; var odd = |n| { if (n == 0) { false } else { even(n - 1) } }; even(100001)",
+			expected: false,
+		},
+		{
+			desc:     "arrow",
+			input:    "var last = |xs, i| { if (i == len(xs) - 1) { xs[i] } else { xs -> last(i + 1) } }; last([x for x in [1, 2, 3] for y in [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]] -> map(|x| { x * 2 }), 0)",
+			expected: 6,
+		},
+		{
+			desc:     "inside callback",
+			input:    "var count = |n, acc| { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; [20000, 30000] -> map(|n| { count(n, 0) }) -> reduce(0, |a, b| { a + b })",
+			expected: 50000,
+		},
+		{
+			desc:     "annotated",
+			input:    "var count = |n: int| -> int { if (n == 0) { 0 } else { count(n - 1) } }; count(100000)",
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated := eval(t, tt.input)
+			testObject(t, tt.expected, evaluated)
+		})
+	}
+}
+
+func TestEval_StackDepthExceeded(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "not in tail position",
+			input:    "var sum = |n| { if (n == 0) { 0 } else { n + sum(n - 1) } }\nsum(100000)",
+			expected: "line 1: stack depth exceeded: more than 10000 nested calls",
+		},
+		{
+			desc:     "inside try",
+			input:    "var f = |n| { try { f(n + 1) } catch (e) { throw e } }\nf(0)",
+			expected: "line 1: uncaught RuntimeError: stack depth exceeded: more than 10000 nested calls",
+		},
+		{
+			desc:     "through callback",
+			input:    "var f = |n| { [n] -> map(f) }\nf(0)",
+			expected: "line 1: stack depth exceeded: more than 10000 nested calls",
+		},
+		{
+			desc:     "return value of tail call",
+			input:    "var f = |n| -> int { if (n == 0) { true } else { f(n - 1) } }\nf(100000)",
+			expected: "line 1: type of return value wrong in f((n - 1)): want int, got true (BOOLEAN)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, evalError.Error())
+			}
+		})
+	}
+}
+
+func TestEval_StackDepthExceeded_Caught(t *testing.T) {
+	evaluated := eval(t, "var sum = |n| { if (n == 0) { 0 } else { n + sum(n - 1) } }; try { sum(100000) } catch (e) { e.kind }")
+	testObject(t, RUNTIME_ERROR, evaluated)
+}
+
+func TestEvalContext(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		timeout  time.Duration
+		expected error
+	}{
+		{desc: "deadline before evaluation", input: "var f = |x| { x }; f(1)", expected: context.DeadlineExceeded},
+		{desc: "tail recursion", input: "var f = |n| { f(n + 1) }; f(0)", timeout: 50 * time.Millisecond, expected: context.DeadlineExceeded},
+		{desc: "not caught", input: "var f = |n| { f(n + 1) }; try { f(0) } catch (e) { 0 }", timeout: 50 * time.Millisecond, expected: context.DeadlineExceeded},
+		{desc: "map", input: "var xs = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]; var g = |n| { if (n == 0) { 0 } else { xs -> map(|x| { g(n - 1) }) } }; g(9)", timeout: 50 * time.Millisecond, expected: context.DeadlineExceeded},
+		{desc: "comprehension", input: "var xs = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]; [0 for a in xs for b in xs for c in xs for d in xs for e in xs for f in xs for g in xs for h in xs for i in xs]", timeout: 50 * time.Millisecond, expected: context.DeadlineExceeded},
+		{desc: "stream", input: "range_from(1) -> filter(|x| { false }) -> take(1)", timeout: 50 * time.Millisecond, expected: context.DeadlineExceeded},
+		{desc: "waiting task", input: "var f = |n| { f(n + 1) }; wait(spawn(|| { f(0) }))", timeout: 50 * time.Millisecond, expected: context.DeadlineExceeded},
+		{desc: "blocked", input: "var ch = channel(0); spawn(|| { recv(ch) }); spawn(|| { var f = |n| { f(n + 1) }; f(0) }); recv(ch)", timeout: 50 * time.Millisecond, expected: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+			if err != nil {
+				t.Fatalf("parse error: %s\n", err)
+			}
+
+			resolve(program)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			_, err = EvalContext(ctx, program, object.NewEnvironment())
+			if _, ok := err.(*CancelError); !ok {
+				t.Fatalf("error type wrong.\nwant=%T\ngot=%T (%v)\n", &CancelError{}, err, err)
+			}
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("error wrong.\nwant=%v\ngot=%v\n", tt.expected, err)
+			}
+		})
+	}
+}
+
+// RunCompiled runs program with the bytecode backend. it is set by the external test package,
+// since package vm depends on this package.
+var RunCompiled func(program *ast.Program) (object.Object, error)
+
+// RunScheduled runs program with the bytecode backend and scheduler, as RunCompiled does.
+var RunScheduled func(program *ast.Program, scheduler Scheduler) (object.Object, error)
+
+// eval evaluates input, checking that the optimized program and the compiled program evaluate to the same value.
 func eval(t *testing.T, input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -696,15 +1350,94 @@ func eval(t *testing.T, input string) object.Object {
 		t.Errorf("parse error: %s\n", err.Error())
 	}
 
+	resolve(program)
 	env := object.NewEnvironment()
 	evaluated, err := Eval(program, env)
 	if err != nil {
 		t.Errorf("eval error: %s\n", err.Error())
 	}
 
+	optimizedProgram := optimizer.Optimize(program)
+	resolve(optimizedProgram)
+	optimized, err := Eval(optimizedProgram, object.NewEnvironment())
+	if err != nil {
+		t.Errorf("eval error of optimized program: %s\n", err.Error())
+	}
+	if !sameValue(evaluated, optimized) {
+		t.Errorf("value of optimized program wrong.\nwant=%v\ngot=%v\n", evaluated, optimized)
+	}
+
+	if RunCompiled != nil {
+		compiled, err := RunCompiled(program)
+		if err != nil {
+			t.Errorf("run error of compiled program: %s\n", err.Error())
+		}
+		if !sameValue(evaluated, compiled) {
+			t.Errorf("value of compiled program wrong.\nwant=%v\ngot=%v\n", evaluated, compiled)
+		}
+	}
+
 	return evaluated
 }
 
+// resolve assigns the slots of the variables in program. the undefined identifiers are left to be reported
+// by the evaluation, which raises the same error at the line it reaches them.
+func resolve(program ast.Node) {
+	NewResolver().Resolve(program)
+}
+
+// evalErr evaluates input which raises an error, checking that the compiled program raises the same error.
+func evalErr(t *testing.T, input string) *EvalError {
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err.Error())
+	}
+	resolve(program)
+	_, err = Eval(program, object.NewEnvironment())
+	evalError, ok := err.(*EvalError)
+	if !ok {
+		t.Fatalf("error type wrong.\nwant=%T\ngot=%T (%v)\n", &EvalError{}, err, err)
+	}
+
+	if RunCompiled != nil {
+		_, err := RunCompiled(program)
+		compiledError, ok := err.(*EvalError)
+		if !ok {
+			t.Fatalf("error type of compiled program wrong.\nwant=%T\ngot=%T (%v)\n", &EvalError{}, err, err)
+		}
+		if compiledError.Error() != evalError.Error() || compiledError.Kind() != evalError.Kind() {
+			t.Errorf("error of compiled program wrong.\nwant=%s (%s)\ngot=%s (%s)\n", evalError, evalError.Kind(), compiledError, compiledError.Kind())
+		}
+		if !reflect.DeepEqual(compiledError.Trace(), evalError.Trace()) {
+			t.Errorf("trace of compiled program wrong.\nwant=%v\ngot=%v\n", evalError.Trace(), compiledError.Trace())
+		}
+	}
+	return evalError
+}
+
+// sameValue reports whether a and b are the same value. functions are compared by their parameters only,
+// since the optimized body of a function differs from the original one.
+func sameValue(a, b object.Object) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type() == object.FUNCTION {
+		return b.Type() == object.FUNCTION && len(parameters(a)) == len(parameters(b))
+	}
+	return a.Type() == b.Type() && a.String() == b.String()
+}
+
+func parameters(function object.Object) []*ast.Identifier {
+	switch function := function.(type) {
+	case *object.Function:
+		return function.Parameters
+	case *object.Closure:
+		return function.Function.Literal.Parameters
+	default:
+		return nil
+	}
+}
+
 func testObject(t *testing.T, expectedValue interface{}, actual object.Object) {
 	switch expectedValue := expectedValue.(type) {
 	case int:
@@ -723,6 +1456,14 @@ func testObject(t *testing.T, expectedValue interface{}, actual object.Object) {
 		if boolean.Value != expectedValue {
 			t.Errorf("boolean value wrong:\nwant=%v\ngot=%v\n", expectedValue, boolean.Value)
 		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok {
+			t.Fatalf("unable to convert to string: %+v\n", actual)
+		}
+		if str.Value != expectedValue {
+			t.Errorf("string value wrong:\nwant=%q\ngot=%q\n", expectedValue, str.Value)
+		}
 	case nil:
 		_, ok := actual.(*object.Null)
 		if !ok {
@@ -0,0 +1,139 @@
+package evaluator
+
+import (
+	"errors"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+)
+
+// a function whose body yields is a generator: a call of it returns the stream of the values yielded by the body,
+// which is evaluated as the stream is iterated. the body is evaluated on a goroutine of its own for each iteration,
+// suspended at each yield statement until the next element is requested. the goroutine ends with the body,
+// or once the iteration is stopped, in which case the suspended yield statement returns errStopped to unwind the body.
+
+// errStopped unwinds the body of a generator whose iteration is stopped.
+// it is not an EvalError, so that it cannot be caught by try.
+var errStopped = errors.New("generator stopped")
+
+// Yield passes a value yielded by the body of a generator to the iteration, and returns once the next element is requested.
+type Yield func(value object.Object) error
+
+// NewGenerator returns the stream of a generator, whose body is evaluated by run with the function passing the values yielded.
+// run is called on a new goroutine by each iteration of the stream. it is shared by package vm.
+func NewGenerator(run func(yield Yield) error) *object.Stream {
+	return &object.Stream{Iterate: func(object.Apply) (object.Iterator, func()) {
+		g := &generator{run: run}
+		return g.next, g.stop
+	}}
+}
+
+// generator is an iteration of the stream of a generator. the goroutine evaluating the body and the one iterating the stream
+// never run at the same time, since each of them waits for the other on the channels while the other runs.
+type generator struct {
+	run      func(yield Yield) error
+	started  bool
+	finished bool
+	stopped  bool
+	resume   chan struct{}    // requests the next element from the body suspended
+	results  chan yieldResult // the values yielded, followed by the end of the body
+	done     chan struct{}    // closed by stop
+	exited   chan struct{}    // closed when the goroutine ends
+}
+
+type yieldResult struct {
+	value object.Object
+	ok    bool
+	err   error
+}
+
+func (g *generator) next() (object.Object, bool, error) {
+	if g.finished || g.stopped {
+		return nil, false, nil
+	}
+	if !g.started {
+		g.started = true
+		g.resume = make(chan struct{})
+		g.results = make(chan yieldResult)
+		g.done = make(chan struct{})
+		g.exited = make(chan struct{})
+		go g.evaluate()
+	} else {
+		g.resume <- struct{}{}
+	}
+	result := <-g.results
+	if !result.ok {
+		g.finished = true
+	}
+	return result.value, result.ok, result.err
+}
+
+func (g *generator) evaluate() {
+	defer close(g.exited)
+	err := g.run(g.yield)
+	if err == errStopped {
+		return
+	}
+	select {
+	case g.results <- yieldResult{err: err}:
+	case <-g.done:
+	}
+}
+
+func (g *generator) yield(value object.Object) error {
+	g.results <- yieldResult{value: value, ok: true}
+	select {
+	case <-g.resume:
+		return nil
+	case <-g.done:
+		return errStopped
+	}
+}
+
+// stop unwinds the body suspended, if any, and waits for the goroutine to end.
+func (g *generator) stop() {
+	if !g.started || g.stopped {
+		return
+	}
+	g.stopped = true
+	close(g.done)
+	<-g.exited
+}
+
+// generate returns the stream of the generator function f called with args. the body is evaluated in a new frame
+// for each iteration, by an evaluator sharing the context, the limits and the resources used with e.
+// the errors raised by the body are traced from the call of f, which is on the top of the stack of e.
+// the value returned by the body is discarded, so the calls in it are not in tail position.
+func (e *evaluator) generate(f *object.Function, args []object.Object) *object.Stream {
+	stack := e.stack
+	return NewGenerator(func(yield Yield) (err error) {
+		g := &evaluator{ctx: e.ctx, limits: e.limits, usage: e.usage, stack: stack, yield: yield, scheduler: e.scheduler}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = Recovered(recovered, g.stack)
+			}
+		}()
+
+		frame := object.NewFrame(f.NumSlots, f.Env)
+		for i, arg := range args {
+			frame.SetSlot(i, arg)
+		}
+		if _, err := g.eval(f.Body, frame); err != nil {
+			return Traced(err, stack)
+		}
+		return nil
+	})
+}
+
+func (e *evaluator) evalYieldStatement(yieldStatement *ast.YieldStatement, env *object.Environment) (object.Object, error) {
+	value, err := e.evalExpression(yieldStatement.Expression, env)
+	if err != nil {
+		return nil, err
+	}
+	if e.yield == nil {
+		return nil, &EvalError{line: yieldStatement.Line(), msg: "yield outside generator function"}
+	}
+	if err := e.yield(value); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,179 @@
+package evaluator
+
+import (
+	"github.com/muiscript/ether/object"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// naturals is an infinite generator, which yields the elements of the generator it calls one level deeper.
+const naturals = "var naturals = |n| { yield n; [if (true) { yield x } for x in naturals(n + 1)] };\n"
+
+func TestEval_Generator(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected []interface{}
+	}{
+		{
+			desc:     "to_array",
+			input:    "var g = |n| { yield n; yield n * 2; yield n * 3 }; to_array(g(2))",
+			expected: []interface{}{2, 4, 6},
+		},
+		{
+			desc:     "comprehension",
+			input:    "var g = || { yield 1; yield 2 }; [x * 10 for x in g() if x > 1]",
+			expected: []interface{}{20},
+		},
+		{
+			desc:     "yield in comprehension and if",
+			input:    "var evens = |xs| { [if (x % 2 == 0) { yield x } for x in xs] }; to_array(evens([1, 2, 3, 4]))",
+			expected: []interface{}{2, 4},
+		},
+		{
+			desc:     "infinite",
+			input:    naturals + "naturals(0) -> map(|x| { x * x }) -> take(4)",
+			expected: []interface{}{0, 1, 4, 9},
+		},
+		{
+			desc:     "lazy",
+			input:    "var g = || { yield 1; yield 1 / 0 }; take(g(), 1)",
+			expected: []interface{}{1},
+		},
+		{
+			desc:     "iterated again",
+			input:    "var g = |n| { yield n; yield n + 1 }; var s = g(1); var a = take(s, 1); to_array(s)",
+			expected: []interface{}{1, 2},
+		},
+		{
+			desc:     "return ends generator",
+			input:    "var g = || { yield 1; return 2; yield 3 }; to_array(g())",
+			expected: []interface{}{1},
+		},
+		{
+			desc:     "no yield evaluated",
+			input:    "var g = |b| { if (b) { yield 1 }; 2 }; to_array(g(false))",
+			expected: []interface{}{},
+		},
+		{
+			desc:     "filter",
+			input:    naturals + "naturals(1) -> filter(|x| { x % 3 == 0 }) -> take(2)",
+			expected: []interface{}{3, 6},
+		},
+		{
+			desc: "pages",
+			input: `var fetch = |page| { if (page < 3) { [page * 2, page * 2 + 1] } else { [] } };
+var items = |page| { var xs = fetch(page); if (len(xs) > 0) { [if (true) { yield x } for x in xs]; [if (true) { yield x } for x in items(page + 1)] } };
+to_array(items(0))`,
+			expected: []interface{}{0, 1, 2, 3, 4, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated := eval(t, tt.input)
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Fatalf("not an array: %+v (%T)\n", evaluated, evaluated)
+			}
+			if len(array.Elements) != len(tt.expected) {
+				t.Fatalf("number of elements wrong.\nwant=%d\ngot=%d\n", len(tt.expected), len(array.Elements))
+			}
+			for i, expected := range tt.expected {
+				testObject(t, expected, array.Elements[i])
+			}
+		})
+	}
+}
+
+func TestEval_Generator_Reduce(t *testing.T) {
+	testObject(t, 15, eval(t, naturals+"naturals(1) -> take(5) -> reduce(0, |acc, x| { acc + x })"))
+	testObject(t, 3, eval(t, "var g = || { yield 1; yield 2 }; reduce(g(), 0, |acc, x| { acc + x })"))
+}
+
+func TestEval_Generator_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		kind     string
+		expected string
+		trace    []Frame
+	}{
+		{
+			desc:     "error in body",
+			input:    "var g = || { yield 1;\n1 / 0 };\nvar s = g();\nto_array(s)",
+			kind:     ARITHMETIC_ERROR,
+			expected: "line 2: division by zero: 1 / 0",
+			trace:    []Frame{{Function: "g", Line: 3}},
+		},
+		{
+			desc:     "caught by consumer",
+			input:    "var g = || { throw \"stop\" }; try { to_array(g()) } catch (e) { throw e.message + \"!\" }",
+			kind:     THROWN_ERROR,
+			expected: "line 1: uncaught Error: stop!",
+		},
+		{
+			desc:     "yield outside generator",
+			input:    "yield 1",
+			kind:     RUNTIME_ERROR,
+			expected: "line 1: yield outside generator function",
+		},
+		{
+			desc:     "return type",
+			input:    "var g = || -> int { yield 1 };\ng()",
+			kind:     TYPE_ERROR,
+			expected: "line 2: type of return value wrong in g(): want int, got stream (STREAM)",
+		},
+		{
+			desc:     "not iterable",
+			input:    "[x for x in 1]",
+			kind:     TYPE_ERROR,
+			expected: "line 1: unable to convert to array: 1 (*object.Integer)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.Kind() != tt.kind {
+				t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", tt.kind, evalError.Kind())
+			}
+			if evalError.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, evalError.Error())
+			}
+			if tt.trace != nil && !reflect.DeepEqual(evalError.Trace(), tt.trace) {
+				t.Errorf("trace wrong.\nwant=%v\ngot=%v\n", tt.trace, evalError.Trace())
+			}
+		})
+	}
+}
+
+// the goroutines of the generators abandoned are ended by the iterations stopping them.
+func TestEval_Generator_Stopped(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{desc: "take", input: naturals + "naturals(0) -> take(3)"},
+		{desc: "error in comprehension", input: naturals + "try { [if (x > 2) { throw x } else { x } for x in naturals(0)] } catch (e) { 0 }"},
+		{desc: "error in map", input: naturals + "try { naturals(0) -> map(|x| { 10 / (2 - x) }) -> take(5) } catch (e) { 0 }"},
+		{desc: "not iterated to the end", input: naturals + "var s = naturals(0); take(s, 2); take(s, 5)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			eval(t, tt.input)
+			// a goroutine ends shortly after the generator is stopped.
+			deadline := time.Now().Add(time.Second)
+			for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if after := runtime.NumGoroutine(); after > before {
+				t.Errorf("goroutines left.\nwant=%d\ngot=%d\n", before, after)
+			}
+		})
+	}
+}
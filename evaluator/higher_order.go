@@ -0,0 +1,179 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/object"
+)
+
+// applyBuiltin calls builtin with args. the builtin functions calling the functions given as arguments
+// are applied by e, so that the calls are nested in the calls of the evaluation, and so are the ones of the tasks,
+// which are scheduled by the scheduler of e.
+func (e *evaluator) applyBuiltin(builtin *object.BuiltinFunction, args []object.Object) (object.Object, error) {
+	switch builtin {
+	case builtinFunctions["map"]:
+		return e.builtinMap(args...)
+	case builtinFunctions["filter"]:
+		return e.builtinFilter(args...)
+	case builtinFunctions["reduce"]:
+		return e.builtinReduce(args...)
+	case builtinFunctions["take"]:
+		return e.builtinTake(args...)
+	case builtinFunctions["to_array"]:
+		return e.builtinToArray(args...)
+	case builtinFunctions["spawn"]:
+		return e.builtinSpawn(args...)
+	case builtinFunctions["wait"]:
+		return Wait(e.scheduler, args...)
+	case builtinFunctions["send"]:
+		return Send(e.scheduler, args...)
+	case builtinFunctions["recv"]:
+		return Recv(e.scheduler, args...)
+	case builtinFunctions["close"]:
+		return Close(e.scheduler, args...)
+	default:
+		return builtin.Fn(args...)
+	}
+}
+
+func (e *evaluator) builtinMap(args ...object.Object) (object.Object, error) {
+	if len(args) != 2 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for map wrong: want=%d got=%d\n", 2, len(args)), kind: ARGUMENT_ERROR}
+	}
+	array, ok := args[0].(*object.Array)
+	stream, isStream := args[0].(*object.Stream)
+	if !ok && !isStream {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for map wrong: want=%T or %T\ngot=%T\n", &object.Array{}, &object.Stream{}, args[0]), kind: TYPE_ERROR}
+	}
+	function, ok := args[1].(*object.Function)
+	if !ok {
+		return nil, NotFunctionError("map", "second argument", args[1])
+	}
+	if len(function.Parameters) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of parameters of map function wrong: want=%d\ngot=%d\n", 1, len(function.Parameters)), kind: ARGUMENT_ERROR}
+	}
+	if isStream {
+		return MapStream(stream, function), nil
+	}
+
+	var convertedElems []object.Object
+	for _, elem := range array.Elements {
+		if err := e.checkContext(callLine(nil, function)); err != nil {
+			return nil, err
+		}
+		evaluated, err := e.applyFunction(nil, function, []object.Object{elem})
+		if err != nil {
+			return nil, err
+		}
+		if err := e.allocate(callLine(nil, function), 1); err != nil {
+			return nil, err
+		}
+		convertedElems = append(convertedElems, evaluated)
+	}
+
+	return &object.Array{Elements: convertedElems}, nil
+}
+
+func (e *evaluator) builtinFilter(args ...object.Object) (object.Object, error) {
+	if len(args) != 2 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for filter wrong: want=%d got=%d\n", 2, len(args)), kind: ARGUMENT_ERROR}
+	}
+	array, ok := args[0].(*object.Array)
+	stream, isStream := args[0].(*object.Stream)
+	if !ok && !isStream {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for filter wrong: want=%T or %T\ngot=%T\n", &object.Array{}, &object.Stream{}, args[0]), kind: TYPE_ERROR}
+	}
+	function, ok := args[1].(*object.Function)
+	if !ok {
+		return nil, NotFunctionError("filter", "second argument", args[1])
+	}
+	if len(function.Parameters) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of parameters of filter function wrong: want=%d\ngot=%d\n", 1, len(function.Parameters)), kind: ARGUMENT_ERROR}
+	}
+	if isStream {
+		return FilterStream(stream, function), nil
+	}
+
+	var filteredElems []object.Object
+	for _, elem := range array.Elements {
+		if err := e.checkContext(callLine(nil, function)); err != nil {
+			return nil, err
+		}
+		evaluated, err := e.applyFunction(nil, function, []object.Object{elem})
+		if err != nil {
+			return nil, err
+		}
+		if evaluated != NULL_OBJ && evaluated != FALSE_OBJ {
+			if err := e.allocate(callLine(nil, function), 1); err != nil {
+				return nil, err
+			}
+			filteredElems = append(filteredElems, elem)
+		}
+	}
+
+	return &object.Array{Elements: filteredElems}, nil
+}
+
+func (e *evaluator) builtinReduce(args ...object.Object) (object.Object, error) {
+	if len(args) != 3 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for reduce wrong: want=%d got=%d\n", 3, len(args)), kind: ARGUMENT_ERROR}
+	}
+
+	next, stop, ok := Iterate(args[0], e.apply)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for reduce wrong: want=%T or %T\ngot=%T\n", &object.Array{}, &object.Stream{}, args[0]), kind: TYPE_ERROR}
+	}
+	defer stop()
+
+	initValue := args[1]
+
+	function, ok := args[2].(*object.Function)
+	if !ok {
+		return nil, NotFunctionError("reduce", "third argument", args[2])
+	}
+	if len(function.Parameters) != 2 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of parameters of reduce function wrong: want=%d\ngot=%d\n", 2, len(function.Parameters)), kind: ARGUMENT_ERROR}
+	}
+
+	var accumulated = initValue
+	for {
+		elem, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if err := e.checkContext(callLine(nil, function)); err != nil {
+			return nil, err
+		}
+		evaluated, err := e.applyFunction(nil, function, []object.Object{accumulated, elem})
+		if err != nil {
+			return nil, err
+		}
+		accumulated = evaluated
+	}
+
+	return accumulated, nil
+}
+
+func (e *evaluator) builtinTake(args ...object.Object) (object.Object, error) {
+	return Take(e.apply, e.checkElement, args...)
+}
+
+func (e *evaluator) builtinToArray(args ...object.Object) (object.Object, error) {
+	return ToArray(e.apply, e.checkElement, args...)
+}
+
+// apply calls a function of a stream iterated by e.
+func (e *evaluator) apply(function object.Object, args ...object.Object) (object.Object, error) {
+	return e.applyFunction(nil, function, args)
+}
+
+// checkElement checks the context and the limits for an element collected from a stream.
+// the errors are located at the call of the builtin function by TracedBuiltin.
+func (e *evaluator) checkElement() error {
+	if err := e.checkContext(0); err != nil {
+		return err
+	}
+	return e.allocate(0, 1)
+}
@@ -0,0 +1,58 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+	"sync/atomic"
+)
+
+// Limits bounds the resources of an evaluation. a zero field means no limit.
+type Limits struct {
+	MaxSteps         int // the number of expressions evaluated
+	MaxCallDepth     int // the number of nested function calls, which cannot exceed the constant MaxCallDepth anyway
+	MaxArrayElements int // the total number of elements of the arrays created by array literals, comprehensions, map and filter
+}
+
+// names of the limits, reported by EvalError.Limit.
+const (
+	STEPS_LIMIT          = "steps"
+	CALL_DEPTH_LIMIT     = "call depth"
+	ARRAY_ELEMENTS_LIMIT = "array elements"
+)
+
+// EvalWithLimits evaluates node in env as EvalContext does, but returns an EvalError of kind LIMIT_ERROR
+// once the evaluation exceeds any of limits. like a CancelError, the error cannot be caught by try,
+// so that untrusted code cannot go on running after it.
+func EvalWithLimits(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) (object.Object, error) {
+	e := newEvaluator(ctx)
+	e.limits = limits
+	return e.evalRecovering(node, env)
+}
+
+// step counts the evaluation of expression against the steps limit.
+func (e *evaluator) step(expression ast.Expression) error {
+	if e.limits.MaxSteps == 0 {
+		return nil
+	}
+	if atomic.AddInt64(&e.usage.steps, 1) > int64(e.limits.MaxSteps) {
+		return limitExceeded(expression.Line(), STEPS_LIMIT, e.limits.MaxSteps)
+	}
+	return nil
+}
+
+// allocate counts count elements of an array created at line against the array elements limit.
+func (e *evaluator) allocate(line int, count int) error {
+	if e.limits.MaxArrayElements == 0 {
+		return nil
+	}
+	if atomic.AddInt64(&e.usage.elements, int64(count)) > int64(e.limits.MaxArrayElements) {
+		return limitExceeded(line, ARRAY_ELEMENTS_LIMIT, e.limits.MaxArrayElements)
+	}
+	return nil
+}
+
+func limitExceeded(line int, limit string, max int) *EvalError {
+	return &EvalError{line: line, msg: fmt.Sprintf("%s limit exceeded: more than %d", limit, max), kind: LIMIT_ERROR, limit: limit}
+}
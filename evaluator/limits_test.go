@@ -0,0 +1,162 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/parser"
+	"testing"
+)
+
+func TestEvalWithLimits(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		limits   Limits
+		expected interface{}
+	}{
+		{desc: "within limits", input: "var f = |n| { if (n == 0) { [] } else { [n] } }; len(f(3) -> map(|x| { x * 2 }))", limits: Limits{MaxSteps: 100, MaxCallDepth: 2, MaxArrayElements: 2}, expected: 1},
+		{desc: "no limits", input: "var f = |n| { if (n == 0) { 0 } else { n + f(n - 1) } }; f(100)", limits: Limits{}, expected: 5050},
+		{desc: "nested tail calls", input: "var f = |n| { if (n == 0) { 0 } else { f(n - 1) } }; f(100)", limits: Limits{MaxCallDepth: 1}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated, err := evalWithLimits(t, tt.input, tt.limits)
+			if err != nil {
+				t.Fatalf("eval error: %s\n", err)
+			}
+			testObject(t, tt.expected, evaluated)
+		})
+	}
+}
+
+func TestEvalWithLimits_Exceeded(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		limits   Limits
+		limit    string
+		expected string
+	}{
+		{
+			desc:     "steps",
+			input:    "var f = |n| { f(n + 1) }\nf(0)",
+			limits:   Limits{MaxSteps: 1000},
+			limit:    STEPS_LIMIT,
+			expected: "line 1: steps limit exceeded: more than 1000",
+		},
+		{
+			desc:     "steps not caught",
+			input:    "var f = |n| { f(n + 1) }\ntry { f(0) } catch (e) {\n  e.kind\n}",
+			limits:   Limits{MaxSteps: 1000},
+			limit:    STEPS_LIMIT,
+			expected: "line 1: steps limit exceeded: more than 1000",
+		},
+		{
+			desc:     "call depth not caught",
+			input:    "var f = |n| {\n  1 + f(n + 1)\n}\ntry { f(0) } catch (e) { 0 }",
+			limits:   Limits{MaxCallDepth: 10},
+			limit:    CALL_DEPTH_LIMIT,
+			expected: "line 2: call depth limit exceeded: more than 10",
+		},
+		{
+			desc:     "array elements not caught",
+			input:    "try {\n  [1, 2, 3]\n} catch (e) { 0 }",
+			limits:   Limits{MaxArrayElements: 2},
+			limit:    ARRAY_ELEMENTS_LIMIT,
+			expected: "line 2: array elements limit exceeded: more than 2",
+		},
+		{
+			desc:     "call depth",
+			input:    "var f = |n| {\n  1 + f(n + 1)\n}\nf(0)",
+			limits:   Limits{MaxCallDepth: 10},
+			limit:    CALL_DEPTH_LIMIT,
+			expected: "line 2: call depth limit exceeded: more than 10",
+		},
+		{
+			desc:     "call depth through callback",
+			input:    "var f = |n| {\n  [n] -> map(f)\n}\nf(0)",
+			limits:   Limits{MaxCallDepth: 10},
+			limit:    CALL_DEPTH_LIMIT,
+			expected: "line 1: call depth limit exceeded: more than 10",
+		},
+		{
+			desc:     "array literal",
+			input:    "var xs = [1, 2];\n[xs, xs]",
+			limits:   Limits{MaxArrayElements: 3},
+			limit:    ARRAY_ELEMENTS_LIMIT,
+			expected: "line 2: array elements limit exceeded: more than 3",
+		},
+		{
+			desc:     "comprehension",
+			input:    "var xs = [1, 2, 3];\n[x * y for x in xs for y in xs]",
+			limits:   Limits{MaxArrayElements: 10},
+			limit:    ARRAY_ELEMENTS_LIMIT,
+			expected: "line 2: array elements limit exceeded: more than 10",
+		},
+		{
+			desc:     "map",
+			input:    "var xs = [1, 2, 3]\nxs -> map(|x| {\n  x })",
+			limits:   Limits{MaxArrayElements: 5},
+			limit:    ARRAY_ELEMENTS_LIMIT,
+			expected: "line 2: array elements limit exceeded: more than 5",
+		},
+		{
+			desc:     "filter",
+			input:    "var xs = [1, 2, 3]\nxs -> filter(|x| { true }) -> filter(|x| { true })",
+			limits:   Limits{MaxArrayElements: 8},
+			limit:    ARRAY_ELEMENTS_LIMIT,
+			expected: "line 2: array elements limit exceeded: more than 8",
+		},
+		{
+			desc:     "infinite stream",
+			input:    "var naturals = range_from(1)\nnaturals -> to_array()",
+			limits:   Limits{MaxArrayElements: 100},
+			limit:    ARRAY_ELEMENTS_LIMIT,
+			expected: "line 2: array elements limit exceeded: more than 100",
+		},
+		{
+			desc:     "steps in generator",
+			input:    "var g = |n| {\n  yield n; [if (true) { yield x } for x in g(n + 1)] }\ng(0) -> take(1000)",
+			limits:   Limits{MaxSteps: 1000},
+			limit:    STEPS_LIMIT,
+			expected: "line 2: steps limit exceeded: more than 1000",
+		},
+		{
+			desc:     "steps in tasks",
+			input:    "var f = |n| { if (n == 0) { 0 } else { f(n - 1) } }; [wait(t) for t in [spawn(|| { f(300) }) for i in [1, 2, 3, 4]]]",
+			limits:   Limits{MaxSteps: 1000},
+			limit:    STEPS_LIMIT,
+			expected: "line 1: steps limit exceeded: more than 1000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := evalWithLimits(t, tt.input, tt.limits)
+			evalError, ok := err.(*EvalError)
+			if !ok {
+				t.Fatalf("error type wrong.\nwant=%T\ngot=%T (%v)\n", &EvalError{}, err, err)
+			}
+			if evalError.Kind() != LIMIT_ERROR {
+				t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", LIMIT_ERROR, evalError.Kind())
+			}
+			if evalError.Limit() != tt.limit {
+				t.Errorf("limit wrong.\nwant=%q\ngot=%q\n", tt.limit, evalError.Limit())
+			}
+			if evalError.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, evalError.Error())
+			}
+		})
+	}
+}
+
+func evalWithLimits(t *testing.T, input string, limits Limits) (object.Object, error) {
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err)
+	}
+	resolve(program)
+	return EvalWithLimits(context.Background(), program, object.NewEnvironment(), limits)
+}
@@ -0,0 +1,170 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+	"sync/atomic"
+)
+
+const maxMacroExpansionDepth = 100
+
+// gensymCounter numbers the names renamed by the expansions, which can run on several goroutines at once.
+var gensymCounter int64
+
+// DefineMacros evaluates the top-level macro definitions (var name = macro |...| { ... })
+// into env and removes them from program. the bodies are resolved once here, and evaluated at each expansion.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	var statements []ast.Statement
+	for _, statement := range program.Statements {
+		varStatement, ok := statement.(*ast.VarStatement)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		macroLiteral, ok := varStatement.Expression.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+
+		// the names undefined in the body are reported when it is evaluated.
+		NewResolver().Resolve(macroLiteral)
+		macro := &object.Macro{Parameters: macroLiteral.Parameters, Body: macroLiteral.Body, Env: env}
+		env.Set(varStatement.Identifier.Name, macro)
+	}
+	program.Statements = statements
+}
+
+// ExpandMacros replaces every call of a macro defined in env with its expansion.
+// The arguments are passed to the macro as quoted, unevaluated AST.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return expandMacros(program, env, 0)
+}
+
+func expandMacros(node ast.Node, env *object.Environment, depth int) (ast.Node, error) {
+	var err error
+	expanded := ast.Rewrite(node, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+		functionCall, ok := node.(*ast.FunctionCall)
+		if !ok {
+			return node
+		}
+		macro, ok := lookupMacro(functionCall, env)
+		if !ok {
+			return node
+		}
+		if depth >= maxMacroExpansionDepth {
+			err = &EvalError{line: functionCall.Line(), msg: fmt.Sprintf("macro expansion too deep: %s", functionCall)}
+			return node
+		}
+
+		var expansion ast.Node
+		expansion, err = expandMacroCall(functionCall, macro)
+		if err != nil {
+			return node
+		}
+		expansion, err = expandMacros(expansion, env, depth+1)
+		if err != nil {
+			return node
+		}
+		return expansion
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+func lookupMacro(functionCall *ast.FunctionCall, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := functionCall.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := env.Get(identifier.Name).(*object.Macro)
+	return macro, ok
+}
+
+func expandMacroCall(functionCall *ast.FunctionCall, macro *object.Macro) (ast.Node, error) {
+	if len(functionCall.Arguments) != len(macro.Parameters) {
+		return nil, &EvalError{line: functionCall.Line(), msg: fmt.Sprintf("number of arguments for %s wrong:\nwant=%d\ngot=%d\n", functionCall, len(macro.Parameters), len(functionCall.Arguments)), kind: ARGUMENT_ERROR}
+	}
+
+	enclosedEnv := object.NewEnclosedEnvironment(macro.Env)
+	for i, arg := range functionCall.Arguments {
+		enclosedEnv.Set(macro.Parameters[i].Name, &object.Quote{Node: arg, Spliced: []ast.Node{arg}, Source: functionCall.Source(i)})
+	}
+
+	evaluated, err := Eval(macro.Body, enclosedEnv)
+	if err != nil {
+		return nil, err
+	}
+	quoted, ok := unwrapReturnValue(evaluated).(*object.Quote)
+	if !ok {
+		return nil, &EvalError{line: functionCall.Line(), msg: fmt.Sprintf("macro must return quoted expression: %s returned %+v", functionCall, evaluated), kind: TYPE_ERROR}
+	}
+
+	return renameMacroBindings(quoted), nil
+}
+
+// renameMacroBindings makes the expansion hygienic.
+// every name bound by the macro itself (var, parameters, catch and comprehension variables) is renamed to a fresh one,
+// so it neither captures nor shadows the names used in the code passed by the caller.
+func renameMacroBindings(quoted *object.Quote) ast.Node {
+	// nodes which must keep their names: the caller's code and field names.
+	keep := make(map[ast.Node]bool)
+	for _, spliced := range quoted.Spliced {
+		ast.Inspect(spliced, func(node ast.Node) bool {
+			if node != nil {
+				keep[node] = true
+			}
+			return true
+		})
+	}
+	ast.Inspect(quoted.Node, func(node ast.Node) bool {
+		if fieldExpression, ok := node.(*ast.FieldExpression); ok {
+			keep[fieldExpression.Field] = true
+		}
+		return true
+	})
+
+	renames := make(map[string]string)
+	bind := func(identifier *ast.Identifier) {
+		if _, ok := renames[identifier.Name]; !ok {
+			renames[identifier.Name] = fmt.Sprintf("%s__%d", identifier.Name, atomic.AddInt64(&gensymCounter, 1))
+		}
+	}
+	ast.Inspect(quoted.Node, func(node ast.Node) bool {
+		if keep[node] {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.VarStatement:
+			bind(node.Identifier)
+		case *ast.FunctionLiteral:
+			for _, parameter := range node.Parameters {
+				bind(parameter)
+			}
+		case *ast.TryExpression:
+			bind(node.Parameter)
+		case *ast.ComprehensionClause:
+			bind(node.Variable)
+		}
+		return true
+	})
+
+	// the identifiers not renamed are copied as well, since the macro body and the code passed by the caller
+	// may be spliced into several places, and the slots of the variables are assigned per identifier.
+	return ast.Rewrite(quoted.Node, func(node ast.Node) ast.Node {
+		identifier, ok := node.(*ast.Identifier)
+		if !ok {
+			return node
+		}
+		if renamed, ok := renames[identifier.Name]; ok && !keep[identifier] {
+			return ast.NewIdentifier(renamed, identifier.Line())
+		}
+		return ast.NewIdentifier(identifier.Name, identifier.Line())
+	})
+}
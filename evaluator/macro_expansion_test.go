@@ -0,0 +1,331 @@
+package evaluator
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/parser"
+	"sync"
+	"testing"
+)
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "quote(5)",
+			input:    "quote(5)",
+			expected: "5",
+		},
+		{
+			desc:     "quote(5+8)",
+			input:    "quote(5 + 8)",
+			expected: "(5 + 8)",
+		},
+		{
+			desc:     "quote(foo)",
+			input:    "quote(foo)",
+			expected: "foo",
+		},
+		{
+			desc:     "quote(unquote(4+4))",
+			input:    "quote(unquote(4 + 4))",
+			expected: "8",
+		},
+		{
+			desc:     "quote(8+unquote(4+4))",
+			input:    "quote(8 + unquote(4 + 4))",
+			expected: "(8 + 8)",
+		},
+		{
+			desc:     "quote(unquote(true==false))",
+			input:    "quote(unquote(true == false))",
+			expected: "false",
+		},
+		{
+			desc:     "unquote string",
+			input:    `quote(unquote("foo" + "bar"))`,
+			expected: `"foobar"`,
+		},
+		{
+			desc:     "unquote quote",
+			input:    "var q = quote(4 + 4); quote(unquote(q) * unquote(q))",
+			expected: "((4 + 4) * (4 + 4))",
+		},
+		{
+			desc:     "unquote does not change the original quote",
+			input:    "var f = |x| { quote(unquote(x) + 1) }; f(1); f(2)",
+			expected: "(2 + 1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated := eval(t, tt.input)
+			quoted, ok := evaluated.(*object.Quote)
+			if !ok {
+				t.Fatalf("unable to convert to quote: %+v (%T)\n", evaluated, evaluated)
+			}
+			if actual := quoted.Node.String(); actual != tt.expected {
+				t.Errorf("quoted node wrong.\nwant=%q\ngot=%q\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+var number = 1;
+var function = |x, y| { x + y };
+var mymacro = macro |x, y| { x + y; };
+`
+	program := parseMacroProgram(t, input)
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("statements length wrong.\nwant=%d\ngot=%d\n", 2, len(program.Statements))
+	}
+	if env.Get("number") != nil {
+		t.Errorf("number should not be defined")
+	}
+	if env.Get("function") != nil {
+		t.Errorf("function should not be defined")
+	}
+	macro, ok := env.Get("mymacro").(*object.Macro)
+	if !ok {
+		t.Fatalf("unable to convert to macro: %+v\n", env.Get("mymacro"))
+	}
+	if len(macro.Parameters) != 2 || macro.Parameters[0].Name != "x" || macro.Parameters[1].Name != "y" {
+		t.Errorf("macro parameters wrong: %+v\n", macro.Parameters)
+	}
+	if expected := "{(x + y);}"; macro.Body.String() != expected {
+		t.Errorf("macro body wrong.\nwant=%q\ngot=%q\n", expected, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc: "infix",
+			input: `
+var infix = macro || { quote(1 + 2) };
+infix();`,
+			expected: "(1 + 2)",
+		},
+		{
+			desc: "reverse",
+			input: `
+var reverse = macro |a, b| { quote(unquote(b) - unquote(a)) };
+reverse(2 + 2, 10 - 5);`,
+			expected: "(10 - 5) - (2 + 2)",
+		},
+		{
+			desc: "unless",
+			input: `
+var unless = macro |cond, cons, alt| {
+  quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) })
+};
+unless(10 > 5, puts("not greater"), puts("greater"));`,
+			expected: `if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			desc: "arrow",
+			input: `
+var twice = macro |x| { quote(unquote(x) * 2) };
+3 -> twice();`,
+			expected: "3 * 2",
+		},
+		{
+			desc: "nested expansion",
+			input: `
+var twice = macro |x| { quote(unquote(x) * 2) };
+var quadruple = macro |x| { quote(twice(twice(unquote(x)))) };
+quadruple(1);`,
+			expected: "(1 * 2) * 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseMacroProgram(t, tt.input)
+			env := object.NewEnvironment()
+			DefineMacros(program, env)
+			expanded, err := ExpandMacros(program, env)
+			if err != nil {
+				t.Fatalf("expand error: %s\n", err.Error())
+			}
+
+			expected := parseMacroProgram(t, tt.expected)
+			if expanded.String() != expected.String() {
+				t.Errorf("expanded program wrong.\nwant=%q\ngot=%q\n", expected.String(), expanded.String())
+			}
+		})
+	}
+}
+
+func TestExpandMacros_Eval(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected interface{}
+	}{
+		{
+			desc: "hygiene: macro binding does not capture caller's name",
+			input: `
+var with_double = macro |x| { quote(|| { var tmp = unquote(x) * 2; tmp }()) };
+var tmp = 5;
+with_double(tmp + 1)`,
+			expected: 12,
+		},
+		{
+			desc: "hygiene: macro binding does not shadow caller's name",
+			input: `
+var plus_tmp = macro |body| { quote(|tmp| { unquote(body) }(100)) };
+var tmp = 1;
+plus_tmp(tmp + 1)`,
+			expected: 2,
+		},
+		{
+			desc: "source returns the text of a macro argument as it was written",
+			input: `
+var assert_eq = macro |actual, expected| {
+  quote(if (unquote(actual) != unquote(expected)) { throw unquote(source(actual)) + " != " + unquote(source(expected)) } else { true })
+};
+try { assert_eq(1+ (1), 3) } catch (e) { e.message }`,
+			expected: "1+ (1) != 3",
+		},
+		{
+			desc: "source returns the formatted code of quoted code without text",
+			input: `
+var show = macro |x| { var q = quote((unquote(x)) * 2); quote(unquote(source(q))) };
+show(1+1)`,
+			expected: "(1 + 1) * 2",
+		},
+		{
+			desc: "assert_eq passes",
+			input: `
+var assert_eq = macro |actual, expected| {
+  quote(if (unquote(actual) != unquote(expected)) { throw unquote(source(actual)) } else { true })
+};
+assert_eq(len([1, 2]), 2)`,
+			expected: true,
+		},
+		{
+			desc: "macro body may use functions",
+			input: `
+var n = macro |x| { var double = |q| { quote(unquote(q) * 2) }; double(x) };
+n(21)`,
+			expected: 42,
+		},
+		{
+			desc: "argument spliced into different frames",
+			input: `
+var both = macro |x| { quote([unquote(x), || { unquote(x) }]) };
+var f = |a| { var pair = both(a); pair[0] + pair[1]() };
+f(3)`,
+			expected: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseMacroProgram(t, tt.input)
+			macroEnv := object.NewEnvironment()
+			DefineMacros(program, macroEnv)
+			expanded, err := ExpandMacros(program, macroEnv)
+			if err != nil {
+				t.Fatalf("expand error: %s\n", err.Error())
+			}
+
+			resolve(expanded)
+			evaluated, err := Eval(expanded, object.NewEnvironment())
+			if err != nil {
+				t.Fatalf("eval error: %s\n", err.Error())
+			}
+			testObject(t, tt.expected, evaluated)
+		})
+	}
+}
+
+func TestExpandMacros_Error(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{
+			desc:  "wrong number of arguments",
+			input: "var m = macro |x| { x }; m(1, 2)",
+		},
+		{
+			desc:  "not a quote",
+			input: "var m = macro |x| { 1 }; m(1)",
+		},
+		{
+			desc:  "infinite expansion",
+			input: "var m = macro |x| { quote(m(unquote(x))) }; m(1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseMacroProgram(t, tt.input)
+			env := object.NewEnvironment()
+			DefineMacros(program, env)
+			if _, err := ExpandMacros(program, env); err == nil {
+				t.Errorf("error expected but got nil")
+			}
+		})
+	}
+}
+
+func TestExpandMacros_Concurrent(t *testing.T) {
+	input := "var twice = macro |x| { quote(|| { var tmp = unquote(x); tmp + tmp }()) }; twice(21)"
+	expanded := make([]ast.Node, 4)
+	errs := make([]error, len(expanded))
+	var wg sync.WaitGroup
+	for i := range expanded {
+		program := parseMacroProgram(t, input)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			env := object.NewEnvironment()
+			DefineMacros(program, env)
+			expanded[i], errs[i] = ExpandMacros(program, env)
+		}(i)
+	}
+	wg.Wait()
+
+	names := make(map[string]bool)
+	for i := range expanded {
+		if errs[i] != nil {
+			t.Fatalf("expand error: %s\n", errs[i])
+		}
+		ast.Inspect(expanded[i], func(node ast.Node) bool {
+			if varStatement, ok := node.(*ast.VarStatement); ok {
+				if names[varStatement.Identifier.Name] {
+					t.Errorf("name renamed twice: %s", varStatement.Identifier.Name)
+				}
+				names[varStatement.Identifier.Name] = true
+			}
+			return true
+		})
+	}
+}
+
+func parseMacroProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err.Error())
+	}
+	return program
+}
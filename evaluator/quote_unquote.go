@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+)
+
+func isQuoteCall(functionCall *ast.FunctionCall) bool {
+	identifier, ok := functionCall.Function.(*ast.Identifier)
+	return ok && identifier.Name == "quote" && len(functionCall.Arguments) == 1
+}
+
+func isUnquoteCall(node ast.Node) bool {
+	functionCall, ok := node.(*ast.FunctionCall)
+	if !ok {
+		return false
+	}
+	identifier, ok := functionCall.Function.(*ast.Identifier)
+	return ok && identifier.Name == "unquote" && len(functionCall.Arguments) == 1
+}
+
+// Quote returns node without evaluating it, except for unquote(...) calls
+// whose arguments are evaluated by unquote and spliced into the quoted tree.
+func Quote(node ast.Node, unquote func(ast.Expression) (object.Object, error)) (object.Object, error) {
+	var spliced []ast.Node
+	var err error
+	quoted := ast.Rewrite(node, func(node ast.Node) ast.Node {
+		if err != nil || !isUnquoteCall(node) {
+			return node
+		}
+		unquoteCall := node.(*ast.FunctionCall)
+
+		var evaluated object.Object
+		evaluated, err = unquote(unquoteCall.Arguments[0])
+		if err != nil {
+			return node
+		}
+		if quoted, ok := evaluated.(*object.Quote); ok {
+			spliced = append(spliced, quoted.Spliced...)
+		}
+
+		var converted ast.Node
+		converted, err = convertObjectToASTNode(evaluated, unquoteCall.Line())
+		if err != nil {
+			return node
+		}
+		return converted
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &object.Quote{Node: quoted, Spliced: spliced}, nil
+}
+
+func convertObjectToASTNode(obj object.Object, line int) (ast.Expression, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return ast.NewIntegerLiteral(obj.Value, line), nil
+	case *object.Boolean:
+		return ast.NewBooleanLiteral(obj.Value, line), nil
+	case *object.String:
+		return ast.NewStringLiteral(obj.Value, line), nil
+	case *object.Array:
+		elements := []ast.Expression{}
+		for _, elem := range obj.Elements {
+			element, err := convertObjectToASTNode(elem, line)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return ast.NewArrayLiteral(elements, line), nil
+	case *object.Quote:
+		expression, ok := obj.Node.(ast.Expression)
+		if !ok {
+			return nil, &EvalError{line: line, msg: fmt.Sprintf("unable to unquote non-expression: %s", obj.Node), kind: TYPE_ERROR}
+		}
+		return expression, nil
+	default:
+		return nil, &EvalError{line: line, msg: fmt.Sprintf("unable to unquote: %+v (%T)", obj, obj), kind: TYPE_ERROR}
+	}
+}
@@ -0,0 +1,335 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"strings"
+)
+
+// Resolver binds every identifier in a program to the scope declaring it, before the program is evaluated.
+// the global declarations are kept between programs, so that a Resolver can be used for the lines of a REPL.
+type Resolver struct {
+	globals map[string]bool
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{globals: make(map[string]bool)}
+}
+
+// scope corresponds to an environment created during the evaluation. the environment of a function call,
+// a catch handler or an iteration of a comprehension clause is a frame, which stores the variables in slots.
+// the top-level environment, and the one the body of a macro is evaluated in, stores them by name.
+type scope struct {
+	outer    *scope
+	function bool                 // the environment of a function call, or of the body of a macro
+	literal  *ast.FunctionLiteral // the function called, nil for the other scopes
+	frame    bool                 // whether the variables are stored in slots
+	global   bool                 // the top-level environment
+	declared map[string]bool      // the names declared so far
+	hoisted  map[string]bool      // the names declared anywhere in the scope
+	slots    map[string]int       // the slots of the names used so far in a frame
+	size     int                  // the number of the slots of a frame
+}
+
+func newScope(outer *scope, function bool) *scope {
+	return &scope{outer: outer, function: function, declared: make(map[string]bool), hoisted: make(map[string]bool)}
+}
+
+func newFrame(outer *scope, literal *ast.FunctionLiteral) *scope {
+	s := newScope(outer, literal != nil)
+	s.literal = literal
+	s.frame = true
+	s.slots = make(map[string]int)
+	return s
+}
+
+func (s *scope) slot(name string) int {
+	if index, ok := s.slots[name]; ok {
+		return index
+	}
+	index := s.size
+	s.slots[name] = index
+	s.size++
+	return index
+}
+
+// Resolve sets Scope of the identifiers in program, and the slots the evaluator stores the variables in:
+// Locations of the identifiers, and the number of slots of the frames created by the evaluation,
+// the same way as package compiler does. program is evaluated with the slots of its last resolution,
+// so a program rewritten after it is resolved, such as by package optimizer, is resolved again.
+// a ResolveError is returned for the identifiers which are neither declared nor builtin functions,
+// but the whole program is resolved, leaving the identifiers to be reported when they are evaluated.
+func (r *Resolver) Resolve(program ast.Node) error {
+	global := newScope(nil, false)
+	global.global = true
+	for name := range r.globals {
+		global.declared[name] = true
+		global.hoisted[name] = true
+	}
+	ast.Hoist(global.hoisted, program)
+
+	resolver := &resolver{scope: global}
+	resolver.resolve(program)
+	if p, ok := program.(*ast.Program); ok {
+		p.Resolved = true
+	}
+	if len(resolver.errors) > 0 {
+		return &ResolveError{Errors: resolver.errors}
+	}
+
+	for name := range global.declared {
+		r.globals[name] = true
+	}
+	return nil
+}
+
+// ResolveError is the undefined identifiers found by Resolve, each of them an EvalError of kind NAME_ERROR,
+// in the order they are used in the program.
+type ResolveError struct {
+	Errors []*EvalError
+}
+
+func (re *ResolveError) Error() string {
+	messages := make([]string, len(re.Errors))
+	for i, err := range re.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+type resolver struct {
+	scope  *scope
+	errors []*EvalError
+}
+
+// declare declares identifier in the current scope, setting the slot it is stored in,
+// or no location if it is stored by name.
+func (r *resolver) declare(identifier *ast.Identifier) {
+	r.scope.declared[identifier.Name] = true
+	r.scope.hoisted[identifier.Name] = true
+	if r.scope.global {
+		identifier.Scope = ast.GLOBAL
+	} else {
+		identifier.Scope = ast.LOCAL
+	}
+	identifier.Locations = nil
+	if r.scope.frame {
+		identifier.Locations = []ast.Location{{Depth: 0, Index: r.scope.slot(identifier.Name)}}
+	}
+}
+
+// parameter declares the parameter at index, which is bound to the slot of the same index.
+// a name repeated in the parameters refers to the last of them, as the arguments are bound in order.
+func (r *resolver) parameter(identifier *ast.Identifier, index int) {
+	r.scope.declared[identifier.Name] = true
+	r.scope.hoisted[identifier.Name] = true
+	identifier.Scope = ast.LOCAL
+	r.scope.slots[identifier.Name] = index
+	r.scope.size = index + 1
+}
+
+// lookup resolves identifier by searching the scopes from the innermost.
+// a name used inside a function may be declared after the function in the enclosing scopes,
+// since the function is evaluated only when it is called.
+func (r *resolver) lookup(identifier *ast.Identifier) {
+	r.locate(identifier)
+
+	inClosure := false
+	for s := r.scope; s != nil; s = s.outer {
+		if s.declared[identifier.Name] || inClosure && s.hoisted[identifier.Name] {
+			switch {
+			case s.global:
+				identifier.Scope = ast.GLOBAL
+			case inClosure:
+				identifier.Scope = ast.CLOSURE
+			default:
+				identifier.Scope = ast.LOCAL
+			}
+			return
+		}
+		if s.function {
+			inClosure = true
+		}
+	}
+
+	if _, ok := builtinFunctions[identifier.Name]; ok {
+		identifier.Scope = ast.BUILTIN
+		return
+	}
+	identifier.Scope = ast.UNRESOLVED
+	r.errors = append(r.errors, &EvalError{line: identifier.Line(), msg: fmt.Sprintf("undefined identifier: %q", identifier.Name), kind: NAME_ERROR})
+}
+
+// locate sets the locations of identifier: the slots of the enclosing frames declaring the name anywhere, from the innermost.
+// the identifier refers to the first of them which has been set, as the environments are searched from the innermost,
+// and to the variable stored by name if none of them has been set. each frame located is counted as captured
+// by the functions in between.
+func (r *resolver) locate(identifier *ast.Identifier) {
+	identifier.Locations = nil
+	depth := 0
+	for s := r.scope; s != nil && s.frame; s = s.outer {
+		if s.hoisted[identifier.Name] {
+			identifier.Locations = append(identifier.Locations, ast.Location{Depth: depth, Index: s.slot(identifier.Name)})
+			r.capture(depth)
+		}
+		depth++
+	}
+}
+
+// capture counts the frame depth levels out as referred to by the bodies of the functions called by the frames in between.
+func (r *resolver) capture(depth int) {
+	s := r.scope
+	for i := 0; i < depth; i++ {
+		if s.literal != nil && s.literal.Captured < depth-i {
+			s.literal.Captured = depth - i
+		}
+		s = s.outer
+	}
+}
+
+func (r *resolver) enter(s *scope) {
+	r.scope = s
+}
+
+func (r *resolver) leave() {
+	r.scope = r.scope.outer
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		r.resolveStatements(node.Statements)
+	case *ast.BlockStatement:
+		r.resolveStatements(node.Statements)
+	case *ast.VarStatement:
+		r.resolve(node.Expression)
+		r.declare(node.Identifier)
+	case *ast.ReturnStatement:
+		r.resolve(node.Expression)
+	case *ast.ThrowStatement:
+		r.resolve(node.Expression)
+	case *ast.YieldStatement:
+		r.resolve(node.Expression)
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+	case *ast.Identifier:
+		r.lookup(node)
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+	case *ast.FunctionLiteral:
+		r.resolveFunction(node)
+	case *ast.MacroLiteral:
+		r.resolveMacro(node)
+	case *ast.FunctionCall:
+		if isQuoteCall(node) {
+			r.resolveQuote(node.Arguments[0])
+			return
+		}
+		r.resolveExpressions(node.Arguments)
+		r.resolve(node.Function)
+	case *ast.MethodCall:
+		r.resolve(node.Receiver)
+		r.resolveExpressions(node.Arguments)
+		r.resolve(node.Method)
+	case *ast.ArrayLiteral:
+		r.resolveExpressions(node.Elements)
+	case *ast.ArrayComprehension:
+		r.resolveComprehensionClauses(node, 0)
+	case *ast.IndexExpression:
+		r.resolve(node.Array)
+		r.resolve(node.Index)
+	case *ast.FieldExpression:
+		r.resolve(node.Object)
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+	case *ast.TryExpression:
+		r.resolve(node.Body)
+		r.enter(newFrame(r.scope, nil))
+		r.declare(node.Parameter)
+		ast.Hoist(r.scope.hoisted, node.Handler)
+		r.resolve(node.Handler)
+		node.NumSlots = r.scope.size
+		r.leave()
+	}
+}
+
+func (r *resolver) resolveStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		r.resolve(statement)
+	}
+}
+
+func (r *resolver) resolveExpressions(expressions []ast.Expression) {
+	for _, expression := range expressions {
+		r.resolve(expression)
+	}
+}
+
+func (r *resolver) resolveFunction(functionLiteral *ast.FunctionLiteral) {
+	functionLiteral.Captured = 0
+	r.enter(newFrame(r.scope, functionLiteral))
+	for i, parameter := range functionLiteral.Parameters {
+		r.parameter(parameter, i)
+	}
+	ast.Hoist(r.scope.hoisted, functionLiteral.Body)
+	r.resolve(functionLiteral.Body)
+	functionLiteral.NumSlots = r.scope.size
+	functionLiteral.Generator = ast.Yields(functionLiteral.Body)
+	r.leave()
+}
+
+// resolveMacro resolves the body of a macro, which is evaluated in an environment storing the parameters by name.
+func (r *resolver) resolveMacro(macroLiteral *ast.MacroLiteral) {
+	r.enter(newScope(r.scope, true))
+	for _, parameter := range macroLiteral.Parameters {
+		r.declare(parameter)
+	}
+	ast.Hoist(r.scope.hoisted, macroLiteral.Body)
+	r.resolve(macroLiteral.Body)
+	r.leave()
+}
+
+// resolveComprehensionClauses enters a frame for the clause at index, in which the following clauses are evaluated.
+func (r *resolver) resolveComprehensionClauses(arrayComprehension *ast.ArrayComprehension, index int) {
+	clauses := arrayComprehension.Clauses
+	if index == len(clauses) {
+		r.resolve(arrayComprehension.Element)
+		return
+	}
+
+	clause := clauses[index]
+	r.resolve(clause.Iterable)
+	r.enter(newFrame(r.scope, nil))
+	r.declare(clause.Variable)
+	ast.Hoist(r.scope.hoisted, clause.Condition)
+	if index+1 < len(clauses) {
+		ast.Hoist(r.scope.hoisted, clauses[index+1].Iterable)
+	} else {
+		ast.Hoist(r.scope.hoisted, arrayComprehension.Element)
+	}
+	if clause.Condition != nil {
+		r.resolve(clause.Condition)
+	}
+	r.resolveComprehensionClauses(arrayComprehension, index+1)
+	clause.NumSlots = r.scope.size
+	r.leave()
+}
+
+// resolveQuote resolves only the arguments of the unquote calls in quoted code,
+// since the rest is not evaluated.
+func (r *resolver) resolveQuote(quoted ast.Node) {
+	ast.Inspect(quoted, func(node ast.Node) bool {
+		if isUnquoteCall(node) {
+			r.resolve(node.(*ast.FunctionCall).Arguments[0])
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,275 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected []string // name:scope of the resolved identifiers in the order of ast.Walk
+	}{
+		{
+			desc:     "global",
+			input:    "var x = 1; x + 1",
+			expected: []string{"x:global", "x:global"},
+		},
+		{
+			desc:  "local and closure",
+			input: "var a = 1; var f = |x| { var y = x; |z| { x + y + z + a } }",
+			expected: []string{
+				"a:global",
+				"f:global", "x:local", "y:local", "x:local",
+				"z:local", "x:closure", "y:closure", "z:local", "a:global",
+			},
+		},
+		{
+			desc:     "builtin",
+			input:    "len([1]); var len = 1; len",
+			expected: []string{"len:builtin", "len:global", "len:global"},
+		},
+		{
+			desc:     "declared later outside function",
+			input:    "var f = || { g() }; var g = || { f() }",
+			expected: []string{"f:global", "g:global", "g:global", "f:global"},
+		},
+		{
+			desc:     "var in if block",
+			input:    "|| { if (true) { var x = 1 } x }",
+			expected: []string{"x:local", "x:local"},
+		},
+		{
+			desc:     "array comprehension",
+			input:    "var xs = [1]; [x + y for x in xs for y in [x]]",
+			expected: []string{"xs:global", "x:local", "y:local", "x:local", "xs:global", "y:local", "x:local"},
+		},
+		{
+			desc:     "catch",
+			input:    "|x| { try { throw x } catch (e) { x + e.line } }",
+			expected: []string{"x:local", "x:local", "e:local", "x:local", "e:local"},
+		},
+		{
+			desc:     "quote",
+			input:    "var b = 1; quote(a + unquote(b))",
+			expected: []string{"b:global", "b:global"},
+		},
+		{
+			desc:     "method call",
+			input:    "var double = |x| { x * 2 }; 2.double()",
+			expected: []string{"double:global", "x:local", "x:local", "double:global"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseMacroProgram(t, tt.input)
+			if err := NewResolver().Resolve(program); err != nil {
+				t.Fatalf("err occurred: %s", err)
+			}
+
+			actual := []string{}
+			ast.Inspect(program, func(node ast.Node) bool {
+				if identifier, ok := node.(*ast.Identifier); ok && identifier.Scope != ast.UNRESOLVED {
+					actual = append(actual, fmt.Sprintf("%s:%s", identifier.Name, identifier.Scope))
+				}
+				return true
+			})
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("resolved identifiers wrong.\nwant=%v\ngot=%v\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "undefined",
+			input:    "puts(x)",
+			expected: `line 1: undefined identifier: "x"`,
+		},
+		{
+			desc:     "in branch",
+			input:    "if (false) {\n  puts(typo)\n}",
+			expected: `line 2: undefined identifier: "typo"`,
+		},
+		{
+			desc:     "used before declared",
+			input:    "puts(x); var x = 1",
+			expected: `line 1: undefined identifier: "x"`,
+		},
+		{
+			desc:     "used before declared in function",
+			input:    "|| { puts(y); var y = 1 }",
+			expected: `line 1: undefined identifier: "y"`,
+		},
+		{
+			desc:     "catch parameter out of handler",
+			input:    "try { 1 } catch (e) { 2 }; e",
+			expected: `line 1: undefined identifier: "e"`,
+		},
+		{
+			desc:     "comprehension variable out of comprehension",
+			input:    "[x for x in [1]]; x",
+			expected: `line 1: undefined identifier: "x"`,
+		},
+		{
+			desc:     "unquote out of quote",
+			input:    "unquote(1)",
+			expected: `line 1: undefined identifier: "unquote"`,
+		},
+		{
+			desc:     "every undefined identifier",
+			input:    "var f = |x| {\n  pritn(x)\n}\nvar y = undefined_thing + f(1)\nundefined_thing",
+			expected: "line 2: undefined identifier: \"pritn\"\nline 4: undefined identifier: \"undefined_thing\"\nline 5: undefined identifier: \"undefined_thing\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := NewResolver().Resolve(parseMacroProgram(t, tt.input))
+			if err == nil {
+				t.Fatalf("error should occur")
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, err.Error())
+			}
+			resolveError, ok := err.(*ResolveError)
+			if !ok {
+				t.Fatalf("error type wrong.\nwant=%T\ngot=%T (%v)\n", &ResolveError{}, err, err)
+			}
+			for _, evalError := range resolveError.Errors {
+				if evalError.Kind() != NAME_ERROR {
+					t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", NAME_ERROR, evalError.Kind())
+				}
+			}
+		})
+	}
+}
+
+func TestResolver_Resolve_KeepsGlobals(t *testing.T) {
+	resolver := NewResolver()
+	inputs := []struct {
+		input string
+		ok    bool
+	}{
+		{input: "var x = 1", ok: true},
+		{input: "x", ok: true},
+		{input: "var y = 1; z", ok: false},
+		{input: "y", ok: false},
+	}
+
+	for _, tt := range inputs {
+		err := resolver.Resolve(parseMacroProgram(t, tt.input))
+		if (err == nil) != tt.ok {
+			t.Errorf("result of %q wrong.\nwant ok=%v\ngot=%v\n", tt.input, tt.ok, err)
+		}
+	}
+}
+
+func TestResolver_Eval(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected interface{}
+	}{
+		{
+			desc:     "builtin",
+			input:    "len([1, 2])",
+			expected: 2,
+		},
+		{
+			desc:     "shadowed builtin",
+			input:    "var len = |x| { 42 }; len([1, 2])",
+			expected: 42,
+		},
+		{
+			desc:     "closure",
+			input:    "var add = |x| { |y| { x + y } }; var add_two = add(2); [1, 2] -> map(add_two) -> reduce(0, |acc, x| { acc + x })",
+			expected: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseMacroProgram(t, tt.input)
+			if err := NewResolver().Resolve(program); err != nil {
+				t.Fatalf("err occurred: %s", err)
+			}
+			evaluated, err := Eval(program, object.NewEnvironment())
+			if err != nil {
+				t.Fatalf("err occurred: %s", err)
+			}
+			testObject(t, tt.expected, evaluated)
+		})
+	}
+}
+
+// a resolved program is only read by the evaluations, which can evaluate it at the same time.
+func TestEval_Unresolved(t *testing.T) {
+	env := object.NewEnvironment()
+	inputs := []struct {
+		input    string
+		expected interface{}
+	}{
+		{input: "var f = |x| { var y = x + 1; [y * z for z in [1, 2]] }; f(2)", expected: []interface{}{3, 6}},
+		{input: "var g = |n| { try { f(n)[1] } catch (e) { 0 } }; g(3)", expected: 8},
+	}
+
+	for _, tt := range inputs {
+		program := parseMacroProgram(t, tt.input)
+		evaluated, err := Eval(program, env)
+		if err != nil {
+			t.Fatalf("err occurred: %s", err)
+		}
+		if expected, ok := tt.expected.([]interface{}); ok {
+			array, ok := evaluated.(*object.Array)
+			if !ok || len(array.Elements) != len(expected) {
+				t.Fatalf("value wrong.\nwant=%v\ngot=%v\n", expected, evaluated)
+			}
+			for i, element := range expected {
+				testObject(t, element, array.Elements[i])
+			}
+			continue
+		}
+		testObject(t, tt.expected, evaluated)
+	}
+}
+
+func TestResolver_Eval_Concurrent(t *testing.T) {
+	program := parseMacroProgram(t, "var f = |n| { [x * n for x in [1, 2, 3]] }; f(2)")
+	if err := NewResolver().Resolve(program); err != nil {
+		t.Fatalf("err occurred: %s", err)
+	}
+
+	evaluated := make([]object.Object, 4)
+	errs := make([]error, len(evaluated))
+	var wg sync.WaitGroup
+	for i := range evaluated {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			evaluated[i], errs[i] = Eval(program, object.NewEnvironment())
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range evaluated {
+		if errs[i] != nil {
+			t.Fatalf("err occurred: %s", errs[i])
+		}
+		if evaluated[i].String() != "[2, 4, 6]" {
+			t.Errorf("value wrong.\nwant=%s\ngot=%s\n", "[2, 4, 6]", evaluated[i])
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+	"math/rand"
+	"sync"
+)
+
+// the tasks of an evaluation are the evaluation itself and the functions run by spawn, each on a goroutine of its own.
+// the channels and the results of the tasks are shared by them, and accessed only through the scheduler of the evaluation.
+// a task blocked by wait, send or recv is woken once it can go on, or with an error once every task is blocked
+// or the evaluation is canceled. the tasks still running when the evaluation ends are canceled,
+// and the evaluation returns once they have unwound.
+
+// Scheduler decides when the tasks of an evaluation run. a scheduler is used by a single evaluation.
+type Scheduler interface {
+	// Begin starts an evaluation with ctx, and returns the context of the evaluation and its tasks, canceled by End.
+	// it is called by the backends, as well as End.
+	Begin(ctx context.Context) context.Context
+	// End cancels the tasks left once the evaluation is evaluated, and waits for them to end.
+	End()
+	// spawn runs run as a new task, whose value and error are set to task once it returns.
+	spawn(task *object.Task, run func() (object.Object, error)) error
+	// block blocks the task calling it until ready reports true, and then calls do.
+	// ready and do are called exclusively of the other tasks, so that they can access the state shared by the tasks.
+	block(ready func() bool, do func()) error
+}
+
+// EvalWithScheduler evaluates node in env as EvalContext does, running the tasks spawned by it with scheduler,
+// such as the one returned by NewDeterministicScheduler to reproduce an interleaving of the tasks.
+func EvalWithScheduler(ctx context.Context, node ast.Node, env *object.Environment, scheduler Scheduler) (object.Object, error) {
+	e := newEvaluator(ctx)
+	e.scheduler = scheduler
+	return e.evalRecovering(node, env)
+}
+
+// NewParallelScheduler returns the scheduler running the tasks in parallel, which is used unless another one is given.
+func NewParallelScheduler() Scheduler {
+	s := &parallelScheduler{ctx: context.Background(), running: 1, blocked: make(map[*waiter]bool)}
+	s.changed = sync.NewCond(&s.mu)
+	return s
+}
+
+type parallelScheduler struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex // guards the state shared by the tasks, as well as the fields below
+	changed *sync.Cond // broadcast once the state shared by the tasks changes
+	running int        // the number of the tasks not blocked, including the evaluation
+	blocked map[*waiter]bool
+	tasks   sync.WaitGroup // the tasks spawned
+}
+
+// waiter is a task blocked until ready reports true.
+type waiter struct {
+	ready      func() bool
+	deadlocked bool
+}
+
+func (s *parallelScheduler) Begin(ctx context.Context) context.Context {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	// the tasks blocked are woken to notice the cancellation.
+	context.AfterFunc(s.ctx, func() {
+		s.mu.Lock()
+		s.changed.Broadcast()
+		s.mu.Unlock()
+	})
+	return s.ctx
+}
+
+func (s *parallelScheduler) End() {
+	s.cancel()
+	s.tasks.Wait()
+}
+
+func (s *parallelScheduler) spawn(task *object.Task, run func() (object.Object, error)) error {
+	s.mu.Lock()
+	s.running++
+	s.mu.Unlock()
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		value, err := run()
+		s.mu.Lock()
+		task.Done, task.Value, task.Err = true, value, err
+		s.running--
+		s.detect()
+		s.changed.Broadcast()
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+func (s *parallelScheduler) block(ready func() bool, do func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := &waiter{ready: ready}
+	for !ready() {
+		if err := s.ctx.Err(); err != nil {
+			return NewCancelError(0, err)
+		}
+		s.running--
+		s.blocked[w] = true
+		s.detect()
+		if !w.deadlocked {
+			s.changed.Wait()
+		}
+		delete(s.blocked, w)
+		s.running++
+		// every task woken with a deadlock raises it, even if another one woken before made it ready.
+		if w.deadlocked {
+			return deadlockError()
+		}
+	}
+	do()
+	s.changed.Broadcast()
+	return nil
+}
+
+// detect wakes the tasks blocked with a deadlock if none of the tasks can go on.
+// once the evaluation is canceled, the tasks stop because of the cancellation, which the ones blocked report instead.
+func (s *parallelScheduler) detect() {
+	if s.running > 0 || s.ctx.Err() != nil {
+		return
+	}
+	for w := range s.blocked {
+		if w.ready() {
+			return
+		}
+	}
+	for w := range s.blocked {
+		w.deadlocked = true
+	}
+	s.changed.Broadcast()
+}
+
+// NewDeterministicScheduler returns the scheduler running one task at a time. the task running passes the turn
+// at spawn, wait, send, recv and close, and once it ends, to a task chosen by the pseudo-random numbers made from seed
+// among the ones which can go on. the evaluations of a program with the same seed interleave the tasks the same way.
+func NewDeterministicScheduler(seed int64) Scheduler {
+	evaluation := &thread{resume: make(chan struct{}, 1)}
+	return &deterministicScheduler{
+		ctx:     context.Background(),
+		rand:    rand.New(rand.NewSource(seed)),
+		threads: []*thread{evaluation},
+		current: evaluation,
+	}
+}
+
+type deterministicScheduler struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	rand    *rand.Rand
+	threads []*thread // the tasks not ended, in the order they are spawned
+	current *thread   // the task having the turn
+	tasks   sync.WaitGroup
+}
+
+// thread is a task of a deterministic scheduler.
+type thread struct {
+	resume     chan struct{} // receives the turn
+	ready      func() bool   // the condition the task is blocked until, or nil if it is not blocked
+	deadlocked bool
+}
+
+func (s *deterministicScheduler) Begin(ctx context.Context) context.Context {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	return s.ctx
+}
+
+// End passes the turn to the tasks left, which unwind one at a time as they notice the cancellation.
+func (s *deterministicScheduler) End() {
+	s.cancel()
+	s.exit()
+	s.tasks.Wait()
+}
+
+func (s *deterministicScheduler) spawn(task *object.Task, run func() (object.Object, error)) error {
+	t := &thread{resume: make(chan struct{}, 1)}
+	s.threads = append(s.threads, t)
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		<-t.resume
+		// a task getting the turn for the first time after the evaluation ended does not run at all.
+		var value object.Object
+		err := s.ctx.Err()
+		if err == nil {
+			value, err = run()
+		} else {
+			err = NewCancelError(0, err)
+		}
+		task.Done, task.Value, task.Err = true, value, err
+		s.exit()
+	}()
+	return s.reschedule()
+}
+
+func (s *deterministicScheduler) block(ready func() bool, do func()) error {
+	if err := s.reschedule(); err != nil {
+		return err
+	}
+	t := s.current
+	for !ready() {
+		t.ready = ready
+		s.switchTo(s.next())
+		t.ready = nil
+		if err := s.ctx.Err(); err != nil {
+			return NewCancelError(0, err)
+		}
+		if t.deadlocked {
+			t.deadlocked = false
+			return deadlockError()
+		}
+	}
+	do()
+	return nil
+}
+
+// reschedule passes the turn to a task chosen among the ones which can go on, including the one calling it.
+func (s *deterministicScheduler) reschedule() error {
+	s.switchTo(s.next())
+	if err := s.ctx.Err(); err != nil {
+		return NewCancelError(0, err)
+	}
+	return nil
+}
+
+// exit removes the task calling it, which is ending, and passes the turn to another task if any.
+func (s *deterministicScheduler) exit() {
+	for i, t := range s.threads {
+		if t == s.current {
+			s.threads = append(s.threads[:i:i], s.threads[i+1:]...)
+			break
+		}
+	}
+	if len(s.threads) == 0 {
+		return
+	}
+	s.current = s.next()
+	s.current.resume <- struct{}{}
+}
+
+// switchTo passes the turn from the task calling it to t, and waits until the task calling it gets the turn back.
+func (s *deterministicScheduler) switchTo(t *thread) {
+	current := s.current
+	if t == current {
+		return
+	}
+	s.current = t
+	t.resume <- struct{}{}
+	<-current.resume
+}
+
+// next chooses the task to pass the turn to. if none of the tasks can go on, the ones blocked are woken with a deadlock.
+func (s *deterministicScheduler) next() *thread {
+	if runnable := s.runnable(); len(runnable) > 0 {
+		return runnable[s.rand.Intn(len(runnable))]
+	}
+	for _, t := range s.threads {
+		t.deadlocked = true
+	}
+	return s.threads[s.rand.Intn(len(s.threads))]
+}
+
+// runnable returns the tasks which can go on, in the order they are spawned.
+func (s *deterministicScheduler) runnable() []*thread {
+	var runnable []*thread
+	for _, t := range s.threads {
+		if t.ready == nil || t.ready() || t.deadlocked || s.ctx.Err() != nil {
+			runnable = append(runnable, t)
+		}
+	}
+	return runnable
+}
+
+func deadlockError() *EvalError {
+	return &EvalError{line: 1, msg: "deadlock: all tasks are blocked"}
+}
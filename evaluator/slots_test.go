@@ -0,0 +1,136 @@
+package evaluator
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/parser"
+	"reflect"
+	"testing"
+)
+
+func TestResolver_Slots(t *testing.T) {
+	// layout is the number of slots and the number of captured frames of a function.
+	type layout struct {
+		numSlots int
+		captured int
+	}
+	tests := []struct {
+		desc     string
+		input    string
+		expected []layout // of the function literals in the order they appear
+	}{
+		{desc: "parameters and variables", input: "var f = |a, b| { var c = a; c + b }", expected: []layout{{3, 0}}},
+		{desc: "repeated parameter", input: "var f = |a, a| { a }", expected: []layout{{2, 0}}},
+		{desc: "global", input: "var g = 1; var f = || { g }", expected: []layout{{0, 0}}},
+		{desc: "closure", input: "var f = |a| { |b| { a + b } }", expected: []layout{{1, 0}, {1, 1}}},
+		{desc: "closure of closure", input: "var f = |a| { |b| { || { a } } }", expected: []layout{{1, 0}, {1, 1}, {0, 2}}},
+		{desc: "frames skipped", input: "var f = |a| { |b| { || { b } } }", expected: []layout{{1, 0}, {1, 0}, {0, 1}}},
+		{desc: "comprehension", input: "var f = |xs| { [|| { x } for x in xs] }", expected: []layout{{1, 0}, {0, 1}}},
+		{desc: "catch parameter", input: "var f = || { try { 1 } catch (e) { || { e } } }", expected: []layout{{0, 0}, {0, 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+			if err != nil {
+				t.Fatalf("parse error: %s\n", err.Error())
+			}
+			if err := NewResolver().Resolve(program); err != nil {
+				t.Fatalf("err occurred: %s", err)
+			}
+
+			var layouts []layout
+			ast.Inspect(program, func(node ast.Node) bool {
+				if functionLiteral, ok := node.(*ast.FunctionLiteral); ok {
+					layouts = append(layouts, layout{functionLiteral.NumSlots, functionLiteral.Captured})
+				}
+				return true
+			})
+			if !reflect.DeepEqual(layouts, tt.expected) {
+				t.Errorf("layouts wrong.\nwant=%v\ngot=%v\n", tt.expected, layouts)
+			}
+		})
+	}
+}
+
+func TestResolver_Locations(t *testing.T) {
+	program, err := parser.New(lexer.New("var x = 1; var f = |a| { var y = x; var x = a; [|| { x + y } for z in [a]] }")).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err.Error())
+	}
+	if err := NewResolver().Resolve(program); err != nil {
+		t.Fatalf("err occurred: %s", err)
+	}
+
+	expected := map[string][][]ast.Location{
+		"x": {nil, {{Depth: 0, Index: 1}}, {{Depth: 0, Index: 1}}, {{Depth: 2, Index: 1}}},
+		"y": {{{Depth: 0, Index: 2}}, {{Depth: 2, Index: 2}}},
+		"a": {nil, {{Depth: 0, Index: 0}}, {{Depth: 0, Index: 0}}},
+		"z": {{{Depth: 0, Index: 0}}},
+	}
+	locations := make(map[string][][]ast.Location)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.Identifier); ok && identifier.Name != "f" {
+			locations[identifier.Name] = append(locations[identifier.Name], identifier.Locations)
+		}
+		return true
+	})
+	if !reflect.DeepEqual(locations, expected) {
+		t.Errorf("locations wrong.\nwant=%v\ngot=%v\n", expected, locations)
+	}
+}
+
+func TestEval_Slots(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected interface{}
+	}{
+		{desc: "closure", input: "var f = |x| { || { x } }; f(1)()", expected: 1},
+		{desc: "declared after closure", input: "var f = || { var g = || { x }; var x = 2; g() }; f()", expected: 2},
+		{desc: "global until declared", input: "var x = 1; var f = || { var y = x; var x = 2; y * 10 + x }; f()", expected: 12},
+		{desc: "frames skipped", input: "var f = |a| { var g = |b| { || { b } }; g(a + 1) }; f(1)()", expected: 2},
+		{desc: "closures in comprehension", input: "var fs = [|| { x * y } for x in [1, 2] for y in [3]]; fs[1]()", expected: 6},
+		{desc: "catch parameter", input: "var f = || { try { throw 1 } catch (e) { var h = || { e.line }; h() } }; f()", expected: 1},
+		{desc: "repeated parameter", input: "var f = |a, a| { a }; f(1, 2)", expected: 2},
+		{desc: "recursion", input: "var fib = |n| { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)", expected: 55},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			testObject(t, tt.expected, eval(t, tt.input))
+		})
+	}
+}
+
+// a recursive program and a pipeline-heavy one, whose variables are mostly parameters and closure variables.
+// the cost of a lookup alone is benchmarked by object.BenchmarkEnvironment.
+const (
+	recursive = "var fib = |n| { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)"
+	pipeline  = `var ds = [0, 1, 2, 3, 4, 5, 6, 7, 8, 9];
+var xs = [a * 10 + b for a in ds for b in ds];
+var step = |k| { |x| { x * k + k } };
+xs -> map(step(2)) -> filter(|x| { x % 3 == 0 }) -> map(|x| { [d * x for d in ds if d < 5] -> reduce(0, |acc, y| { acc + y }) }) -> reduce(0, |acc, x| { acc + x })`
+)
+
+func BenchmarkEval_Recursive(b *testing.B) {
+	benchmarkEval(b, recursive)
+}
+
+func BenchmarkEval_Pipeline(b *testing.B) {
+	benchmarkEval(b, pipeline)
+}
+
+func benchmarkEval(b *testing.B, input string) {
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		b.Fatalf("parse error: %s\n", err.Error())
+	}
+	resolve(program)
+	for i := 0; i < b.N; i++ {
+		if _, err := Eval(program, object.NewEnvironment()); err != nil {
+			b.Fatalf("eval error: %s\n", err.Error())
+		}
+	}
+}
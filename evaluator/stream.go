@@ -0,0 +1,201 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/object"
+)
+
+// the builtin functions of streams are shared by package vm, since the functions of a stream
+// are called by the object.Apply of the evaluation iterating it. map and filter take a stream as well as an array,
+// returning a stream which calls the function as it is iterated, and reduce, take and to_array iterate it.
+// the iterations are stopped by the ones which start them, once they are finished or abandoned by an error.
+
+// Iterate returns an iterator over the elements of iterable, an array or a stream whose functions are called by apply,
+// and the function stopping the iteration. ok is false if iterable is neither.
+func Iterate(iterable object.Object, apply object.Apply) (next object.Iterator, stop func(), ok bool) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		i := 0
+		return func() (object.Object, bool, error) {
+			if i == len(iterable.Elements) {
+				return nil, false, nil
+			}
+			i++
+			return iterable.Elements[i-1], true, nil
+		}, object.NoStop, true
+	case *object.Stream:
+		next, stop := iterable.Iterate(apply)
+		return next, stop, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// MapStream returns the stream of the values of function called with the elements of stream.
+func MapStream(stream *object.Stream, function object.Object) *object.Stream {
+	return &object.Stream{Iterate: func(apply object.Apply) (object.Iterator, func()) {
+		next, stop := stream.Iterate(apply)
+		return func() (object.Object, bool, error) {
+			elem, ok, err := next()
+			if !ok {
+				return nil, false, err
+			}
+			value, err := apply(function, elem)
+			if err != nil {
+				return nil, false, err
+			}
+			return value, true, nil
+		}, stop
+	}}
+}
+
+// FilterStream returns the stream of the elements of stream for which function returns neither false nor null.
+func FilterStream(stream *object.Stream, function object.Object) *object.Stream {
+	return &object.Stream{Iterate: func(apply object.Apply) (object.Iterator, func()) {
+		next, stop := stream.Iterate(apply)
+		return func() (object.Object, bool, error) {
+			for {
+				elem, ok, err := next()
+				if !ok {
+					return nil, false, err
+				}
+				value, err := apply(function, elem)
+				if err != nil {
+					return nil, false, err
+				}
+				if value != NULL_OBJ && value != FALSE_OBJ {
+					return elem, true, nil
+				}
+			}
+		}, stop
+	}}
+}
+
+// Take returns the array of the first elements of a stream or an array, for the builtin function take.
+// check is called for each element, so that an infinite stream is stopped by the context and the limits of the evaluation.
+func Take(apply object.Apply, check func() error, args ...object.Object) (object.Object, error) {
+	if len(args) != 2 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for take wrong: want=%d got=%d\n", 2, len(args)), kind: ARGUMENT_ERROR}
+	}
+	next, stop, ok := Iterate(args[0], apply)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for take wrong: want=%T or %T\ngot=%T\n", &object.Array{}, &object.Stream{}, args[0]), kind: TYPE_ERROR}
+	}
+	defer stop()
+	count, ok := args[1].(*object.Integer)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("second argument type for take wrong: want=%T\ngot=%T\n", &object.Integer{}, args[1]), kind: TYPE_ERROR}
+	}
+	if count.Value < 0 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of elements for take wrong: %d is negative", count.Value), kind: ARGUMENT_ERROR}
+	}
+	return collect(next, count.Value, check)
+}
+
+// ToArray returns the array of the elements of a stream or an array, for the builtin function to_array.
+// check is called for each element, as it is by Take.
+func ToArray(apply object.Apply, check func() error, args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for to_array wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
+	}
+	if array, ok := args[0].(*object.Array); ok {
+		return array, nil
+	}
+	next, stop, ok := Iterate(args[0], apply)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for to_array wrong: want=%T or %T\ngot=%T\n", &object.Array{}, &object.Stream{}, args[0]), kind: TYPE_ERROR}
+	}
+	defer stop()
+	return collect(next, -1, check)
+}
+
+// collect returns the array of at most count elements of next, or of all of them if count is negative.
+func collect(next object.Iterator, count int, check func() error) (object.Object, error) {
+	var elements []object.Object
+	for count < 0 || len(elements) < count {
+		elem, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if err := check(); err != nil {
+			return nil, err
+		}
+		elements = append(elements, elem)
+	}
+	return &object.Array{Elements: elements}, nil
+}
+
+// builtinIterate returns the infinite stream of seed, f(seed), f(f(seed)), ...
+func builtinIterate(args ...object.Object) (object.Object, error) {
+	if len(args) != 2 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for iterate wrong: want=%d got=%d\n", 2, len(args)), kind: ARGUMENT_ERROR}
+	}
+	seed, function := args[0], args[1]
+	count, ok := parameterCount(function)
+	if !ok {
+		return nil, NotFunctionError("iterate", "second argument", function)
+	}
+	if count != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of parameters of iterate function wrong: want=%d\ngot=%d\n", 1, count), kind: ARGUMENT_ERROR}
+	}
+
+	return &object.Stream{Iterate: func(apply object.Apply) (object.Iterator, func()) {
+		var current object.Object
+		started := false
+		return func() (object.Object, bool, error) {
+			if !started {
+				started = true
+				current = seed
+				return current, true, nil
+			}
+			value, err := apply(function, current)
+			if err != nil {
+				return nil, false, err
+			}
+			current = value
+			return current, true, nil
+		}, object.NoStop
+	}}, nil
+}
+
+// builtinRangeFrom returns the infinite stream of the integers from start, which fails once an integer overflows.
+func builtinRangeFrom(args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for range_from wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
+	}
+	start, ok := args[0].(*object.Integer)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for range_from wrong: want=%T\ngot=%T\n", &object.Integer{}, args[0]), kind: TYPE_ERROR}
+	}
+
+	return &object.Stream{Iterate: func(apply object.Apply) (object.Iterator, func()) {
+		current, overflowed := start.Value, false
+		return func() (object.Object, bool, error) {
+			if overflowed {
+				return nil, false, &EvalError{line: 1, msg: fmt.Sprintf("integer overflow: %d + 1", current), kind: ARITHMETIC_ERROR}
+			}
+			value := current
+			if next, ok := object.Add(current, 1); ok {
+				current = next
+			} else {
+				overflowed = true
+			}
+			return &object.Integer{Value: value}, true, nil
+		}, object.NoStop
+	}}, nil
+}
+
+// parameterCount returns the number of the parameters of function, which is a function of either the evaluator or package vm.
+func parameterCount(function object.Object) (int, bool) {
+	switch function := function.(type) {
+	case *object.Function:
+		return len(function.Parameters), true
+	case *object.Closure:
+		return len(function.Function.Literal.Parameters), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,89 @@
+package evaluator
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+)
+
+// tailCall is a call in tail position of a function body, which is returned to applyFunction unapplied
+// so that the call replaces the one of the body instead of nesting in it.
+type tailCall struct {
+	call     ast.Expression
+	function object.Object
+	args     []object.Object
+}
+
+func (tc *tailCall) String() string    { return "TailCall<" + tc.call.String() + ">" }
+func (tc *tailCall) Type() object.Type { return "TAIL_CALL" }
+
+// evalTailStatements evaluates the statements of a function body, or of a branch of if in it.
+// the calls in tail position are returned as tailCall: the returned values and, if tail, the value of the statements.
+// the branches of if are searched for them as well, since if does not create an environment.
+// calls in try expressions are not in tail position, since the handler must catch the errors raised by them.
+func (e *evaluator) evalTailStatements(statements []ast.Statement, env *object.Environment, tail bool) (object.Object, error) {
+	var evaluated object.Object
+	for i, statement := range statements {
+		var err error
+		switch statement := statement.(type) {
+		case *ast.ReturnStatement:
+			var value object.Object
+			value, err = e.evalTailExpression(statement.Expression, env, true)
+			if err != nil {
+				return nil, err
+			}
+			return wrapReturnValue(value), nil
+		case *ast.ExpressionStatement:
+			evaluated, err = e.evalTailExpression(statement.Expression, env, tail && i == len(statements)-1)
+		default:
+			evaluated, err = e.eval(statement, env)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+			return returnValue, nil
+		}
+	}
+	return evaluated, nil
+}
+
+// evalTailExpression evaluates expression, returning a call as tailCall if tail.
+func (e *evaluator) evalTailExpression(expression ast.Expression, env *object.Environment, tail bool) (object.Object, error) {
+	switch expression := expression.(type) {
+	case *ast.FunctionCall:
+		if tail && !isQuoteCall(expression) {
+			return e.evalTailCall(expression, env)
+		}
+	case *ast.MethodCall:
+		if tail {
+			return e.evalTailCall(expression, env)
+		}
+	case *ast.IfExpression:
+		if err := e.step(expression); err != nil {
+			return nil, err
+		}
+		condition, err := e.evalExpression(expression.Condition, env)
+		if err != nil {
+			return nil, err
+		}
+		if condition == FALSE_OBJ || condition == NULL_OBJ {
+			if expression.Alternative == nil {
+				return NULL_OBJ, nil
+			}
+			return e.evalTailStatements(expression.Alternative.Statements, env, tail)
+		}
+		return e.evalTailStatements(expression.Consequence.Statements, env, tail)
+	}
+	return e.evalExpression(expression, env)
+}
+
+func (e *evaluator) evalTailCall(call ast.Expression, env *object.Environment) (object.Object, error) {
+	if err := e.step(call); err != nil {
+		return nil, err
+	}
+	function, evaluatedArgs, err := e.evalCall(call, env)
+	if err != nil {
+		return nil, err
+	}
+	return &tailCall{call: call, function: function, args: evaluatedArgs}, nil
+}
@@ -0,0 +1,179 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/object"
+)
+
+// the builtin functions of the tasks and the channels are shared with package vm, given the scheduler of the evaluation.
+// spawn is defined by each backend, since it calls a function of its own. the errors are reported at line 1
+// and relocated to the call by TracedBuiltin, as the ones of the other builtin functions.
+
+// Spawn runs run as a new task of the evaluation scheduled by scheduler, and returns the task.
+// function is the function called by run, whose frames are shared with the task.
+func Spawn(scheduler Scheduler, function object.Object, run func() (object.Object, error)) (object.Object, error) {
+	object.Share(function)
+	task := &object.Task{}
+	if err := scheduler.spawn(task, run); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Wait returns the value returned by the function of a task once it returns, or raises the error raised by the function.
+func Wait(scheduler Scheduler, args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for wait wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
+	}
+	task, ok := args[0].(*object.Task)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for wait wrong: want=%T\ngot=%T\n", &object.Task{}, args[0]), kind: TYPE_ERROR}
+	}
+
+	var value object.Object
+	var err error
+	ready := func() bool { return task.Done }
+	if blockErr := scheduler.block(ready, func() { value, err = task.Value, task.Err }); blockErr != nil {
+		return nil, blockErr
+	}
+	return value, err
+}
+
+func builtinChannel(args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for channel wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
+	}
+	capacity, ok := args[0].(*object.Integer)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for channel wrong: want=%T\ngot=%T\n", &object.Integer{}, args[0]), kind: TYPE_ERROR}
+	}
+	if capacity.Value < 0 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("capacity of channel negative: %d", capacity.Value), kind: ARGUMENT_ERROR}
+	}
+
+	return &object.Channel{Capacity: capacity.Value}, nil
+}
+
+// Send sends a value to a channel and returns null. it waits until the value is received if the channel has no capacity,
+// or until there is room for the value otherwise.
+func Send(scheduler Scheduler, args ...object.Object) (object.Object, error) {
+	if len(args) != 2 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for send wrong: want=%d got=%d\n", 2, len(args)), kind: ARGUMENT_ERROR}
+	}
+	channel, ok := args[0].(*object.Channel)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("first argument type for send wrong: want=%T\ngot=%T\n", &object.Channel{}, args[0]), kind: TYPE_ERROR}
+	}
+
+	// the value can be read by the task receiving it while the task sending it goes on.
+	object.Share(args[1])
+	// a channel without capacity holds the value being sent until it is received.
+	room := channel.Capacity
+	if room == 0 {
+		room = 1
+	}
+	var closed bool
+	var sent int
+	ready := func() bool { return channel.Closed || len(channel.Buffer) < room }
+	err := scheduler.block(ready, func() {
+		if channel.Closed {
+			closed = true
+			return
+		}
+		channel.Buffer = append(channel.Buffer, args[1])
+		sent = channel.Sent
+		channel.Sent++
+	})
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		return nil, &EvalError{line: 1, msg: "send on closed channel"}
+	}
+	if channel.Capacity == 0 {
+		if err := scheduler.block(func() bool { return channel.Received > sent }, func() {}); err != nil {
+			return nil, err
+		}
+	}
+
+	return NULL_OBJ, nil
+}
+
+// Recv receives a value from a channel, waiting until one is sent. it returns null once the channel is closed
+// and all the values sent are received.
+func Recv(scheduler Scheduler, args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for recv wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
+	}
+	channel, ok := args[0].(*object.Channel)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for recv wrong: want=%T\ngot=%T\n", &object.Channel{}, args[0]), kind: TYPE_ERROR}
+	}
+
+	var value object.Object = NULL_OBJ
+	ready := func() bool { return channel.Closed || len(channel.Buffer) > 0 }
+	err := scheduler.block(ready, func() {
+		if len(channel.Buffer) == 0 {
+			return
+		}
+		value = channel.Buffer[0]
+		channel.Buffer = channel.Buffer[1:]
+		channel.Received++
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// Close closes a channel, so that no more values are sent to it, and returns null.
+func Close(scheduler Scheduler, args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for close wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
+	}
+	channel, ok := args[0].(*object.Channel)
+	if !ok {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("argument type for close wrong: want=%T\ngot=%T\n", &object.Channel{}, args[0]), kind: TYPE_ERROR}
+	}
+
+	var closed bool
+	err := scheduler.block(func() bool { return true }, func() {
+		closed = channel.Closed
+		channel.Closed = true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		return nil, &EvalError{line: 1, msg: "close of closed channel"}
+	}
+
+	return NULL_OBJ, nil
+}
+
+func (e *evaluator) builtinSpawn(args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of arguments for spawn wrong: want=%d got=%d\n", 1, len(args)), kind: ARGUMENT_ERROR}
+	}
+	function, ok := args[0].(*object.Function)
+	if !ok {
+		return nil, NotFunctionError("spawn", "argument", args[0])
+	}
+	if len(function.Parameters) != 0 {
+		return nil, &EvalError{line: 1, msg: fmt.Sprintf("number of parameters of spawn function wrong: want=%d\ngot=%d\n", 0, len(function.Parameters)), kind: ARGUMENT_ERROR}
+	}
+
+	// the function is called by an evaluator of its own, sharing the context, the limits and the resources used with e.
+	// the errors raised by it are traced from the call of spawn, which is on the top of the stack of e.
+	stack := e.stack
+	return Spawn(e.scheduler, function, func() (value object.Object, err error) {
+		t := &evaluator{ctx: e.ctx, limits: e.limits, usage: e.usage, stack: stack, scheduler: e.scheduler}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				value, err = nil, Recovered(recovered, t.stack)
+			}
+		}()
+		return t.applyFunction(nil, function, nil)
+	})
+}
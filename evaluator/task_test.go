@@ -0,0 +1,241 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/parser"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// interleaving records the order the sends of two tasks are made in.
+const interleaving = `var log = channel(6);
+var worker = |name| { || { [send(log, name + i) for i in ["1", "2", "3"]] } };
+var a = spawn(worker("a"));
+var b = spawn(worker("b"));
+wait(a); wait(b); close(log);
+var drain = |acc| { var x = recv(log); if (x) { drain(acc + x + " ") } else { acc } };
+drain("")`
+
+func TestEval_Task(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected interface{}
+	}{
+		{desc: "wait", input: "var t = spawn(|| { 1 + 2 }); wait(t)", expected: 3},
+		{desc: "wait twice", input: "var t = spawn(|| { 5 }); wait(t) + wait(t)", expected: 10},
+		{
+			desc:     "captured variables",
+			input:    "var xs = [1, 2, 3]; var k = 10; var ts = [spawn(|| { xs -> map(|x| { x * k * i }) -> reduce(0, |a, b| { a + b }) }) for i in [1, 2, 3]]; [wait(t) for t in ts] -> reduce(0, |a, b| { a + b })",
+			expected: 360,
+		},
+		{
+			desc:     "variables declared while read",
+			input:    "var base = 1; var t = spawn(|| { reduce([1, 2, 3, 4, 5, 6, 7, 8, 9, 10], 0, |acc, x| { acc + base }) }); var a = 1; var b = 2; var c = 3; wait(t) + a + b + c",
+			expected: 16,
+		},
+		{desc: "global declared while read", input: "var t = spawn(|| { try { x } catch (e) { 1 } }); var x = 1; wait(t)", expected: 1},
+		{desc: "local declared while read", input: "var f = || { var t = spawn(|| { try { x } catch (e) { 1 } }); var x = 1; wait(t) }; f()", expected: 1},
+		{
+			desc:     "unbuffered channel",
+			input:    "var ch = channel(0); var p = spawn(|| { [send(ch, x * x) for x in [1, 2, 3, 4]]; close(ch) }); var sum = |acc| { var x = recv(ch); if (x) { sum(acc + x) } else { acc } }; sum(0)",
+			expected: 30,
+		},
+		{desc: "value of send", input: "var ch = channel(1); var r = send(ch, 1); r", expected: nil},
+		{desc: "values of send in array", input: "var ch = channel(2); [send(ch, 1), send(ch, 2)][1]", expected: nil},
+		{desc: "value of close", input: "var ch = channel(0); var r = close(ch); r", expected: nil},
+		{desc: "buffered channel", input: "var ch = channel(2); send(ch, 1); send(ch, 2); recv(ch) * 10 + recv(ch)", expected: 12},
+		{desc: "closed and drained", input: "var ch = channel(1); send(ch, 1); close(ch); var a = recv(ch); var b = recv(ch); if (b) { 0 } else { a }", expected: 1},
+		{
+			desc: "pipeline",
+			input: `var numbers = channel(0); var squares = channel(0);
+spawn(|| { [send(numbers, n) for n in [1, 2, 3]]; close(numbers) });
+spawn(|| { var loop = || { var n = recv(numbers); if (n) { send(squares, n * n); loop() } else { close(squares) } }; loop() });
+var sum = |acc| { var x = recv(squares); if (x) { sum(acc + x) } else { acc } };
+sum(0)`,
+			expected: 14,
+		},
+		{desc: "generator in task", input: "var g = || { yield 1; yield 2 }; wait(spawn(|| { reduce(g(), 0, |a, b| { a + b }) }))", expected: 3},
+		{desc: "error caught in task", input: "wait(spawn(|| { try { 1 / 0 } catch (e) { e.kind } }))", expected: "ArithmeticError"},
+		{desc: "deadlock caught", input: "try { recv(channel(0)) } catch (e) { e.message }", expected: "deadlock: all tasks are blocked"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			testObject(t, tt.expected, eval(t, tt.input))
+		})
+	}
+}
+
+func TestEval_Task_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		kind     string
+		expected string
+		trace    []Frame
+	}{
+		{
+			desc:     "error in task",
+			input:    "var t = spawn(|| {\n1 / 0 });\nwait(t)",
+			kind:     ARITHMETIC_ERROR,
+			expected: "line 2: division by zero: 1 / 0",
+			trace:    []Frame{{Function: "spawn", Line: 1}, {Function: "", Line: 1}},
+		},
+		{
+			desc:     "deadlock",
+			input:    "var ch = channel(0);\nvar t = spawn(|| { recv(ch) });\nwait(t)",
+			kind:     RUNTIME_ERROR,
+			expected: "line 3: deadlock: all tasks are blocked",
+		},
+		{
+			desc:     "send on closed channel",
+			input:    "var ch = channel(1);\nclose(ch);\nsend(ch, 1)",
+			kind:     RUNTIME_ERROR,
+			expected: "line 3: send on closed channel",
+		},
+		{
+			desc:     "close of closed channel",
+			input:    "var ch = channel(1);\nclose(ch);\nclose(ch)",
+			kind:     RUNTIME_ERROR,
+			expected: "line 3: close of closed channel",
+		},
+		{
+			desc:     "parameters of spawn function",
+			input:    "spawn(|x| { x })",
+			kind:     ARGUMENT_ERROR,
+			expected: "line 1: number of parameters of spawn function wrong: want=0\ngot=1\n",
+		},
+		{
+			desc:     "not function",
+			input:    "spawn(1)",
+			kind:     TYPE_ERROR,
+			expected: "line 1: spawn: argument must be a function, got INTEGER",
+		},
+		{
+			desc:     "negative capacity",
+			input:    "channel(-1)",
+			kind:     ARGUMENT_ERROR,
+			expected: "line 1: capacity of channel negative: -1",
+		},
+		{
+			desc:     "not task",
+			input:    "wait(1)",
+			kind:     TYPE_ERROR,
+			expected: "line 1: argument type for wait wrong: want=*object.Task\ngot=*object.Integer\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.Kind() != tt.kind {
+				t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", tt.kind, evalError.Kind())
+			}
+			if evalError.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, evalError.Error())
+			}
+			if tt.trace != nil && !reflect.DeepEqual(evalError.Trace(), tt.trace) {
+				t.Errorf("trace wrong.\nwant=%v\ngot=%v\n", tt.trace, evalError.Trace())
+			}
+		})
+	}
+}
+
+// a deterministic scheduler interleaves the tasks the same way for a seed, with either backend.
+func TestEval_Task_Deterministic(t *testing.T) {
+	interleavings := make(map[string]bool)
+	for seed := int64(0); seed < 10; seed++ {
+		evaluated := evalScheduled(t, interleaving, seed)
+		if again := evalScheduled(t, interleaving, seed); again.String() != evaluated.String() {
+			t.Errorf("interleaving of seed %d wrong.\nwant=%s\ngot=%s\n", seed, evaluated, again)
+		}
+		interleavings[evaluated.String()] = true
+	}
+	if len(interleavings) < 2 {
+		t.Errorf("number of interleavings wrong.\nwant=more than 1\ngot=%d\n", len(interleavings))
+	}
+}
+
+func TestEval_Task_Deterministic_Deadlock(t *testing.T) {
+	program, err := parser.New(lexer.New("var ch = channel(0);\nspawn(|| { recv(ch) });\nrecv(ch)")).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err)
+	}
+	resolve(program)
+	_, err = EvalWithScheduler(context.Background(), program, object.NewEnvironment(), NewDeterministicScheduler(1))
+	if expected := "line 3: deadlock: all tasks are blocked"; err == nil || err.Error() != expected {
+		t.Errorf("error wrong.\nwant=%s\ngot=%v\n", expected, err)
+	}
+}
+
+// the tasks still running when the evaluation ends are canceled, and their goroutines end with it.
+// a task running forever keeps the turn of a deterministic scheduler, so it is run by the parallel one only.
+func TestEval_Task_Canceled(t *testing.T) {
+	parallel := NewParallelScheduler
+	deterministic := func() Scheduler { return NewDeterministicScheduler(1) }
+	tests := []struct {
+		desc       string
+		input      string
+		schedulers []func() Scheduler
+	}{
+		{desc: "running", input: "var f = |n| { f(n + 1) }; spawn(|| { f(0) }); 1", schedulers: []func() Scheduler{parallel}},
+		{desc: "blocked", input: "var ch = channel(0); spawn(|| { recv(ch) }); 1", schedulers: []func() Scheduler{parallel, deterministic}},
+		{desc: "not started", input: "spawn(|| { 0 }); spawn(|| { 0 }); 1", schedulers: []func() Scheduler{parallel, deterministic}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+			if err != nil {
+				t.Fatalf("parse error: %s\n", err)
+			}
+			resolve(program)
+			for _, scheduler := range tt.schedulers {
+				before := runtime.NumGoroutine()
+				evaluated, err := EvalWithScheduler(context.Background(), program, object.NewEnvironment(), scheduler())
+				if err != nil {
+					t.Fatalf("eval error: %s\n", err)
+				}
+				testObject(t, 1, evaluated)
+				// the goroutines of the tasks have returned, but may not have exited yet.
+				deadline := time.Now().Add(time.Second)
+				for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+				if after := runtime.NumGoroutine(); after > before {
+					t.Errorf("goroutines left.\nwant=%d\ngot=%d\n", before, after)
+				}
+			}
+		})
+	}
+}
+
+// evalScheduled evaluates input with a deterministic scheduler of seed, checking that the compiled program
+// evaluates to the same value with a scheduler of the same seed.
+func evalScheduled(t *testing.T, input string, seed int64) object.Object {
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err)
+	}
+	resolve(program)
+	evaluated, err := EvalWithScheduler(context.Background(), program, object.NewEnvironment(), NewDeterministicScheduler(seed))
+	if err != nil {
+		t.Fatalf("eval error: %s\n", err)
+	}
+
+	if RunScheduled != nil {
+		compiled, err := RunScheduled(program, NewDeterministicScheduler(seed))
+		if err != nil {
+			t.Fatalf("run error of compiled program: %s\n", err)
+		}
+		if !sameValue(evaluated, compiled) {
+			t.Errorf("value of compiled program wrong.\nwant=%v\ngot=%v\n", evaluated, compiled)
+		}
+	}
+	return evaluated
+}
@@ -0,0 +1,106 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+)
+
+// Frame is a function call being evaluated, reported in the trace of an EvalError.
+type Frame struct {
+	Function string // the name of the function, or "" if it is not called by name
+	Line     int    // the line of the call, or of the body of a function called by a builtin function
+	Stage    int    // the position of the call in a pipeline of ->, starting at 1, or 0 if not called with ->
+}
+
+// NewFrame returns the frame of a call of function at call, which is nil for the calls by builtin functions.
+func NewFrame(call ast.Expression, function object.Object) Frame {
+	frame := Frame{Line: callLine(call, function)}
+	switch call := call.(type) {
+	case *ast.FunctionCall:
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			frame.Function = ident.Name
+		}
+		for stage := call; stage != nil && stage.Arrow; {
+			frame.Stage++
+			stage, _ = stage.Arguments[0].(*ast.FunctionCall)
+		}
+	case *ast.MethodCall:
+		frame.Function = call.Method.Name
+	}
+	return frame
+}
+
+func (f Frame) String() string {
+	function := f.Function
+	if function == "" {
+		function = "anonymous function"
+	}
+	if f.Stage > 0 {
+		return fmt.Sprintf("line %d, in %s (stage %d of ->)", f.Line, function, f.Stage)
+	}
+	return fmt.Sprintf("line %d, in %s", f.Line, function)
+}
+
+// CallStack is an immutable stack of calls. a stack shares the calls below its top with the stack it is pushed onto,
+// so that an error can keep the stack of the point where it is raised without copying it. nil is the empty stack.
+// the frames are made only when the trace of an error is requested.
+type CallStack struct {
+	call     ast.Expression
+	function object.Object
+	below    *CallStack
+}
+
+// Push returns the stack of the call of function at call on top of cs.
+func (cs *CallStack) Push(call ast.Expression, function object.Object) *CallStack {
+	return &CallStack{call: call, function: function, below: cs}
+}
+
+// Pop returns the stack below the top of cs.
+func (cs *CallStack) Pop() *CallStack {
+	if cs == nil {
+		return nil
+	}
+	return cs.below
+}
+
+// Frames returns the frames of cs from the outermost call.
+func (cs *CallStack) Frames() []Frame {
+	var frames []Frame
+	for s := cs; s != nil; s = s.below {
+		frames = append(frames, NewFrame(s.call, s.function))
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// Traced attaches stack to err as the calls being evaluated when it is raised, unless err already has its stack.
+func Traced(err error, stack *CallStack) error {
+	if evalError, ok := err.(*EvalError); ok && !evalError.traced {
+		evalError.stack = stack
+		evalError.traced = true
+	}
+	return err
+}
+
+// TracedBuiltin attaches stack to err returned by a builtin function called at call, as Traced does.
+// the errors raised by the builtin function itself, which knows nothing of call, are reported at the line of call,
+// and so is the cancellation noticed by it, at line 0.
+func TracedBuiltin(err error, call ast.Expression, stack *CallStack) error {
+	if call == nil {
+		return Traced(err, stack)
+	}
+	switch err := err.(type) {
+	case *EvalError:
+		if !err.traced {
+			err.line = call.Line()
+		}
+	case *CancelError:
+		if err.line == 0 {
+			err.line = call.Line()
+		}
+	}
+	return Traced(err, stack)
+}
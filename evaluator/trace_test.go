@@ -0,0 +1,124 @@
+package evaluator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEval_Trace(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		line     int
+		expected []Frame
+	}{
+		{
+			desc:     "top level",
+			input:    "var x = 1\nx + true",
+			line:     2,
+			expected: nil,
+		},
+		{
+			desc:  "nested calls",
+			input: "var f = |x| {\n  x + true\n}\nvar g = |x| {\n  1 + f(x)\n}\ng(1)",
+			line:  2,
+			expected: []Frame{
+				{Function: "g", Line: 7},
+				{Function: "f", Line: 5},
+			},
+		},
+		{
+			desc:  "reduce callback in pipeline",
+			input: "var add = |a, b| {\n  a + b\n}\nvar total = |xs| {\n  xs -> map(|x| { x })\n    -> reduce(0, |a, b| {\n      1 * add(a, b)\n    })\n}\ntotal([1, true])",
+			line:  2,
+			expected: []Frame{
+				{Function: "total", Line: 10},
+				{Function: "reduce", Line: 6, Stage: 2},
+				{Function: "", Line: 6},
+				{Function: "add", Line: 7},
+			},
+		},
+		{
+			desc:  "builtin",
+			input: "var f = |x| {\n  len(x)\n}\n1 + f(1)",
+			line:  2,
+			expected: []Frame{
+				{Function: "f", Line: 4},
+				{Function: "len", Line: 2},
+			},
+		},
+		{
+			desc:  "method call",
+			input: "var f = |x| {\n  x + true\n};\n[1].map(f)",
+			line:  2,
+			expected: []Frame{
+				{Function: "map", Line: 4},
+				{Function: "", Line: 1},
+			},
+		},
+		{
+			desc:  "tail call",
+			input: "var f = |x| { x + true }\nvar g = |x| {\n  f(x)\n}\n1 + g(1)",
+			line:  1,
+			expected: []Frame{
+				{Function: "f", Line: 3},
+			},
+		},
+		{
+			desc:  "arguments of call",
+			input: "var f = |x| { x }\nvar g = || {\n  f(1, 2)\n}\n1 + g()",
+			line:  3,
+			expected: []Frame{
+				{Function: "g", Line: 5},
+			},
+		},
+		{
+			desc:  "return value",
+			input: "var f = || -> int { true }\nvar g = || {\n  1 + f()\n}\n1 + g()",
+			line:  3,
+			expected: []Frame{
+				{Function: "g", Line: 5},
+			},
+		},
+		{
+			desc:  "rethrown",
+			input: "var f = || { [][0] }\nvar g = || {\n  try { f() } catch (e) {\n    throw e\n  }\n}\n1 + g()",
+			line:  4,
+			expected: []Frame{
+				{Function: "g", Line: 7},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.line != tt.line {
+				t.Errorf("line wrong.\nwant=%d\ngot=%d (%s)\n", tt.line, evalError.line, evalError)
+			}
+			if !reflect.DeepEqual(evalError.Trace(), tt.expected) {
+				t.Errorf("trace wrong.\nwant=%v\ngot=%v\n", tt.expected, evalError.Trace())
+			}
+		})
+	}
+}
+
+func TestFrame_String(t *testing.T) {
+	tests := []struct {
+		desc     string
+		frame    Frame
+		expected string
+	}{
+		{desc: "named", frame: Frame{Function: "f", Line: 3}, expected: "line 3, in f"},
+		{desc: "anonymous", frame: Frame{Line: 3}, expected: "line 3, in anonymous function"},
+		{desc: "pipeline", frame: Frame{Function: "map", Line: 3, Stage: 2}, expected: "line 3, in map (stage 2 of ->)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if tt.frame.String() != tt.expected {
+				t.Errorf("string wrong.\nwant=%q\ngot=%q\n", tt.expected, tt.frame.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+)
+
+// Conforms reports whether value is of the annotated type t. a nil t is an absent annotation, which accepts any value.
+// type variables accept any value as well, and a function is checked only for the number of its parameters,
+// since the types of its parameters are not known until it is called.
+func Conforms(value object.Object, t ast.TypeAnnotation) bool {
+	switch t := t.(type) {
+	case nil:
+		return true
+	case *ast.NamedType:
+		switch t.Name {
+		case "int":
+			_, ok := value.(*object.Integer)
+			return ok
+		case "bool":
+			_, ok := value.(*object.Boolean)
+			return ok
+		case "string":
+			_, ok := value.(*object.String)
+			return ok
+		case "null":
+			_, ok := value.(*object.Null)
+			return ok || value == nil
+		case "error":
+			_, ok := value.(*object.Error)
+			return ok
+		case "quote":
+			_, ok := value.(*object.Quote)
+			return ok
+		default:
+			return true
+		}
+	case *ast.ArrayType:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return false
+		}
+		for _, element := range array.Elements {
+			if !Conforms(element, t.Element) {
+				return false
+			}
+		}
+		return true
+	case *ast.FunctionType:
+		switch function := value.(type) {
+		case *object.Function:
+			return len(function.Parameters) == len(t.Parameters)
+		case *object.Closure:
+			return len(function.Function.Literal.Parameters) == len(t.Parameters)
+		case *object.BuiltinFunction:
+			return true
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+}
+
+// Describe returns value with its type, for the messages of type errors.
+func Describe(value object.Object) string {
+	if value == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%s (%s)", value, value.Type())
+}
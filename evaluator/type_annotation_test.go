@@ -0,0 +1,108 @@
+package evaluator
+
+import "testing"
+
+func TestEval_TypeAnnotation(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected interface{}
+	}{
+		{
+			desc:     "parameters and return value",
+			input:    "var sum = |x: int, xs: [int]| -> int { xs -> reduce(x, |a, b| { a + b }) }; sum(1, [2, 3])",
+			expected: 6,
+		},
+		{
+			desc:     "partially annotated",
+			input:    `var f = |x, s: string| { x }; f(true, "a")`,
+			expected: true,
+		},
+		{
+			desc:     "var statement",
+			input:    `var s: string = "a"; s`,
+			expected: "a",
+		},
+		{
+			desc:     "type variable",
+			input:    "var first = |xs: [a]| -> a { xs[0] }; first([true])",
+			expected: true,
+		},
+		{
+			desc:     "function",
+			input:    "var apply = |f: |int| -> int, x: int| -> int { f(x) }; apply(|x| { x * 2 }, 3)",
+			expected: 6,
+		},
+		{
+			desc:     "early return",
+			input:    "var f = |x: int| -> bool { if (x > 0) { return true } false }; f(1)",
+			expected: true,
+		},
+		{
+			desc:     "null",
+			input:    "var f = || -> null { puts() }; f()",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evaluated := eval(t, tt.input)
+			if evaluated == nil {
+				evaluated = NULL_OBJ
+			}
+			testObject(t, tt.expected, evaluated)
+		})
+	}
+}
+
+func TestEval_TypeAnnotation_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "parameter",
+			input:    "var f = |x: int| { x }\nf(true)",
+			expected: `line 2: type of parameter "x" wrong in f(true): want int, got true (BOOLEAN)`,
+		},
+		{
+			desc:     "array element",
+			input:    "var f = |n, xs: [int]| { n }; 0 -> f([1, true])",
+			expected: `line 1: type of parameter "xs" wrong in (0 -> f([1, true])): want [int], got [1, true] (ARRAY)`,
+		},
+		{
+			desc:     "method call",
+			input:    `var f = |s: string| { s }; 1.f()`,
+			expected: `line 1: type of parameter "s" wrong in 1.f(): want string, got 1 (INTEGER)`,
+		},
+		{
+			desc:     "number of parameters of function",
+			input:    "var apply = |f: |int| -> int| { f(1) }; apply(|a, b| { a })",
+			expected: `line 1: type of parameter "f" wrong in apply(|a, b| {a;}): want |int| -> int, got |a, b| {a;} (FUNCTION)`,
+		},
+		{
+			desc:     "return value",
+			input:    "var f = |x| -> int { if (x) { return false } 1 }\nf(true)",
+			expected: `line 2: type of return value wrong in f(true): want int, got false (BOOLEAN)`,
+		},
+		{
+			desc:     "var statement",
+			input:    "var a = 1\nvar b: [int] = a",
+			expected: `line 2: type of "b" wrong: want [int], got 1 (INTEGER)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			evalError := evalErr(t, tt.input)
+			if evalError.Kind() != TYPE_ERROR {
+				t.Errorf("error kind wrong.\nwant=%s\ngot=%s\n", TYPE_ERROR, evalError.Kind())
+			}
+			if evalError.Error() != tt.expected {
+				t.Errorf("error message wrong.\nwant=%q\ngot=%q\n", tt.expected, evalError.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/muiscript/ether/format"
+	"io/ioutil"
+	"os"
+)
+
+// fmtCommand formats files.
+// by default the formatted source is printed. with --check, the names of the files
+// which are not formatted are printed and the exit status is 1 if there is any.
+// with --diff, the differences from the formatted source are printed instead.
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "report files which are not formatted and exit with 1 if any")
+	diff := flags.Bool("diff", false, "print the differences from the formatted source")
+	write := flags.Bool("w", false, "write the formatted source to the file")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 || *write && (*check || *diff) {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 1
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		formatted, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			return 2
+		}
+		formattedAlready := bytes.Equal(src, formatted)
+
+		switch {
+		case *write:
+			if formattedAlready {
+				continue
+			}
+			if err := ioutil.WriteFile(filename, formatted, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		case *check || *diff:
+			if formattedAlready {
+				continue
+			}
+			if *diff {
+				fmt.Print(unifiedDiff(filename, string(src), string(formatted)))
+			} else {
+				fmt.Println(filename)
+			}
+			if *check {
+				status = 1
+			}
+		default:
+			fmt.Print(string(formatted))
+		}
+	}
+	return status
+}
@@ -0,0 +1,618 @@
+// Package format implements the canonical formatting of ether source code.
+package format
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/parser"
+	"github.com/muiscript/ether/token"
+	"sort"
+	"strings"
+)
+
+const INDENT = "  "
+
+// precedence of expressions which never need parentheses, such as literals.
+const ATOM = parser.FIELD + 1
+
+var operatorPrecedences = map[string]parser.Precedence{
+	"==": parser.EQUAL,
+	"!=": parser.EQUAL,
+	"<":  parser.COMPARISON,
+	">":  parser.COMPARISON,
+	"+":  parser.ADDITION,
+	"-":  parser.ADDITION,
+	"*":  parser.MULTIPLICATION,
+	"/":  parser.MULTIPLICATION,
+	"%":  parser.MULTIPLICATION,
+}
+
+// Source formats ether source code.
+// the comments in src are kept, attached to the lines they were written on,
+// and so are single blank lines between statements.
+func Source(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	program, err := parser.New(l).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &printer{comments: append([]token.Comment{}, l.Comments()...), blankLines: make(map[int]bool)}
+	sort.SliceStable(p.comments, func(i, j int) bool { return p.comments[i].Line < p.comments[j].Line })
+	for i, line := range strings.Split(string(src), "\n") {
+		if strings.TrimSpace(line) == "" {
+			p.blankLines[i+1] = true
+		}
+	}
+	return p.program(program)
+}
+
+// Program formats program.
+func Program(program *ast.Program) ([]byte, error) {
+	p := &printer{blankLines: make(map[int]bool)}
+	return p.program(program)
+}
+
+// Node formats node, which is an expression or a statement.
+func Node(node ast.Node) ([]byte, error) {
+	switch node := node.(type) {
+	case *ast.Program:
+		return Program(node)
+	case ast.Statement:
+		return Program(&ast.Program{Statements: []ast.Statement{node}})
+	case ast.Expression:
+		return Program(&ast.Program{Statements: []ast.Statement{ast.NewExpressionStatement(node, node.Line())}})
+	default:
+		return nil, fmt.Errorf("line %d: unable to format node: %T", node.Line(), node)
+	}
+}
+
+func (p *printer) program(program *ast.Program) ([]byte, error) {
+	p.statements(program.Statements)
+	p.leadingComments(int(^uint(0) >> 1))
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return []byte(p.output()), nil
+}
+
+type outputLine struct {
+	code    string
+	comment string
+}
+
+type printer struct {
+	lines      []outputLine
+	code       strings.Builder
+	indent     int
+	comments   []token.Comment // not printed yet, sorted by line
+	blankLines map[int]bool    // source lines with nothing but spaces
+	lineMax    int             // the last source line printed on the current output line
+	lastLine   int             // the last source line printed so far
+	err        error
+}
+
+func (p *printer) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (p *printer) write(s string) {
+	if p.code.Len() == 0 {
+		p.code.WriteString(strings.Repeat(INDENT, p.indent))
+	}
+	p.code.WriteString(s)
+}
+
+func (p *printer) mark(node ast.Node) {
+	p.markLine(node.Line())
+}
+
+// markLine records that the code written on line is printed on the current output line.
+func (p *printer) markLine(line int) {
+	if line > p.lineMax {
+		p.lineMax = line
+	}
+}
+
+// newline ends the current output line.
+func (p *printer) newline() {
+	p.newlineBefore(int(^uint(0) >> 1))
+}
+
+// newlineBefore ends the current output line, which is followed by the code written on line.
+// the comments written on the source lines printed on it, before line, are appended to it,
+// so a trailing comment stays after the last code of its line. when there are several of them,
+// all but the last one are printed on their own lines before it.
+func (p *printer) newlineBefore(line int) {
+	var comments []token.Comment
+	for len(p.comments) > 0 && p.comments[0].Line <= p.lineMax && p.comments[0].Line < line {
+		comments = append(comments, p.comments[0])
+		p.comments = p.comments[1:]
+	}
+	code := p.code.String()
+	comment := ""
+	if len(comments) > 0 {
+		indent := code[:len(code)-len(strings.TrimLeft(code, " "))]
+		for _, c := range comments[:len(comments)-1] {
+			p.lines = append(p.lines, outputLine{code: indent + c.Text})
+		}
+		comment = comments[len(comments)-1].Text
+	}
+	p.lines = append(p.lines, outputLine{code: code, comment: comment})
+	p.code.Reset()
+
+	if p.lineMax > p.lastLine {
+		p.lastLine = p.lineMax
+	}
+	p.lineMax = 0
+}
+
+// blankLine separates what starts at line from the previous line
+// if they are separated by a blank line in the source, unless the previous line opens a block.
+func (p *printer) blankLine(line int) {
+	separated := false
+	for l := p.lastLine + 1; l < line; l++ {
+		separated = separated || p.blankLines[l]
+	}
+	if !separated || len(p.lines) == 0 {
+		return
+	}
+	last := p.lines[len(p.lines)-1]
+	if last.code == "" && last.comment == "" || strings.HasSuffix(last.code, "{") {
+		return
+	}
+	p.lines = append(p.lines, outputLine{})
+}
+
+// leadingComments prints the comments written before line on their own lines.
+func (p *printer) leadingComments(line int) {
+	for len(p.comments) > 0 && p.comments[0].Line < line {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+		p.blankLine(comment.Line)
+		p.lines = append(p.lines, outputLine{code: strings.Repeat(INDENT, p.indent) + comment.Text})
+		p.lastLine = comment.Line
+	}
+}
+
+// hasCommentsWithin reports whether a comment is written inside node,
+// other than a trailing comment on its last line.
+func (p *printer) hasCommentsWithin(node ast.Node) bool {
+	last := maxLine(node)
+	for _, comment := range p.comments {
+		if comment.Line < node.Line() {
+			continue
+		}
+		if comment.Line > last || comment.Line == last && comment.Trailing {
+			break
+		}
+		return true
+	}
+	return false
+}
+
+// hasTrailingComment reports whether a trailing comment is written on line.
+func (p *printer) hasTrailingComment(line int) bool {
+	for _, comment := range p.comments {
+		if comment.Line == line && comment.Trailing {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCommentsBetween reports whether a comment is written between the start of node and the first of expressions,
+// or between the last line of one of them and the next one, such as after an element of a multi-line array literal.
+func (p *printer) hasCommentsBetween(node ast.Node, expressions []ast.Expression) bool {
+	if len(expressions) == 0 {
+		return false
+	}
+	from := node.Line()
+	for _, expression := range expressions {
+		to := expression.Line()
+		for _, comment := range p.comments {
+			if from <= comment.Line && comment.Line < to {
+				return true
+			}
+		}
+		from = maxLine(expression)
+	}
+	return false
+}
+
+// output joins the lines, aligning the trailing comments of consecutive lines.
+func (p *printer) output() string {
+	var out strings.Builder
+	for i := 0; i < len(p.lines); {
+		if p.lines[i].comment == "" {
+			out.WriteString(strings.TrimRight(p.lines[i].code, " ") + "\n")
+			i++
+			continue
+		}
+
+		j, width := i, 0
+		for ; j < len(p.lines) && p.lines[j].comment != ""; j++ {
+			if len(p.lines[j].code) > width {
+				width = len(p.lines[j].code)
+			}
+		}
+		for _, line := range p.lines[i:j] {
+			out.WriteString(line.code + strings.Repeat(" ", width-len(line.code)+1) + line.comment + "\n")
+		}
+		i = j
+	}
+	return out.String()
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+	previousEnd := -1
+	for _, statement := range statements {
+		p.leadingComments(statement.Line())
+		p.blankLine(statement.Line())
+
+		start := len(p.lines)
+		p.statement(statement)
+		p.newline()
+
+		// newlines do not end statements, so `f()` followed by `(x)` would be read as `f()(x)`.
+		// the comments moved before the statement are skipped.
+		for strings.HasPrefix(strings.TrimSpace(p.lines[start].code), "#") {
+			start++
+		}
+		if previousEnd >= 0 && strings.ContainsAny(strings.TrimSpace(p.lines[start].code)[:1], "([-") {
+			p.lines[previousEnd].code += ";"
+		}
+		previousEnd = len(p.lines) - 1
+		if last := maxLine(statement); last > p.lastLine {
+			p.lastLine = last
+		}
+	}
+}
+
+func (p *printer) statement(statement ast.Statement) {
+	p.mark(statement)
+	switch statement := statement.(type) {
+	case *ast.VarStatement:
+		if statement.Type != nil {
+			p.write("var " + statement.Identifier.Name + ": " + statement.Type.String() + " = ")
+		} else {
+			p.write("var " + statement.Identifier.Name + " = ")
+		}
+		p.topLevelExpression(statement.Expression)
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.topLevelExpression(statement.Expression)
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.topLevelExpression(statement.Expression)
+	case *ast.YieldStatement:
+		p.write("yield ")
+		p.topLevelExpression(statement.Expression)
+	case *ast.ExpressionStatement:
+		p.topLevelExpression(statement.Expression)
+	default:
+		p.fail("line %d: unable to format statement: %T", statement.Line(), statement)
+	}
+}
+
+// topLevelExpression prints an expression which is a whole statement.
+// `->` pipelines of more than one stage are broken into one stage per line.
+func (p *printer) topLevelExpression(expression ast.Expression) {
+	stages := pipelineStages(expression)
+	if len(stages) < 2 {
+		p.expression(expression, parser.LOWEST)
+		return
+	}
+
+	p.expression(stages[0].Arguments[0], parser.ARROW)
+	for _, stage := range stages {
+		p.newlineBefore(stage.Line())
+		p.mark(stage)
+		p.write("-> ")
+		p.call(stage, stage.Function, stage.Arguments[1:])
+	}
+}
+
+// pipelineStages returns the arrow calls of the pipeline expression, from the first stage to the last.
+func pipelineStages(expression ast.Expression) []*ast.FunctionCall {
+	var stages []*ast.FunctionCall
+	for {
+		call, ok := expression.(*ast.FunctionCall)
+		if !ok || !isArrowCall(call) {
+			break
+		}
+		stages = append([]*ast.FunctionCall{call}, stages...)
+		expression = call.Arguments[0]
+	}
+	return stages
+}
+
+func isArrowCall(call *ast.FunctionCall) bool {
+	return call.Arrow && len(call.Arguments) > 0
+}
+
+func precedenceOf(expression ast.Expression) parser.Precedence {
+	switch expression := expression.(type) {
+	case *ast.InfixExpression:
+		if precedence, ok := operatorPrecedences[expression.Operator]; ok {
+			return precedence
+		}
+		return parser.LOWEST
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.IntegerLiteral:
+		if expression.Value < 0 {
+			return parser.PREFIX
+		}
+		return ATOM
+	case *ast.FunctionCall:
+		if isArrowCall(expression) {
+			return parser.ARROW
+		}
+		return parser.CALL
+	case *ast.MethodCall, *ast.IndexExpression, *ast.FieldExpression:
+		return parser.CALL
+	default:
+		return ATOM
+	}
+}
+
+// expression prints expression, parenthesized if it binds looser than precedence.
+func (p *printer) expression(expression ast.Expression, precedence parser.Precedence) {
+	if precedenceOf(expression) < precedence {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	// an infix or postfix expression starts at its operator, so it is marked after its left operand is printed.
+	switch expression.(type) {
+	case *ast.InfixExpression, *ast.FunctionCall, *ast.MethodCall, *ast.IndexExpression, *ast.FieldExpression:
+	default:
+		p.mark(expression)
+	}
+
+	switch expression := expression.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.BooleanLiteral, *ast.StringLiteral:
+		p.write(expression.String())
+	case *ast.PrefixExpression:
+		p.write(expression.Operator)
+		if precedenceOf(expression.Right) == parser.PREFIX {
+			// avoid `--x`.
+			p.write("(")
+			p.expression(expression.Right, parser.LOWEST)
+			p.write(")")
+		} else {
+			p.expression(expression.Right, parser.PREFIX)
+		}
+	case *ast.InfixExpression:
+		operatorPrecedence, ok := operatorPrecedences[expression.Operator]
+		if !ok {
+			operatorPrecedence = ATOM - 1
+		}
+		p.expression(expression.Left, operatorPrecedence)
+		p.mark(expression)
+		p.write(" " + expression.Operator + " ")
+		p.expression(expression.Right, operatorPrecedence+1)
+	case *ast.FunctionLiteral:
+		p.write("|")
+		p.parameterList(expression, expression.Parameters, expression.ParameterType)
+		p.write("| ")
+		if expression.ReturnType != nil {
+			p.write("-> " + expression.ReturnType.String() + " ")
+		}
+		p.block(expression.Body, p.isInline(expression.Body))
+	case *ast.MacroLiteral:
+		p.write("macro |")
+		p.parameterList(expression, expression.Parameters, func(int) ast.TypeAnnotation { return nil })
+		p.write("| ")
+		p.block(expression.Body, p.isInline(expression.Body))
+	case *ast.FunctionCall:
+		if isArrowCall(expression) {
+			p.expression(expression.Arguments[0], parser.ARROW)
+			p.write(" -> ")
+			p.call(expression, expression.Function, expression.Arguments[1:])
+		} else {
+			p.call(expression, expression.Function, expression.Arguments)
+		}
+	case *ast.MethodCall:
+		p.expression(expression.Receiver, parser.CALL)
+		p.mark(expression)
+		p.write("." + expression.Method.Name + "(")
+		p.expressionList(expression, expression.Arguments)
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.expressionList(expression, expression.Elements)
+		p.write("]")
+	case *ast.ArrayComprehension:
+		p.write("[")
+		p.expression(expression.Element, parser.LOWEST)
+		for _, clause := range expression.Clauses {
+			p.mark(clause)
+			p.write(" for " + clause.Variable.Name + " in ")
+			p.expression(clause.Iterable, parser.LOWEST)
+			if clause.Condition != nil {
+				p.write(" if ")
+				p.expression(clause.Condition, parser.LOWEST)
+			}
+		}
+		p.write("]")
+	case *ast.IndexExpression:
+		p.expression(expression.Array, parser.CALL)
+		p.mark(expression)
+		p.write("[")
+		p.expression(expression.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.FieldExpression:
+		p.expression(expression.Object, parser.CALL)
+		p.mark(expression)
+		p.write("." + expression.Field.Name)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(expression.Condition, parser.LOWEST)
+		p.write(") ")
+		// both branches are printed on one line, or neither of them.
+		inline := p.isInline(expression.Consequence) && (expression.Alternative == nil || p.isInline(expression.Alternative))
+		p.block(expression.Consequence, inline)
+		if expression.Alternative != nil {
+			p.keywordAfter(expression.Consequence, expression.Alternative, "else ")
+			p.block(expression.Alternative, inline)
+		}
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(expression.Body, p.isInline(expression.Body))
+		p.keywordAfter(expression.Body, expression.Parameter, "catch ("+expression.Parameter.Name+") ")
+		p.block(expression.Handler, p.isInline(expression.Handler))
+	default:
+		p.fail("line %d: unable to format expression: %T", expression.Line(), expression)
+	}
+}
+
+// call prints function(arguments...) of node.
+func (p *printer) call(node ast.Node, function ast.Expression, arguments []ast.Expression) {
+	if _, ok := function.(*ast.FieldExpression); ok {
+		// `(x.f)(y)` is not the method call `x.f(y)`.
+		p.expression(function, ATOM)
+	} else {
+		p.expression(function, parser.CALL)
+	}
+	p.mark(node)
+	p.write("(")
+	p.expressionList(node, arguments)
+	p.write(")")
+}
+
+// keywordAfter prints keyword, which continues an expression after block, followed by next.
+// it starts a new line if a trailing comment is written after the closing brace of block,
+// so that the comment stays there.
+func (p *printer) keywordAfter(block *ast.BlockStatement, next ast.Node, keyword string) {
+	if next.Line() > block.End && p.hasTrailingComment(block.End) {
+		p.newlineBefore(next.Line())
+		p.write(keyword)
+		return
+	}
+	p.write(" " + keyword)
+}
+
+// expressionList prints the expressions of node separated by commas,
+// or one per line, indented, if comments are written between them.
+func (p *printer) expressionList(node ast.Node, expressions []ast.Expression) {
+	p.list(node, expressions, func(i int) {
+		p.expression(expressions[i], parser.LOWEST)
+	})
+}
+
+// parameterList prints parameters of node with their type annotations, in the same way as expressionList.
+func (p *printer) parameterList(node ast.Node, parameters []*ast.Identifier, parameterType func(i int) ast.TypeAnnotation) {
+	expressions := make([]ast.Expression, len(parameters))
+	for i, parameter := range parameters {
+		expressions[i] = parameter
+	}
+	p.list(node, expressions, func(i int) {
+		p.mark(parameters[i])
+		if t := parameterType(i); t != nil {
+			p.write(parameters[i].Name + ": " + t.String())
+		} else {
+			p.write(parameters[i].Name)
+		}
+	})
+}
+
+// list prints the items of node with print separated by commas,
+// or one per line, indented, if comments are written between them.
+func (p *printer) list(node ast.Node, expressions []ast.Expression, print func(i int)) {
+	if !p.hasCommentsBetween(node, expressions) {
+		for i := range expressions {
+			if i > 0 {
+				p.write(", ")
+			}
+			print(i)
+		}
+		return
+	}
+
+	p.newlineBefore(expressions[0].Line())
+	p.indent++
+	for i, expression := range expressions {
+		p.leadingComments(expression.Line())
+		print(i)
+		if i < len(expressions)-1 {
+			p.write(",")
+			p.newlineBefore(expressions[i+1].Line())
+		} else {
+			p.newline()
+		}
+	}
+	p.indent--
+}
+
+// block prints `{ expression }` on one line if inline, which requires isInline(block),
+// and one statement per line, indented, otherwise.
+func (p *printer) block(block *ast.BlockStatement, inline bool) {
+	p.mark(block)
+	if inline {
+		if len(block.Statements) == 0 {
+			p.write("{}")
+			return
+		}
+		p.write("{ ")
+		p.expression(block.Statements[0].(*ast.ExpressionStatement).Expression, parser.LOWEST)
+		p.write(" }")
+		return
+	}
+
+	p.write("{")
+	p.newline()
+	p.indent++
+	p.statements(block.Statements)
+	p.leadingComments(block.End)
+	p.indent--
+	p.write("}")
+	p.markLine(block.End)
+}
+
+// isInline reports whether block is a single simple expression written on one line.
+func (p *printer) isInline(block *ast.BlockStatement) bool {
+	if maxLine(block) != block.Line() || p.hasCommentsWithin(block) {
+		return false
+	}
+	switch len(block.Statements) {
+	case 0:
+		return true
+	case 1:
+		statement, ok := block.Statements[0].(*ast.ExpressionStatement)
+		return ok && len(pipelineStages(statement.Expression)) < 2 && p.isSingleLine(statement.Expression)
+	default:
+		return false
+	}
+}
+
+func (p *printer) isSingleLine(expression ast.Expression) bool {
+	singleLine := true
+	ast.Inspect(expression, func(node ast.Node) bool {
+		if block, ok := node.(*ast.BlockStatement); ok && !p.isInline(block) {
+			singleLine = false
+		}
+		return singleLine
+	})
+	return singleLine
+}
+
+// maxLine returns the last line on which a node in the tree starts, or a block of it ends.
+func maxLine(node ast.Node) int {
+	last := node.Line()
+	ast.Inspect(node, func(node ast.Node) bool {
+		if node != nil && node.Line() > last {
+			last = node.Line()
+		}
+		if block, ok := node.(*ast.BlockStatement); ok && block.End > last {
+			last = block.End
+		}
+		return true
+	})
+	return last
+}
@@ -0,0 +1,184 @@
+package format
+
+import (
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/parser"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "one statement per line",
+			input:    "var x = 1; var y = 2;puts(x+y)",
+			expected: "var x = 1\nvar y = 2\nputs(x + y)\n",
+		},
+		{
+			desc:     "parentheses",
+			input:    "(1 + (2 * 3)) * (4 - (5 - 6)) == -(-7)",
+			expected: "(1 + 2 * 3) * (4 - (5 - 6)) == -(-7)\n",
+		},
+		{
+			desc:     "postfix",
+			input:    "(-x).f(a, b)[0].message; (f)(1); (x -> f())(1); [1][0]",
+			expected: "(-x).f(a, b)[0].message\nf(1);\n(x -> f())(1);\n[1][0]\n",
+		},
+		{
+			desc:     "semicolon before statement starting with parenthesis",
+			input:    "puts(1); (2 + 3) * 4; -5",
+			expected: "puts(1);\n(2 + 3) * 4;\n-5\n",
+		},
+		{
+			desc:     "single line block",
+			input:    "var double = |x|{x*2}; if (x) {1} else {2}; || {}",
+			expected: "var double = |x| { x * 2 }\nif (x) { 1 } else { 2 }\n|| {}\n",
+		},
+		{
+			desc:     "type annotations",
+			input:    "var n:int=1; var f = |x:int,xs :[ int ], g:( |int|->int )|->[int]{xs}",
+			expected: "var n: int = 1\nvar f = |x: int, xs: [int], g: |int| -> int| -> [int] { xs }\n",
+		},
+		{
+			desc:     "indented block",
+			input:    "var f = |x| { var y = x * 2; if (y > 1) { return y; } y }",
+			expected: "var f = |x| {\n  var y = x * 2\n  if (y > 1) {\n    return y\n  }\n  y\n}\n",
+		},
+		{
+			desc:     "block written on multiple lines",
+			input:    "var f = |x| {\nx\n}",
+			expected: "var f = |x| {\n  x\n}\n",
+		},
+		{
+			desc:     "try, macro and comprehension",
+			input:    "try { throw \"a\" } catch (e) { e.message }; var m = macro |x| { quote(unquote(x)) }; [x for x in xs if x > 1 for y in ys]",
+			expected: "try {\n  throw \"a\"\n} catch (e) { e.message }\nvar m = macro |x| { quote(unquote(x)) };\n[x for x in xs if x > 1 for y in ys]\n",
+		},
+		{
+			desc:     "arrow with one stage",
+			input:    "var x = (1 -> add(2)) * 3; var y = (1 + 2 -> f()) == 3",
+			expected: "var x = (1 -> add(2)) * 3\nvar y = 1 + 2 -> f() == 3\n",
+		},
+		{
+			desc:     "pipeline",
+			input:    "var x = [1, 2] -> map(|x| { x * 2 }) -> filter(|x| { x > 2 })",
+			expected: "var x = [1, 2]\n-> map(|x| { x * 2 })\n-> filter(|x| { x > 2 })\n",
+		},
+		{
+			desc:     "pipeline in block",
+			input:    "|xs| { xs -> f() -> g(1) }",
+			expected: "|xs| {\n  xs\n  -> f()\n  -> g(1)\n}\n",
+		},
+		{
+			desc:     "nested pipeline",
+			input:    "f(x -> g() -> h())",
+			expected: "f(x -> g() -> h())\n",
+		},
+		{
+			desc:     "comments",
+			input:    "# head\n\n\nvar x = 1 # one\nvar yy = 2    # two\n\n# before\nputs(x)\n# tail",
+			expected: "# head\n\nvar x = 1  # one\nvar yy = 2 # two\n\n# before\nputs(x)\n# tail\n",
+		},
+		{
+			desc:     "comments in block",
+			input:    "var f = |x| { # start\n  x # end\n}",
+			expected: "var f = |x| { # start\n  x           # end\n}\n",
+		},
+		{
+			desc:     "comments in pipeline",
+			input:    "var x =\n[1, 2]\n-> f() # f\n-> g() # g",
+			expected: "var x = [1, 2]\n-> f() # f\n-> g() # g\n",
+		},
+		{
+			desc:     "comments in array literal",
+			input:    "var xs = [\n1, # one\n2 # two\n]",
+			expected: "var xs = [\n  1, # one\n  2  # two\n]\n",
+		},
+		{
+			desc:     "comments between arguments",
+			input:    "f(a, # a\n\n# before b\nb, [c,\nd]).g(\n# e\ne)",
+			expected: "f(\n  a, # a\n\n  # before b\n  b,\n  [c, d]\n).g(\n  # e\n  e\n)\n",
+		},
+		{
+			desc:     "comments in callback",
+			input:    "xs -> map(|x| { # double\n  x * 2\n})",
+			expected: "xs -> map(|x| { # double\n  x * 2\n})\n",
+		},
+		{
+			desc:     "comments in multi-line expression",
+			input:    "var x = 1 + # one\n2 # two",
+			expected: "# one\nvar x = 1 + 2 # two\n",
+		},
+		{
+			desc:     "comments moved before statement starting with parenthesis",
+			input:    "puts(1);\n(2 + # two\n3) * 4 # four",
+			expected: "puts(1);\n# two\n(2 + 3) * 4 # four\n",
+		},
+		{
+			desc:     "trailing comment on pipeline",
+			input:    "var x = [1, 2] -> f() -> g() # x",
+			expected: "var x = [1, 2]\n-> f()\n-> g() # x\n",
+		},
+		{
+			desc:     "comments before closing brace",
+			input:    "var f = |x| {\n  x + 1\n\n  # end of block\n}\nvar g = || {\n  # empty\n}",
+			expected: "var f = |x| {\n  x + 1\n\n  # end of block\n}\nvar g = || {\n  # empty\n}\n",
+		},
+		{
+			desc:     "comments between parameters",
+			input:    "var f = |a, # first\n b: int| { a + b }\nmacro |x, # x\ny| { x }",
+			expected: "var f = |\n  a, # first\n  b: int\n| { a + b }\nmacro |\n  x, # x\n  y\n| { x }\n",
+		},
+		{
+			desc:     "trailing comments after closing brace",
+			input:    "if (x) {\n  1\n} # then\nelse {\n  2\n} # else\ntry {\n  f()\n} # body\ncatch (e) { e }\nif (x) { 1 } else { 2 } # inline",
+			expected: "if (x) {\n  1\n} # then\nelse {\n  2\n} # else\ntry {\n  f()\n} # body\ncatch (e) { e }\nif (x) { 1 } else { 2 } # inline\n",
+		},
+		{
+			desc:     "if with one branch on multiple lines",
+			input:    "var f = |a, b| { if (a > b) { return a - b } else { b - a } }",
+			expected: "var f = |a, b| {\n  if (a > b) {\n    return a - b\n  } else {\n    b - a\n  }\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			formatted, err := Source([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("err occurred: %s", err)
+			}
+			if string(formatted) != tt.expected {
+				t.Errorf("formatted source wrong.\nwant=%q\ngot=%q\n", tt.expected, formatted)
+			}
+
+			reformatted, err := Source(formatted)
+			if err != nil {
+				t.Fatalf("err occurred: %s", err)
+			}
+			if string(reformatted) != string(formatted) {
+				t.Errorf("formatting is not idempotent.\nwant=%q\ngot=%q\n", formatted, reformatted)
+			}
+
+			if got, want := parse(t, string(formatted)), parse(t, tt.input); got != want {
+				t.Errorf("formatted program differs.\nwant=%s\ngot=%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestSource_Error(t *testing.T) {
+	if _, err := Source([]byte("var = 1")); err == nil {
+		t.Errorf("error should occur")
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("err occurred: %s", err)
+	}
+	return program.String()
+}
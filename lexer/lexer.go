@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"github.com/muiscript/ether/token"
+	"strings"
 )
 
 // TODO: implement builtin function (filter, reduce...)
@@ -12,6 +13,10 @@ type Lexer struct {
 	peekPosition    int
 	currentLine     int
 	ch              byte
+	lastTokenLine   int
+	tokenStart      int // the byte offset of the last token read
+	tokenEnd        int // the byte offset following the last token read
+	comments        []token.Comment
 }
 
 func New(input string) *Lexer {
@@ -24,6 +29,7 @@ func New(input string) *Lexer {
 func (l *Lexer) NextToken() token.Token {
 	l.skipSpaces()
 
+	start := l.currentPosition
 	var tok token.Token
 	switch l.ch {
 	case '#':
@@ -76,8 +82,19 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.Token{Type: token.RBRACKET, Literal: "]", Line: l.currentLine}
 	case '|':
 		tok = token.Token{Type: token.BAR, Literal: "|", Line: l.currentLine}
+	case '.':
+		tok = token.Token{Type: token.DOT, Literal: ".", Line: l.currentLine}
+	case '"':
+		line := l.currentLine
+		if literal, ok := l.readString(); ok {
+			tok = token.Token{Type: token.STRING, Literal: literal, Line: line}
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Literal: literal, Line: line}
+		}
 	case ',':
 		tok = token.Token{Type: token.COMMA, Literal: ",", Line: l.currentLine}
+	case ':':
+		tok = token.Token{Type: token.COLON, Literal: ":", Line: l.currentLine}
 	case ';':
 		tok = token.Token{Type: token.SEMICOLON, Literal: ";", Line: l.currentLine}
 	case 0:
@@ -95,9 +112,32 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.consumeChar()
+	l.lastTokenLine = tok.Line
+	l.tokenStart, l.tokenEnd = start, l.currentPosition
+	if l.tokenEnd > len(l.input) {
+		l.tokenEnd = len(l.input)
+	}
+	if l.tokenStart > l.tokenEnd {
+		l.tokenStart = l.tokenEnd
+	}
 	return tok
 }
 
+// Comments returns the comments read so far.
+func (l *Lexer) Comments() []token.Comment {
+	return l.comments
+}
+
+// Range returns the byte offsets of the input the last token was read from, from start up to end.
+func (l *Lexer) Range() (start, end int) {
+	return l.tokenStart, l.tokenEnd
+}
+
+// Text returns the input from the byte offset start up to end.
+func (l *Lexer) Text(start, end int) string {
+	return l.input[start:end]
+}
+
 func (l *Lexer) consumeChar() {
 	if l.peekPosition >= len(l.input) {
 		l.ch = 0
@@ -142,6 +182,39 @@ func (l *Lexer) readInteger() string {
 	return l.input[start : l.currentPosition+1]
 }
 
+// readString reads a double-quoted string literal and returns its unescaped content.
+// ok is false when the input ends before the closing quote.
+func (l *Lexer) readString() (literal string, ok bool) {
+	var out []byte
+	for {
+		l.consumeChar()
+		switch l.ch {
+		case 0:
+			return string(out), false
+		case '"':
+			return string(out), true
+		case '\\':
+			l.consumeChar()
+			switch l.ch {
+			case 'n':
+				out = append(out, '\n')
+			case 't':
+				out = append(out, '\t')
+			case 'r':
+				out = append(out, '\r')
+			case '0':
+				out = append(out, 0)
+			case 0:
+				return string(out), false
+			default:
+				out = append(out, l.ch)
+			}
+		default:
+			out = append(out, l.ch)
+		}
+	}
+}
+
 func (l *Lexer) skipSpaces() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' || l.ch == '\n' {
 		l.consumeChar()
@@ -149,9 +222,14 @@ func (l *Lexer) skipSpaces() {
 }
 
 func (l *Lexer) ignoreComment() {
+	start := l.currentPosition
+	line := l.currentLine
 	for l.ch != '\n' && l.ch != 0 {
 		l.consumeChar()
 	}
+
+	text := strings.TrimRight(l.input[start:l.currentPosition], " \t\r")
+	l.comments = append(l.comments, token.Comment{Text: text, Line: line, Trailing: l.lastTokenLine == line})
 }
 
 func isDigit(c byte) bool {
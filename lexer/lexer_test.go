@@ -20,7 +20,7 @@ func TestLexer_NextToken(t *testing.T) {
 		},
 		{
 			desc:  "single-char operators",
-			input: "=+-*/%!<>(){}[]|,;",
+			input: "=+-*/%!<>(){}[]|,:;",
 			expectedTokens: []token.Token{
 				{Type: token.ASSIGN, Literal: "=", Line: 1},
 				{Type: token.PLUS, Literal: "+", Line: 1},
@@ -39,6 +39,7 @@ func TestLexer_NextToken(t *testing.T) {
 				{Type: token.RBRACKET, Literal: "]", Line: 1},
 				{Type: token.BAR, Literal: "|", Line: 1},
 				{Type: token.COMMA, Literal: ",", Line: 1},
+				{Type: token.COLON, Literal: ":", Line: 1},
 				{Type: token.SEMICOLON, Literal: ";", Line: 1},
 				{Type: token.EOF, Literal: "", Line: 1},
 			},
@@ -141,6 +142,51 @@ return foo;`,
 				{Type: token.EOF, Literal: "", Line: 1},
 			},
 		},
+		{
+			desc:  "string literal",
+			input: `"foo" "a \"b\"\n" "\t\r\0\\" e.message`,
+			expectedTokens: []token.Token{
+				{Type: token.STRING, Literal: "foo", Line: 1},
+				{Type: token.STRING, Literal: "a \"b\"\n", Line: 1},
+				{Type: token.STRING, Literal: "\t\r\x00\\", Line: 1},
+				{Type: token.IDENT, Literal: "e", Line: 1},
+				{Type: token.DOT, Literal: ".", Line: 1},
+				{Type: token.IDENT, Literal: "message", Line: 1},
+				{Type: token.EOF, Literal: "", Line: 1},
+			},
+		},
+		{
+			desc:  "throw and try-catch",
+			input: "try { throw 1 } catch (e) { e }",
+			expectedTokens: []token.Token{
+				{Type: token.TRY, Literal: "try", Line: 1},
+				{Type: token.LBRACE, Literal: "{", Line: 1},
+				{Type: token.THROW, Literal: "throw", Line: 1},
+				{Type: token.INTEGER, Literal: "1", Line: 1},
+				{Type: token.RBRACE, Literal: "}", Line: 1},
+				{Type: token.CATCH, Literal: "catch", Line: 1},
+				{Type: token.LPAREN, Literal: "(", Line: 1},
+				{Type: token.IDENT, Literal: "e", Line: 1},
+				{Type: token.RPAREN, Literal: ")", Line: 1},
+				{Type: token.LBRACE, Literal: "{", Line: 1},
+				{Type: token.IDENT, Literal: "e", Line: 1},
+				{Type: token.RBRACE, Literal: "}", Line: 1},
+				{Type: token.EOF, Literal: "", Line: 1},
+			},
+		},
+		{
+			desc:  "yield",
+			input: "|| { yield 1 }",
+			expectedTokens: []token.Token{
+				{Type: token.BAR, Literal: "|", Line: 1},
+				{Type: token.BAR, Literal: "|", Line: 1},
+				{Type: token.LBRACE, Literal: "{", Line: 1},
+				{Type: token.YIELD, Literal: "yield", Line: 1},
+				{Type: token.INTEGER, Literal: "1", Line: 1},
+				{Type: token.RBRACE, Literal: "}", Line: 1},
+				{Type: token.EOF, Literal: "", Line: 1},
+			},
+		},
 		{
 			desc: "comment",
 			input: `var foo = 42;
@@ -175,3 +221,29 @@ return foo; # this is comment`,
 		})
 	}
 }
+
+func TestLexer_Comments(t *testing.T) {
+	input := `# head
+var foo = 42; # foo  
+  # indented
+return foo;`
+	expected := []token.Comment{
+		{Text: "# head", Line: 1, Trailing: false},
+		{Text: "# foo", Line: 2, Trailing: true},
+		{Text: "# indented", Line: 3, Trailing: false},
+	}
+
+	lexer := New(input)
+	for lexer.NextToken().Type != token.EOF {
+	}
+
+	comments := lexer.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("number of comments wrong.\nwant=%d\ngot=%d\n", len(expected), len(comments))
+	}
+	for i, comment := range comments {
+		if comment != expected[i] {
+			t.Errorf("wrong comment. \nwant:%+v\ngot:%+v\n", expected[i], comment)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+// Package lint reports suspicious code which is valid ether.
+package lint
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/evaluator"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/parser"
+	"github.com/muiscript/ether/token"
+	"sort"
+	"strings"
+)
+
+// names of the rules.
+const (
+	UNUSED         = "unused"         // var bindings and parameters which are never used
+	SHADOW         = "shadow"         // bindings which shadow builtin functions
+	UNREACHABLE    = "unreachable"    // statements after return or throw in a block
+	IF_VALUE       = "if-value"       // if without else used as a value
+	CALLBACK_ARITY = "callback-arity" // functions passed to map, filter, reduce, iterate and spawn with the wrong number of parameters
+)
+
+// Rules are all the rules. every rule is enabled unless disabled.
+var Rules = []string{UNUSED, SHADOW, UNREACHABLE, IF_VALUE, CALLBACK_ARITY}
+
+// IGNORE_DIRECTIVE in a comment suppresses the warnings of the rules following it, or all the warnings if none follows.
+// a trailing comment applies to its own line, and a comment on its own line applies to the next line.
+const IGNORE_DIRECTIVE = "lint:ignore"
+
+// the number of parameters of the function argument of the builtin higher-order functions.
+var callbackArities = map[string]struct{ index, parameters int }{
+	"map":     {index: 1, parameters: 1},
+	"filter":  {index: 1, parameters: 1},
+	"reduce":  {index: 2, parameters: 2},
+	"iterate": {index: 1, parameters: 1},
+	"spawn":   {index: 0, parameters: 0},
+}
+
+type Warning struct {
+	Rule    string
+	Line    int
+	Message string
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("line %d: %s (%s)", w.Line, w.Message, w.Rule)
+}
+
+// Source lints ether source code.
+// the warnings of the rules in disabled and the ones suppressed by comments are not reported.
+func Source(src []byte, disabled map[string]bool) ([]*Warning, error) {
+	l := lexer.New(string(src))
+	program, err := parser.New(l).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+
+	for rule := range disabled {
+		if !isRule(rule) {
+			return nil, fmt.Errorf("unknown rule: %q", rule)
+		}
+	}
+
+	var warnings []*Warning
+	ignored := ignoredRules(l.Comments())
+	for _, warning := range Program(program) {
+		if disabled[warning.Rule] || ignored[warning.Line][warning.Rule] || ignored[warning.Line][""] {
+			continue
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings, nil
+}
+
+func isRule(name string) bool {
+	for _, rule := range Rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredRules returns the rules ignored by comments for each line. the rule "" means all of them.
+func ignoredRules(comments []token.Comment) map[int]map[string]bool {
+	ignored := make(map[int]map[string]bool)
+	for _, comment := range comments {
+		fields := strings.Fields(strings.TrimPrefix(comment.Text, "#"))
+		if len(fields) == 0 || fields[0] != IGNORE_DIRECTIVE {
+			continue
+		}
+
+		line := comment.Line
+		if !comment.Trailing {
+			line++
+		}
+		if ignored[line] == nil {
+			ignored[line] = make(map[string]bool)
+		}
+		if len(fields) == 1 {
+			ignored[line][""] = true
+		}
+		for _, field := range fields[1:] {
+			for _, rule := range strings.Split(field, ",") {
+				ignored[line][rule] = true
+			}
+		}
+	}
+	return ignored
+}
+
+// Program returns the warnings of all the rules for program, in the order of lines.
+func Program(program *ast.Program) []*Warning {
+	l := &linter{statementIfs: make(map[*ast.IfExpression]bool), returnedIfs: make(map[*ast.IfExpression]bool)}
+	l.enter(false)
+	ast.Hoist(l.scope.hoisted, program)
+	l.statements(program.Statements)
+	l.leave()
+
+	sort.SliceStable(l.warnings, func(i, j int) bool { return l.warnings[i].Line < l.warnings[j].Line })
+	return l.warnings
+}
+
+type binding struct {
+	identifier *ast.Identifier
+	kind       string // "variable" or "parameter"
+	used       bool
+	function   *ast.FunctionLiteral // the function bound by var, if any
+}
+
+// scope follows the environments created during the evaluation, as the resolver of the evaluator does.
+type scope struct {
+	outer     *scope
+	function  bool
+	bindings  []*binding
+	declared  map[string]*binding
+	hoisted   map[string]bool // the names declared anywhere in the scope
+	usedEarly map[string]bool // the names used by closures, which may be called after the names are declared again
+}
+
+type linter struct {
+	scope        *scope
+	statementIfs map[*ast.IfExpression]bool // if expressions whose value is discarded
+	returnedIfs  map[*ast.IfExpression]bool // if expressions ending the bodies of functions, whose value is returned
+	warnings     []*Warning
+}
+
+func (l *linter) warn(rule string, line int, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, &Warning{Rule: rule, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) enter(function bool) {
+	l.scope = &scope{
+		outer:     l.scope,
+		function:  function,
+		declared:  make(map[string]*binding),
+		hoisted:   make(map[string]bool),
+		usedEarly: make(map[string]bool),
+	}
+}
+
+// leave reports the bindings of the current scope which are never used.
+// names starting with '_' are intentionally unused.
+func (l *linter) leave() {
+	for _, binding := range l.scope.bindings {
+		if !binding.used && !strings.HasPrefix(binding.identifier.Name, "_") {
+			l.warn(UNUSED, binding.identifier.Line(), "%s %q is never used", binding.kind, binding.identifier.Name)
+		}
+	}
+	l.scope = l.scope.outer
+}
+
+func (l *linter) declare(identifier *ast.Identifier, kind string) *binding {
+	if evaluator.IsBuiltin(identifier.Name) {
+		l.warn(SHADOW, identifier.Line(), "%s %q shadows builtin function", kind, identifier.Name)
+	}
+
+	b := &binding{identifier: identifier, kind: kind, used: l.scope.usedEarly[identifier.Name]}
+	l.scope.bindings = append(l.scope.bindings, b)
+	l.scope.declared[identifier.Name] = b
+	return b
+}
+
+// lookup marks the binding identifier refers to as used.
+// it returns nil if identifier is not declared, such as builtin functions.
+func (l *linter) lookup(identifier *ast.Identifier) *binding {
+	inClosure := false
+	for s := l.scope; s != nil; s = s.outer {
+		if b, ok := s.declared[identifier.Name]; ok {
+			b.used = true
+			// a var statement declaring the name again assigns the same variable, which the closure reads when it is called.
+			if inClosure {
+				s.usedEarly[identifier.Name] = true
+			}
+			return b
+		}
+		if inClosure && s.hoisted[identifier.Name] {
+			s.usedEarly[identifier.Name] = true
+			return nil
+		}
+		if s.function {
+			inClosure = true
+		}
+	}
+	return nil
+}
+
+func (l *linter) statements(statements []ast.Statement) {
+	for _, statement := range statements {
+		l.statement(statement)
+	}
+}
+
+func (l *linter) block(block *ast.BlockStatement) {
+	for i := 0; i+1 < len(block.Statements); i++ {
+		var keyword string
+		switch block.Statements[i].(type) {
+		case *ast.ReturnStatement:
+			keyword = "return"
+		case *ast.ThrowStatement:
+			keyword = "throw"
+		default:
+			continue
+		}
+		l.warn(UNREACHABLE, block.Statements[i+1].Line(), "unreachable code after %s", keyword)
+		break
+	}
+	l.statements(block.Statements)
+}
+
+func (l *linter) statement(statement ast.Statement) {
+	switch statement := statement.(type) {
+	case *ast.VarStatement:
+		l.expression(statement.Expression)
+		b := l.declare(statement.Identifier, "variable")
+		if function, ok := statement.Expression.(*ast.FunctionLiteral); ok {
+			b.function = function
+		}
+	case *ast.ReturnStatement:
+		l.expression(statement.Expression)
+	case *ast.ThrowStatement:
+		l.expression(statement.Expression)
+	case *ast.YieldStatement:
+		l.expression(statement.Expression)
+	case *ast.ExpressionStatement:
+		if ifExpression, ok := statement.Expression.(*ast.IfExpression); ok && !l.returnedIfs[ifExpression] {
+			l.statementIfs[ifExpression] = true
+		}
+		l.expression(statement.Expression)
+	}
+}
+
+func (l *linter) expressions(expressions []ast.Expression) {
+	for _, expression := range expressions {
+		l.expression(expression)
+	}
+}
+
+func (l *linter) expression(expression ast.Expression) {
+	switch expression := expression.(type) {
+	case *ast.Identifier:
+		l.lookup(expression)
+	case *ast.PrefixExpression:
+		l.expression(expression.Right)
+	case *ast.InfixExpression:
+		l.expression(expression.Left)
+		l.expression(expression.Right)
+	case *ast.FunctionLiteral:
+		l.function(expression.Parameters, expression.Body)
+	case *ast.MacroLiteral:
+		l.function(expression.Parameters, expression.Body)
+	case *ast.FunctionCall:
+		if isQuoteCall(expression) {
+			l.quote(expression.Arguments[0])
+			return
+		}
+		l.expressions(expression.Arguments)
+		l.expression(expression.Function)
+		if identifier, ok := expression.Function.(*ast.Identifier); ok {
+			l.callback(identifier, expression.Arguments)
+		}
+	case *ast.MethodCall:
+		l.expression(expression.Receiver)
+		l.expressions(expression.Arguments)
+		l.expression(expression.Method)
+		l.callback(expression.Method, append([]ast.Expression{expression.Receiver}, expression.Arguments...))
+	case *ast.ArrayLiteral:
+		l.expressions(expression.Elements)
+	case *ast.ArrayComprehension:
+		for _, clause := range expression.Clauses {
+			l.expression(clause.Iterable)
+			l.enter(false)
+			l.declare(clause.Variable, "variable")
+			if clause.Condition != nil {
+				l.expression(clause.Condition)
+			}
+		}
+		l.expression(expression.Element)
+		for range expression.Clauses {
+			l.leave()
+		}
+	case *ast.IndexExpression:
+		l.expression(expression.Array)
+		l.expression(expression.Index)
+	case *ast.FieldExpression:
+		l.expression(expression.Object)
+	case *ast.IfExpression:
+		if expression.Alternative == nil && !l.statementIfs[expression] {
+			l.warn(IF_VALUE, expression.Line(), "value of if without else is null when the condition is false")
+		}
+		l.expression(expression.Condition)
+		l.block(expression.Consequence)
+		if expression.Alternative != nil {
+			l.block(expression.Alternative)
+		}
+	case *ast.TryExpression:
+		l.block(expression.Body)
+		l.enter(false)
+		ast.Hoist(l.scope.hoisted, expression.Handler)
+		// the error is often caught only to be ignored.
+		l.declare(expression.Parameter, "parameter").used = true
+		l.block(expression.Handler)
+		l.leave()
+	}
+}
+
+func (l *linter) function(parameters []*ast.Identifier, body *ast.BlockStatement) {
+	l.enter(true)
+	for _, parameter := range parameters {
+		l.declare(parameter, "parameter")
+	}
+	ast.Hoist(l.scope.hoisted, body)
+	// the value of the last statement of the body is returned, unless the function is a generator.
+	if len(body.Statements) > 0 && !ast.Yields(body) {
+		if statement, ok := body.Statements[len(body.Statements)-1].(*ast.ExpressionStatement); ok {
+			if ifExpression, ok := statement.Expression.(*ast.IfExpression); ok {
+				l.returnedIfs[ifExpression] = true
+			}
+		}
+	}
+	l.block(body)
+	l.leave()
+}
+
+// callback checks the number of parameters of the function passed to map, filter, reduce or iterate.
+func (l *linter) callback(function *ast.Identifier, arguments []ast.Expression) {
+	arity, ok := callbackArities[function.Name]
+	if !ok || arity.index >= len(arguments) || l.isDeclared(function.Name) {
+		return
+	}
+
+	var callback *ast.FunctionLiteral
+	switch argument := arguments[arity.index].(type) {
+	case *ast.FunctionLiteral:
+		callback = argument
+	case *ast.Identifier:
+		if b := l.binding(argument.Name); b != nil {
+			callback = b.function
+		}
+	}
+	if callback != nil && len(callback.Parameters) != arity.parameters {
+		l.warn(CALLBACK_ARITY, arguments[arity.index].Line(), "function passed to %s should take %d parameter(s), but takes %d", function.Name, arity.parameters, len(callback.Parameters))
+	}
+}
+
+func (l *linter) binding(name string) *binding {
+	for s := l.scope; s != nil; s = s.outer {
+		if b, ok := s.declared[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (l *linter) isDeclared(name string) bool {
+	for s := l.scope; s != nil; s = s.outer {
+		if _, ok := s.declared[name]; ok || s.hoisted[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// quote marks the names used in quoted code as used, since they are used where the code is expanded.
+func (l *linter) quote(quoted ast.Node) {
+	ast.Inspect(quoted, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionCall:
+			if isUnquoteCall(node) {
+				l.expression(node.Arguments[0])
+				return false
+			}
+		case *ast.Identifier:
+			l.lookup(node)
+		}
+		return true
+	})
+}
+
+func isQuoteCall(functionCall *ast.FunctionCall) bool {
+	identifier, ok := functionCall.Function.(*ast.Identifier)
+	return ok && identifier.Name == "quote" && len(functionCall.Arguments) == 1
+}
+
+func isUnquoteCall(node ast.Node) bool {
+	functionCall, ok := node.(*ast.FunctionCall)
+	if !ok {
+		return false
+	}
+	identifier, ok := functionCall.Function.(*ast.Identifier)
+	return ok && identifier.Name == "unquote" && len(functionCall.Arguments) == 1
+}
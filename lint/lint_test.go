@@ -0,0 +1,130 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected []string
+	}{
+		{
+			desc:     "no warnings",
+			input:    "var double = |x| { x * 2 }\nputs([1, 2] -> map(double))",
+			expected: []string{},
+		},
+		{
+			desc:  "unused",
+			input: "var a = 1\nvar f = |x, y, _z| {\n  var b = y\n  y\n}\nf(1, 2, 3)",
+			expected: []string{
+				`line 1: variable "a" is never used (unused)`,
+				`line 2: parameter "x" is never used (unused)`,
+				`line 3: variable "b" is never used (unused)`,
+			},
+		},
+		{
+			desc:     "used by closure before declared",
+			input:    "var f = || { g() }\nvar g = || { f() }\n",
+			expected: []string{},
+		},
+		{
+			desc:     "declared again after used by closure",
+			input:    "var x = 1\nvar f = || { x }\nvar x = 2\nputs(f())\nvar y = 1\nputs(y)\nvar y = 2",
+			expected: []string{`line 7: variable "y" is never used (unused)`},
+		},
+		{
+			desc:     "used in quote",
+			input:    "var helper = |x| { x }\nvar m = macro |a| { quote(helper(unquote(a))) }\nm(1)",
+			expected: []string{},
+		},
+		{
+			desc:  "shadow",
+			input: "var len = |x| { x }\n|map| { map };\n[filter for filter in [1]]\nlen(1)",
+			expected: []string{
+				`line 1: variable "len" shadows builtin function (shadow)`,
+				`line 2: parameter "map" shadows builtin function (shadow)`,
+				`line 3: variable "filter" shadows builtin function (shadow)`,
+			},
+		},
+		{
+			desc:  "unreachable",
+			input: "|| {\n  return 1\n  puts(2)\n  return 3\n}\n|| {\n  throw 1\n  2\n}",
+			expected: []string{
+				`line 3: unreachable code after return (unreachable)`,
+				`line 8: unreachable code after throw (unreachable)`,
+			},
+		},
+		{
+			desc:  "if without else as value",
+			input: "if (true) { puts(1) }\nputs(if (true) { 1 })\nvar x = if (true) { 1 } else { 2 }\nputs(x)",
+			expected: []string{
+				`line 2: value of if without else is null when the condition is false (if-value)`,
+			},
+		},
+		{
+			desc:  "if without else returned",
+			input: "var f = |x| {\n  if (x > 0) { puts(x) }\n  if (x > 1) { x }\n}\nvar g = |x| {\n  if (x > 0) { yield x }\n}\nf(1)\ng(1)",
+			expected: []string{
+				`line 3: value of if without else is null when the condition is false (if-value)`,
+			},
+		},
+		{
+			desc:  "callback arity",
+			input: "var add = |a, b| { a + b }\nmap([1], add);\n[1] -> filter(|| { true });\n[1].reduce(0, |x| { x })\nreduce([1], 0, add)\niterate(1, add)\nspawn(add)",
+			expected: []string{
+				`line 2: function passed to map should take 1 parameter(s), but takes 2 (callback-arity)`,
+				`line 3: function passed to filter should take 1 parameter(s), but takes 0 (callback-arity)`,
+				`line 4: function passed to reduce should take 2 parameter(s), but takes 1 (callback-arity)`,
+				`line 6: function passed to iterate should take 1 parameter(s), but takes 2 (callback-arity)`,
+				`line 7: function passed to spawn should take 0 parameter(s), but takes 2 (callback-arity)`,
+			},
+		},
+		{
+			desc:     "callback arity of user defined map",
+			input:    "var map = |xs, f| { f(xs) }\nmap([1], |a, b| { a + b })",
+			expected: []string{`line 1: variable "map" shadows builtin function (shadow)`},
+		},
+		{
+			desc:  "suppressed by comment",
+			input: "var a = 1 # lint:ignore unused\n# lint:ignore\nvar len = 2\nvar b = 3 # lint:ignore shadow",
+			expected: []string{
+				`line 4: variable "b" is never used (unused)`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			warnings, err := Source([]byte(tt.input), nil)
+			if err != nil {
+				t.Fatalf("err occurred: %s", err)
+			}
+
+			actual := []string{}
+			for _, warning := range warnings {
+				actual = append(actual, warning.String())
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("warnings wrong.\nwant=%q\ngot=%q\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSource_Disabled(t *testing.T) {
+	input := "var len = 1\nputs(if (true) { 1 })"
+	warnings, err := Source([]byte(input), map[string]bool{UNUSED: true, SHADOW: true})
+	if err != nil {
+		t.Fatalf("err occurred: %s", err)
+	}
+	if len(warnings) != 1 || warnings[0].Rule != IF_VALUE {
+		t.Errorf("warnings wrong.\nwant=[%s]\ngot=%v\n", IF_VALUE, warnings)
+	}
+
+	if _, err := Source([]byte(input), map[string]bool{"unknown": true}); err == nil {
+		t.Errorf("error should occur for unknown rule")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/muiscript/ether/lint"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// lintCommand prints the warnings for files. the exit status is 1 if there is any.
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	disable := flags.String("disable", "", "comma separated rules to disable: "+strings.Join(lint.Rules, ", "))
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 1
+	}
+
+	disabled := make(map[string]bool)
+	for _, rule := range strings.Split(*disable, ",") {
+		if rule != "" {
+			disabled[rule] = true
+		}
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		warnings, err := lint.Source(src, disabled)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			return 2
+		}
+
+		for _, warning := range warnings {
+			fmt.Printf("%s: %s\n", filename, warning)
+			status = 1
+		}
+	}
+	return status
+}
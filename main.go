@@ -1,36 +1,61 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/compiler"
 	"github.com/muiscript/ether/evaluator"
 	"github.com/muiscript/ether/lexer"
 	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/optimizer"
 	"github.com/muiscript/ether/parser"
 	"github.com/muiscript/ether/repl"
+	"github.com/muiscript/ether/vm"
 	"io/ioutil"
 	"os"
 )
 
 const USAGE = `
 usage: ether [FILE_PATH]
+       ether run [--optimize] [--vm] [--timeout DURATION] [--seed SEED] FILE_PATH
+       ether ast (--json | --dot | --tree) FILE_PATH
+       ether check FILE_PATH...
+       ether fmt [--check] [--diff] [-w] FILE_PATH...
+       ether lint [--disable RULE,...] FILE_PATH...
 `
 
 func main() {
+	if len(os.Args) > 2 {
+		switch os.Args[1] {
+		case "ast":
+			os.Exit(astCommand(os.Args[2:]))
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "check":
+			os.Exit(checkCommand(os.Args[2:]))
+		case "fmt":
+			os.Exit(fmtCommand(os.Args[2:]))
+		case "lint":
+			os.Exit(lintCommand(os.Args[2:]))
+		}
+	}
+
 	switch len(os.Args) {
 	case 1:
 		repl.Start()
 	case 2:
-		os.Exit(interpret(os.Args[1]))
+		os.Exit(interpret(os.Args[1], runOptions{}))
 	default:
 		fmt.Fprintf(os.Stderr, USAGE)
 		os.Exit(1)
 	}
 }
 
-func interpret(filename string) int {
+func interpret(filename string, options runOptions) int {
 	bytes, err := ioutil.ReadFile(filename)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr, err)
 		return 1
 	}
 
@@ -39,16 +64,82 @@ func interpret(filename string) int {
 
 	program, err := p.ParseProgram()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr, err)
 		return 2
 	}
 
-	env := object.NewEnvironment()
-	_, err = evaluator.Eval(program, env)
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr, err)
+		return 3
+	}
+	if err := evaluator.NewResolver().Resolve(expanded); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if options.optimize {
+		expanded = optimizer.Optimize(expanded.(*ast.Program))
+		// the slots are assigned again for the program rewritten, whose names are all defined.
+		evaluator.NewResolver().Resolve(expanded)
+	}
+
+	ctx := context.Background()
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+
+	scheduler := evaluator.NewParallelScheduler()
+	if options.deterministic {
+		scheduler = evaluator.NewDeterministicScheduler(options.seed)
+	}
+
+	if options.vm {
+		bytecode, compileErr := compiler.Compile(expanded.(*ast.Program))
+		if compileErr != nil {
+			fmt.Fprintln(os.Stderr, compileErr)
+			return 2
+		}
+		_, err = vm.New(bytecode).RunWithScheduler(ctx, scheduler)
+	} else {
+		env := object.NewEnvironment()
+		_, err = evaluator.EvalWithScheduler(ctx, expanded, env, scheduler)
+	}
+	if err != nil {
+		if evalError, ok := err.(*evaluator.EvalError); ok && evalError.Kind() == evaluator.INTERNAL_ERROR {
+			// an internal error is a bug of ether, reported with the stack of the Go code.
+			fmt.Fprintf(os.Stderr, "%s\n", evalError.PanicStack())
+		}
+		printTraceback(err)
+		fmt.Fprintln(os.Stderr, err)
 		return 3
 	}
 
 	return 0
 }
+
+// printTraceback prints the calls being evaluated when err is raised, if it is raised in a function.
+// a frame repeated by recursion is printed once with the number of the repetitions.
+func printTraceback(err error) {
+	evalError, ok := err.(*evaluator.EvalError)
+	if !ok || len(evalError.Trace()) == 0 {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "traceback (most recent call last):")
+	trace := evalError.Trace()
+	for i := 0; i < len(trace); {
+		repeated := 1
+		for i+repeated < len(trace) && trace[i+repeated] == trace[i] {
+			repeated++
+		}
+		fmt.Fprintf(os.Stderr, "  %s\n", trace[i])
+		if repeated > 1 {
+			fmt.Fprintf(os.Stderr, "  [previous frame repeated %d more times]\n", repeated-1)
+		}
+		i += repeated
+	}
+}
@@ -1,31 +1,87 @@
 package object
 
+import (
+	"sync"
+)
+
+// Environment holds the variables of an evaluation. the top-level environment, and the one a macro is called in,
+// stores the variables by name. the environment of a function call, a catch handler or an iteration of
+// a comprehension clause is a frame, which stores them in slots numbered by package evaluator before the evaluation.
+//
+// an environment can be read by the tasks spawned in it while the task evaluating it declares variables.
+// the variables stored by name are guarded by mu, and the ones in the slots by the lock of Slots.
 type Environment struct {
 	outer   *Environment
-	objects map[string]Object
+	mu      sync.RWMutex
+	objects map[string]Object // nil for a frame
+	slots   *Slots
+	named   *Environment // the innermost environment storing the variables by name
 }
 
 func NewEnvironment() *Environment {
-	return &Environment{objects: make(map[string]Object)}
+	e := &Environment{objects: make(map[string]Object)}
+	e.named = e
+	return e
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	return &Environment{
-		objects: make(map[string]Object),
-		outer:   outer,
-	}
+	e := NewEnvironment()
+	e.outer = outer
+	return e
+}
+
+// NewFrame returns a frame of size slots enclosed by outer.
+func NewFrame(size int, outer *Environment) *Environment {
+	return &Environment{outer: outer, slots: NewSlots(size), named: outer.named}
 }
 
+// Set stores the variable by name in the innermost environment storing the variables by name.
 func (e *Environment) Set(name string, value Object) {
-	e.objects[name] = value
+	e.named.mu.Lock()
+	e.named.objects[name] = value
+	e.named.mu.Unlock()
 }
+
+// Get returns the variable stored by name, or nil if there is none. the variables in the slots are not searched.
 func (e *Environment) Get(name string) Object {
-	value, ok := e.objects[name]
-	if !ok {
-		if e.outer == nil {
-			return nil
+	for env := e.named; env != nil; env = env.outer {
+		env.mu.RLock()
+		value, ok := env.objects[name]
+		env.mu.RUnlock()
+		if ok {
+			return value
 		}
-		return e.outer.Get(name)
 	}
-	return value
+	return nil
+}
+
+// Slot returns the variable in the slot index of the frame depth levels out from e, or nil if it is not set yet.
+func (e *Environment) Slot(depth, index int) Object {
+	frame := e
+	for i := 0; i < depth; i++ {
+		frame = frame.outer
+	}
+	return frame.slots.Get(index)
+}
+
+// SetSlot stores the variable in the slot index of the frame e.
+func (e *Environment) SetSlot(index int, value Object) {
+	e.slots.Set(index, value)
+}
+
+// Capture returns the environment of a closure defined in e whose body refers to the innermost frames of e.
+// the other frames are dropped, so that they are not kept alive by the closure: the environment keeps
+// the same variables of the frames captured, but encloses them directly in the environment storing the variables by name.
+func (e *Environment) Capture(frames int) *Environment {
+	if e.objects != nil {
+		return e
+	}
+	if frames == 0 {
+		return e.named
+	}
+	outer := e.outer.Capture(frames - 1)
+	if outer == e.outer {
+		return e
+	}
+	return &Environment{outer: outer, slots: e.slots, named: e.named}
 }
@@ -0,0 +1,72 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestEnvironment_Capture(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("g", &Integer{Value: 0})
+	outer := NewFrame(1, global)
+	outer.SetSlot(0, &Integer{Value: 1})
+	inner := NewFrame(1, outer)
+	inner.SetSlot(0, &Integer{Value: 2})
+
+	if captured := inner.Capture(0); captured != global {
+		t.Errorf("environment capturing no frame wrong.\nwant=%p\ngot=%p\n", global, captured)
+	}
+	if captured := inner.Capture(2); captured != inner {
+		t.Errorf("environment capturing all the frames wrong.\nwant=%p\ngot=%p\n", inner, captured)
+	}
+
+	captured := inner.Capture(1)
+	if captured.outer != global {
+		t.Errorf("outer of environment capturing a frame wrong.\nwant=%p\ngot=%p\n", global, captured.outer)
+	}
+	inner.SetSlot(0, &Integer{Value: 3})
+	if value := captured.Slot(0, 0).(*Integer).Value; value != 3 {
+		t.Errorf("slot of captured frame wrong.\nwant=%d\ngot=%d\n", 3, value)
+	}
+	if value := captured.Get("g").(*Integer).Value; value != 0 {
+		t.Errorf("variable of captured environment wrong.\nwant=%d\ngot=%d\n", 0, value)
+	}
+}
+
+// the environments of the benchmarks below are nested depth levels below the top level,
+// with a variable declared at each of them, the same way as the nested calls of a closure.
+const depth = 4
+
+// BenchmarkEnvironment_Get looks up the variables stored by name, as every variable was before the slots were assigned.
+func BenchmarkEnvironment_Get(b *testing.B) {
+	names := []string{"a", "b", "c", "d"}
+	env := NewEnvironment()
+	for i := 0; i < depth; i++ {
+		env = NewEnclosedEnvironment(env)
+		env.Set(names[i], &Integer{Value: i})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, name := range names {
+			if env.Get(name) == nil {
+				b.Fatalf("variable %q not found\n", name)
+			}
+		}
+	}
+}
+
+// BenchmarkEnvironment_Slot looks up the same variables stored in slots.
+func BenchmarkEnvironment_Slot(b *testing.B) {
+	env := NewEnvironment()
+	for i := 0; i < depth; i++ {
+		env = NewFrame(1, env)
+		env.SetSlot(0, &Integer{Value: i})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for d := depth - 1; d >= 0; d-- {
+			if env.Slot(d, 0) == nil {
+				b.Fatalf("slot at depth %d not found\n", d)
+			}
+		}
+	}
+}
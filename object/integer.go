@@ -0,0 +1,32 @@
+package object
+
+import "math"
+
+// the arithmetic on the values of integers, which reports whether the result fits in an int instead of wrapping around.
+// the division by zero is not checked, since it is an error of its own.
+
+func Add(a, b int) (int, bool) {
+	c := a + b
+	return c, (c >= a) == (b >= 0)
+}
+
+func Subtract(a, b int) (int, bool) {
+	c := a - b
+	return c, (c <= a) == (b >= 0)
+}
+
+func Multiply(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	return c, c/b == a && !(a == math.MinInt && b == -1)
+}
+
+func Divide(a, b int) (int, bool) {
+	return a / b, !(a == math.MinInt && b == -1)
+}
+
+func Negate(a int) (int, bool) {
+	return -a, a != math.MinInt
+}
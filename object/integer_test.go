@@ -0,0 +1,40 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		desc     string
+		fn       func(a, b int) (int, bool)
+		a, b     int
+		expected int
+		ok       bool
+	}{
+		{desc: "add", fn: Add, a: 1, b: 2, expected: 3, ok: true},
+		{desc: "add negative", fn: Add, a: math.MinInt + 1, b: -1, expected: math.MinInt, ok: true},
+		{desc: "add overflow", fn: Add, a: math.MaxInt, b: 1, ok: false},
+		{desc: "add underflow", fn: Add, a: math.MinInt, b: -1, ok: false},
+		{desc: "subtract", fn: Subtract, a: 1, b: 2, expected: -1, ok: true},
+		{desc: "subtract overflow", fn: Subtract, a: math.MaxInt, b: -1, ok: false},
+		{desc: "subtract underflow", fn: Subtract, a: math.MinInt, b: 1, ok: false},
+		{desc: "multiply", fn: Multiply, a: -3, b: 4, expected: -12, ok: true},
+		{desc: "multiply by zero", fn: Multiply, a: math.MinInt, b: 0, expected: 0, ok: true},
+		{desc: "multiply overflow", fn: Multiply, a: math.MaxInt/2 + 1, b: 2, ok: false},
+		{desc: "multiply min by -1", fn: Multiply, a: math.MinInt, b: -1, ok: false},
+		{desc: "multiply -1 by min", fn: Multiply, a: -1, b: math.MinInt, ok: false},
+		{desc: "divide", fn: Divide, a: -7, b: 2, expected: -3, ok: true},
+		{desc: "divide min by -1", fn: Divide, a: math.MinInt, b: -1, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			actual, ok := tt.fn(tt.a, tt.b)
+			if ok != tt.ok || (ok && actual != tt.expected) {
+				t.Errorf("result wrong.\nwant=%d (%t)\ngot=%d (%t)\n", tt.expected, tt.ok, actual, ok)
+			}
+		})
+	}
+}
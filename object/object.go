@@ -12,10 +12,17 @@ type Type string
 const (
 	INTEGER          = "INTEGER"
 	BOOLEAN          = "BOOLEAN"
+	STRING           = "STRING"
 	ARRAY            = "ARRAY"
+	STREAM           = "STREAM"
+	TASK             = "TASK"
+	CHANNEL          = "CHANNEL"
 	FUNCTION         = "FUNCTION"
 	RETURN_VALUE     = "RETURN_VALUE"
 	BUILTIN_FUNCTION = "BUILTIN_FUNCTION"
+	ERROR            = "ERROR"
+	QUOTE            = "QUOTE"
+	MACRO            = "MACRO"
 	NULL             = "NULL"
 )
 
@@ -38,6 +45,13 @@ type Boolean struct {
 func (b *Boolean) String() string { return strconv.FormatBool(b.Value) }
 func (b *Boolean) Type() Type     { return BOOLEAN }
 
+type String struct {
+	Value string
+}
+
+func (s *String) String() string { return s.Value }
+func (s *String) Type() Type     { return STRING }
+
 type Array struct {
 	Elements []Object
 }
@@ -52,28 +66,108 @@ func (a *Array) String() string {
 }
 func (a *Array) Type() Type { return ARRAY }
 
+// Stream is a lazy sequence, whose elements are computed one at a time as it is iterated.
+// each iteration starts over from the first element, so that a stream can be iterated any number of times.
+// stop releases the resources of the iteration, such as the goroutine of a generator. it must be called
+// once the iteration is finished or abandoned, and the iterator must not be called after it.
+type Stream struct {
+	Iterate func(apply Apply) (next Iterator, stop func())
+}
+
+// Apply calls a function of a stream with args. it is given by the evaluation iterating the stream,
+// since the functions are called the way the evaluation calls them.
+type Apply func(function Object, args ...Object) (Object, error)
+
+// Iterator returns the next element of a stream, or false if there is none left.
+type Iterator func() (Object, bool, error)
+
+// NoStop is the stop function of the iterations which hold no resources.
+func NoStop() {}
+
+func (s *Stream) String() string { return "stream" }
+func (s *Stream) Type() Type     { return STREAM }
+
+// Task is a function running concurrently with the task which spawned it, on its own goroutine.
+// its fields are set by the scheduler of the evaluation once the function returns.
+type Task struct {
+	Done  bool
+	Value Object // the value returned by the function
+	Err   error  // the error raised by the function
+}
+
+func (t *Task) String() string { return "task" }
+func (t *Task) Type() Type     { return TASK }
+
+// Channel passes values from the tasks sending them to the tasks receiving them, in the order they are sent.
+// a send waits until the value is received if Capacity is 0, or until there is room for it in Buffer otherwise.
+// its fields are accessed only through the scheduler of the evaluation, which serializes the tasks accessing them.
+type Channel struct {
+	Capacity int
+	Buffer   []Object // the values sent but not received yet
+	Closed   bool
+	Sent     int // the number of the values sent
+	Received int // the number of the values received
+}
+
+func (c *Channel) String() string { return "channel" }
+func (c *Channel) Type() Type     { return CHANNEL }
+
 type Function struct {
-	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Environment
+	Parameters     []*ast.Identifier
+	ParameterTypes []ast.TypeAnnotation // nil, or one per parameter with nil for the ones not annotated
+	ReturnType     ast.TypeAnnotation   // nil if not annotated
+	Body           *ast.BlockStatement
+	NumSlots       int  // the number of variables in the frame of a call, including the parameters
+	Generator      bool // whether a call returns the stream of the values yielded by the body
+	Env            *Environment
 }
 
 func (f *Function) String() string {
 	var paramStrs []string
-	for _, param := range f.Parameters {
-		paramStrs = append(paramStrs, param.String())
+	for i, param := range f.Parameters {
+		if i < len(f.ParameterTypes) && f.ParameterTypes[i] != nil {
+			paramStrs = append(paramStrs, param.String()+": "+f.ParameterTypes[i].String())
+		} else {
+			paramStrs = append(paramStrs, param.String())
+		}
 	}
 
 	var out bytes.Buffer
 	out.WriteString("|")
 	out.WriteString(strings.Join(paramStrs, ", "))
 	out.WriteString("| ")
+	if f.ReturnType != nil {
+		out.WriteString("-> " + f.ReturnType.String() + " ")
+	}
 	out.WriteString(f.Body.String())
 
 	return out.String()
 }
 func (f *Function) Type() Type { return FUNCTION }
 
+// CompiledFunction is a function literal compiled to bytecode by package compiler.
+type CompiledFunction struct {
+	Instructions []byte
+	NumSlots     int                  // the number of variables in the environment of a call, including the parameters
+	Generator    bool                 // whether a call returns the stream of the values yielded by the body
+	Closures     bool                 // whether the body defines functions, which can keep the scope of a call after it returns
+	Literal      *ast.FunctionLiteral // the source, for the parameters, the annotations and String
+}
+
+func (cf *CompiledFunction) String() string {
+	return (&Function{Parameters: cf.Literal.Parameters, ParameterTypes: cf.Literal.ParameterTypes, ReturnType: cf.Literal.ReturnType, Body: cf.Literal.Body}).String()
+}
+func (cf *CompiledFunction) Type() Type { return FUNCTION }
+
+// Closure is a compiled function with the environment it was created in, which is executed by package vm.
+type Closure struct {
+	Function *CompiledFunction
+	Scope    *Scope
+}
+
+func (c *Closure) String() string { return c.Function.String() }
+func (c *Closure) Type() Type     { return FUNCTION }
+
 type ReturnValue struct {
 	Value Object
 }
@@ -88,6 +182,53 @@ type BuiltinFunction struct {
 func (bf *BuiltinFunction) String() string { return "Builtin" }
 func (bf *BuiltinFunction) Type() Type     { return BUILTIN_FUNCTION }
 
+// Error is a catchable error value. It is created either by a throw statement
+// or by converting a runtime error raised inside a try expression.
+type Error struct {
+	Message string
+	Kind    string
+	Line    int
+	Value   Object // the thrown value, or nil for runtime errors
+}
+
+func (e *Error) String() string { return e.Kind + ": " + e.Message }
+func (e *Error) Type() Type     { return ERROR }
+
+// Quote is an unevaluated piece of AST.
+// Spliced holds the subtrees which were written by the macro caller rather than the macro itself,
+// so that macro expansion can rename only the bindings introduced by the macro.
+// Source is the text Node was parsed from for an argument of a macro call, "" if it is not known.
+type Quote struct {
+	Node    ast.Node
+	Spliced []ast.Node
+	Source  string
+}
+
+func (q *Quote) String() string { return "QUOTE(" + q.Node.String() + ")" }
+func (q *Quote) Type() Type     { return QUOTE }
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) String() string {
+	var paramStrs []string
+	for _, param := range m.Parameters {
+		paramStrs = append(paramStrs, param.String())
+	}
+
+	var out bytes.Buffer
+	out.WriteString("macro |")
+	out.WriteString(strings.Join(paramStrs, ", "))
+	out.WriteString("| ")
+	out.WriteString(m.Body.String())
+
+	return out.String()
+}
+func (m *Macro) Type() Type { return MACRO }
+
 type Null struct{}
 
 func (n *Null) String() string { return "null" }
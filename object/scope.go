@@ -0,0 +1,28 @@
+package object
+
+// Scope is an environment of compiled code. the variables are stored in slots numbered by package compiler,
+// so that they are accessed without looking up their names.
+type Scope struct {
+	Slots Slots
+	Outer *Scope
+}
+
+func NewScope(numSlots int, outer *Scope) *Scope {
+	s := &Scope{Outer: outer}
+	s.Slots.values = make([]Object, numSlots)
+	return s
+}
+
+// Reset empties s for another call of numSlots slots enclosed by outer, reusing the slots of s.
+// nothing must refer to s anymore, such as a closure defined in the call s was made for.
+func (s *Scope) Reset(numSlots int, outer *Scope) {
+	if cap(s.Slots.values) < numSlots {
+		s.Slots.values = make([]Object, numSlots)
+	} else {
+		s.Slots.values = s.Slots.values[:numSlots]
+		for i := range s.Slots.values {
+			s.Slots.values[i] = nil
+		}
+	}
+	s.Outer = outer
+}
@@ -0,0 +1,65 @@
+package object
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Slots are the variables of a frame, numbered before the evaluation. they are shared by the closures capturing the frame,
+// which can be called by the tasks spawned in it while the task running the frame declares variables.
+// the slots of such a frame are guarded by a lock once they are shared by Share, and are accessed without it before,
+// since only the task running the frame can reach them until then.
+type Slots struct {
+	mu     sync.RWMutex
+	shared int32 // 1 once the slots are shared, accessed atomically
+	values []Object
+}
+
+func NewSlots(size int) *Slots {
+	return &Slots{values: make([]Object, size)}
+}
+
+// Get returns the variable in the slot index, or nil if it is not set yet.
+func (s *Slots) Get(index int) Object {
+	if atomic.LoadInt32(&s.shared) == 0 {
+		return s.values[index]
+	}
+	s.mu.RLock()
+	value := s.values[index]
+	s.mu.RUnlock()
+	return value
+}
+
+// Set stores the variable in the slot index. a value stored in shared slots can be read by the other tasks,
+// so the frames captured by it are shared as well.
+func (s *Slots) Set(index int, value Object) {
+	if atomic.LoadInt32(&s.shared) == 0 {
+		s.values[index] = value
+		return
+	}
+	Share(value)
+	s.mu.Lock()
+	s.values[index] = value
+	s.mu.Unlock()
+}
+
+// Share marks the slots of the frames captured by the functions in value as shared, so that they are locked from then on.
+// it must be called by the task running the frames before value is passed to another task, by spawn or by a channel.
+func Share(value Object) {
+	switch value := value.(type) {
+	case *Function:
+		for env := value.Env; env != nil; env = env.outer {
+			if env.slots != nil {
+				atomic.StoreInt32(&env.slots.shared, 1)
+			}
+		}
+	case *Closure:
+		for scope := value.Scope; scope != nil; scope = scope.Outer {
+			atomic.StoreInt32(&scope.Slots.shared, 1)
+		}
+	case *Array:
+		for _, element := range value.Elements {
+			Share(element)
+		}
+	}
+}
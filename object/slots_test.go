@@ -0,0 +1,49 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestShare(t *testing.T) {
+	global := NewEnvironment()
+	outer := NewFrame(1, global)
+	inner := NewFrame(1, outer)
+	other := NewFrame(1, global)
+	scope := NewScope(1, NewScope(1, nil))
+
+	Share(&Array{Elements: []Object{&Integer{Value: 1}, &Function{Env: inner}, &Closure{Scope: scope}}})
+	for _, slots := range []*Slots{inner.slots, outer.slots, &scope.Slots, &scope.Outer.Slots} {
+		if slots.shared != 1 {
+			t.Errorf("slots captured not shared.\nwant=%d\ngot=%d\n", 1, slots.shared)
+		}
+	}
+	if other.slots.shared != 0 {
+		t.Errorf("slots not captured shared.\nwant=%d\ngot=%d\n", 0, other.slots.shared)
+	}
+
+	// a function stored in shared slots can be read by another task, which shares the frames it captures.
+	inner.SetSlot(0, &Function{Env: other})
+	if other.slots.shared != 1 {
+		t.Errorf("slots captured by value stored not shared.\nwant=%d\ngot=%d\n", 1, other.slots.shared)
+	}
+}
+
+// the slots shared are read and written by several goroutines, which go test -race checks.
+func TestSlots_Shared(t *testing.T) {
+	frame := NewFrame(1, NewEnvironment())
+	Share(&Function{Env: frame})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			frame.SetSlot(0, &Integer{Value: i})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		frame.Slot(0, 0)
+	}
+	<-done
+	if value := frame.Slot(0, 0).(*Integer).Value; value != 99 {
+		t.Errorf("slot wrong.\nwant=%d\ngot=%d\n", 99, value)
+	}
+}
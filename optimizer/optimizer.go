@@ -0,0 +1,288 @@
+package optimizer
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/object"
+)
+
+// Optimize returns program with the constant prefix and infix expressions folded
+// and the branches of if expressions with constant conditions eliminated.
+// the result evaluates to the same value as program, raising the same runtime errors:
+// an expression which would fail, such as `1 / 0` or `1 + true`, is left as it is.
+// program itself is not modified.
+func Optimize(program *ast.Program) *ast.Program {
+	o := &optimizer{quoted: quotedNodes(program)}
+	return ast.Rewrite(program, o.optimize).(*ast.Program)
+}
+
+type optimizer struct {
+	quoted map[ast.Node]bool // the nodes in quoted code, which are data rather than code to evaluate
+}
+
+func (o *optimizer) optimize(node ast.Node) ast.Node {
+	if o.isQuoted(node) {
+		return node
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		if statements, changed := eliminateIfStatements(node.Statements); changed {
+			return &ast.Program{Statements: statements}
+		}
+	case *ast.BlockStatement:
+		if statements, changed := eliminateIfStatements(node.Statements); changed {
+			block := ast.NewBlockStatement(statements, node.Line())
+			block.End = node.End
+			return block
+		}
+	case *ast.PrefixExpression:
+		if folded := foldPrefixExpression(node); folded != nil {
+			return folded
+		}
+	case *ast.InfixExpression:
+		if folded := foldInfixExpression(node); folded != nil {
+			return folded
+		}
+	case *ast.IfExpression:
+		// a branch of a single expression can replace the if expression, as the blocks of if share the environment.
+		if branch, ok := decideBranch(node); ok && branch != nil && len(branch.Statements) == 1 {
+			if expressionStatement, ok := branch.Statements[0].(*ast.ExpressionStatement); ok {
+				return expressionStatement.Expression
+			}
+		}
+	}
+	return node
+}
+
+// isQuoted reports whether node is in quoted code. a node rebuilt by ast.Rewrite from quoted nodes,
+// because an unquoted expression in it was optimized, is quoted as well.
+func (o *optimizer) isQuoted(node ast.Node) bool {
+	if o.quoted[node] {
+		return true
+	}
+	quoted := false
+	ast.Inspect(node, func(child ast.Node) bool {
+		if child == node {
+			return true
+		}
+		if child != nil && o.quoted[child] {
+			quoted = true
+		}
+		return false
+	})
+	if quoted {
+		o.quoted[node] = true
+	}
+	return quoted
+}
+
+// quotedNodes returns the nodes in the arguments of quote calls, except the ones in the arguments of unquote calls.
+func quotedNodes(program ast.Node) map[ast.Node]bool {
+	quoted := make(map[ast.Node]bool)
+	var mark func(node ast.Node)
+	mark = func(node ast.Node) {
+		ast.Inspect(node, func(node ast.Node) bool {
+			if node == nil {
+				return false
+			}
+			if isCallOf(node, "unquote") {
+				quoted[node] = true
+				quoted[node.(*ast.FunctionCall).Function] = true
+				return false
+			}
+			quoted[node] = true
+			return true
+		})
+	}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if isCallOf(node, "quote") {
+			mark(node.(*ast.FunctionCall).Arguments[0])
+		}
+		return true
+	})
+	return quoted
+}
+
+func isCallOf(node ast.Node, name string) bool {
+	functionCall, ok := node.(*ast.FunctionCall)
+	if !ok || len(functionCall.Arguments) != 1 {
+		return false
+	}
+	identifier, ok := functionCall.Function.(*ast.Identifier)
+	return ok && identifier.Name == name
+}
+
+func foldPrefixExpression(node *ast.PrefixExpression) ast.Expression {
+	if value, ok := integerValue(node.Right); ok {
+		switch node.Operator {
+		case "-":
+			value, ok := object.Negate(value)
+			return foldedInteger(value, ok, node.Line())
+		case "!":
+			return ast.NewBooleanLiteral(false, node.Line())
+		}
+		return nil
+	}
+	if right, ok := node.Right.(*ast.BooleanLiteral); ok && node.Operator == "!" {
+		return ast.NewBooleanLiteral(!right.Value, node.Line())
+	}
+	return nil
+}
+
+// foldInfixExpression returns the value of node if both operands are literals and the evaluation succeeds, or nil otherwise.
+func foldInfixExpression(node *ast.InfixExpression) ast.Expression {
+	line := node.Line()
+	if left, ok := integerValue(node.Left); ok {
+		right, ok := integerValue(node.Right)
+		if !ok {
+			return nil
+		}
+		switch node.Operator {
+		case "+":
+			value, ok := object.Add(left, right)
+			return foldedInteger(value, ok, line)
+		case "-":
+			value, ok := object.Subtract(left, right)
+			return foldedInteger(value, ok, line)
+		case "*":
+			value, ok := object.Multiply(left, right)
+			return foldedInteger(value, ok, line)
+		case "/":
+			if right == 0 {
+				return nil
+			}
+			value, ok := object.Divide(left, right)
+			return foldedInteger(value, ok, line)
+		case "%":
+			if right == 0 {
+				return nil
+			}
+			return foldedInteger(left%right, true, line)
+		case "<":
+			return ast.NewBooleanLiteral(left < right, line)
+		case ">":
+			return ast.NewBooleanLiteral(left > right, line)
+		case "==":
+			return ast.NewBooleanLiteral(left == right, line)
+		case "!=":
+			return ast.NewBooleanLiteral(left != right, line)
+		}
+		return nil
+	}
+
+	switch left := node.Left.(type) {
+	case *ast.BooleanLiteral:
+		right, ok := node.Right.(*ast.BooleanLiteral)
+		if !ok {
+			return nil
+		}
+		switch node.Operator {
+		case "==":
+			return ast.NewBooleanLiteral(left.Value == right.Value, line)
+		case "!=":
+			return ast.NewBooleanLiteral(left.Value != right.Value, line)
+		}
+	case *ast.StringLiteral:
+		right, ok := node.Right.(*ast.StringLiteral)
+		if !ok {
+			return nil
+		}
+		switch node.Operator {
+		case "+":
+			return ast.NewStringLiteral(left.Value+right.Value, line)
+		case "==":
+			return ast.NewBooleanLiteral(left.Value == right.Value, line)
+		case "!=":
+			return ast.NewBooleanLiteral(left.Value != right.Value, line)
+		}
+	}
+	return nil
+}
+
+// integerValue returns the value of expression if it is an integer constant:
+// an integer literal, or the negation of one, which is how a negative integer is written.
+func integerValue(expression ast.Expression) (int, bool) {
+	switch expression := expression.(type) {
+	case *ast.IntegerLiteral:
+		return expression.Value, true
+	case *ast.PrefixExpression:
+		if literal, ok := expression.Right.(*ast.IntegerLiteral); ok && expression.Operator == "-" {
+			return object.Negate(literal.Value)
+		}
+	}
+	return 0, false
+}
+
+// foldedInteger returns the constant of value, or nil if the integer expression it is folded from overflows.
+// a negative value is written as the negation of a literal, as the parser reads it, so that the optimized program
+// is printed as source which parses into the same tree. the smallest integer cannot be written so, and is not folded.
+func foldedInteger(value int, ok bool, line int) ast.Expression {
+	if !ok {
+		return nil
+	}
+	if value >= 0 {
+		return ast.NewIntegerLiteral(value, line)
+	}
+	absolute, ok := object.Negate(value)
+	if !ok {
+		return nil
+	}
+	return ast.NewPrefixExpression("-", ast.NewIntegerLiteral(absolute, line), line)
+}
+
+// decideBranch returns the branch of node taken when its condition is a literal, which may be a nil alternative.
+// ok is false if the condition is not a literal, or if the branch not taken yields,
+// since removing it could turn the function containing it from a generator into an ordinary function.
+func decideBranch(node *ast.IfExpression) (branch *ast.BlockStatement, ok bool) {
+	var discarded *ast.BlockStatement
+	switch condition := node.Condition.(type) {
+	case *ast.BooleanLiteral:
+		if condition.Value {
+			branch, discarded = node.Consequence, node.Alternative
+		} else {
+			branch, discarded = node.Alternative, node.Consequence
+		}
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		branch, discarded = node.Consequence, node.Alternative
+	default:
+		if _, ok := integerValue(condition); !ok {
+			return nil, false
+		}
+		branch, discarded = node.Consequence, node.Alternative
+	}
+	if discarded != nil && ast.Yields(discarded) {
+		return nil, false
+	}
+	return branch, true
+}
+
+// eliminateIfStatements replaces the if expressions with literal conditions written as statements
+// with the statements of the branch taken, or removes them if no branch is taken.
+// the last statement is kept if no branch is taken, since its value, null, is the value of the statements.
+func eliminateIfStatements(statements []ast.Statement) ([]ast.Statement, bool) {
+	var eliminated []ast.Statement
+	changed := false
+	for i, statement := range statements {
+		expressionStatement, ok := statement.(*ast.ExpressionStatement)
+		if !ok {
+			eliminated = append(eliminated, statement)
+			continue
+		}
+		ifExpression, ok := expressionStatement.Expression.(*ast.IfExpression)
+		if !ok {
+			eliminated = append(eliminated, statement)
+			continue
+		}
+		branch, ok := decideBranch(ifExpression)
+		if !ok || (branch == nil || len(branch.Statements) == 0) && i == len(statements)-1 {
+			eliminated = append(eliminated, statement)
+			continue
+		}
+
+		if branch != nil {
+			eliminated = append(eliminated, branch.Statements...)
+		}
+		changed = true
+	}
+	return eliminated, changed
+}
@@ -0,0 +1,122 @@
+package optimizer
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/parser"
+	"testing"
+)
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("err occurred: %s", err)
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "integer arithmetic",
+			input:    "60 * 60 * 24; 7 / 2 - 10 % 4",
+			expected: "86400;1;",
+		},
+		{
+			desc:     "comparison and logic",
+			input:    `1 < 2 == !false; "a" + "b" != "ab"; !1`,
+			expected: "true;false;false;",
+		},
+		{
+			desc:     "prefix",
+			input:    "-(2 * 3); -x",
+			expected: "(-6);(-x);",
+		},
+		{
+			desc:     "partially constant",
+			input:    "x + 2 * 3; (1 + 2) + x",
+			expected: "(x + 6);(3 + x);",
+		},
+		{
+			desc:     "runtime errors are kept",
+			input:    `1 / 0; 5 % (3 - 3); 1 + true; "a" - "b"; -true; !"a"`,
+			expected: `(1 / 0);(5 % 0);(1 + true);("a" - "b");(-true);(!"a");`,
+		},
+		{
+			desc:     "overflows are kept",
+			input:    "9223372036854775807 + 1; 0 - 9223372036854775807 - 2; 4611686018427387904 * 2",
+			expected: "(9223372036854775807 + 1);((-9223372036854775807) - 2);(4611686018427387904 * 2);",
+		},
+		{
+			desc:     "if expression",
+			input:    "var a = if (1 < 2) { x } else { y }; var b = if (false) { x } else { y }; var c = if (\"\") { x }",
+			expected: "var a = x;var b = y;var c = x;",
+		},
+		{
+			desc:     "if statement",
+			input:    "if (true) { var a = 1; a } else { 2 }; if (false) { 1 }; puts(a); if (false) { 2 }",
+			expected: "var a = 1;a;puts(a);if (false) {2;};",
+		},
+		{
+			desc:     "if in block",
+			input:    "|x| { if (0 == 0) { puts(x); return x }; x }",
+			expected: "|x| {puts(x);return x;x;};",
+		},
+		{
+			desc:     "not constant condition",
+			input:    "if (x) { 1 + 1 } else { 2 }",
+			expected: "if (x) {2;} else {2;};",
+		},
+		{
+			desc:     "quoted code",
+			input:    "source(quote(60 * 60 + unquote(2 * 3))); quote(if (true) { unquote(1 + 1) })",
+			expected: "source(quote(((60 * 60) + unquote(6))));quote(if (true) {unquote(2);});",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+			before := program.String()
+			optimized := Optimize(program)
+			if optimized.String() != tt.expected {
+				t.Errorf("optimized program wrong.\nwant=%s\ngot=%s\n", tt.expected, optimized)
+			}
+			if program.String() != before {
+				t.Errorf("program modified.\nwant=%s\ngot=%s\n", before, program)
+			}
+		})
+	}
+}
+
+func TestOptimize_RoundTrip(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{desc: "negative result", input: "2 - 7; 3 * -2; -(-5); -(2 + 3) * 4"},
+		{desc: "smallest integer", input: "0 - 9223372036854775807 - 1; -(0 - 9223372036854775807 - 1)"},
+		{desc: "negative condition", input: "if (0 - 1) { x } else { y }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			optimized := Optimize(parseProgram(t, tt.input))
+			reparsed := parseProgram(t, optimized.String())
+			if reparsed.String() != optimized.String() {
+				t.Errorf("optimized program does not round-trip.\nwant=%s\ngot=%s\n", optimized, reparsed)
+			}
+			// the parser never makes a negative literal, so the optimized tree should not have one either.
+			ast.Inspect(optimized, func(node ast.Node) bool {
+				if literal, ok := node.(*ast.IntegerLiteral); ok && literal.Value < 0 {
+					t.Errorf("negative literal in optimized program: %s", optimized)
+				}
+				return true
+			})
+		})
+	}
+}
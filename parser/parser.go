@@ -20,49 +20,67 @@ const (
 	PREFIX
 	CALL
 	INDEX
+	FIELD
 )
 
-var (
-	TRUE_NODE  = &ast.BooleanLiteral{Value: true}
-	FALSE_NODE = &ast.BooleanLiteral{Value: false}
-)
-
-func precedence(t token.Token) Precedence {
-	switch t.Type {
-	case token.ARROW:
-		return ARROW
-	case token.EQ, token.NEQ:
-		return EQUAL
-	case token.GT, token.LT:
-		return COMPARISON
-	case token.PLUS, token.MINUS:
-		return ADDITION
-	case token.ASTER, token.SLASH, token.PERCENT:
-		return MULTIPLICATION
-	case token.LPAREN:
-		return CALL
-	case token.LBRACKET:
-		return INDEX
-	default:
-		return LOWEST
-	}
-}
-
 type Parser struct {
 	lexer        *lexer.Lexer
 	currentToken token.Token
 	peekToken    token.Token
+	currentRange textRange
+	peekRange    textRange
 	errors       []*ParserError
+
+	prefixParseFns map[token.Type]PrefixParseFn
+	infixRules     map[token.Type]infixRule
+	keywords       map[string]token.Type
 }
 
 func New(lexer *lexer.Lexer) *Parser {
-	parser := &Parser{lexer: lexer}
+	parser := &Parser{
+		lexer:          lexer,
+		prefixParseFns: make(map[token.Type]PrefixParseFn),
+		infixRules:     make(map[token.Type]infixRule),
+		keywords:       make(map[string]token.Type),
+	}
+	parser.registerDefaultRules()
 	parser.consumeToken()
 	parser.consumeToken()
 
 	return parser
 }
 
+func (p *Parser) registerDefaultRules() {
+	p.RegisterPrefix(token.INTEGER, func(p *Parser) (ast.Expression, error) { return p.parseIntegerLiteral() })
+	p.RegisterPrefix(token.STRING, func(p *Parser) (ast.Expression, error) { return p.parseStringLiteral() })
+	p.RegisterPrefix(token.TRUE, func(p *Parser) (ast.Expression, error) { return p.parseBooleanLiteral() })
+	p.RegisterPrefix(token.FALSE, func(p *Parser) (ast.Expression, error) { return p.parseBooleanLiteral() })
+	p.RegisterPrefix(token.IDENT, func(p *Parser) (ast.Expression, error) { return p.parseIdentifier() })
+	p.RegisterPrefix(token.MINUS, func(p *Parser) (ast.Expression, error) { return p.parsePrefixExpression() })
+	p.RegisterPrefix(token.BANG, func(p *Parser) (ast.Expression, error) { return p.parsePrefixExpression() })
+	p.RegisterPrefix(token.LPAREN, (*Parser).parseGroupedExpression)
+	p.RegisterPrefix(token.BAR, (*Parser).parseFunctionLiteral)
+	p.RegisterPrefix(token.IF, (*Parser).parseIfExpression)
+	p.RegisterPrefix(token.LBRACKET, (*Parser).parseArrayLiteral)
+	p.RegisterPrefix(token.TRY, (*Parser).parseTryExpression)
+	p.RegisterPrefix(token.MACRO, (*Parser).parseMacroLiteral)
+
+	infix := InfixOperator()
+	p.RegisterInfix(token.ARROW, ARROW, LEFT, func(p *Parser, left ast.Expression) (ast.Expression, error) { return p.parseArrowExpression(left) })
+	p.RegisterInfix(token.EQ, EQUAL, LEFT, infix)
+	p.RegisterInfix(token.NEQ, EQUAL, LEFT, infix)
+	p.RegisterInfix(token.GT, COMPARISON, LEFT, infix)
+	p.RegisterInfix(token.LT, COMPARISON, LEFT, infix)
+	p.RegisterInfix(token.PLUS, ADDITION, LEFT, infix)
+	p.RegisterInfix(token.MINUS, ADDITION, LEFT, infix)
+	p.RegisterInfix(token.ASTER, MULTIPLICATION, LEFT, infix)
+	p.RegisterInfix(token.SLASH, MULTIPLICATION, LEFT, infix)
+	p.RegisterInfix(token.PERCENT, MULTIPLICATION, LEFT, infix)
+	p.RegisterInfix(token.LPAREN, CALL, LEFT, func(p *Parser, left ast.Expression) (ast.Expression, error) { return p.parseFunctionCall(left) })
+	p.RegisterInfix(token.LBRACKET, INDEX, LEFT, func(p *Parser, left ast.Expression) (ast.Expression, error) { return p.parseIndexExpression(left) })
+	p.RegisterInfix(token.DOT, FIELD, LEFT, (*Parser).parseFieldExpression)
+}
+
 func (p *Parser) ParseProgram() (*ast.Program, error) {
 	statements := make([]ast.Statement, 0)
 
@@ -78,9 +96,21 @@ func (p *Parser) ParseProgram() (*ast.Program, error) {
 	return &ast.Program{Statements: statements}, nil
 }
 
+// textRange is the byte offsets of the input a token is read from.
+type textRange struct {
+	start, end int
+}
+
 func (p *Parser) consumeToken() {
 	p.currentToken = p.peekToken
+	p.currentRange = p.peekRange
 	p.peekToken = p.lexer.NextToken()
+	p.peekRange.start, p.peekRange.end = p.lexer.Range()
+	if p.peekToken.Type == token.IDENT {
+		if tokenType, ok := p.keywords[p.peekToken.Literal]; ok {
+			p.peekToken.Type = tokenType
+		}
+	}
 }
 
 func (p *Parser) expectToken(tokenType token.Type) error {
@@ -94,12 +124,11 @@ func (p *Parser) expectToken(tokenType token.Type) error {
 	return nil
 }
 
-func (p *Parser) currentPrecedence() Precedence {
-	return precedence(p.currentToken)
-}
-
 func (p *Parser) peekPrecedence() Precedence {
-	return precedence(p.peekToken)
+	if rule, ok := p.infixRules[p.peekToken.Type]; ok {
+		return rule.precedence
+	}
+	return LOWEST
 }
 
 func (p *Parser) parseStatement() (ast.Statement, error) {
@@ -108,6 +137,10 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 		return p.parseVarStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.YIELD:
+		return p.parseYieldStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -122,6 +155,16 @@ func (p *Parser) parseVarStatement() (*ast.VarStatement, error) {
 		return nil, err
 	}
 
+	var varType ast.TypeAnnotation
+	if p.peekToken.Type == token.COLON {
+		p.consumeToken()
+		p.consumeToken()
+		varType, err = p.parseTypeAnnotation()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err := p.expectToken(token.ASSIGN); err != nil {
 		return nil, err
 	}
@@ -135,7 +178,9 @@ func (p *Parser) parseVarStatement() (*ast.VarStatement, error) {
 		p.consumeToken()
 	}
 
-	return ast.NewVarStatement(identifier, expression, line), nil
+	varStatement := ast.NewVarStatement(identifier, expression, line)
+	varStatement.Type = varType
+	return varStatement, nil
 }
 
 func (p *Parser) parseReturnStatement() (*ast.ReturnStatement, error) {
@@ -153,6 +198,36 @@ func (p *Parser) parseReturnStatement() (*ast.ReturnStatement, error) {
 	return ast.NewReturnStatement(expression, line), nil
 }
 
+func (p *Parser) parseThrowStatement() (*ast.ThrowStatement, error) {
+	line := p.currentToken.Line
+	p.consumeToken()
+
+	expression, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	if p.peekToken.Type == token.SEMICOLON {
+		p.consumeToken()
+	}
+
+	return ast.NewThrowStatement(expression, line), nil
+}
+
+func (p *Parser) parseYieldStatement() (*ast.YieldStatement, error) {
+	line := p.currentToken.Line
+	p.consumeToken()
+
+	expression, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	if p.peekToken.Type == token.SEMICOLON {
+		p.consumeToken()
+	}
+
+	return ast.NewYieldStatement(expression, line), nil
+}
+
 func (p *Parser) parseExpressionStatement() (*ast.ExpressionStatement, error) {
 	line := p.currentToken.Line
 	expression, err := p.parseExpression(LOWEST)
@@ -180,48 +255,24 @@ func (p *Parser) parseBlockStatement() (*ast.BlockStatement, error) {
 		p.consumeToken()
 	}
 
-	return ast.NewBlockStatement(statements, line), nil
+	block := ast.NewBlockStatement(statements, line)
+	block.End = p.currentToken.Line
+	return block, nil
 }
 
 func (p *Parser) parseExpression(precedence Precedence) (ast.Expression, error) {
-	var left ast.Expression
-	var err error
-	switch p.currentToken.Type {
-	case token.INTEGER:
-		left, err = p.parseIntegerLiteral()
-	case token.TRUE, token.FALSE:
-		left, err = p.parseBooleanLiteral()
-	case token.IDENT:
-		left, err = p.parseIdentifier()
-	case token.MINUS, token.BANG:
-		left, err = p.parsePrefixExpression()
-	case token.LPAREN:
-		left, err = p.parseGroupedExpression()
-	case token.BAR:
-		left, err = p.parseFunctionLiteral()
-	case token.IF:
-		left, err = p.parseIfExpression()
-	case token.LBRACKET:
-		left, err = p.parseArrayLiteral()
-	default:
+	prefix, ok := p.prefixParseFns[p.currentToken.Type]
+	if !ok {
 		return nil, &ParserError{line: p.currentToken.Line, msg: fmt.Sprintf("unable to parse prefix token %+v\n", p.currentToken)}
 	}
+	left, err := prefix(p)
 	if err != nil {
 		return nil, err
 	}
 
 	for precedence < p.peekPrecedence() {
 		p.consumeToken()
-		switch p.currentToken.Type {
-		case token.LPAREN:
-			left, err = p.parseFunctionCall(left)
-		case token.LBRACKET:
-			left, err = p.parseIndexExpression(left)
-		case token.ARROW:
-			left, err = p.parseArrowExpression(left)
-		default:
-			left, err = p.parseInfixExpression(left)
-		}
+		left, err = p.infixRules[p.currentToken.Type].parse(p, left)
 		if err != nil {
 			return nil, err
 		}
@@ -239,13 +290,17 @@ func (p *Parser) parseIntegerLiteral() (*ast.IntegerLiteral, error) {
 	return ast.NewIntegerLiteral(v, line), nil
 }
 
+func (p *Parser) parseStringLiteral() (*ast.StringLiteral, error) {
+	return ast.NewStringLiteral(p.currentToken.Literal, p.currentToken.Line), nil
+}
+
 func (p *Parser) parseBooleanLiteral() (*ast.BooleanLiteral, error) {
 	line := p.currentToken.Line
 	switch p.currentToken.Type {
 	case token.TRUE:
-		return TRUE_NODE, nil
+		return ast.NewBooleanLiteral(true, line), nil
 	case token.FALSE:
-		return FALSE_NODE, nil
+		return ast.NewBooleanLiteral(false, line), nil
 	default:
 		return nil, &ParserError{line: line, msg: fmt.Sprintf("not boolean: %+v", p.currentToken)}
 	}
@@ -317,18 +372,59 @@ func (p *Parser) parseIfExpression() (ast.Expression, error) {
 	return ast.NewIfExpression(condition, consequence, alternative, line), nil
 }
 
+func (p *Parser) parseTryExpression() (ast.Expression, error) {
+	line := p.currentToken.Line
+
+	if err := p.expectToken(token.LBRACE); err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlockStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expectToken(token.CATCH); err != nil {
+		return nil, err
+	}
+	if err := p.expectToken(token.LPAREN); err != nil {
+		return nil, err
+	}
+	if err := p.expectToken(token.IDENT); err != nil {
+		return nil, err
+	}
+	parameter, err := p.parseIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectToken(token.RPAREN); err != nil {
+		return nil, err
+	}
+
+	if err := p.expectToken(token.LBRACE); err != nil {
+		return nil, err
+	}
+	handler, err := p.parseBlockStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewTryExpression(body, parameter, handler, line), nil
+}
+
 func (p *Parser) parseFunctionLiteral() (ast.Expression, error) {
 	line := p.currentToken.Line
-	expressions, err := p.parseCommaSeparatedExpressions(token.BAR)
+	parameters, parameterTypes, err := p.parseParameters()
 	if err != nil {
 		return nil, err
 	}
-	var parameters []*ast.Identifier
-	for _, expression := range expressions {
-		if parameter, ok := expression.(*ast.Identifier); ok {
-			parameters = append(parameters, parameter)
-		} else {
-			return nil, &ParserError{line: line, msg: fmt.Sprintf("unable to parse function parameter: %+v", expression)}
+
+	var returnType ast.TypeAnnotation
+	if p.peekToken.Type == token.ARROW {
+		p.consumeToken()
+		p.consumeToken()
+		returnType, err = p.parseTypeAnnotation()
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -340,25 +436,215 @@ func (p *Parser) parseFunctionLiteral() (ast.Expression, error) {
 		return nil, err
 	}
 
-	return ast.NewFunctionLiteral(parameters, body, line), nil
+	functionLiteral := ast.NewFunctionLiteral(parameters, body, line)
+	functionLiteral.ParameterTypes = parameterTypes
+	functionLiteral.ReturnType = returnType
+	return functionLiteral, nil
+}
+
+// parseParameters parses the parameters between the bars, each optionally annotated as `x: int`.
+// parameterTypes is nil if no parameter is annotated.
+func (p *Parser) parseParameters() ([]*ast.Identifier, []ast.TypeAnnotation, error) {
+	parameters := []*ast.Identifier{}
+	var parameterTypes []ast.TypeAnnotation
+	annotated := false
+	for p.peekToken.Type != token.BAR {
+		if len(parameters) > 0 {
+			if err := p.expectToken(token.COMMA); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := p.expectToken(token.IDENT); err != nil {
+			return nil, nil, err
+		}
+		parameter, err := p.parseIdentifier()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var parameterType ast.TypeAnnotation
+		if p.peekToken.Type == token.COLON {
+			p.consumeToken()
+			p.consumeToken()
+			parameterType, err = p.parseTypeAnnotation()
+			if err != nil {
+				return nil, nil, err
+			}
+			annotated = true
+		}
+		parameters = append(parameters, parameter)
+		parameterTypes = append(parameterTypes, parameterType)
+	}
+	p.consumeToken()
+
+	if !annotated {
+		parameterTypes = nil
+	}
+	return parameters, parameterTypes, nil
+}
+
+// parseTypeAnnotation parses a type such as `int`, `[int]`, `|int, bool| -> int` or `(|int| -> int)`.
+func (p *Parser) parseTypeAnnotation() (ast.TypeAnnotation, error) {
+	line := p.currentToken.Line
+	switch p.currentToken.Type {
+	case token.IDENT:
+		return ast.NewNamedType(p.currentToken.Literal, line), nil
+	case token.LBRACKET:
+		p.consumeToken()
+		element, err := p.parseTypeAnnotation()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectToken(token.RBRACKET); err != nil {
+			return nil, err
+		}
+		return ast.NewArrayType(element, line), nil
+	case token.LPAREN:
+		p.consumeToken()
+		typeAnnotation, err := p.parseTypeAnnotation()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectToken(token.RPAREN); err != nil {
+			return nil, err
+		}
+		return typeAnnotation, nil
+	case token.BAR:
+		parameters := []ast.TypeAnnotation{}
+		for p.peekToken.Type != token.BAR {
+			if len(parameters) > 0 {
+				if err := p.expectToken(token.COMMA); err != nil {
+					return nil, err
+				}
+			}
+			p.consumeToken()
+			parameter, err := p.parseTypeAnnotation()
+			if err != nil {
+				return nil, err
+			}
+			parameters = append(parameters, parameter)
+		}
+		p.consumeToken()
+
+		if err := p.expectToken(token.ARROW); err != nil {
+			return nil, err
+		}
+		p.consumeToken()
+		ret, err := p.parseTypeAnnotation()
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewFunctionType(parameters, ret, line), nil
+	default:
+		return nil, &ParserError{line: line, msg: fmt.Sprintf("unable to parse type annotation: %+v", p.currentToken)}
+	}
+}
+
+func (p *Parser) parseMacroLiteral() (ast.Expression, error) {
+	line := p.currentToken.Line
+	if err := p.expectToken(token.BAR); err != nil {
+		return nil, err
+	}
+	function, err := p.parseFunctionLiteral()
+	if err != nil {
+		return nil, err
+	}
+	functionLiteral := function.(*ast.FunctionLiteral)
+	if functionLiteral.ParameterTypes != nil || functionLiteral.ReturnType != nil {
+		return nil, &ParserError{line: line, msg: "macro cannot have type annotations"}
+	}
+
+	return ast.NewMacroLiteral(functionLiteral.Parameters, functionLiteral.Body, line), nil
 }
 
 func (p *Parser) parseArrayLiteral() (ast.Expression, error) {
 	line := p.currentToken.Line
-	elements, err := p.parseCommaSeparatedExpressions(token.RBRACKET)
+	if p.peekToken.Type == token.RBRACKET {
+		p.consumeToken()
+		return ast.NewArrayLiteral([]ast.Expression{}, line), nil
+	}
+
+	p.consumeToken()
+	first, err := p.parseExpression(LOWEST)
 	if err != nil {
 		return nil, err
 	}
+	if p.peekToken.Type == token.FOR {
+		return p.parseArrayComprehension(first, line)
+	}
+
+	elements := []ast.Expression{first}
+	for p.peekToken.Type != token.RBRACKET {
+		if err := p.expectToken(token.COMMA); err != nil {
+			return nil, err
+		}
+		p.consumeToken()
+
+		element, err := p.parseExpression(LOWEST)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	if err := p.expectToken(token.RBRACKET); err != nil {
+		return nil, err
+	}
 
 	return ast.NewArrayLiteral(elements, line), nil
 }
 
+func (p *Parser) parseArrayComprehension(element ast.Expression, line int) (*ast.ArrayComprehension, error) {
+	var clauses []*ast.ComprehensionClause
+	for p.peekToken.Type == token.FOR {
+		p.consumeToken()
+		clause, err := p.parseComprehensionClause()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	if err := p.expectToken(token.RBRACKET); err != nil {
+		return nil, err
+	}
+
+	return ast.NewArrayComprehension(element, clauses, line), nil
+}
+
+func (p *Parser) parseComprehensionClause() (*ast.ComprehensionClause, error) {
+	line := p.currentToken.Line
+	if err := p.expectToken(token.IDENT); err != nil {
+		return nil, err
+	}
+	variable, err := p.parseIdentifier()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expectToken(token.IN); err != nil {
+		return nil, err
+	}
+	p.consumeToken()
+	iterable, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekToken.Type != token.IF {
+		return ast.NewComprehensionClause(variable, iterable, nil, line), nil
+	}
+	p.consumeToken()
+	p.consumeToken()
+	condition, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewComprehensionClause(variable, iterable, condition, line), nil
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) (*ast.InfixExpression, error) {
 	line := p.currentToken.Line
-	precedence := p.currentPrecedence()
 	operator := p.currentToken.Literal
-	p.consumeToken()
-	right, err := p.parseExpression(precedence)
+	right, err := p.ParseOperand()
 	if err != nil {
 		return nil, err
 	}
@@ -367,11 +653,13 @@ func (p *Parser) parseInfixExpression(left ast.Expression) (*ast.InfixExpression
 
 func (p *Parser) parseFunctionCall(left ast.Expression) (*ast.FunctionCall, error) {
 	line := p.currentToken.Line
-	arguments, err := p.parseCommaSeparatedExpressions(token.RPAREN)
+	arguments, sources, err := p.parseCommaSeparatedExpressions(token.RPAREN)
 	if err != nil {
 		return nil, err
 	}
-	return ast.NewFunctionCall(left, arguments, line), nil
+	call := ast.NewFunctionCall(left, arguments, line)
+	call.Sources = sources
+	return call, nil
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) (*ast.IndexExpression, error) {
@@ -387,10 +675,31 @@ func (p *Parser) parseIndexExpression(left ast.Expression) (*ast.IndexExpression
 	return ast.NewIndexExpression(left, index, line), nil
 }
 
-func (p *Parser) parseArrowExpression(left ast.Expression) (*ast.FunctionCall, error) {
+// parseFieldExpression parses both field access (x.f) and method call (x.f(y)).
+func (p *Parser) parseFieldExpression(left ast.Expression) (ast.Expression, error) {
 	line := p.currentToken.Line
+	if err := p.expectToken(token.IDENT); err != nil {
+		return nil, err
+	}
+	field, err := p.parseIdentifier()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekToken.Type != token.LPAREN {
+		return ast.NewFieldExpression(left, field, line), nil
+	}
 	p.consumeToken()
-	right, err := p.parseExpression(ARROW)
+	arguments, _, err := p.parseCommaSeparatedExpressions(token.RPAREN)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewMethodCall(left, field, arguments, line), nil
+}
+
+func (p *Parser) parseArrowExpression(left ast.Expression) (*ast.FunctionCall, error) {
+	line := p.currentToken.Line
+	right, err := p.ParseOperand()
 	if err != nil {
 		return nil, err
 	}
@@ -399,37 +708,54 @@ func (p *Parser) parseArrowExpression(left ast.Expression) (*ast.FunctionCall, e
 		return nil, &ParserError{line: line, msg: fmt.Sprintf("right of '->' should be function call. got=%+v (%T)\n", right, right)}
 	}
 	rightCall.Arguments = append([]ast.Expression{left}, rightCall.Arguments...)
+	rightCall.Sources = append([]string{""}, rightCall.Sources...)
+	rightCall.Arrow = true
 
 	return rightCall, nil
 }
 
-func (p *Parser) parseCommaSeparatedExpressions(endTokenType token.Type) ([]ast.Expression, error) {
+// parseCommaSeparatedExpressions parses the expressions up to endTokenType,
+// and returns the source text each of them is parsed from.
+func (p *Parser) parseCommaSeparatedExpressions(endTokenType token.Type) ([]ast.Expression, []string, error) {
 	p.consumeToken()
 	if p.currentToken.Type == endTokenType {
-		return []ast.Expression{}, nil
+		return []ast.Expression{}, []string{}, nil
 	}
 
-	first, err := p.parseExpression(LOWEST)
+	first, source, err := p.parseExpressionSource()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	expressions := []ast.Expression{first}
+	sources := []string{source}
 
 	for p.peekToken.Type != endTokenType {
 		if err := p.expectToken(token.COMMA); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		p.consumeToken()
 
-		expression, err := p.parseExpression(LOWEST)
+		expression, source, err := p.parseExpressionSource()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		expressions = append(expressions, expression)
+		sources = append(sources, source)
 	}
 	if err := p.expectToken(endTokenType); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return expressions, nil
+	return expressions, sources, nil
+}
+
+// parseExpressionSource parses an expression, and returns the source text it is parsed from,
+// from its first token up to its last one.
+func (p *Parser) parseExpressionSource() (ast.Expression, string, error) {
+	start := p.currentRange.start
+	expression, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, "", err
+	}
+	return expression, p.lexer.Text(start, p.currentRange.end), nil
 }
@@ -3,6 +3,7 @@ package parser
 import (
 	"github.com/muiscript/ether/ast"
 	"github.com/muiscript/ether/lexer"
+	"reflect"
 	"testing"
 )
 
@@ -411,6 +412,96 @@ func TestParser_ParseProgram_FunctionLiteral(t *testing.T) {
 	}
 }
 
+func TestParser_ParseProgram_TypeAnnotation(t *testing.T) {
+	tests := []struct {
+		desc                   string
+		input                  string
+		expectedParameterTypes []string
+		expectedReturnType     string
+	}{
+		{
+			desc:                   "not annotated",
+			input:                  "|x, y| { x }",
+			expectedParameterTypes: nil,
+			expectedReturnType:     "",
+		},
+		{
+			desc:                   "parameters",
+			input:                  "|x: int, y, z: [[bool]]| { x }",
+			expectedParameterTypes: []string{"int", "", "[[bool]]"},
+			expectedReturnType:     "",
+		},
+		{
+			desc:                   "return type",
+			input:                  "|| -> string { x }",
+			expectedParameterTypes: nil,
+			expectedReturnType:     "string",
+		},
+		{
+			desc:                   "function types",
+			input:                  "|f: |a, (|| -> b)| -> [b]| -> |int| -> int { f }",
+			expectedParameterTypes: []string{"|a, (|| -> b)| -> [b]"},
+			expectedReturnType:     "|int| -> int",
+		},
+	}
+
+	typeString := func(typeAnnotation ast.TypeAnnotation) string {
+		if typeAnnotation == nil {
+			return ""
+		}
+		return typeAnnotation.String()
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+			functionLiteral, ok := convertStatementsToSingleExpression(t, program.Statements).(*ast.FunctionLiteral)
+			if !ok {
+				t.Fatalf("expression type wrong.\nwant=%T\ngot=%T\n", &ast.FunctionLiteral{}, program.Statements[0])
+			}
+
+			var parameterTypes []string
+			for _, parameterType := range functionLiteral.ParameterTypes {
+				parameterTypes = append(parameterTypes, typeString(parameterType))
+			}
+			if !reflect.DeepEqual(parameterTypes, tt.expectedParameterTypes) {
+				t.Errorf("parameter types wrong.\nwant=%q\ngot=%q\n", tt.expectedParameterTypes, parameterTypes)
+			}
+			if typeString(functionLiteral.ReturnType) != tt.expectedReturnType {
+				t.Errorf("return type wrong.\nwant=%q\ngot=%q\n", tt.expectedReturnType, typeString(functionLiteral.ReturnType))
+			}
+		})
+	}
+
+	varStatement, ok := parseProgram(t, "var xs: [int] = [1]").Statements[0].(*ast.VarStatement)
+	if !ok || typeString(varStatement.Type) != "[int]" {
+		t.Errorf("type of var statement wrong.\nwant=%s\ngot=%v\n", "[int]", varStatement)
+	}
+
+	for _, input := range []string{"macro |x: int| { x }", "|x: 1| { x }", "|x: |int|| { x }", "var x: = 1"} {
+		if _, err := New(lexer.New(input)).ParseProgram(); err == nil {
+			t.Errorf("error should occur for %q", input)
+		}
+	}
+}
+
+func TestParser_ParseProgram_MacroLiteral(t *testing.T) {
+	program := parseProgram(t, "macro |x, y| { x + y; }")
+	expression := convertStatementsToSingleExpression(t, program.Statements)
+
+	macroLiteral, ok := expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("expression type wrong.\nwant=%T\ngot=%T (%v)\n", &ast.MacroLiteral{}, expression, expression)
+	}
+	if len(macroLiteral.Parameters) != 2 {
+		t.Fatalf("parameter length wrong.\nwant=%d\ngot=%d\n", 2, len(macroLiteral.Parameters))
+	}
+	testLiteral(t, "x", macroLiteral.Parameters[0])
+	testLiteral(t, "y", macroLiteral.Parameters[1])
+	body := convertStatementsToSingleExpression(t, macroLiteral.Body.Statements)
+	testInfixExpression(t, "+", "x", "y", body.(*ast.InfixExpression))
+}
+
 func TestParser_ParseProgram_FunctionCall(t *testing.T) {
 	tests := []struct {
 		desc         string
@@ -460,6 +551,32 @@ func TestParser_ParseProgram_FunctionCall(t *testing.T) {
 	}
 }
 
+func TestParser_ParseProgram_FunctionCall_Sources(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected []string
+	}{
+		{desc: "no arguments", input: "f()", expected: []string{}},
+		{desc: "as written", input: "f(1+ (2), g(x,\n  y), \"a\\n\")", expected: []string{"1+ (2)", "g(x,\n  y)", "\"a\\n\""}},
+		{desc: "comments", input: "f(a # a\n, (b))", expected: []string{"a", "(b)"}},
+		{desc: "arrow", input: "x -> f(y  * 2)", expected: []string{"", "y  * 2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+			functionCall, ok := convertStatementsToSingleExpression(t, program.Statements).(*ast.FunctionCall)
+			if !ok {
+				t.Fatalf("expression type wrong.\nwant=%T\ngot=%T\n", &ast.FunctionCall{}, program.Statements[0])
+			}
+			if !reflect.DeepEqual(functionCall.Sources, tt.expected) {
+				t.Errorf("sources wrong.\nwant=%q\ngot=%q\n", tt.expected, functionCall.Sources)
+			}
+		})
+	}
+}
+
 func TestParser_ParseProgram_ArrayLiteral(t *testing.T) {
 	tests := []struct {
 		desc             string
@@ -506,6 +623,45 @@ func TestParser_ParseProgram_ArrayLiteral(t *testing.T) {
 	}
 }
 
+func TestParser_ParseProgram_ArrayComprehension(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "[x for x in xs]",
+			input:    "[x for x in xs];",
+			expected: "[x for x in xs]",
+		},
+		{
+			desc:     "[x*x for x in xs if x%2==1]",
+			input:    "[x * x for x in xs if x % 2 == 1];",
+			expected: "[(x * x) for x in xs if ((x % 2) == 1)]",
+		},
+		{
+			desc:     "nested",
+			input:    "[[x, y] for x in [1, 2] if x > 1 for y in ys];",
+			expected: "[[x, y] for x in [1, 2] if (x > 1) for y in ys]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+			expression := convertStatementsToSingleExpression(t, program.Statements)
+
+			arrayComprehension, ok := expression.(*ast.ArrayComprehension)
+			if !ok {
+				t.Fatalf("expression type wrong.\nwant=%T\ngot=%T (%v)\n", &ast.ArrayComprehension{}, expression, expression)
+			}
+			if actual := arrayComprehension.String(); actual != tt.expected {
+				t.Errorf("string expression wrong.\nwant=%q\ngot=%q\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
 func TestParser_ParseProgram_IndexExpression(t *testing.T) {
 	tests := []struct {
 		desc          string
@@ -599,6 +755,205 @@ func TestParser_ParseProgram_ArrowExpression(t *testing.T) {
 	}
 }
 
+func TestParser_ParseProgram_ThrowStatement(t *testing.T) {
+	tests := []struct {
+		desc               string
+		input              string
+		expectedExpression interface{}
+	}{
+		{
+			desc:               "throw e",
+			input:              "throw e;",
+			expectedExpression: "e",
+		},
+		{
+			desc:               "throw 42",
+			input:              "throw 42",
+			expectedExpression: 42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+
+			if len(program.Statements) != 1 {
+				t.Errorf("statements length wrong.\nwant=%d\ngot=%d\n", 1, len(program.Statements))
+			}
+			throwStatement, ok := program.Statements[0].(*ast.ThrowStatement)
+			if !ok {
+				t.Fatalf("statement type wrong.\nwant=%T\ngot=%T (%v)\n", &ast.ThrowStatement{}, program.Statements[0], program.Statements[0])
+			}
+			testLiteral(t, tt.expectedExpression, throwStatement.Expression)
+		})
+	}
+}
+
+func TestParser_ParseProgram_YieldStatement(t *testing.T) {
+	tests := []struct {
+		desc               string
+		input              string
+		expectedExpression interface{}
+	}{
+		{
+			desc:               "yield x",
+			input:              "yield x;",
+			expectedExpression: "x",
+		},
+		{
+			desc:               "yield 42",
+			input:              "yield 42",
+			expectedExpression: 42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+
+			if len(program.Statements) != 1 {
+				t.Errorf("statements length wrong.\nwant=%d\ngot=%d\n", 1, len(program.Statements))
+			}
+			yieldStatement, ok := program.Statements[0].(*ast.YieldStatement)
+			if !ok {
+				t.Fatalf("statement type wrong.\nwant=%T\ngot=%T (%v)\n", &ast.YieldStatement{}, program.Statements[0], program.Statements[0])
+			}
+			testLiteral(t, tt.expectedExpression, yieldStatement.Expression)
+		})
+	}
+}
+
+func TestParser_ParseProgram_TryExpression(t *testing.T) {
+	tests := []struct {
+		desc              string
+		input             string
+		expectedBody      interface{}
+		expectedParameter string
+		expectedHandler   interface{}
+	}{
+		{
+			desc:              "try{1}catch(e){e}",
+			input:             "try { 1 } catch (e) { e }",
+			expectedBody:      1,
+			expectedParameter: "e",
+			expectedHandler:   "e",
+		},
+		{
+			desc:              "try{x}catch(err){2}",
+			input:             "try { x; } catch (err) { 2; };",
+			expectedBody:      "x",
+			expectedParameter: "err",
+			expectedHandler:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+			expression := convertStatementsToSingleExpression(t, program.Statements)
+
+			tryExpression, ok := expression.(*ast.TryExpression)
+			if !ok {
+				t.Fatalf("expression type wrong.\nwant=%T\ngot=%T (%v)\n", &ast.TryExpression{}, expression, expression)
+			}
+			body := convertStatementsToSingleExpression(t, tryExpression.Body.Statements)
+			testLiteral(t, tt.expectedBody, body)
+			if tryExpression.Parameter.Name != tt.expectedParameter {
+				t.Errorf("parameter name wrong.\nwant=%s\ngot=%s\n", tt.expectedParameter, tryExpression.Parameter.Name)
+			}
+			handler := convertStatementsToSingleExpression(t, tryExpression.Handler.Statements)
+			testLiteral(t, tt.expectedHandler, handler)
+		})
+	}
+}
+
+func TestParser_ParseProgram_FieldExpression(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "e.message",
+			input:    "e.message;",
+			expected: "e.message",
+		},
+		{
+			desc:     "e.line + 1",
+			input:    "e.line + 1;",
+			expected: "(e.line + 1)",
+		},
+		{
+			desc:     "-e.line",
+			input:    "-e.line;",
+			expected: "(-e.line)",
+		},
+		{
+			desc:     "string",
+			input:    `"foo" + e.kind;`,
+			expected: `("foo" + e.kind)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+			expression := convertStatementsToSingleExpression(t, program.Statements)
+
+			if actual := expression.String(); actual != tt.expected {
+				t.Errorf("string expression wrong.\nwant=%q\ngot=%q\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParser_ParseProgram_MethodCall(t *testing.T) {
+	tests := []struct {
+		desc             string
+		input            string
+		expectedReceiver interface{}
+		expectedMethod   string
+		expectedArgs     []interface{}
+	}{
+		{
+			desc:             "x.f();",
+			input:            "x.f();",
+			expectedReceiver: "x",
+			expectedMethod:   "f",
+			expectedArgs:     []interface{}{},
+		},
+		{
+			desc:             "5.add(x,1);",
+			input:            "5.add(x, 1);",
+			expectedReceiver: 5,
+			expectedMethod:   "add",
+			expectedArgs:     []interface{}{"x", 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+			expression := convertStatementsToSingleExpression(t, program.Statements)
+
+			methodCall, ok := expression.(*ast.MethodCall)
+			if !ok {
+				t.Fatalf("expression type wrong.\nwant=%T\ngot=%T (%v)\n", &ast.MethodCall{}, expression, expression)
+			}
+			testLiteral(t, tt.expectedReceiver, methodCall.Receiver)
+			if methodCall.Method.Name != tt.expectedMethod {
+				t.Errorf("method name wrong.\nwant=%s\ngot=%s\n", tt.expectedMethod, methodCall.Method.Name)
+			}
+			if len(methodCall.Arguments) != len(tt.expectedArgs) {
+				t.Fatalf("arguments length wrong.\nwant=%d\ngot=%d\n", len(tt.expectedArgs), len(methodCall.Arguments))
+			}
+			for i, expectedArg := range tt.expectedArgs {
+				testLiteral(t, expectedArg, methodCall.Arguments[i])
+			}
+		})
+	}
+}
+
 func TestParser_ParseProgram_ComplexArithmetic(t *testing.T) {
 	tests := []struct {
 		desc     string
@@ -635,6 +990,11 @@ func TestParser_ParseProgram_ComplexArithmetic(t *testing.T) {
 			input:    "- -42;",
 			expected: "(-(-42))",
 		},
+		{
+			desc:     "method chain",
+			input:    "xs.map(f).filter(g)[0] + 1;",
+			expected: "(xs.map(f).filter(g)[0] + 1)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/token"
+)
+
+// PrefixParseFn parses an expression starting at the current token.
+// when it returns, the current token must be the last token of the expression.
+type PrefixParseFn func(p *Parser) (ast.Expression, error)
+
+// InfixParseFn parses an expression whose operator is the current token and whose left operand is left.
+// when it returns, the current token must be the last token of the expression.
+type InfixParseFn func(p *Parser, left ast.Expression) (ast.Expression, error)
+
+type Associativity int
+
+const (
+	LEFT Associativity = iota
+	RIGHT
+)
+
+type infixRule struct {
+	parse         InfixParseFn
+	precedence    Precedence
+	associativity Associativity
+}
+
+// RegisterPrefix registers fn as the parse function for expressions starting with tokenType.
+// it replaces the rule registered for tokenType, if any.
+func (p *Parser) RegisterPrefix(tokenType token.Type, fn PrefixParseFn) {
+	p.prefixParseFns[tokenType] = fn
+}
+
+// RegisterInfix registers fn as the parse function for the infix operator tokenType.
+// it replaces the rule registered for tokenType, if any.
+func (p *Parser) RegisterInfix(tokenType token.Type, precedence Precedence, associativity Associativity, fn InfixParseFn) {
+	p.infixRules[tokenType] = infixRule{parse: fn, precedence: precedence, associativity: associativity}
+}
+
+// RegisterKeyword makes the parser read identifiers spelled literal as tokens of tokenType,
+// so that words such as `matches` can be used as operators.
+func (p *Parser) RegisterKeyword(literal string, tokenType token.Type) {
+	p.keywords[literal] = tokenType
+	if p.peekToken.Type == token.IDENT && p.peekToken.Literal == literal {
+		p.peekToken.Type = tokenType
+	}
+	if p.currentToken.Type == token.IDENT && p.currentToken.Literal == literal {
+		p.currentToken.Type = tokenType
+	}
+}
+
+// InfixOperator returns a parse function which builds ast.InfixExpression for the operator.
+func InfixOperator() InfixParseFn {
+	return func(p *Parser, left ast.Expression) (ast.Expression, error) {
+		return p.parseInfixExpression(left)
+	}
+}
+
+func (p *Parser) CurrentToken() token.Token { return p.currentToken }
+func (p *Parser) PeekToken() token.Token    { return p.peekToken }
+
+// NextToken advances to the next token.
+func (p *Parser) NextToken() { p.consumeToken() }
+
+// ExpectPeek advances to the next token if it is of tokenType, and returns an error otherwise.
+func (p *Parser) ExpectPeek(tokenType token.Type) error { return p.expectToken(tokenType) }
+
+// ParseExpression parses an expression starting at the current token,
+// consuming infix operators which bind tighter than precedence.
+func (p *Parser) ParseExpression(precedence Precedence) (ast.Expression, error) {
+	return p.parseExpression(precedence)
+}
+
+// ParseBlockStatement parses `{ ... }` starting at the current `{` token.
+func (p *Parser) ParseBlockStatement() (*ast.BlockStatement, error) {
+	return p.parseBlockStatement()
+}
+
+// ParseOperand consumes the current infix operator and parses its right operand
+// according to the precedence and associativity the operator was registered with.
+func (p *Parser) ParseOperand() (ast.Expression, error) {
+	rule, ok := p.infixRules[p.currentToken.Type]
+	if !ok {
+		return nil, p.Errorf("not infix operator: %+v", p.currentToken)
+	}
+	precedence := rule.precedence
+	if rule.associativity == RIGHT {
+		precedence--
+	}
+	p.consumeToken()
+	return p.parseExpression(precedence)
+}
+
+// Errorf returns a parser error located at the current token.
+func (p *Parser) Errorf(format string, args ...interface{}) error {
+	return &ParserError{line: p.currentToken.Line, msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/token"
+	"testing"
+)
+
+type membershipExpression struct {
+	Element    ast.Expression
+	Collection ast.Expression
+}
+
+func (me *membershipExpression) Line() int { return 1 }
+func (me *membershipExpression) String() string {
+	return "(" + me.Element.String() + " in " + me.Collection.String() + ")"
+}
+func (me *membershipExpression) ExpressionNode() {}
+
+func TestParser_RegisterInfix(t *testing.T) {
+	const (
+		MATCHES token.Type = "MATCHES"
+		POW     token.Type = "POW"
+	)
+
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "custom node",
+			input:    "x in [1, 2];",
+			expected: "(x in [1, 2])",
+		},
+		{
+			desc:     "precedence of custom node",
+			input:    "1 + 2 in xs == true;",
+			expected: "(((1 + 2) in xs) == true)",
+		},
+		{
+			desc:     "keyword operator",
+			input:    `name matches "foo";`,
+			expected: `(name matches "foo")`,
+		},
+		{
+			desc:     "right associative operator",
+			input:    "2 pow 3 pow 2;",
+			expected: "(2 pow (3 pow 2))",
+		},
+		{
+			desc:     "right associative operator binds tighter than addition",
+			input:    "1 + 2 pow 3 + 4;",
+			expected: "((1 + (2 pow 3)) + 4)",
+		},
+		{
+			desc:     "builtin rules are kept",
+			input:    "xs -> map(f) == -1 * ys[0];",
+			expected: "((xs -> map(f)) == ((-1) * ys[0]))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.RegisterInfix(token.IN, COMPARISON, LEFT, func(p *Parser, left ast.Expression) (ast.Expression, error) {
+				collection, err := p.ParseOperand()
+				if err != nil {
+					return nil, err
+				}
+				return &membershipExpression{Element: left, Collection: collection}, nil
+			})
+			p.RegisterKeyword("matches", MATCHES)
+			p.RegisterInfix(MATCHES, EQUAL, LEFT, InfixOperator())
+			p.RegisterKeyword("pow", POW)
+			p.RegisterInfix(POW, MULTIPLICATION, RIGHT, InfixOperator())
+
+			program, err := p.ParseProgram()
+			if err != nil {
+				t.Fatalf("parse error: %s", err.Error())
+			}
+			expression := convertStatementsToSingleExpression(t, program.Statements)
+			if actual := expression.String(); actual != tt.expected {
+				t.Errorf("string expression wrong.\nwant=%q\ngot=%q\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParser_RegisterPrefix(t *testing.T) {
+	p := New(lexer.New("#nothing\n~5;"))
+	// the lexer reads `~` as ILLEGAL token; an embedder can still give it a meaning.
+	p.RegisterPrefix(token.ILLEGAL, func(p *Parser) (ast.Expression, error) {
+		if p.CurrentToken().Literal != "~" {
+			return nil, p.Errorf("unexpected %q", p.CurrentToken().Literal)
+		}
+		line := p.CurrentToken().Line
+		p.NextToken()
+		right, err := p.ParseExpression(PREFIX)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewPrefixExpression("~", right, line), nil
+	})
+
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s", err.Error())
+	}
+	expression := convertStatementsToSingleExpression(t, program.Statements)
+	if expected := "(~5)"; expression.String() != expected {
+		t.Errorf("string expression wrong.\nwant=%q\ngot=%q\n", expected, expression.String())
+	}
+}
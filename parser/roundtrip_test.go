@@ -0,0 +1,256 @@
+package parser
+
+import (
+	"encoding/json"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// TestParser_RoundTrip checks that parsing the String() of a program gives the same program
+// for randomly generated programs.
+func TestParser_RoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		generator := &programGenerator{random: random}
+		program := generator.program()
+		input := program.String()
+
+		parsed, err := New(lexer.New(input)).ParseProgram()
+		if err != nil {
+			t.Fatalf("err occurred: %s\ninput=%q", err, input)
+		}
+		if !equalIgnoringLines(t, program, parsed) {
+			t.Fatalf("round trip wrong.\nwant=%s\ngot=%s\n", input, parsed)
+		}
+	}
+}
+
+func TestParser_RoundTrip_Source(t *testing.T) {
+	inputs := []string{
+		`var x = [1, 2, 3] -> map(|x| { x * 2 }) -> filter(|x| { x > 2 });`,
+		`puts(1); (2 + 3) * 4; -5`,
+		`(a.b)(1); a.b(1); (x -> f())(1); x -> (y -> f())();`,
+		`"a\"b\\c\nd\te\rf\0g"`,
+		`try { throw error("a", "Kind") } catch (e) { e.message }`,
+		`[x * y for x in xs if x > 1 for y in if (a) { ys } else { zs }]`,
+		`var m = macro |c, a| { quote(if (!(unquote(c))) { unquote(a) }) }; m(false, 1)`,
+		`|| {}(); |x| { return x; }(1)[0].f`,
+		`var f: |int, [a]| -> [a] = |n: int, xs, ys: [a]| -> |[int]| -> [a] { || -> int { n } }`,
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			program := parseProgram(t, input)
+			printed := program.String()
+			if !equalIgnoringLines(t, program, parseProgram(t, printed)) {
+				t.Errorf("round trip wrong.\ninput=%s\nprinted=%s\n", input, printed)
+			}
+		})
+	}
+}
+
+func equalIgnoringLines(t *testing.T, expected, actual *ast.Program) bool {
+	return reflect.DeepEqual(withoutLines(t, expected), withoutLines(t, actual))
+}
+
+func withoutLines(t *testing.T, program *ast.Program) interface{} {
+	encoded, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("err occurred: %s", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("err occurred: %s", err)
+	}
+
+	var strip func(value interface{})
+	strip = func(value interface{}) {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			delete(value, "line")
+			delete(value, "end")
+			delete(value, "sources")
+			for _, v := range value {
+				strip(v)
+			}
+		case []interface{}:
+			for _, v := range value {
+				strip(v)
+			}
+		}
+	}
+	strip(decoded)
+	return decoded
+}
+
+// programGenerator generates random programs of the shapes the parser produces.
+type programGenerator struct {
+	random *rand.Rand
+}
+
+var generatedNames = []string{"a", "b", "foo", "quote", "unquote", "map"}
+var generatedOperators = []string{"+", "-", "*", "/", "%", "==", "!=", "<", ">"}
+var generatedTypeNames = []string{"int", "bool", "a"}
+var generatedStrings = []string{"", "a", "foo bar", "\"", "\\", "\n\t\r", "\x00", "#", "é", "\\n"}
+
+func (g *programGenerator) program() *ast.Program {
+	statements := []ast.Statement{}
+	for i := g.random.Intn(4); i > 0; i-- {
+		statements = append(statements, g.statement(3))
+	}
+	return &ast.Program{Statements: statements}
+}
+
+func (g *programGenerator) statement(depth int) ast.Statement {
+	switch g.random.Intn(5) {
+	case 0:
+		varStatement := ast.NewVarStatement(g.identifier(), g.expression(depth), 1)
+		varStatement.Type = g.optionalTypeAnnotation(2)
+		return varStatement
+	case 1:
+		return ast.NewReturnStatement(g.expression(depth), 1)
+	case 2:
+		return ast.NewThrowStatement(g.expression(depth), 1)
+	default:
+		return ast.NewExpressionStatement(g.expression(depth), 1)
+	}
+}
+
+func (g *programGenerator) block(depth int) *ast.BlockStatement {
+	statements := []ast.Statement{}
+	for i := g.random.Intn(3); i > 0; i-- {
+		statements = append(statements, g.statement(depth))
+	}
+	return ast.NewBlockStatement(statements, 1)
+}
+
+func (g *programGenerator) optionalTypeAnnotation(depth int) ast.TypeAnnotation {
+	if g.random.Intn(2) == 0 {
+		return nil
+	}
+	return g.typeAnnotation(depth)
+}
+
+func (g *programGenerator) typeAnnotation(depth int) ast.TypeAnnotation {
+	if depth <= 0 {
+		return ast.NewNamedType(generatedTypeNames[g.random.Intn(len(generatedTypeNames))], 1)
+	}
+
+	depth--
+	switch g.random.Intn(3) {
+	case 0:
+		return ast.NewArrayType(g.typeAnnotation(depth), 1)
+	case 1:
+		parameters := []ast.TypeAnnotation{}
+		for i := g.random.Intn(3); i > 0; i-- {
+			parameters = append(parameters, g.typeAnnotation(depth))
+		}
+		return ast.NewFunctionType(parameters, g.typeAnnotation(depth), 1)
+	default:
+		return g.typeAnnotation(0)
+	}
+}
+
+// isAnnotated reports whether any of typeAnnotations is not nil, as the parser leaves ParameterTypes nil otherwise.
+func isAnnotated(typeAnnotations []ast.TypeAnnotation) bool {
+	for _, typeAnnotation := range typeAnnotations {
+		if typeAnnotation != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *programGenerator) identifier() *ast.Identifier {
+	return ast.NewIdentifier(generatedNames[g.random.Intn(len(generatedNames))], 1)
+}
+
+func (g *programGenerator) identifiers() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+	for i := g.random.Intn(3); i > 0; i-- {
+		identifiers = append(identifiers, g.identifier())
+	}
+	return identifiers
+}
+
+func (g *programGenerator) expressions(depth, min int) []ast.Expression {
+	expressions := []ast.Expression{}
+	for i := min + g.random.Intn(3); i > 0; i-- {
+		expressions = append(expressions, g.expression(depth))
+	}
+	return expressions
+}
+
+func (g *programGenerator) expression(depth int) ast.Expression {
+	if depth <= 0 {
+		switch g.random.Intn(4) {
+		case 0:
+			return ast.NewIntegerLiteral(g.random.Intn(1000), 1)
+		case 1:
+			return ast.NewBooleanLiteral(g.random.Intn(2) == 0, 1)
+		case 2:
+			return ast.NewStringLiteral(generatedStrings[g.random.Intn(len(generatedStrings))], 1)
+		default:
+			return g.identifier()
+		}
+	}
+
+	depth--
+	switch g.random.Intn(16) {
+	case 0:
+		operators := []string{"-", "!"}
+		return ast.NewPrefixExpression(operators[g.random.Intn(len(operators))], g.expression(depth), 1)
+	case 1:
+		operator := generatedOperators[g.random.Intn(len(generatedOperators))]
+		return ast.NewInfixExpression(operator, g.expression(depth), g.expression(depth), 1)
+	case 2:
+		functionLiteral := ast.NewFunctionLiteral(g.identifiers(), g.block(depth), 1)
+		for range functionLiteral.Parameters {
+			functionLiteral.ParameterTypes = append(functionLiteral.ParameterTypes, g.optionalTypeAnnotation(2))
+		}
+		if !isAnnotated(functionLiteral.ParameterTypes) {
+			functionLiteral.ParameterTypes = nil
+		}
+		functionLiteral.ReturnType = g.optionalTypeAnnotation(2)
+		return functionLiteral
+	case 3:
+		return ast.NewMacroLiteral(g.identifiers(), g.block(depth), 1)
+	case 4:
+		return ast.NewFunctionCall(g.expression(depth), g.expressions(depth, 0), 1)
+	case 5:
+		call := ast.NewFunctionCall(g.expression(depth), g.expressions(depth, 1), 1)
+		call.Arrow = true
+		return call
+	case 6:
+		return ast.NewMethodCall(g.expression(depth), g.identifier(), g.expressions(depth, 0), 1)
+	case 7:
+		return ast.NewArrayLiteral(g.expressions(depth, 0), 1)
+	case 8:
+		clauses := []*ast.ComprehensionClause{}
+		for i := 1 + g.random.Intn(2); i > 0; i-- {
+			var condition ast.Expression
+			if g.random.Intn(2) == 0 {
+				condition = g.expression(depth)
+			}
+			clauses = append(clauses, ast.NewComprehensionClause(g.identifier(), g.expression(depth), condition, 1))
+		}
+		return ast.NewArrayComprehension(g.expression(depth), clauses, 1)
+	case 9:
+		return ast.NewIndexExpression(g.expression(depth), g.expression(depth), 1)
+	case 10:
+		return ast.NewFieldExpression(g.expression(depth), g.identifier(), 1)
+	case 11:
+		var alternative *ast.BlockStatement
+		if g.random.Intn(2) == 0 {
+			alternative = g.block(depth)
+		}
+		return ast.NewIfExpression(g.expression(depth), g.block(depth), alternative, 1)
+	case 12:
+		return ast.NewTryExpression(g.block(depth), g.identifier(), g.block(depth), 1)
+	default:
+		return g.expression(0)
+	}
+}
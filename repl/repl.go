@@ -16,6 +16,8 @@ func Start() {
 	scanner := bufio.NewScanner(os.Stdin)
 
 	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+	resolver := evaluator.NewResolver()
 
 	for {
 		fmt.Print(PROMPT)
@@ -34,7 +36,18 @@ func Start() {
 			continue
 		}
 
-		evaluated, err := evaluator.Eval(program, env)
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if err := resolver.Resolve(expanded); err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		evaluated, err := evaluator.Eval(expanded, env)
 		if err != nil {
 			fmt.Println(err)
 			continue
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runOptions are the options of `ether run`. the zero value runs a file as `ether FILE_PATH` does.
+type runOptions struct {
+	optimize      bool
+	vm            bool
+	timeout       time.Duration // no limit if zero
+	deterministic bool          // whether the tasks are run one at a time, interleaved by seed
+	seed          int64
+}
+
+// runCommand runs a file with the options given as flags.
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	var options runOptions
+	flags.BoolVar(&options.optimize, "optimize", false, "fold constant expressions and eliminate dead branches before running")
+	flags.BoolVar(&options.vm, "vm", false, "compile to bytecode and run it with the virtual machine instead of evaluating the syntax tree")
+	flags.DurationVar(&options.timeout, "timeout", 0, "stop running after the duration, such as 500ms or 10s")
+	flags.Int64Var(&options.seed, "seed", 0, "run the tasks one at a time, interleaved in the order chosen by the seed, to reproduce a run")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 1
+	}
+	flags.Visit(func(f *flag.Flag) {
+		options.deterministic = options.deterministic || f.Name == "seed"
+	})
+	return interpret(flags.Arg(0), options)
+}
@@ -9,6 +9,7 @@ const (
 	// identifier and literal
 	IDENT   = "IDENT"
 	INTEGER = "INTEGER"
+	STRING  = "STRING"
 
 	// operators
 	ASSIGN  = "ASSIGN"
@@ -26,6 +27,7 @@ const (
 
 	// delimiters
 	COMMA     = "COMMA"
+	COLON     = "COLON"
 	SEMICOLON = "SEMICOLON"
 	LPAREN    = "LPAREN"
 	RPAREN    = "RPAREN"
@@ -34,6 +36,7 @@ const (
 	LBRACKET  = "LBRACKET"
 	RBRACKET  = "RBRACKET"
 	BAR       = "BAR"
+	DOT       = "DOT"
 
 	// keywords
 	VAR    = "VAR"
@@ -42,6 +45,13 @@ const (
 	FALSE  = "FALSE"
 	IF     = "IF"
 	ELSE   = "ELSE"
+	THROW  = "THROW"
+	YIELD  = "YIELD"
+	TRY    = "TRY"
+	CATCH  = "CATCH"
+	FOR    = "FOR"
+	IN     = "IN"
+	MACRO  = "MACRO"
 )
 
 type Token struct {
@@ -50,6 +60,14 @@ type Token struct {
 	Line    int
 }
 
+// Comment is a `# ...` comment. Text includes the leading '#'.
+// Trailing is true when the comment follows a token on the same line.
+type Comment struct {
+	Text     string
+	Line     int
+	Trailing bool
+}
+
 func TypeByLiteral(literal string) Type {
 	switch literal {
 	case "var":
@@ -64,6 +82,20 @@ func TypeByLiteral(literal string) Type {
 		return IF
 	case "else":
 		return ELSE
+	case "throw":
+		return THROW
+	case "yield":
+		return YIELD
+	case "try":
+		return TRY
+	case "catch":
+		return CATCH
+	case "for":
+		return FOR
+	case "in":
+		return IN
+	case "macro":
+		return MACRO
 	default:
 		return IDENT
 	}
@@ -0,0 +1,678 @@
+package types
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+)
+
+// TypeError is an expression whose type does not match the type required there.
+type TypeError struct {
+	Node    ast.Node
+	Message string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Node.Line(), e.Message)
+}
+
+// Check infers the types in program without evaluating it.
+// it returns the type of the value of program and the type errors, in the order they are found.
+// an expression with an error gets a type variable, so that the checking goes on.
+func Check(program ast.Node) (Type, []*TypeError) {
+	c := &checker{}
+	c.enter()
+	t := c.check(program)
+	c.settle(0)
+	c.checkNegations()
+	return t, c.errors
+}
+
+// scope corresponds to an environment created during the evaluation.
+type scope struct {
+	outer        *scope
+	bindings     map[string]*Scheme
+	placeholders map[string]*placeholder // the names declared later in the scope
+}
+
+// placeholder is the type of a name used by a function before its var statement.
+// such a name is monomorphic, since the function is checked before its type is known.
+type placeholder struct {
+	variable *Variable
+	used     bool
+}
+
+type checker struct {
+	scope   *scope
+	level   int
+	returns []Type // the return types of the enclosing functions, the innermost last
+	yields  []Type // the element types of the streams of the enclosing functions, nil for the ones not generators
+	// the clauses of comprehensions whose iterables are not known to be arrays or streams yet, the latest last.
+	iterations []iteration
+	// the operands of !, in the order they are found.
+	negations []negation
+	errors    []*TypeError
+}
+
+// iteration is a clause of a comprehension whose iterable is a type variable when the clause is checked.
+// it is settled later, since the variable can be the return type of a generator used before its var statement.
+type iteration struct {
+	node     ast.Node
+	iterable Type
+	element  *Variable
+}
+
+// negation is the operand of a !, which can be an integer or a boolean.
+// a single type cannot express it, so it is checked after the program, when the type of the operand is known.
+type negation struct {
+	node    *ast.PrefixExpression
+	operand Type
+}
+
+func (c *checker) errorf(node ast.Node, format string, a ...interface{}) {
+	c.errors = append(c.errors, &TypeError{Node: node, Message: fmt.Sprintf(format, a...)})
+}
+
+// expect unifies the type of node with want and reports an error if they differ.
+func (c *checker) expect(node ast.Node, got Type, want Type) {
+	if !unify(want, got) {
+		c.errorf(node, "type mismatch in %s: want %s, got %s", node, want, got)
+	}
+}
+
+func (c *checker) newVariable() *Variable {
+	return &Variable{level: c.level}
+}
+
+func (c *checker) enter() {
+	c.scope = &scope{outer: c.scope, bindings: make(map[string]*Scheme), placeholders: make(map[string]*placeholder)}
+}
+
+func (c *checker) leave() {
+	c.scope = c.scope.outer
+}
+
+// hoist makes placeholders for the names declared in the same environment as node.
+func (c *checker) hoist(node ast.Node) {
+	for _, name := range ast.Declarations(node) {
+		if _, ok := c.scope.placeholders[name]; !ok {
+			c.scope.placeholders[name] = &placeholder{variable: c.newVariable()}
+		}
+	}
+}
+
+// declare binds name to t in the current scope, generalizing the variables made inside the var statement.
+// the iterations from the index iterations on, which are in the var statement, are settled before.
+func (c *checker) declare(node ast.Node, name string, t Type, iterations int) {
+	if p, ok := c.scope.placeholders[name]; ok {
+		delete(c.scope.placeholders, name)
+		if p.used {
+			if !unify(p.variable, t) {
+				c.errorf(node, "type of %s wrong: used as %s, declared as %s", name, p.variable, t)
+			}
+			c.settle(iterations)
+			c.scope.bindings[name] = &Scheme{body: t}
+			return
+		}
+	}
+	c.settle(iterations)
+	c.scope.bindings[name] = c.generalize(t)
+}
+
+// settle unifies the iterables of the iterations from the index from on with the streams or arrays of their elements.
+// an iterable still unknown is assumed to be an array.
+func (c *checker) settle(from int) {
+	for _, it := range c.iterations[from:] {
+		c.iterate(it.node, it.iterable, it.element)
+	}
+	c.iterations = c.iterations[:from]
+}
+
+// iterate unifies iterable with the stream of element if it is known to be a stream, and with the array of element otherwise.
+func (c *checker) iterate(node ast.Node, iterable Type, element *Variable) {
+	if _, ok := prune(iterable).(*Stream); ok {
+		c.expect(node, iterable, &Stream{Element: element})
+	} else {
+		c.expect(node, iterable, &Array{Element: element})
+	}
+}
+
+// bind binds name to t in the current scope without generalizing it, as parameters are bound.
+func (c *checker) bind(name string, t Type) {
+	c.scope.bindings[name] = &Scheme{body: t}
+}
+
+// lookup returns the type of name, or nil if it is not declared.
+func (c *checker) lookup(name string) Type {
+	for s := c.scope; s != nil; s = s.outer {
+		if scheme, ok := s.bindings[name]; ok {
+			return c.instantiate(scheme)
+		}
+		if p, ok := s.placeholders[name]; ok {
+			p.used = true
+			return p.variable
+		}
+	}
+	return c.builtin(name)
+}
+
+func (c *checker) generalize(t Type) *Scheme {
+	c.restrictChannels(t)
+	scheme := &Scheme{body: t}
+	seen := make(map[*Variable]bool)
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Variable:
+			if t.level > c.level && !seen[t] {
+				seen[t] = true
+				scheme.variables = append(scheme.variables, t)
+			}
+		case *Array:
+			collect(t.Element)
+		case *Stream:
+			collect(t.Element)
+		case *Task:
+			collect(t.Value)
+		case *Channel:
+			collect(t.Element)
+		case *Function:
+			for _, parameter := range t.Parameters {
+				collect(parameter)
+			}
+			collect(t.Return)
+		}
+	}
+	collect(t)
+	return scheme
+}
+
+// restrictChannels keeps the types of the elements of the channels in t from being generalized, lowering the levels
+// of their variables, since the values sent to a channel and received from it must be of the same type.
+// the channels made by a function are made for each call, and are generalized as the other types.
+func (c *checker) restrictChannels(t Type) {
+	switch t := prune(t).(type) {
+	case *Array:
+		c.restrictChannels(t.Element)
+	case *Stream:
+		c.restrictChannels(t.Element)
+	case *Task:
+		c.restrictChannels(t.Value)
+	case *Channel:
+		occurs(&Variable{level: c.level}, t.Element)
+	}
+}
+
+func (c *checker) instantiate(scheme *Scheme) Type {
+	if len(scheme.variables) == 0 {
+		return scheme.body
+	}
+	fresh := make(map[*Variable]Type)
+	for _, v := range scheme.variables {
+		fresh[v] = c.newVariable()
+	}
+	var copy func(t Type) Type
+	copy = func(t Type) Type {
+		switch t := prune(t).(type) {
+		case *Variable:
+			if v, ok := fresh[t]; ok {
+				return v
+			}
+			return t
+		case *Array:
+			return &Array{Element: copy(t.Element)}
+		case *Stream:
+			return &Stream{Element: copy(t.Element)}
+		case *Task:
+			return &Task{Value: copy(t.Value)}
+		case *Channel:
+			return &Channel{Element: copy(t.Element)}
+		case *Function:
+			parameters := make([]Type, len(t.Parameters))
+			for i, parameter := range t.Parameters {
+				parameters[i] = copy(parameter)
+			}
+			return &Function{Parameters: parameters, Return: copy(t.Return)}
+		default:
+			return t
+		}
+	}
+	return copy(scheme.body)
+}
+
+// builtin returns the type of the builtin function name, or nil if there is no such function.
+func (c *checker) builtin(name string) Type {
+	a, b := c.newVariable(), c.newVariable()
+	switch name {
+	case "puts":
+		return &Function{Parameters: []Type{a}, Return: NULL}
+	case "len":
+		return &Function{Parameters: []Type{&Array{Element: a}}, Return: INT}
+	case "error":
+		return &Function{Parameters: []Type{STRING}, Return: ERROR}
+	case "source":
+		return &Function{Parameters: []Type{QUOTE}, Return: STRING}
+	case "map":
+		return &Function{
+			Parameters: []Type{&Array{Element: a}, &Function{Parameters: []Type{a}, Return: b}},
+			Return:     &Array{Element: b},
+		}
+	case "filter":
+		return &Function{
+			Parameters: []Type{&Array{Element: a}, &Function{Parameters: []Type{a}, Return: b}},
+			Return:     &Array{Element: a},
+		}
+	case "reduce":
+		return &Function{
+			Parameters: []Type{&Array{Element: a}, b, &Function{Parameters: []Type{b, a}, Return: b}},
+			Return:     b,
+		}
+	case "take":
+		return &Function{Parameters: []Type{&Array{Element: a}, INT}, Return: &Array{Element: a}}
+	case "to_array":
+		return &Function{Parameters: []Type{&Array{Element: a}}, Return: &Array{Element: a}}
+	case "iterate":
+		return &Function{Parameters: []Type{a, &Function{Parameters: []Type{a}, Return: a}}, Return: &Stream{Element: a}}
+	case "range_from":
+		return &Function{Parameters: []Type{INT}, Return: &Stream{Element: INT}}
+	case "spawn":
+		return &Function{Parameters: []Type{&Function{Return: a}}, Return: &Task{Value: a}}
+	case "wait":
+		return &Function{Parameters: []Type{&Task{Value: a}}, Return: a}
+	case "channel":
+		return &Function{Parameters: []Type{INT}, Return: &Channel{Element: a}}
+	case "send":
+		return &Function{Parameters: []Type{&Channel{Element: a}, a}, Return: NULL}
+	case "recv":
+		return &Function{Parameters: []Type{&Channel{Element: a}}, Return: a}
+	case "close":
+		return &Function{Parameters: []Type{&Channel{Element: a}}, Return: NULL}
+	default:
+		return nil
+	}
+}
+
+// streamBuiltin returns the type of the builtin function taking an array or a stream as the first argument,
+// if it is called with an argument known to be a stream, or nil otherwise. builtin returns the types for arrays.
+func (c *checker) streamBuiltin(function ast.Expression, types []Type) Type {
+	if len(types) == 0 {
+		return nil
+	}
+	stream, ok := prune(types[0]).(*Stream)
+	if !ok {
+		return nil
+	}
+	a, b := stream.Element, c.newVariable()
+	switch {
+	case c.isBuiltin(function, "map"):
+		return &Function{Parameters: []Type{stream, &Function{Parameters: []Type{a}, Return: b}}, Return: &Stream{Element: b}}
+	case c.isBuiltin(function, "filter"):
+		return &Function{Parameters: []Type{stream, &Function{Parameters: []Type{a}, Return: b}}, Return: stream}
+	case c.isBuiltin(function, "reduce"):
+		return &Function{Parameters: []Type{stream, b, &Function{Parameters: []Type{b, a}, Return: b}}, Return: b}
+	case c.isBuiltin(function, "take"):
+		return &Function{Parameters: []Type{stream, INT}, Return: &Array{Element: a}}
+	case c.isBuiltin(function, "to_array"):
+		return &Function{Parameters: []Type{stream}, Return: &Array{Element: a}}
+	default:
+		return nil
+	}
+}
+
+// isBuiltin reports whether name refers to the builtin function, not shadowed by a declaration.
+func (c *checker) isBuiltin(expression ast.Expression, name string) bool {
+	identifier, ok := expression.(*ast.Identifier)
+	if !ok || identifier.Name != name {
+		return false
+	}
+	for s := c.scope; s != nil; s = s.outer {
+		if _, ok := s.bindings[name]; ok {
+			return false
+		}
+		if _, ok := s.placeholders[name]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *checker) check(node ast.Node) Type {
+	switch node := node.(type) {
+	case *ast.Program:
+		c.hoist(node)
+		c.returns = append(c.returns, c.newVariable())
+		c.yields = append(c.yields, nil)
+		t := c.checkStatements(node.Statements)
+		c.returns = c.returns[:len(c.returns)-1]
+		c.yields = c.yields[:len(c.yields)-1]
+		return t
+	case *ast.BlockStatement:
+		return c.checkStatements(node.Statements)
+	case *ast.VarStatement:
+		c.level++
+		iterations := len(c.iterations)
+		t := c.check(node.Expression)
+		if node.Type != nil {
+			c.expect(node.Expression, t, c.annotated(node.Type, make(map[string]*Variable)))
+		}
+		c.level--
+		c.declare(node, node.Identifier.Name, t, iterations)
+		return NULL
+	case *ast.ReturnStatement:
+		t := c.check(node.Expression)
+		want := c.returns[len(c.returns)-1]
+		if !unify(want, t) {
+			c.errorf(node, "type of return value wrong in %s: want %s, got %s", node, want, t)
+		}
+		return c.newVariable()
+	case *ast.ThrowStatement:
+		c.check(node.Expression)
+		return c.newVariable()
+	case *ast.YieldStatement:
+		t := c.check(node.Expression)
+		element := c.yields[len(c.yields)-1]
+		if element == nil {
+			c.errorf(node, "yield outside generator function")
+		} else if !unify(element, t) {
+			c.errorf(node, "type of yielded value wrong in %s: want %s, got %s", node, element, t)
+		}
+		return NULL
+	case *ast.ExpressionStatement:
+		return c.check(node.Expression)
+	case *ast.Identifier:
+		if t := c.lookup(node.Name); t != nil {
+			return t
+		}
+		c.errorf(node, "undefined identifier: %q", node.Name)
+		return c.newVariable()
+	case *ast.IntegerLiteral:
+		return INT
+	case *ast.BooleanLiteral:
+		return BOOL
+	case *ast.StringLiteral:
+		return STRING
+	case *ast.PrefixExpression:
+		return c.checkPrefixExpression(node)
+	case *ast.InfixExpression:
+		return c.checkInfixExpression(node)
+	case *ast.FunctionLiteral:
+		return c.checkFunction(node)
+	case *ast.MacroLiteral:
+		// macros are expanded before checking. the ones left are not checked, as they are not called.
+		return c.newVariable()
+	case *ast.FunctionCall:
+		if c.isBuiltin(node.Function, "quote") && len(node.Arguments) == 1 {
+			c.checkQuote(node.Arguments[0])
+			return QUOTE
+		}
+		return c.checkCall(node, node.Function, node.Arguments)
+	case *ast.MethodCall:
+		arguments := append([]ast.Expression{node.Receiver}, node.Arguments...)
+		return c.checkCall(node, node.Method, arguments)
+	case *ast.ArrayLiteral:
+		element := c.newVariable()
+		for _, e := range node.Elements {
+			c.expect(e, c.check(e), element)
+		}
+		return &Array{Element: element}
+	case *ast.ArrayComprehension:
+		for _, clause := range node.Clauses {
+			// a clause iterates a stream as well as an array. an iterable not known yet is settled later.
+			variable := c.newVariable()
+			iterable := c.check(clause.Iterable)
+			if _, ok := prune(iterable).(*Variable); ok {
+				c.iterations = append(c.iterations, iteration{node: clause.Iterable, iterable: iterable, element: variable})
+			} else {
+				c.iterate(clause.Iterable, iterable, variable)
+			}
+			c.enter()
+			c.bind(clause.Variable.Name, variable)
+			// a condition is true unless it is false or null, so it may be of any type.
+			if clause.Condition != nil {
+				c.check(clause.Condition)
+			}
+		}
+		element := c.check(node.Element)
+		for range node.Clauses {
+			c.leave()
+		}
+		return &Array{Element: element}
+	case *ast.IndexExpression:
+		element := c.newVariable()
+		c.expect(node.Array, c.check(node.Array), &Array{Element: element})
+		c.expect(node.Index, c.check(node.Index), INT)
+		return element
+	case *ast.FieldExpression:
+		c.expect(node.Object, c.check(node.Object), ERROR)
+		switch node.Field.Name {
+		case "message", "kind":
+			return STRING
+		case "line":
+			return INT
+		default:
+			c.errorf(node, "unknown field for error: %q", node.Field.Name)
+			return c.newVariable()
+		}
+	case *ast.IfExpression:
+		// a condition is true unless it is false or null, so it may be of any type.
+		c.check(node.Condition)
+		consequence := c.check(node.Consequence)
+		if node.Alternative == nil {
+			return NULL
+		}
+		alternative := c.check(node.Alternative)
+		if !unify(consequence, alternative) {
+			c.errorf(node, "branches of if have different types: %s and %s", consequence, alternative)
+		}
+		return consequence
+	case *ast.TryExpression:
+		body := c.check(node.Body)
+		c.enter()
+		c.hoist(node.Handler)
+		c.bind(node.Parameter.Name, ERROR)
+		handler := c.check(node.Handler)
+		c.leave()
+		if !unify(body, handler) {
+			c.errorf(node, "try and catch have different types: %s and %s", body, handler)
+		}
+		return body
+	default:
+		return c.newVariable()
+	}
+}
+
+// checkStatements returns the type of the last statement, or null if there is none.
+func (c *checker) checkStatements(statements []ast.Statement) Type {
+	var t Type = NULL
+	for _, statement := range statements {
+		t = c.check(statement)
+	}
+	return t
+}
+
+func (c *checker) checkPrefixExpression(node *ast.PrefixExpression) Type {
+	right := c.check(node.Right)
+	switch node.Operator {
+	case "-":
+		c.expect(node, right, INT)
+		return INT
+	case "!":
+		// like the evaluator, ! is false for an integer and negates a boolean.
+		c.negations = append(c.negations, negation{node: node, operand: right})
+		return BOOL
+	default:
+		c.errorf(node, "unknown prefix operator: %q", node.Operator)
+		return c.newVariable()
+	}
+}
+
+// checkNegations reports the operands of ! which turn out to be neither integers nor booleans.
+// an operand still unknown, such as the parameter of a polymorphic function, is accepted.
+func (c *checker) checkNegations() {
+	for _, n := range c.negations {
+		switch t := prune(n.operand); t {
+		case INT, BOOL:
+		default:
+			if _, ok := t.(*Variable); !ok {
+				c.errorf(n.node, "type mismatch in %s: want int or bool, got %s", n.node, t)
+			}
+		}
+	}
+}
+
+func (c *checker) checkInfixExpression(node *ast.InfixExpression) Type {
+	left, right := c.check(node.Left), c.check(node.Right)
+	switch node.Operator {
+	case "+":
+		// + concatenates strings if either side is known to be a string, and adds integers otherwise.
+		operand := INT
+		if prune(left) == STRING || prune(right) == STRING {
+			operand = STRING
+		}
+		c.expect(node, left, operand)
+		c.expect(node, right, operand)
+		return operand
+	case "-", "*", "/", "%":
+		c.expect(node, left, INT)
+		c.expect(node, right, INT)
+		return INT
+	case "<", ">":
+		c.expect(node, left, INT)
+		c.expect(node, right, INT)
+		return BOOL
+	case "==", "!=":
+		c.expect(node, right, left)
+		return BOOL
+	default:
+		c.errorf(node, "unknown infix operator: %q", node.Operator)
+		return c.newVariable()
+	}
+}
+
+func (c *checker) checkFunction(node *ast.FunctionLiteral) Type {
+	// the type variables in the annotations of a function are shared by its parameters and return value.
+	names := make(map[string]*Variable)
+	function := &Function{Return: c.newVariable()}
+	if node.ReturnType != nil {
+		function.Return = c.annotated(node.ReturnType, names)
+	}
+	c.enter()
+	for i, parameter := range node.Parameters {
+		var t Type = c.newVariable()
+		if annotation := node.ParameterType(i); annotation != nil {
+			t = c.annotated(annotation, names)
+		}
+		function.Parameters = append(function.Parameters, t)
+		c.bind(parameter.Name, t)
+	}
+	body := node.Body
+	c.hoist(body)
+
+	// a generator returns the stream of the values yielded, discarding the value of the body and the ones returned.
+	// the stream is known before the body is checked, so that the recursive calls in the body are iterated as a stream.
+	if ast.Yields(body) {
+		element := c.newVariable()
+		if stream := (&Stream{Element: element}); !unify(function.Return, stream) {
+			c.errorf(body, "type of return value wrong: want %s, got %s", function.Return, stream)
+		}
+		c.returns = append(c.returns, c.newVariable())
+		c.yields = append(c.yields, element)
+		c.check(body)
+	} else {
+		c.returns = append(c.returns, function.Return)
+		c.yields = append(c.yields, nil)
+		t := c.check(body)
+		if !unify(function.Return, t) {
+			c.errorf(body, "type of return value wrong: want %s, got %s", function.Return, t)
+		}
+	}
+	c.returns = c.returns[:len(c.returns)-1]
+	c.yields = c.yields[:len(c.yields)-1]
+	c.leave()
+	return function
+}
+
+// annotated returns the type written as annotation. names holds the type variables by their names.
+func (c *checker) annotated(annotation ast.TypeAnnotation, names map[string]*Variable) Type {
+	switch annotation := annotation.(type) {
+	case *ast.NamedType:
+		for _, constant := range []*Constant{INT, BOOL, STRING, NULL, ERROR, QUOTE} {
+			if annotation.Name == constant.Name {
+				return constant
+			}
+		}
+		if _, ok := names[annotation.Name]; !ok {
+			names[annotation.Name] = c.newVariable()
+		}
+		return names[annotation.Name]
+	case *ast.ArrayType:
+		return &Array{Element: c.annotated(annotation.Element, names)}
+	case *ast.FunctionType:
+		function := &Function{Return: c.annotated(annotation.Return, names)}
+		for _, parameter := range annotation.Parameters {
+			function.Parameters = append(function.Parameters, c.annotated(parameter, names))
+		}
+		return function
+	default:
+		return c.newVariable()
+	}
+}
+
+// checkCall infers the type of a call as the type of the function applied to the arguments.
+// an arrow expression is a call as well, so it is checked the same way.
+func (c *checker) checkCall(node ast.Node, function ast.Expression, arguments []ast.Expression) Type {
+	types := make([]Type, len(arguments))
+	for i, argument := range arguments {
+		types[i] = c.check(argument)
+	}
+
+	// puts and error take a variable number of arguments, which a function type cannot express.
+	switch {
+	case c.isBuiltin(function, "puts"):
+		return NULL
+	case c.isBuiltin(function, "error"):
+		if len(arguments) != 1 && len(arguments) != 2 {
+			c.errorf(node, "number of arguments for error wrong in %s: want 1 or 2, got %d", node, len(arguments))
+		}
+		for i, t := range types {
+			c.expect(arguments[i], t, STRING)
+		}
+		return ERROR
+	}
+
+	// map, filter, reduce, take and to_array take a stream as well as an array, which a function type cannot express either.
+	t := c.streamBuiltin(function, types)
+	if t == nil {
+		t = c.check(function)
+	}
+	switch f := prune(t).(type) {
+	case *Function:
+		if len(f.Parameters) != len(arguments) {
+			c.errorf(node, "number of arguments for %s wrong in %s: want %d, got %d", function, node, len(f.Parameters), len(arguments))
+			return f.Return
+		}
+		for i, parameter := range f.Parameters {
+			if !unify(parameter, types[i]) {
+				c.errorf(arguments[i], "argument %d of %s wrong in %s: want %s, got %s", i+1, function, node, parameter, types[i])
+			}
+		}
+		return f.Return
+	default:
+		result := c.newVariable()
+		want := &Function{Parameters: types, Return: result}
+		if !unify(want, f) {
+			c.errorf(node, "type of %s wrong in %s: want %s, got %s", function, node, want, f)
+		}
+		return result
+	}
+}
+
+// checkQuote checks only the arguments of the unquote calls in quoted code, since the rest is not evaluated.
+func (c *checker) checkQuote(quoted ast.Node) {
+	ast.Inspect(quoted, func(node ast.Node) bool {
+		if functionCall, ok := node.(*ast.FunctionCall); ok && c.isBuiltin(functionCall.Function, "unquote") && len(functionCall.Arguments) == 1 {
+			c.check(functionCall.Arguments[0])
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,192 @@
+package types
+
+import (
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/parser"
+	"reflect"
+	"testing"
+)
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("err occurred: %s", err)
+	}
+	return program
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{desc: "integer", input: "1 + 2 * 3", expected: "int"},
+		{desc: "boolean", input: "!(1 < 2) == true", expected: "bool"},
+		{desc: "string", input: `"a" + "b"`, expected: "string"},
+		{desc: "var statement", input: "var x = 1", expected: "null"},
+		{desc: "array", input: "[1, 2][0]", expected: "int"},
+		{desc: "empty array", input: "[]", expected: "[a]"},
+		{desc: "identity", input: "|x| { x }", expected: "|a| -> a"},
+		{desc: "function", input: "|x, y| { if (x) { y } else { 0 } }", expected: "|a, int| -> int"},
+		{desc: "truthiness", input: `[!5, !x, if (1) { true } else { false }] -> filter(|b| { [b] }); var x = [n for n in [1] if 1][0]; !true`, expected: "bool"},
+		{desc: "negation", input: "|x| { !x }", expected: "|a| -> bool"},
+		{desc: "return", input: "|n| { if (n < 0) { return true } false }", expected: "|int| -> bool"},
+		{desc: "let polymorphism", input: "var id = |x| { x }; [id(1) + 1] -> map(|b| { id(b > 0) })", expected: "[bool]"},
+		{desc: "recursion", input: "var fact = |n| { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact", expected: "|int| -> int"},
+		{desc: "used before declared", input: "var f = || { g(1) }; var g = |x| { x > 0 }; f", expected: "|| -> bool"},
+		{desc: "map", input: "|xs| { xs -> map(|x| { x * 2 }) }", expected: "|[int]| -> [int]"},
+		{desc: "filter", input: "[1, 2].filter(|x| { x > 1 })", expected: "[int]"},
+		{desc: "reduce", input: "|xs, f| { reduce(xs, true, f) }", expected: "|[a], (|bool, a| -> bool)| -> bool"},
+		{desc: "len", input: "len", expected: "|[a]| -> int"},
+		{desc: "comprehension", input: `var xs = []; [x + "!" for x in xs for y in [1] if y > 0]`, expected: "[string]"},
+		{desc: "if without else", input: "if (true) { 1 }", expected: "null"},
+		{desc: "try", input: "try { throw 1 } catch (e) { e.message }", expected: "string"},
+		{desc: "error", input: `error("a", "b")`, expected: "error"},
+		{desc: "puts", input: `puts(1, true, "a")`, expected: "null"},
+		{desc: "annotation", input: "|xs: [a], f: |a| -> b| -> [b] { xs -> map(f) }", expected: "|[a], (|a| -> b)| -> [b]"},
+		{desc: "annotated var", input: "var xs: [int] = []; xs", expected: "[int]"},
+		{desc: "quote", input: "var x = 1; quote(a + unquote(x + 1))", expected: "quote"},
+		{desc: "stream", input: "range_from(1) -> filter(|x| { x % 2 == 0 }) -> map(|x| { x > 2 })", expected: "stream[bool]"},
+		{desc: "iterate", input: `iterate("a", |s| { s + "b" }) -> take(3)`, expected: "[string]"},
+		{desc: "reduce stream", input: "range_from(1) -> reduce(0, |acc, x| { acc + x })", expected: "int"},
+		{desc: "to_array", input: "|xs| { to_array(xs)[0] + 1 }", expected: "|[int]| -> int"},
+		{desc: "generator", input: `|n| { yield n; yield n + 1 }`, expected: "|int| -> stream[int]"},
+		{desc: "generator in comprehension", input: `var g = || { yield "a" }; [s + "!" for s in g()]`, expected: "[string]"},
+		{desc: "recursive generator", input: "var g = |n| { yield n; [if (true) { yield x } for x in g(n + 1)] }; g", expected: "|int| -> stream[int]"},
+		{desc: "iterable settled", input: "|xs| { [x + 1 for x in xs] }", expected: "|[int]| -> [int]"},
+		{desc: "spawn", input: `spawn(|| { "a" })`, expected: "task[string]"},
+		{desc: "wait", input: "var t = spawn(|| { [1, 2] }); wait(t)[0] + 1", expected: "int"},
+		{desc: "channel", input: "var ch = channel(1); send(ch, true); ch", expected: "channel[bool]"},
+		{desc: "recv", input: "|ch| { recv(ch) + 1 }", expected: "|channel[int]| -> int"},
+		{desc: "channel made by function", input: `var make = || { channel(0) }; send(make(), 1); send(make(), "a"); make`, expected: "|| -> channel[a]"},
+		{desc: "generic task", input: "var run = |f| { wait(spawn(f)) }; [run(|| { 1 }), run(|| { 2 })]", expected: "[int]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			actual, errors := Check(parseProgram(t, tt.input))
+			if len(errors) > 0 {
+				t.Fatalf("type errors occurred: %v", errors)
+			}
+			if actual.String() != tt.expected {
+				t.Errorf("type wrong.\nwant=%s\ngot=%s\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheck_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected []string
+	}{
+		{
+			desc:     "stream element",
+			input:    `range_from(1) -> map(|x| { x + "!" })`,
+			expected: []string{`line 1: argument 2 of map wrong in (range_from(1) -> map(|x| {(x + "!");})): want |int| -> a, got |string| -> string`},
+		},
+		{
+			desc:     "yielded value",
+			input:    "|| { yield 1; yield true }",
+			expected: []string{"line 1: type of yielded value wrong in yield true;: want int, got bool"},
+		},
+		{
+			desc:     "yield outside generator",
+			input:    "yield 1",
+			expected: []string{"line 1: yield outside generator function"},
+		},
+		{
+			desc:     "channel element",
+			input:    `var ch = channel(0); send(ch, 1); send(ch, "a")`,
+			expected: []string{`line 1: argument 2 of send wrong in send(ch, "a"): want int, got string`},
+		},
+		{
+			desc:     "spawn function",
+			input:    "spawn(|x| { x })",
+			expected: []string{"line 1: argument 1 of spawn wrong in spawn(|x| {x;}): want || -> a, got |a| -> a"},
+		},
+		{
+			desc:     "infix",
+			input:    "5 + true",
+			expected: []string{"line 1: type mismatch in (5 + true): want int, got bool"},
+		},
+		{
+			desc:     "builtin argument",
+			input:    "len(3)",
+			expected: []string{"line 1: argument 1 of len wrong in len(3): want [a], got int"},
+		},
+		{
+			desc:     "arrow",
+			input:    `[1] -> map(|x| { x + "!" })`,
+			expected: []string{`line 1: argument 2 of map wrong in ([1] -> map(|x| {(x + "!");})): want |int| -> a, got |string| -> string`},
+		},
+		{
+			desc:     "negation",
+			input:    `!"a"; [[1]] -> map(|x| { !x })`,
+			expected: []string{`line 1: type mismatch in (!"a"): want int or bool, got string`, "line 1: type mismatch in (!x): want int or bool, got [int]"},
+		},
+		{
+			desc:     "not executed",
+			input:    "if (false) {\n  puts(1 - \"a\")\n}",
+			expected: []string{`line 2: type mismatch in (1 - "a"): want int, got string`},
+		},
+		{
+			desc:  "multiple errors",
+			input: "var f = |x| { x + 1 }\nf(true)\nf(1, 2)\n1(2)",
+			expected: []string{
+				"line 2: argument 1 of f wrong in f(true): want int, got bool",
+				"line 3: number of arguments for f wrong in f(1, 2): want 1, got 2",
+				"line 4: type of 1 wrong in 1(2): want |int| -> a, got int",
+			},
+		},
+		{
+			desc:     "branches",
+			input:    "if (true) { 1 } else { false }",
+			expected: []string{"line 1: branches of if have different types: int and bool"},
+		},
+		{
+			desc:     "array elements",
+			input:    `[1, "a"]`,
+			expected: []string{`line 1: type mismatch in "a": want int, got string`},
+		},
+		{
+			desc:     "infinite type",
+			input:    "|f| { f(f) }",
+			expected: []string{"line 1: type of f wrong in f(f): want |a| -> b, got a"},
+		},
+		{
+			desc:     "field",
+			input:    "try { 1 } catch (e) { e.name }",
+			expected: []string{`line 1: unknown field for error: "name"`},
+		},
+		{
+			desc:  "annotation",
+			input: "var f = |x: string| -> int { x }\nvar n: bool = f(\"a\")",
+			expected: []string{
+				"line 1: type of return value wrong: want int, got string",
+				`line 2: type mismatch in f("a"): want bool, got int`,
+			},
+		},
+		{
+			desc:     "undefined",
+			input:    "x",
+			expected: []string{`line 1: undefined identifier: "x"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, errors := Check(parseProgram(t, tt.input))
+			actual := []string{}
+			for _, err := range errors {
+				actual = append(actual, err.Error())
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("type errors wrong.\nwant=%q\ngot=%q\n", tt.expected, actual)
+			}
+		})
+	}
+}
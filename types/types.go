@@ -0,0 +1,221 @@
+package types
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Type is the static type of an expression.
+type Type interface {
+	String() string
+}
+
+// Constant is a type without parameters.
+type Constant struct {
+	Name string
+}
+
+func (c *Constant) String() string { return c.Name }
+
+var (
+	INT    = &Constant{Name: "int"}
+	BOOL   = &Constant{Name: "bool"}
+	STRING = &Constant{Name: "string"}
+	NULL   = &Constant{Name: "null"}
+	ERROR  = &Constant{Name: "error"} // the value caught by try-catch or made by error()
+	QUOTE  = &Constant{Name: "quote"}
+)
+
+// Array is the type of arrays whose elements are of type Element.
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return typeString(a) }
+
+// Stream is the type of lazy sequences whose elements are of type Element. it is written as stream[int].
+type Stream struct {
+	Element Type
+}
+
+func (s *Stream) String() string { return typeString(s) }
+
+// Task is the type of tasks spawned by functions returning a value of type Value. it is written as task[int].
+type Task struct {
+	Value Type
+}
+
+func (t *Task) String() string { return typeString(t) }
+
+// Channel is the type of channels sending values of type Element. it is written as channel[int].
+type Channel struct {
+	Element Type
+}
+
+func (c *Channel) String() string { return typeString(c) }
+
+// Function is the type of functions. it is written as |int, bool| -> int, parenthesizing the parameters of function types.
+type Function struct {
+	Parameters []Type
+	Return     Type
+}
+
+func (f *Function) String() string { return typeString(f) }
+
+// Variable is a type not known yet. it becomes its instance once unified with another type.
+type Variable struct {
+	level    int // the depth of the var statements the variable is made in, used for generalization
+	instance Type
+}
+
+func (v *Variable) String() string { return typeString(v) }
+
+// Scheme is a polymorphic type, which is instantiated with fresh variables for each use.
+type Scheme struct {
+	variables []*Variable
+	body      Type
+}
+
+// prune returns the type t stands for, following the instances of variables.
+func prune(t Type) Type {
+	if v, ok := t.(*Variable); ok && v.instance != nil {
+		v.instance = prune(v.instance)
+		return v.instance
+	}
+	return t
+}
+
+// unify makes a and b the same type, binding the variables in them. it reports whether they could be unified.
+func unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if v, ok := a.(*Variable); ok {
+		if a == b {
+			return true
+		}
+		if occurs(v, b) {
+			return false
+		}
+		v.instance = b
+		return true
+	}
+	if _, ok := b.(*Variable); ok {
+		return unify(b, a)
+	}
+
+	switch a := a.(type) {
+	case *Constant:
+		return a == b
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && unify(a.Element, b.Element)
+	case *Stream:
+		b, ok := b.(*Stream)
+		return ok && unify(a.Element, b.Element)
+	case *Task:
+		b, ok := b.(*Task)
+		return ok && unify(a.Value, b.Value)
+	case *Channel:
+		b, ok := b.(*Channel)
+		return ok && unify(a.Element, b.Element)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !unify(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return unify(a.Return, b.Return)
+	}
+	return false
+}
+
+// occurs reports whether v is in t. it also lowers the levels of the variables in t to the level of v,
+// since they are bound together.
+func occurs(v *Variable, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if t == v {
+			return true
+		}
+		if t.level > v.level {
+			t.level = v.level
+		}
+	case *Array:
+		return occurs(v, t.Element)
+	case *Stream:
+		return occurs(v, t.Element)
+	case *Task:
+		return occurs(v, t.Value)
+	case *Channel:
+		return occurs(v, t.Element)
+	case *Function:
+		for _, parameter := range t.Parameters {
+			if occurs(v, parameter) {
+				return true
+			}
+		}
+		return occurs(v, t.Return)
+	}
+	return false
+}
+
+// typeString writes t naming its variables a, b, c, ... in the order they appear.
+func typeString(t Type) string {
+	var out bytes.Buffer
+	names := make(map[*Variable]string)
+	var write func(t Type)
+	write = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Constant:
+			out.WriteString(t.Name)
+		case *Array:
+			out.WriteString("[")
+			write(t.Element)
+			out.WriteString("]")
+		case *Stream:
+			out.WriteString("stream[")
+			write(t.Element)
+			out.WriteString("]")
+		case *Task:
+			out.WriteString("task[")
+			write(t.Value)
+			out.WriteString("]")
+		case *Channel:
+			out.WriteString("channel[")
+			write(t.Element)
+			out.WriteString("]")
+		case *Function:
+			out.WriteString("|")
+			for i, parameter := range t.Parameters {
+				if i > 0 {
+					out.WriteString(", ")
+				}
+				if _, ok := prune(parameter).(*Function); ok {
+					out.WriteString("(")
+					write(parameter)
+					out.WriteString(")")
+				} else {
+					write(parameter)
+				}
+			}
+			out.WriteString("| -> ")
+			write(t.Return)
+		case *Variable:
+			name, ok := names[t]
+			if !ok {
+				name = variableName(len(names))
+				names[t] = name
+			}
+			out.WriteString(name)
+		}
+	}
+	write(t)
+	return out.String()
+}
+
+func variableName(i int) string {
+	return strings.Repeat(string(rune('a'+i%26)), i/26+1)
+}
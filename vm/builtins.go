@@ -0,0 +1,193 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/evaluator"
+	"github.com/muiscript/ether/object"
+)
+
+// the builtin functions taking a function are defined for the closures of the VM, and so are the ones of the tasks
+// for the scheduler of the VM. the others are the ones of package evaluator.
+
+func (vm *VM) builtinMap(args ...object.Object) (object.Object, error) {
+	if len(args) != 2 {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("number of arguments for map wrong: want=%d got=%d\n", 2, len(args)), evaluator.ARGUMENT_ERROR)
+	}
+	array, ok := args[0].(*object.Array)
+	stream, isStream := args[0].(*object.Stream)
+	if !ok && !isStream {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("first argument type for map wrong: want=%T or %T\ngot=%T\n", &object.Array{}, &object.Stream{}, args[0]), evaluator.TYPE_ERROR)
+	}
+	closure, ok := args[1].(*object.Closure)
+	if !ok {
+		return nil, evaluator.NotFunctionError("map", "second argument", args[1])
+	}
+	if count := len(closure.Function.Literal.Parameters); count != 1 {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("number of parameters of map function wrong: want=%d\ngot=%d\n", 1, count), evaluator.ARGUMENT_ERROR)
+	}
+	if isStream {
+		return evaluator.MapStream(stream, closure), nil
+	}
+
+	var convertedElems []object.Object
+	for _, elem := range array.Elements {
+		if err := vm.checkContext(callLine(nil, closure)); err != nil {
+			return nil, err
+		}
+		evaluated, err := vm.apply(closure, elem)
+		if err != nil {
+			return nil, err
+		}
+		convertedElems = append(convertedElems, evaluated)
+	}
+
+	return &object.Array{Elements: convertedElems}, nil
+}
+
+func (vm *VM) builtinFilter(args ...object.Object) (object.Object, error) {
+	if len(args) != 2 {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("number of arguments for filter wrong: want=%d got=%d\n", 2, len(args)), evaluator.ARGUMENT_ERROR)
+	}
+	array, ok := args[0].(*object.Array)
+	stream, isStream := args[0].(*object.Stream)
+	if !ok && !isStream {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("first argument type for filter wrong: want=%T or %T\ngot=%T\n", &object.Array{}, &object.Stream{}, args[0]), evaluator.TYPE_ERROR)
+	}
+	closure, ok := args[1].(*object.Closure)
+	if !ok {
+		return nil, evaluator.NotFunctionError("filter", "second argument", args[1])
+	}
+	if count := len(closure.Function.Literal.Parameters); count != 1 {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("number of parameters of filter function wrong: want=%d\ngot=%d\n", 1, count), evaluator.ARGUMENT_ERROR)
+	}
+	if isStream {
+		return evaluator.FilterStream(stream, closure), nil
+	}
+
+	var filteredElems []object.Object
+	for _, elem := range array.Elements {
+		if err := vm.checkContext(callLine(nil, closure)); err != nil {
+			return nil, err
+		}
+		evaluated, err := vm.apply(closure, elem)
+		if err != nil {
+			return nil, err
+		}
+		if evaluated != evaluator.NULL_OBJ && evaluated != evaluator.FALSE_OBJ {
+			filteredElems = append(filteredElems, elem)
+		}
+	}
+
+	return &object.Array{Elements: filteredElems}, nil
+}
+
+func (vm *VM) builtinReduce(args ...object.Object) (object.Object, error) {
+	if len(args) != 3 {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("number of arguments for reduce wrong: want=%d got=%d\n", 3, len(args)), evaluator.ARGUMENT_ERROR)
+	}
+	next, stop, ok := evaluator.Iterate(args[0], vm.callback)
+	if !ok {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("first argument type for reduce wrong: want=%T or %T\ngot=%T\n", &object.Array{}, &object.Stream{}, args[0]), evaluator.TYPE_ERROR)
+	}
+	defer stop()
+	closure, ok := args[2].(*object.Closure)
+	if !ok {
+		return nil, evaluator.NotFunctionError("reduce", "third argument", args[2])
+	}
+	if count := len(closure.Function.Literal.Parameters); count != 2 {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("number of parameters of reduce function wrong: want=%d\ngot=%d\n", 2, count), evaluator.ARGUMENT_ERROR)
+	}
+
+	var accumulated = args[1]
+	for {
+		elem, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if err := vm.checkContext(callLine(nil, closure)); err != nil {
+			return nil, err
+		}
+		evaluated, err := vm.apply(closure, accumulated, elem)
+		if err != nil {
+			return nil, err
+		}
+		accumulated = evaluated
+	}
+
+	return accumulated, nil
+}
+
+func (vm *VM) builtinTake(args ...object.Object) (object.Object, error) {
+	return evaluator.Take(vm.callback, vm.checkElement, args...)
+}
+
+func (vm *VM) builtinToArray(args ...object.Object) (object.Object, error) {
+	return evaluator.ToArray(vm.callback, vm.checkElement, args...)
+}
+
+// callback calls a function of a stream iterated by vm, checking the context as the builtin functions do for each element.
+func (vm *VM) callback(function object.Object, args ...object.Object) (object.Object, error) {
+	closure := function.(*object.Closure)
+	if err := vm.checkContext(callLine(nil, closure)); err != nil {
+		return nil, err
+	}
+	return vm.apply(closure, args...)
+}
+
+// checkElement checks the context for an element collected from a stream.
+// the cancellation is located at the call of the builtin function by evaluator.TracedBuiltin.
+func (vm *VM) checkElement() error {
+	return vm.checkContext(0)
+}
+
+func (vm *VM) builtinSpawn(args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("number of arguments for spawn wrong: want=%d got=%d\n", 1, len(args)), evaluator.ARGUMENT_ERROR)
+	}
+	closure, ok := args[0].(*object.Closure)
+	if !ok {
+		return nil, evaluator.NotFunctionError("spawn", "argument", args[0])
+	}
+	if count := len(closure.Function.Literal.Parameters); count != 0 {
+		return nil, evaluator.NewEvalError(1, fmt.Sprintf("number of parameters of spawn function wrong: want=%d\ngot=%d\n", 0, count), evaluator.ARGUMENT_ERROR)
+	}
+
+	// the closure is executed by a VM of its own, sharing the context and the bytecode with vm, whose first frame is the call of it.
+	calls := vm.builtin.Push(nil, closure)
+	return evaluator.Spawn(vm.scheduler, closure, func() (value object.Object, err error) {
+		t := New(vm.bytecode)
+		t.ctx, t.scheduler = vm.ctx, vm.scheduler
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				value, err = nil, evaluator.Recovered(recovered, t.panicked())
+				t.truncate(0)
+			}
+		}()
+
+		if err := t.checkContext(callLine(nil, closure)); err != nil {
+			return nil, err
+		}
+		t.frames = append(t.frames, &frame{closure: closure, instructions: closure.Function.Instructions, scope: t.bind(closure, nil, nil)})
+		t.calls = append(t.calls, calls)
+		return t.run(0)
+	})
+}
+
+func (vm *VM) builtinWait(args ...object.Object) (object.Object, error) {
+	return evaluator.Wait(vm.scheduler, args...)
+}
+
+func (vm *VM) builtinSend(args ...object.Object) (object.Object, error) {
+	return evaluator.Send(vm.scheduler, args...)
+}
+
+func (vm *VM) builtinRecv(args ...object.Object) (object.Object, error) {
+	return evaluator.Recv(vm.scheduler, args...)
+}
+
+func (vm *VM) builtinClose(args ...object.Object) (object.Object, error) {
+	return evaluator.Close(vm.scheduler, args...)
+}
@@ -0,0 +1,51 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/evaluator"
+	"github.com/muiscript/ether/object"
+)
+
+// callGenerator calls the generator closure on the top of the stack with count arguments below it,
+// pushing the stream of the values yielded by its body in place of them, as evaluator.Eval does.
+// the call is made right away as the one of a builtin function, so the stream is traced from the frame calling it.
+func (vm *VM) callGenerator(call ast.Expression, closure *object.Closure, count int) error {
+	args := make([]object.Object, count)
+	copy(args, vm.stack[len(vm.stack)-count:])
+	vm.stack = vm.stack[:len(vm.stack)-count]
+
+	var calls *evaluator.CallStack
+	if call == nil {
+		calls = vm.builtin.Push(call, closure)
+	} else {
+		calls = vm.callStack(len(vm.frames)-1).Push(call, closure)
+	}
+	stream := vm.generate(calls, closure, args)
+	if returnType := closure.Function.Literal.ReturnType; call != nil && returnType != nil && !evaluator.Conforms(stream, returnType) {
+		return evaluator.NewEvalError(call.Line(), fmt.Sprintf("type of return value wrong in %s: want %s, got %s", call, returnType, evaluator.Describe(stream)), evaluator.TYPE_ERROR)
+	}
+	vm.push(stream)
+	return nil
+}
+
+// generate returns the stream of the generator closure called with args. the body is executed for each iteration
+// by a VM of its own, sharing the context and the bytecode with vm, whose first frame is the call of closure.
+// calls is the calls being executed by vm, up to the call of closure, from which the errors of the body are traced.
+func (vm *VM) generate(calls *evaluator.CallStack, closure *object.Closure, args []object.Object) *object.Stream {
+	return evaluator.NewGenerator(func(yield evaluator.Yield) (err error) {
+		g := New(vm.bytecode)
+		g.ctx, g.yield, g.scheduler = vm.ctx, yield, vm.scheduler
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = evaluator.Recovered(recovered, g.panicked())
+				g.truncate(0)
+			}
+		}()
+
+		g.frames = append(g.frames, &frame{closure: closure, instructions: closure.Function.Instructions, scope: g.bind(closure, args, nil)})
+		g.calls = append(g.calls, calls)
+		_, err = g.run(0)
+		return err
+	})
+}
@@ -0,0 +1,709 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/compiler"
+	"github.com/muiscript/ether/evaluator"
+	"github.com/muiscript/ether/object"
+)
+
+// VM executes bytecode with the same semantics as evaluator.Eval: the values, the errors and their kinds are the same.
+type VM struct {
+	ctx       context.Context
+	bytecode  *compiler.Bytecode
+	stack     []object.Object
+	frames    []*frame
+	handlers  []handler
+	builtins  map[string]*object.BuiltinFunction
+	calls     []*evaluator.CallStack // the calls being executed in each frame, made on demand
+	builtin   *evaluator.CallStack   // the calls being executed by the builtin function being called, if any
+	yield     evaluator.Yield        // passes the values yielded by the body of a generator, nil for the program
+	scheduler evaluator.Scheduler
+}
+
+// frame is the execution of a function call, or of the program itself.
+// the frames popped are kept above the top of frames of VM, and reused by the following calls.
+type frame struct {
+	closure      *object.Closure // nil for the program
+	instructions compiler.Instructions
+	ip           int
+	scope        *object.Scope
+	base         int            // the height of the stack when the frame was entered
+	call         ast.Expression // the call site, for the type of the return value; nil if not checked
+	returnChecks []returnCheck  // the return values of the functions replaced by tail calls, to be checked on return
+	reusable     *object.Scope  // the scope of a call of a function defining no closures, reused by the next one
+}
+
+// returnCheck is the annotated type of the return value of a function called at call.
+type returnCheck struct {
+	call       ast.Expression
+	returnType ast.TypeAnnotation
+}
+
+// handler is a catch handler installed by OpSetupTry, with the state to restore when an error is caught.
+type handler struct {
+	frame   int
+	height  int
+	scope   *object.Scope
+	address int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	vm := &VM{ctx: context.Background(), bytecode: bytecode, scheduler: evaluator.NewParallelScheduler()}
+	vm.builtins = map[string]*object.BuiltinFunction{
+		"map":      {Fn: vm.builtinMap},
+		"filter":   {Fn: vm.builtinFilter},
+		"reduce":   {Fn: vm.builtinReduce},
+		"take":     {Fn: vm.builtinTake},
+		"to_array": {Fn: vm.builtinToArray},
+		"spawn":    {Fn: vm.builtinSpawn},
+		"wait":     {Fn: vm.builtinWait},
+		"send":     {Fn: vm.builtinSend},
+		"recv":     {Fn: vm.builtinRecv},
+		"close":    {Fn: vm.builtinClose},
+	}
+	return vm
+}
+
+// Run executes the program and returns its value, as evaluator.Eval returns the value of the program.
+func (vm *VM) Run() (object.Object, error) {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext executes the program as Run does, but returns an evaluator.CancelError once ctx is done,
+// as evaluator.EvalContext does.
+func (vm *VM) RunContext(ctx context.Context) (value object.Object, err error) {
+	ctx = vm.scheduler.Begin(ctx)
+	defer vm.scheduler.End()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			value, err = nil, evaluator.Recovered(recovered, vm.panicked())
+			vm.truncate(0)
+		}
+	}()
+
+	vm.ctx = ctx
+	f := vm.pushFrame()
+	f.instructions = vm.bytecode.Instructions
+	f.scope = object.NewScope(vm.bytecode.NumSlots, nil)
+	vm.calls = append(vm.calls, nil)
+	return vm.run(0)
+}
+
+// RunWithScheduler executes the program as RunContext does, running the tasks spawned by it with scheduler,
+// as evaluator.EvalWithScheduler does.
+func (vm *VM) RunWithScheduler(ctx context.Context, scheduler evaluator.Scheduler) (object.Object, error) {
+	vm.scheduler = scheduler
+	return vm.RunContext(ctx)
+}
+
+func (vm *VM) push(value object.Object) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() object.Object {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+// truncate discards the values above height on the stack, stopping the iterations of the streams abandoned by them.
+func (vm *VM) truncate(height int) {
+	for _, value := range vm.stack[height:] {
+		if it, ok := value.(*iterator); ok && it.stop != nil {
+			it.stop()
+		}
+	}
+	vm.stack = vm.stack[:height]
+}
+
+// run executes the instructions until the frames return to depth, and returns the value returned by the last of them.
+func (vm *VM) run(depth int) (object.Object, error) {
+	for {
+		f := vm.frames[len(vm.frames)-1]
+		op := compiler.Opcode(f.instructions[f.ip])
+		f.ip++
+
+		var err error
+		switch op {
+		case compiler.OpConstant:
+			vm.push(vm.bytecode.Constants[vm.readOperand(f)])
+		case compiler.OpTrue:
+			vm.push(evaluator.TRUE_OBJ)
+		case compiler.OpFalse:
+			vm.push(evaluator.FALSE_OBJ)
+		case compiler.OpNull:
+			vm.push(evaluator.NULL_OBJ)
+		case compiler.OpNil:
+			vm.push(nil)
+		case compiler.OpPop:
+			vm.pop()
+		case compiler.OpGetVariable:
+			var value object.Object
+			value, err = vm.getVariable(f, vm.bytecode.Variables[vm.readOperand(f)])
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpGetLocal:
+			scope := f.scope
+			for i := f.instructions[f.ip]; i > 0; i-- {
+				scope = scope.Outer
+			}
+			f.ip++
+			if value := scope.Slots.Get(vm.readOperand(f)); value != nil {
+				f.ip += 2
+				vm.push(value)
+				break
+			}
+			var value object.Object
+			value, err = vm.getVariable(f, vm.bytecode.Variables[vm.readOperand(f)])
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpSetLocal:
+			f.scope.Slots.Set(vm.readOperand(f), vm.pop())
+		case compiler.OpCheckVar:
+			varStatement := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.VarStatement)
+			if value := vm.stack[len(vm.stack)-1]; !evaluator.Conforms(value, varStatement.Type) {
+				err = evaluator.NewEvalError(varStatement.Line(), fmt.Sprintf("type of %q wrong: want %s, got %s", varStatement.Identifier.Name, varStatement.Type, evaluator.Describe(value)), evaluator.TYPE_ERROR)
+			}
+		case compiler.OpPrefix:
+			prefixExpression := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.PrefixExpression)
+			var value object.Object
+			value, err = evaluator.Prefix(prefixExpression, vm.pop())
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpInfix:
+			infixExpression := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.InfixExpression)
+			right := vm.pop()
+			left := vm.pop()
+			var value object.Object
+			value, err = evaluator.Infix(infixExpression, left, right)
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpAdd, compiler.OpSubtract, compiler.OpMultiply, compiler.OpDivide, compiler.OpModulo,
+			compiler.OpGreater, compiler.OpLess, compiler.OpEqual, compiler.OpNotEqual:
+			infixExpression := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.InfixExpression)
+			right := vm.pop()
+			left := vm.pop()
+			var value object.Object
+			value, err = arithmetic(op, infixExpression, left, right)
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpJump:
+			f.ip = vm.readOperand(f)
+		case compiler.OpJumpIfFalsy:
+			address := vm.readOperand(f)
+			if condition := vm.pop(); condition == evaluator.FALSE_OBJ || condition == evaluator.NULL_OBJ {
+				f.ip = address
+			}
+		case compiler.OpClosure:
+			function := vm.bytecode.Constants[vm.readOperand(f)].(*object.CompiledFunction)
+			vm.push(&object.Closure{Function: function, Scope: f.scope})
+		case compiler.OpCall:
+			call := vm.bytecode.Nodes[vm.readOperand(f)].(ast.Expression)
+			count := int(f.instructions[f.ip])
+			f.ip++
+			err = vm.call(call, count)
+		case compiler.OpTailCall:
+			call := vm.bytecode.Nodes[vm.readOperand(f)].(ast.Expression)
+			count := int(f.instructions[f.ip])
+			f.ip++
+			err = vm.tailCall(f, call, count)
+		case compiler.OpReturn:
+			var value object.Object
+			var returned bool
+			value, returned, err = vm.leave(depth)
+			if returned {
+				return value, nil
+			}
+		case compiler.OpReturnValue:
+			vm.push(&object.ReturnValue{Value: vm.pop()})
+		case compiler.OpArray:
+			count := vm.readOperand(f)
+			var elements []object.Object
+			if count > 0 {
+				elements = make([]object.Object, count)
+				copy(elements, vm.stack[len(vm.stack)-count:])
+			}
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			vm.push(&object.Array{Elements: elements})
+		case compiler.OpIndex:
+			indexExpression := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.IndexExpression)
+			index := vm.pop()
+			evaluated := vm.pop()
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				err = evaluator.NewEvalError(indexExpression.Line(), fmt.Sprintf("unable to convert to array: %+v (%T)", evaluated, evaluated), evaluator.TYPE_ERROR)
+				break
+			}
+			var value object.Object
+			value, err = evaluator.Index(indexExpression, array, index)
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpField:
+			fieldExpression := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.FieldExpression)
+			var value object.Object
+			value, err = evaluator.Field(fieldExpression, vm.pop())
+			if err == nil {
+				vm.push(value)
+			}
+		case compiler.OpThrow:
+			throwStatement := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.ThrowStatement)
+			err = evaluator.Throw(throwStatement, vm.pop())
+		case compiler.OpSetupTry:
+			vm.handlers = append(vm.handlers, handler{frame: len(vm.frames) - 1, height: len(vm.stack), scope: f.scope, address: vm.readOperand(f)})
+		case compiler.OpPopTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case compiler.OpEnterScope:
+			f.scope = object.NewScope(vm.readOperand(f), f.scope)
+		case compiler.OpLeaveScope:
+			f.scope = f.scope.Outer
+		case compiler.OpIterate:
+			clause := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.ComprehensionClause)
+			evaluated := vm.pop()
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				next, stop, ok := evaluator.Iterate(evaluated, vm.callback)
+				if !ok {
+					err = evaluator.NewEvalError(clause.Line(), fmt.Sprintf("unable to convert to array: %+v (%T)", evaluated, evaluated), evaluator.TYPE_ERROR)
+					break
+				}
+				vm.push(&iterator{next: next, stop: stop, line: clause.Line(), iterable: clause.Iterable})
+				break
+			}
+			vm.push(&iterator{elements: array.Elements, line: clause.Line()})
+		case compiler.OpNext:
+			address := vm.readOperand(f)
+			it := vm.stack[len(vm.stack)-1].(*iterator)
+			if it.next != nil {
+				err = vm.nextOfStream(f, it, address)
+				break
+			}
+			if it.index == len(it.elements) {
+				vm.pop()
+				f.ip = address
+				break
+			}
+			if err = vm.checkContext(it.line); err != nil {
+				break
+			}
+			vm.push(it.elements[it.index])
+			it.index++
+		case compiler.OpAppend:
+			clauses := vm.readOperand(f)
+			value := vm.pop()
+			array := vm.stack[len(vm.stack)-1-clauses].(*object.Array)
+			array.Elements = append(array.Elements, value)
+		case compiler.OpQuote:
+			node := vm.bytecode.Nodes[vm.readOperand(f)]
+			count := vm.readOperand(f)
+			values := vm.stack[len(vm.stack)-count:]
+			var quoted object.Object
+			quoted, err = evaluator.Quote(node, func(ast.Expression) (object.Object, error) {
+				value := values[0]
+				values = values[1:]
+				return value, nil
+			})
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			if err == nil {
+				vm.push(quoted)
+			}
+		case compiler.OpYield:
+			yieldStatement := vm.bytecode.Nodes[vm.readOperand(f)].(*ast.YieldStatement)
+			value := vm.pop()
+			if vm.yield == nil {
+				err = evaluator.NewEvalError(yieldStatement.Line(), "yield outside generator function", evaluator.RUNTIME_ERROR)
+				break
+			}
+			err = vm.yield(value)
+		default:
+			err = fmt.Errorf("opcode %d undefined", op)
+		}
+
+		if err != nil && len(vm.frames) > 0 {
+			err = evaluator.Traced(err, vm.callStack(len(vm.frames)-1))
+		}
+		if err != nil && !vm.recover(err, depth) {
+			return nil, err
+		}
+	}
+}
+
+// readOperand reads an operand of 2 bytes.
+func (vm *VM) readOperand(f *frame) int {
+	operand := int(compiler.ReadUint16(f.instructions[f.ip:]))
+	f.ip += 2
+	return operand
+}
+
+// getVariable returns the value of the first location of variable which has been set, or the builtin function of the name.
+func (vm *VM) getVariable(f *frame, variable *compiler.Variable) (object.Object, error) {
+	for _, location := range variable.Locations {
+		scope := f.scope
+		for i := 0; i < location.Depth; i++ {
+			scope = scope.Outer
+		}
+		if value := scope.Slots.Get(location.Index); value != nil {
+			return value, nil
+		}
+	}
+
+	name := variable.Identifier.Name
+	if builtin, ok := vm.builtins[name]; ok {
+		return builtin, nil
+	}
+	if builtin, ok := evaluator.LookupBuiltin(name); ok {
+		return builtin, nil
+	}
+	return nil, evaluator.NewEvalError(variable.Identifier.Line(), fmt.Sprintf("undefined identifier: %q", name), evaluator.NAME_ERROR)
+}
+
+// call calls the function on the top of the stack with count arguments below it.
+// a closure is executed by the loop of run in a new frame, and a builtin function is called right away.
+func (vm *VM) call(call ast.Expression, count int) error {
+	if len(vm.frames)-1 >= evaluator.MaxCallDepth {
+		return vm.depthExceeded(call, vm.stack[len(vm.stack)-1])
+	}
+	if err := vm.checkContext(call.Line()); err != nil {
+		return err
+	}
+	return vm.callFunction(call, count)
+}
+
+func (vm *VM) callFunction(call ast.Expression, count int) error {
+	function := vm.pop()
+	args := vm.stack[len(vm.stack)-count:]
+
+	switch function := function.(type) {
+	case *object.Closure:
+		if err := vm.check(function, args, call); err != nil {
+			return err
+		}
+		if function.Function.Generator {
+			return vm.callGenerator(call, function, count)
+		}
+		f := vm.pushFrame()
+		f.scope = vm.bind(function, args, f)
+		vm.stack = vm.stack[:len(vm.stack)-count]
+		f.closure = function
+		f.instructions = function.Function.Instructions
+		f.base = len(vm.stack)
+		f.call = call
+		// the calls of a callback are made right away, since the ones of the builtin function are not in the frames.
+		var calls *evaluator.CallStack
+		if call == nil {
+			calls = vm.builtin.Push(call, function)
+		}
+		vm.calls = append(vm.calls[:len(vm.frames)-1], calls)
+		return nil
+	case *object.BuiltinFunction:
+		copied := make([]object.Object, count)
+		copy(copied, args)
+		vm.stack = vm.stack[:len(vm.stack)-count]
+		outer := vm.builtin
+		calls := vm.callStack(len(vm.frames)-1).Push(call, function)
+		vm.builtin = calls
+		value, err := function.Fn(copied...)
+		vm.builtin = outer
+		if err != nil {
+			return evaluator.TracedBuiltin(err, call, calls)
+		}
+		vm.push(value)
+		return nil
+	default:
+		return evaluator.NewEvalError(call.Line(), fmt.Sprintf("unable to convert to function in %s: %+v (%T)", call, function, function), evaluator.TYPE_ERROR)
+	}
+}
+
+// tailCall calls the function on the top of the stack in tail position of the current frame.
+// a closure replaces the function of the frame, whose return value is checked when the frame returns.
+func (vm *VM) tailCall(f *frame, call ast.Expression, count int) error {
+	if err := vm.checkContext(call.Line()); err != nil {
+		return err
+	}
+	closure, ok := vm.stack[len(vm.stack)-1].(*object.Closure)
+	if !ok || closure.Function.Generator {
+		return vm.callFunction(call, count)
+	}
+	vm.pop()
+	args := vm.stack[len(vm.stack)-count:]
+	if err := vm.check(closure, args, call); err != nil {
+		return err
+	}
+	scope := vm.bind(closure, args, f)
+
+	if f.call != nil && f.closure.Function.Literal.ReturnType != nil {
+		f.returnChecks = append(f.returnChecks, returnCheck{call: f.call, returnType: f.closure.Function.Literal.ReturnType})
+	}
+	vm.truncate(f.base)
+	f.closure = closure
+	f.instructions = closure.Function.Instructions
+	f.ip = 0
+	f.scope = scope
+	f.call = call
+	if calls := vm.calls[len(vm.frames)-1]; calls != nil {
+		vm.calls[len(vm.frames)-1] = calls.Pop().Push(call, closure)
+	}
+	return nil
+}
+
+// callStack returns the calls being executed in the i-th frame. it is made only when an error or a builtin function
+// needs it, and kept while the frame is, since the frames below never change meanwhile.
+func (vm *VM) callStack(i int) *evaluator.CallStack {
+	f := vm.frames[i]
+	if vm.calls[i] == nil && f.closure != nil {
+		vm.calls[i] = vm.callStack(i-1).Push(f.call, f.closure)
+	}
+	return vm.calls[i]
+}
+
+// panicked returns the calls being executed when a panic happens, which is in a builtin function
+// if it is called by the innermost frame.
+func (vm *VM) panicked() *evaluator.CallStack {
+	if len(vm.frames) == 0 {
+		return nil
+	}
+	calls := vm.callStack(len(vm.frames) - 1)
+	if vm.builtin != nil && vm.builtin.Pop() == calls {
+		return vm.builtin
+	}
+	return calls
+}
+
+// check checks the number and the types of args of a call of closure.
+// call is the call site for the errors, or nil for the calls by builtin functions, whose arguments are not checked.
+func (vm *VM) check(closure *object.Closure, args []object.Object, call ast.Expression) error {
+	if call == nil {
+		return nil
+	}
+	literal := closure.Function.Literal
+	if len(args) != len(literal.Parameters) {
+		return evaluator.NewEvalError(call.Line(), fmt.Sprintf("number of arguments for %s wrong:\nwant=%d\ngot=%d\n", call, len(literal.Parameters), len(args)), evaluator.ARGUMENT_ERROR)
+	}
+	for i, arg := range args {
+		if !evaluator.Conforms(arg, literal.ParameterType(i)) {
+			return evaluator.NewEvalError(call.Line(), fmt.Sprintf("type of parameter %q wrong in %s: want %s, got %s", literal.Parameters[i].Name, call, literal.ParameterType(i), evaluator.Describe(arg)), evaluator.TYPE_ERROR)
+		}
+	}
+	return nil
+}
+
+// bind returns the scope of a call of closure with args checked by check, executed in f, or in no frame if f is nil.
+// the scope of a closure defining no closures is not referred to once the call returns, so the one of f is reused.
+func (vm *VM) bind(closure *object.Closure, args []object.Object, f *frame) *object.Scope {
+	var scope *object.Scope
+	switch {
+	case f == nil || closure.Function.Closures:
+		scope = object.NewScope(closure.Function.NumSlots, closure.Scope)
+	case f.reusable == nil:
+		scope = object.NewScope(closure.Function.NumSlots, closure.Scope)
+		f.reusable = scope
+	default:
+		scope = f.reusable
+		scope.Reset(closure.Function.NumSlots, closure.Scope)
+	}
+	for i, arg := range args {
+		scope.Slots.Set(i, arg)
+	}
+	return scope
+}
+
+// pushFrame pushes a frame, reusing the one left above the top of the frames by a call returned if any.
+func (vm *VM) pushFrame() *frame {
+	if len(vm.frames) < cap(vm.frames) {
+		vm.frames = vm.frames[:len(vm.frames)+1]
+		if f := vm.frames[len(vm.frames)-1]; f != nil {
+			*f = frame{returnChecks: f.returnChecks[:0], reusable: f.reusable}
+			return f
+		}
+	} else {
+		vm.frames = append(vm.frames, nil)
+	}
+	f := &frame{}
+	vm.frames[len(vm.frames)-1] = f
+	return f
+}
+
+func (vm *VM) depthExceeded(call ast.Expression, function object.Object) error {
+	return evaluator.NewEvalError(callLine(call, function), fmt.Sprintf("stack depth exceeded: more than %d nested calls", evaluator.MaxCallDepth), evaluator.RUNTIME_ERROR)
+}
+
+// checkContext returns an evaluator.CancelError noticed at line if the context of the execution is done.
+func (vm *VM) checkContext(line int) error {
+	select {
+	case <-vm.ctx.Done():
+		return evaluator.NewCancelError(line, vm.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// callLine returns the line of a call of function at call, which is nil for the calls by builtin functions.
+func callLine(call ast.Expression, function object.Object) int {
+	if call != nil {
+		return call.Line()
+	}
+	if closure, ok := function.(*object.Closure); ok {
+		return closure.Function.Literal.Body.Line()
+	}
+	return 1
+}
+
+// leave pops the current frame, pushing the value it returns to the frame below,
+// and reports whether the frames returned to depth, in which case the value is returned instead.
+// the type of the value is checked after the frame is popped, so that the handlers of the frame do not catch the error.
+func (vm *VM) leave(depth int) (object.Object, bool, error) {
+	f := vm.frames[len(vm.frames)-1]
+	value := vm.pop()
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= len(vm.frames) {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+	vm.truncate(f.base)
+
+	if f.call != nil && f.closure.Function.Literal.ReturnType != nil {
+		f.returnChecks = append(f.returnChecks, returnCheck{call: f.call, returnType: f.closure.Function.Literal.ReturnType})
+	}
+	for i := len(f.returnChecks) - 1; i >= 0; i-- {
+		check := f.returnChecks[i]
+		if !evaluator.Conforms(value, check.returnType) {
+			return nil, false, evaluator.NewEvalError(check.call.Line(), fmt.Sprintf("type of return value wrong in %s: want %s, got %s", check.call, check.returnType, evaluator.Describe(value)), evaluator.TYPE_ERROR)
+		}
+	}
+	if len(vm.frames) == depth {
+		return value, true, nil
+	}
+	vm.push(value)
+	return nil, false, nil
+}
+
+// recover passes err to the innermost handler installed by the frames above depth, as a try expression catches it.
+// it reports whether err is caught. otherwise, the frames above depth are discarded.
+func (vm *VM) recover(err error, depth int) bool {
+	evalError, ok := err.(*evaluator.EvalError)
+	if ok && evalError.Catchable() && len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= depth {
+		h := vm.handlers[len(vm.handlers)-1]
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		vm.frames = vm.frames[:h.frame+1]
+		f := vm.frames[h.frame]
+		f.scope = h.scope
+		f.ip = h.address
+		vm.truncate(h.height)
+		vm.push(evalError.Object())
+		return true
+	}
+
+	if depth < len(vm.frames) {
+		vm.truncate(vm.frames[depth].base)
+	}
+	vm.frames = vm.frames[:depth]
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= depth {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+	return false
+}
+
+// apply calls closure with args from a builtin function, running the frames of the call to the end.
+func (vm *VM) apply(closure *object.Closure, args ...object.Object) (object.Object, error) {
+	depth := len(vm.frames)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	vm.push(closure)
+	if len(vm.frames)-1 >= evaluator.MaxCallDepth {
+		return nil, vm.depthExceeded(nil, closure)
+	}
+	if err := vm.callFunction(nil, len(args)); err != nil {
+		return nil, err
+	}
+	return vm.run(depth)
+}
+
+// arithmetic applies the operator of op, such as compiler.OpAdd, to left and right. the integers, which are the most frequent,
+// are handled here, and the other values and the errors by evaluator.Infix.
+func arithmetic(op compiler.Opcode, infixExpression *ast.InfixExpression, left, right object.Object) (object.Object, error) {
+	if left, ok := left.(*object.Integer); ok {
+		if right, ok := right.(*object.Integer); ok {
+			switch op {
+			case compiler.OpAdd:
+				if value, ok := object.Add(left.Value, right.Value); ok {
+					return &object.Integer{Value: value}, nil
+				}
+			case compiler.OpSubtract:
+				if value, ok := object.Subtract(left.Value, right.Value); ok {
+					return &object.Integer{Value: value}, nil
+				}
+			case compiler.OpMultiply:
+				if value, ok := object.Multiply(left.Value, right.Value); ok {
+					return &object.Integer{Value: value}, nil
+				}
+			case compiler.OpDivide:
+				if right.Value != 0 {
+					if value, ok := object.Divide(left.Value, right.Value); ok {
+						return &object.Integer{Value: value}, nil
+					}
+				}
+			case compiler.OpModulo:
+				if right.Value != 0 {
+					return &object.Integer{Value: left.Value % right.Value}, nil
+				}
+			case compiler.OpGreater:
+				return nativeBoolean(left.Value > right.Value), nil
+			case compiler.OpLess:
+				return nativeBoolean(left.Value < right.Value), nil
+			case compiler.OpEqual:
+				return nativeBoolean(left.Value == right.Value), nil
+			case compiler.OpNotEqual:
+				return nativeBoolean(left.Value != right.Value), nil
+			}
+		}
+	}
+	return evaluator.Infix(infixExpression, left, right)
+}
+
+func nativeBoolean(value bool) *object.Boolean {
+	if value {
+		return evaluator.TRUE_OBJ
+	}
+	return evaluator.FALSE_OBJ
+}
+
+// iterator is the state of the loop over the array or the stream of a comprehension clause, kept on the stack.
+type iterator struct {
+	elements []object.Object
+	index    int
+	next     object.Iterator // the iteration of a stream, nil for an array
+	stop     func()
+	line     int            // the line of the clause, for the errors
+	iterable ast.Expression // the iterable of the clause, at which the errors of the stream are reported
+}
+
+// nextOfStream pushes the next element of the stream iterated by it, or stops the iteration, pops it
+// and jumps to address if the stream is exhausted, as OpNext does for an array.
+func (vm *VM) nextOfStream(f *frame, it *iterator, address int) error {
+	elem, ok, err := it.next()
+	if err != nil {
+		return evaluator.TracedBuiltin(err, it.iterable, vm.callStack(len(vm.frames)-1))
+	}
+	if !ok {
+		it.stop()
+		vm.pop()
+		f.ip = address
+		return nil
+	}
+	if err := vm.checkContext(it.line); err != nil {
+		return err
+	}
+	vm.push(elem)
+	return nil
+}
+
+func (it *iterator) String() string    { return "Iterator" }
+func (it *iterator) Type() object.Type { return "ITERATOR" }
@@ -0,0 +1,153 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"github.com/muiscript/ether/ast"
+	"github.com/muiscript/ether/compiler"
+	"github.com/muiscript/ether/evaluator"
+	"github.com/muiscript/ether/lexer"
+	"github.com/muiscript/ether/object"
+	"github.com/muiscript/ether/parser"
+	"testing"
+	"time"
+)
+
+func parseProgram(t testing.TB, input string) *ast.Program {
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %s\n", err)
+	}
+	return program
+}
+
+func run(t testing.TB, input string) (object.Object, error) {
+	bytecode, err := compiler.Compile(parseProgram(t, input))
+	if err != nil {
+		t.Fatalf("compile error: %s\n", err)
+	}
+	return New(bytecode).Run()
+}
+
+// the semantics are tested mainly by the tests of package evaluator, which run the programs with the VM as well.
+// the tests here are for the environments and the handlers, whose states are managed differently from Eval.
+func TestVM_Run(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{desc: "recursion", input: "var fib = |n| { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", expected: "610"},
+		{desc: "closure", input: "var adder = |x| { |y| { x + y } }; var add2 = adder(2); add2(3)", expected: "5"},
+		{desc: "declared after closure", input: "var f = || { g() }; var g = || { 1 }; f()", expected: "1"},
+		{desc: "redeclared", input: "var x = 1; var f = || { x }; var x = 2; f()", expected: "2"},
+		{desc: "outer until declared", input: "var x = 1; var f = || { var y = x; var x = 2; [y, x] }; f()", expected: "[1, 2]"},
+		{desc: "not declared in branch", input: "var x = 1; var f = |c| { if (c) { var x = 2 }; x }; [f(true), f(false)]", expected: "[2, 1]"},
+		{desc: "comprehension scopes", input: "var fs = [|| { x * y } for x in [1, 2] for y in [10]]; [f() for f in fs]", expected: "[10, 20]"},
+		{desc: "repeated parameter", input: "var f = |x, x| { x }; f(1, 2)", expected: "2"},
+		{desc: "catch in caller", input: "var f = |x| { [x][1] }; try { f(1) } catch (e) { e.line }", expected: "1"},
+		{desc: "catch from builtin", input: "try { [1, 0] -> map(|x| { if (x == 0) { throw x } x }) } catch (e) { e.message }", expected: "0"},
+		{desc: "catch inside builtin", input: "[1, 0] -> map(|x| { try { [][x] } catch (e) { -1 } })", expected: "[-1, -1]"},
+		{desc: "return from try", input: "var f = || { try { return 1 } catch (e) { 2 } }; f() + f()", expected: "2"},
+		{desc: "stack after catch", input: "1 + try { 2 + [][0] } catch (e) { 3 }", expected: "4"},
+		{desc: "builtin shadowed", input: "var len = |x| { 0 }; len([1])", expected: "0"},
+		{desc: "quote", input: "var x = 1; source(quote(a + unquote(x + 1)))", expected: "a + 2"},
+		{desc: "scope reused by next call", input: "var g = |x| { x * 2 }; var f = |a, b| { var c = g(a) + g(b); [a, b, c] }; [f(1, 2), f(3, 4)]", expected: "[[1, 2, 6], [3, 4, 14]]"},
+		{desc: "scope kept by closure", input: "var g = |x| { || { x } }; var f = |a, b| { [g(a), g(b)] }; [h() for h in f(1, 2)]", expected: "[1, 2]"},
+		{desc: "scope reused by tail call", input: "var g = |x, y| { [x, y] }; var f = |x| { g(x + 1, x) }; f(1)", expected: "[2, 1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			actual, err := run(t, tt.input)
+			if err != nil {
+				t.Fatalf("run error: %s\n", err)
+			}
+			if actual.String() != tt.expected {
+				t.Errorf("value wrong.\nwant=%s\ngot=%s\n", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestVM_Run_Error(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{desc: "undefined", input: "var f = || { x }\nf()", expected: `line 1: undefined identifier: "x"`},
+		{desc: "uncaught", input: "var f = |x| { throw x }\ntry { 1 } catch (e) { 2 }\nf(3)", expected: "line 1: uncaught Error: 3"},
+		{desc: "return value not caught by callee", input: "var f = || -> int { try { return true } catch (e) { 1 } }; f()", expected: "line 1: type of return value wrong in f(): want int, got true (BOOLEAN)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := run(t, tt.input)
+			if err == nil {
+				t.Fatalf("error not raised")
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("error wrong.\nwant=%q\ngot=%q\n", tt.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestVM_RunContext(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{desc: "tail recursion", input: "var f = |n| { f(n + 1) }; f(0)"},
+		{desc: "not caught", input: "var f = |n| { f(n + 1) }; try { f(0) } catch (e) { 0 }"},
+		{desc: "map", input: "var xs = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]; var g = |n| { if (n == 0) { 0 } else { xs -> map(|x| { g(n - 1) }) } }; g(9)"},
+		{desc: "comprehension", input: "var xs = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]; [0 for a in xs for b in xs for c in xs for d in xs for e in xs for f in xs for g in xs for h in xs for i in xs]"},
+		{desc: "stream", input: "range_from(1) -> filter(|x| { false }) -> take(1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			bytecode, err := compiler.Compile(parseProgram(t, tt.input))
+			if err != nil {
+				t.Fatalf("compile error: %s\n", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err = New(bytecode).RunContext(ctx)
+			if _, ok := err.(*evaluator.CancelError); !ok {
+				t.Fatalf("error type wrong.\nwant=%T\ngot=%T (%v)\n", &evaluator.CancelError{}, err, err)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("error wrong.\nwant=%v\ngot=%v\n", context.DeadlineExceeded, err)
+			}
+		})
+	}
+}
+
+const fibonacci = "var fib = |n| { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)"
+
+func BenchmarkFibonacci_VM(b *testing.B) {
+	bytecode, err := compiler.Compile(parseProgram(b, fibonacci))
+	if err != nil {
+		b.Fatalf("compile error: %s\n", err)
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := New(bytecode).Run(); err != nil {
+			b.Fatalf("run error: %s\n", err)
+		}
+	}
+}
+
+func BenchmarkFibonacci_Eval(b *testing.B) {
+	program := parseProgram(b, fibonacci)
+	if err := evaluator.NewResolver().Resolve(program); err != nil {
+		b.Fatalf("resolve error: %s\n", err)
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := evaluator.Eval(program, object.NewEnvironment()); err != nil {
+			b.Fatalf("eval error: %s\n", err)
+		}
+	}
+}